@@ -11,6 +11,7 @@ import (
 	"github.com/sequring/sculptor/internal/config"
 	k8s_gateway "github.com/sequring/sculptor/internal/gateway/k8s"
 	prom_gateway "github.com/sequring/sculptor/internal/gateway/prometheus"
+	snapshot_gateway "github.com/sequring/sculptor/internal/gateway/snapshot"
 	"github.com/sequring/sculptor/internal/presenter"
 	"github.com/sequring/sculptor/internal/usecase"
 	"github.com/spf13/pflag"
@@ -54,51 +55,113 @@ func main() {
 		os.Exit(0)
 	}
 
-	k8sClient, err := k8s_gateway.NewClient(cfg, logger)
-	if err != nil {
-		logger.Error("Failed to create Kubernetes client", "error", err)
-		os.Exit(1)
-	}
+	var k8sGateway usecase.DeploymentGateway
+	var promGateway usecase.MetricsGateway
 
-	var prometheusURL string
-	if cfg.Prometheus.URL != "" {
-		prometheusURL = cfg.Prometheus.URL
-		logger.Info("Connecting to Prometheus directly", "url", prometheusURL)
+	if cfg.Snapshot != "" {
+		logger.Info("Running offline analysis from snapshot", "path", cfg.Snapshot)
+		snapshotGateway, err := snapshot_gateway.NewGateway(cfg.Snapshot, logger)
+		if err != nil {
+			logger.Error("Failed to load metrics snapshot", "error", err)
+			os.Exit(1)
+		}
+		k8sGateway, promGateway = snapshotGateway, snapshotGateway
 	} else {
-		logger.Info("Prometheus URL not specified, starting automatic port-forward")
-		stopCh := make(chan struct{}, 1)
-		readyCh := make(chan struct{})
-		errCh := make(chan error, 1)
-		defer close(stopCh)
-
-		go func() {
-			err := k8sClient.StartPortForward(logger, cfg.Prometheus.Namespace, cfg.Prometheus.Service, cfg.Prometheus.Port, stopCh, readyCh)
-			if err != nil {
-				errCh <- fmt.Errorf("port-forwarding failed: %w", err)
+		k8sClient, err := k8s_gateway.NewClient(cfg, logger)
+		if err != nil {
+			logger.Error("Failed to create Kubernetes client", "error", err)
+			os.Exit(1)
+		}
+
+		var prometheusURL string
+		if cfg.Prometheus.URL != "" {
+			prometheusURL = cfg.Prometheus.URL
+			logger.Info("Connecting to Prometheus directly", "url", prometheusURL)
+		} else {
+			logger.Info("Prometheus URL not specified, starting automatic port-forward")
+			stopCh := make(chan struct{}, 1)
+			readyCh := make(chan struct{})
+			errCh := make(chan error, 1)
+			defer close(stopCh)
+
+			go func() {
+				err := k8sClient.StartPortForward(logger, cfg.Prometheus.Namespace, cfg.Prometheus.Service, cfg.Prometheus.Port, stopCh, readyCh)
+				if err != nil {
+					errCh <- fmt.Errorf("port-forwarding failed: %w", err)
+				}
+			}()
+
+			select {
+			case <-readyCh:
+				logger.Info("Port-forwarding is ready")
+			case <-time.After(30 * time.Second):
+				logger.Error("Port-forwarding timed out")
+				os.Exit(1)
+			case err := <-errCh:
+				logger.Error("Error during port-forward setup", "error", err)
+				os.Exit(1)
 			}
-		}()
+			prometheusURL = fmt.Sprintf("http://localhost:%d", cfg.Prometheus.Port)
+		}
 
-		select {
-		case <-readyCh:
-			logger.Info("Port-forwarding is ready")
-		case <-time.After(30 * time.Second):
-			logger.Error("Port-forwarding timed out")
-			os.Exit(1)
-		case err := <-errCh:
-			logger.Error("Error during port-forward setup", "error", err)
+		var promOpts []prom_gateway.Option
+		if cfg.Prometheus.QueryMode == "client" {
+			logger.Info("Computing percentiles client-side from raw series", "chunk", cfg.Prometheus.ChunkDuration, "step", cfg.Prometheus.StepDuration)
+			promOpts = append(promOpts, prom_gateway.WithClientSideAggregation(prom_gateway.ClientSideConfig{
+				Chunk: cfg.Prometheus.ChunkDuration,
+				Step:  cfg.Prometheus.StepDuration,
+			}))
+		}
+
+		livePromGateway, err := prom_gateway.NewGateway(prometheusURL, logger, promOpts...)
+		if err != nil {
+			logger.Error("Failed to create Prometheus gateway", "error", err)
 			os.Exit(1)
 		}
-		prometheusURL = fmt.Sprintf("http://localhost:%d", cfg.Prometheus.Port)
+		liveK8sGateway := k8s_gateway.NewGateway(k8sClient.Clientset, logger)
+
+		if cfg.Command == "export" {
+			if err := runExport(cfg, liveK8sGateway, livePromGateway, logger); err != nil {
+				logger.Error("Error exporting analysis bundle", "error", err)
+				os.Exit(1)
+			}
+			return
+		}
+
+		k8sGateway, promGateway = liveK8sGateway, livePromGateway
 	}
 
-	promGateway, err := prom_gateway.NewGateway(prometheusURL, logger)
+	qosClass, err := usecase.ParseQoSClass(cfg.Policy.QoSClass)
 	if err != nil {
-		logger.Error("Failed to create Prometheus gateway", "error", err)
+		logger.Error("Invalid policy", "error", err)
 		os.Exit(1)
 	}
-
-	k8sGateway := k8s_gateway.NewGateway(k8sClient.Clientset, logger)
-	recommender := usecase.NewRecommenderUseCase(k8sGateway, promGateway, logger)
+	peakWindow, err := usecase.ParsePeakWindow(cfg.Policy.PeakWindow)
+	if err != nil {
+		logger.Error("Invalid policy", "error", err)
+		os.Exit(1)
+	}
+	recommender := usecase.NewRecommenderUseCase(k8sGateway, promGateway, logger, usecase.WithFetchConfig(usecase.FetchConfig{
+		Concurrency:  cfg.Prometheus.Concurrency,
+		QueryTimeout: cfg.Prometheus.QueryTimeoutDuration,
+		Retries:      cfg.Prometheus.Retries,
+	}), usecase.WithPolicy(usecase.Policy{
+		MinDataSpan:        time.Duration(cfg.Policy.MinDataHours * float64(time.Hour)),
+		MinPods:            cfg.Policy.MinPods,
+		OmitCPULimit:       cfg.Policy.NoCPULimit,
+		MemorySizing:       usecase.MemorySizing(cfg.Policy.MemorySizing),
+		QoSClass:           qosClass,
+		CPUManagerStatic:   cfg.Policy.CPUManagerStatic,
+		OOMMaxIncrease:     cfg.Policy.OOMMaxIncreaseBytes,
+		TargetUptime:       cfg.Policy.TargetUptimeDuration,
+		PeakWindow:         peakWindow,
+		ForecastHorizon:    cfg.Policy.ForecastHorizonDuration,
+		ForecastRange:      cfg.Policy.ForecastRange,
+		PodSizing:          usecase.PodSizing(cfg.Policy.PodSizing),
+		PodQuantile:        cfg.Policy.PodQuantile,
+		InitTargetDuration: cfg.Policy.InitTargetDuration,
+		JVM:                cfg.Policy.JVM,
+	}))
 	yamlPresenter := presenter.NewYAMLPresenter(cfg.Silent, os.Stdout)
 
 	var recommendations *usecase.AllRecommendations
@@ -120,6 +183,7 @@ func main() {
 		initRecs, err := recommender.CalculateForInitContainers(context.Background(), params)
 		if err == nil {
 			recommendations = &usecase.AllRecommendations{InitContainers: initRecs}
+			err = recommender.Assess(context.Background(), params, recommendations)
 		}
 		calcErr = err
 	default: // main
@@ -127,6 +191,7 @@ func main() {
 		mainRecs, err := recommender.CalculateForDeployment(context.Background(), params)
 		if err == nil {
 			recommendations = &usecase.AllRecommendations{MainContainers: mainRecs}
+			err = recommender.Assess(context.Background(), params, recommendations)
 		}
 		calcErr = err
 	}
@@ -147,3 +212,35 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+func runExport(cfg *config.Data, k8sGateway *k8s_gateway.Gateway, promGateway *prom_gateway.Gateway, logger *slog.Logger) (err error) {
+	exporter := usecase.NewExporterUseCase(k8sGateway, promGateway, version, logger)
+	params := usecase.DeploymentParams{
+		Namespace:       cfg.Namespace,
+		DeploymentName:  cfg.Deployment,
+		TargetContainer: cfg.Container,
+		TimeRange:       cfg.Range,
+	}
+
+	logger.Info("Exporting analysis bundle", "deployment", cfg.Deployment, "namespace", cfg.Namespace, "range", cfg.Range)
+	bundle, err := exporter.Export(context.Background(), params, time.Now())
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(cfg.Output)
+	if err != nil {
+		return fmt.Errorf("failed to create bundle file: %w", err)
+	}
+	defer func() {
+		if closeErr := f.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to write bundle: %w", closeErr)
+		}
+	}()
+
+	if err := presenter.NewBundlePresenter(f).Render(bundle); err != nil {
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+	logger.Info("Analysis bundle written", "path", cfg.Output, "series", len(bundle.Series), "pods", len(bundle.Pods))
+	return nil
+}
@@ -6,12 +6,17 @@ import (
 	"log/slog"
 	"os"
 	"regexp"
+	"strings"
+	"time"
 
+	"github.com/prometheus/common/model"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 type Data struct {
+	Command    string
 	Kubeconfig string
 	Context    string
 	Range      string
@@ -19,13 +24,47 @@ type Data struct {
 	Deployment string
 	Container  string
 	Target     string
+	Snapshot   string
+	Output     string
 	Silent     bool
 	Verbose    bool
 	Prometheus struct {
-		URL       string `mapstructure:"url"`
-		Namespace string
-		Service   string
-		Port      int
+		URL          string `mapstructure:"url"`
+		Namespace    string
+		Service      string
+		Port         int
+		QueryMode    string `mapstructure:"query_mode"`
+		Chunk        string
+		Step         string
+		Concurrency  int
+		QueryTimeout string `mapstructure:"query_timeout"`
+		Retries      int
+
+		ChunkDuration        time.Duration `mapstructure:"-"`
+		StepDuration         time.Duration `mapstructure:"-"`
+		QueryTimeoutDuration time.Duration `mapstructure:"-"`
+	}
+	Policy struct {
+		MinDataHours     float64 `mapstructure:"min_data_hours"`
+		MinPods          int     `mapstructure:"min_pods"`
+		NoCPULimit       bool    `mapstructure:"no_cpu_limit"`
+		MemorySizing     string  `mapstructure:"memory_sizing"`
+		QoSClass         string  `mapstructure:"qos_class"`
+		CPUManagerStatic bool    `mapstructure:"cpu_manager_static"`
+		OOMMaxIncrease   string  `mapstructure:"oom_max_increase"`
+		TargetUptime     string  `mapstructure:"target_uptime"`
+		PeakWindow       string  `mapstructure:"peak_window"`
+		ForecastHorizon  string  `mapstructure:"forecast_horizon"`
+		ForecastRange    string  `mapstructure:"forecast_range"`
+		PodSizing        string  `mapstructure:"pod_sizing"`
+		PodQuantile      float64 `mapstructure:"pod_quantile"`
+		InitTarget       string  `mapstructure:"init_target_duration"`
+		JVM              bool    `mapstructure:"jvm"`
+
+		OOMMaxIncreaseBytes     int64         `mapstructure:"-"`
+		TargetUptimeDuration    time.Duration `mapstructure:"-"`
+		ForecastHorizonDuration time.Duration `mapstructure:"-"`
+		InitTargetDuration      time.Duration `mapstructure:"-"`
 	}
 }
 
@@ -40,6 +79,24 @@ func Load() (*Data, error) {
 	pflag.String("deployment", "", "The name of the deployment to analyze")
 	pflag.String("container", "", "The name of the container to apply resources to (defaults to all containers)")
 	pflag.String("target", "all", "The target for analysis: 'all' for all containers, 'main' for primary containers, or 'init' for init containers")
+	pflag.String("snapshot", "", "Path to a metrics snapshot directory or export bundle for offline analysis (skips cluster and Prometheus access)")
+	pflag.String("output", "", "Path of the bundle written by the export command (defaults to <deployment>-bundle.tar.gz)")
+	pflag.String("query-mode", "server", "How percentiles are computed: 'server' uses PromQL subqueries, 'client' fetches raw query_range series and computes them locally")
+	pflag.Int("concurrency", 4, "Maximum number of Prometheus queries in flight")
+	pflag.Float64("min-data-hours", 24, "Minimum hours of metric history required for a confident recommendation")
+	pflag.Int("min-pods", 1, "Minimum number of distinct pods that must have reported metrics")
+	pflag.Bool("no-cpu-limit", false, "Recommend CPU requests only and omit CPU limits")
+	pflag.String("qos-class", "", "Target QoS class of the recommended resources: 'Guaranteed' or 'Burstable' (can be overridden per Deployment with the sculptor.io/qos-class annotation)")
+	pflag.String("oom-max-increase", "2Gi", "Maximum memory limit increase after OOM kills (e.g. 2Gi, 0 for no cap)")
+	pflag.String("target-uptime", "", "Uptime between restarts a leaking container's memory limit must last (e.g. 7d, empty to disable)")
+	pflag.String("peak-window", "", "Recurring peak window to size for, e.g. 'Mon-Fri 09:00-18:00 +02:00' (empty to disable)")
+	pflag.String("forecast-horizon", "", "Planning horizon to also size for from the usage trend, e.g. 12w (empty to disable)")
+	pflag.String("forecast-range", "90d", "Time range the usage trend of --forecast-horizon is fitted over")
+	pflag.String("pod-sizing", "max", "Which pods main containers are sized for: 'max', 'quantile' (see --pod-quantile) or 'median'")
+	pflag.Float64("pod-quantile", 0.9, "Quantile of pods --pod-sizing=quantile sizes for")
+	pflag.String("init-target-duration", "", "Time one-shot init containers should finish within, sizing their CPU request (e.g. 2m, empty for the observed duration)")
+	pflag.Bool("jvm", false, "Size the memory limit of Java containers around their max heap and recommend the heap option to set with it")
+	pflag.String("memory-sizing", "guaranteed", "How memory requests are sized: 'guaranteed' sets request equal to limit, 'burstable' sets request to the p95 working set")
 	pflag.Bool("version", false, "Print version information and exit")
 	pflag.Bool("silent", false, "Disable all logs and logo output, only show the YAML output")
 	pflag.Bool("verbose", false, "Enable debug logging")
@@ -52,10 +109,30 @@ func Load() (*Data, error) {
 	viper.BindPFlag("deployment", pflag.Lookup("deployment"))
 	viper.BindPFlag("container", pflag.Lookup("container"))
 	viper.BindPFlag("target", pflag.Lookup("target"))
+	viper.BindPFlag("snapshot", pflag.Lookup("snapshot"))
+	viper.BindPFlag("output", pflag.Lookup("output"))
+	viper.BindPFlag("prometheus.query_mode", pflag.Lookup("query-mode"))
+	viper.SetDefault("prometheus.chunk", "1d")
+	viper.BindPFlag("prometheus.concurrency", pflag.Lookup("concurrency"))
+	viper.SetDefault("prometheus.query_timeout", "1m")
+	viper.SetDefault("prometheus.retries", 2)
+	viper.BindPFlag("policy.min_data_hours", pflag.Lookup("min-data-hours"))
+	viper.BindPFlag("policy.min_pods", pflag.Lookup("min-pods"))
+	viper.BindPFlag("policy.no_cpu_limit", pflag.Lookup("no-cpu-limit"))
+	viper.BindPFlag("policy.memory_sizing", pflag.Lookup("memory-sizing"))
+	viper.BindPFlag("policy.qos_class", pflag.Lookup("qos-class"))
+	viper.BindPFlag("policy.oom_max_increase", pflag.Lookup("oom-max-increase"))
+	viper.BindPFlag("policy.target_uptime", pflag.Lookup("target-uptime"))
+	viper.BindPFlag("policy.peak_window", pflag.Lookup("peak-window"))
+	viper.BindPFlag("policy.forecast_horizon", pflag.Lookup("forecast-horizon"))
+	viper.BindPFlag("policy.forecast_range", pflag.Lookup("forecast-range"))
+	viper.BindPFlag("policy.pod_sizing", pflag.Lookup("pod-sizing"))
+	viper.BindPFlag("policy.pod_quantile", pflag.Lookup("pod-quantile"))
+	viper.BindPFlag("policy.init_target_duration", pflag.Lookup("init-target-duration"))
+	viper.BindPFlag("policy.jvm", pflag.Lookup("jvm"))
 	viper.BindPFlag("silent", pflag.Lookup("silent"))
 	viper.BindPFlag("verbose", pflag.Lookup("verbose"))
 
-	
 	pflag.Parse()
 	genConfig, _ := pflag.CommandLine.GetBool("generate-config")
 	if genConfig {
@@ -87,11 +164,17 @@ func Load() (*Data, error) {
 		return nil, fmt.Errorf("unable to decode config into struct: %w", err)
 	}
 
+	cfg.Command = pflag.Arg(0)
+
 	showVersion, _ := pflag.CommandLine.GetBool("version")
 	if showVersion {
 		return &cfg, nil
 	}
 
+	if cfg.Command != "" && cfg.Command != "export" {
+		return nil, fmt.Errorf("unknown command %q: the only supported command is 'export'", cfg.Command)
+	}
+
 	if cfg.Deployment == "" {
 		return nil, fmt.Errorf("--deployment flag is required")
 	}
@@ -105,6 +188,101 @@ func Load() (*Data, error) {
 		return nil, fmt.Errorf("invalid value for --target: must be 'all', 'main', or 'init'")
 	}
 
+	if cfg.Prometheus.QueryMode != "server" && cfg.Prometheus.QueryMode != "client" {
+		return nil, fmt.Errorf("invalid value for --query-mode: must be 'server' or 'client'")
+	}
+	if cfg.Prometheus.Chunk != "" {
+		chunk, err := model.ParseDuration(cfg.Prometheus.Chunk)
+		if err != nil {
+			return nil, fmt.Errorf("invalid format for 'prometheus.chunk': %w", err)
+		}
+		cfg.Prometheus.ChunkDuration = time.Duration(chunk)
+	}
+	if cfg.Prometheus.Step != "" {
+		step, err := model.ParseDuration(cfg.Prometheus.Step)
+		if err != nil {
+			return nil, fmt.Errorf("invalid format for 'prometheus.step': %w", err)
+		}
+		cfg.Prometheus.StepDuration = time.Duration(step)
+	}
+	if cfg.Prometheus.StepDuration > 0 && cfg.Prometheus.ChunkDuration > 0 && cfg.Prometheus.StepDuration >= cfg.Prometheus.ChunkDuration {
+		return nil, fmt.Errorf("invalid value for 'prometheus.step': must be shorter than 'prometheus.chunk'")
+	}
+
+	if cfg.Prometheus.Concurrency < 1 {
+		return nil, fmt.Errorf("invalid value for --concurrency: must be at least 1")
+	}
+	if cfg.Prometheus.Retries < 0 {
+		return nil, fmt.Errorf("invalid value for 'prometheus.retries': must not be negative")
+	}
+	queryTimeout, err := model.ParseDuration(cfg.Prometheus.QueryTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("invalid format for 'prometheus.query_timeout': %w", err)
+	}
+	cfg.Prometheus.QueryTimeoutDuration = time.Duration(queryTimeout)
+
+	if cfg.Policy.MinDataHours < 0 {
+		return nil, fmt.Errorf("invalid value for --min-data-hours: must not be negative")
+	}
+	if cfg.Policy.MinPods < 0 {
+		return nil, fmt.Errorf("invalid value for --min-pods: must not be negative")
+	}
+
+	if cfg.Policy.MemorySizing != "guaranteed" && cfg.Policy.MemorySizing != "burstable" {
+		return nil, fmt.Errorf("invalid value for --memory-sizing: must be 'guaranteed' or 'burstable'")
+	}
+	oomMaxIncrease, err := resource.ParseQuantity(cfg.Policy.OOMMaxIncrease)
+	if err != nil {
+		return nil, fmt.Errorf("invalid format for --oom-max-increase: %w", err)
+	}
+	if oomMaxIncrease.Sign() < 0 {
+		return nil, fmt.Errorf("invalid value for --oom-max-increase: must not be negative")
+	}
+	cfg.Policy.OOMMaxIncreaseBytes = oomMaxIncrease.Value()
+	if cfg.Policy.TargetUptime != "" {
+		uptime, err := model.ParseDuration(cfg.Policy.TargetUptime)
+		if err != nil {
+			return nil, fmt.Errorf("invalid format for --target-uptime: %w", err)
+		}
+		cfg.Policy.TargetUptimeDuration = time.Duration(uptime)
+	}
+	if cfg.Policy.ForecastHorizon != "" {
+		horizon, err := model.ParseDuration(cfg.Policy.ForecastHorizon)
+		if err != nil {
+			return nil, fmt.Errorf("invalid format for --forecast-horizon: %w", err)
+		}
+		cfg.Policy.ForecastHorizonDuration = time.Duration(horizon)
+	}
+	if _, err := model.ParseDuration(cfg.Policy.ForecastRange); err != nil {
+		return nil, fmt.Errorf("invalid format for --forecast-range: %w", err)
+	}
+	if cfg.Policy.InitTarget != "" {
+		target, err := model.ParseDuration(cfg.Policy.InitTarget)
+		if err != nil {
+			return nil, fmt.Errorf("invalid format for --init-target-duration: %w", err)
+		}
+		cfg.Policy.InitTargetDuration = time.Duration(target)
+	}
+	if cfg.Policy.PodSizing != "max" && cfg.Policy.PodSizing != "quantile" && cfg.Policy.PodSizing != "median" {
+		return nil, fmt.Errorf("invalid value for --pod-sizing: must be 'max', 'quantile' or 'median'")
+	}
+	if cfg.Policy.PodQuantile <= 0 || cfg.Policy.PodQuantile > 1 {
+		return nil, fmt.Errorf("invalid value for --pod-quantile: must be above 0 and at most 1")
+	}
+
+	if strings.EqualFold(cfg.Policy.QoSClass, "guaranteed") && (cfg.Policy.NoCPULimit || cfg.Policy.MemorySizing == "burstable") {
+		return nil, fmt.Errorf("--qos-class=Guaranteed requires CPU limits and Guaranteed memory sizing")
+	}
+
+	if cfg.Command == "export" {
+		if cfg.Snapshot != "" {
+			return nil, fmt.Errorf("the export command needs cluster access and cannot be combined with --snapshot")
+		}
+		if cfg.Output == "" {
+			cfg.Output = cfg.Deployment + "-bundle.tar.gz"
+		}
+	}
+
 	return &cfg, nil
 }
 
@@ -147,6 +325,105 @@ verbose = false
   
   # The local port to forward to.
   port = 9090
+
+  # --- Query settings ---
+
+  # How percentiles are computed. "server" uses quantile_over_time subqueries,
+  # "client" fetches raw query_range series and computes them locally, which is
+  # much cheaper for large Prometheus instances and long ranges.
+  query_mode = "server"
+
+  # (client mode) Widest time window fetched by a single query_range request.
+  chunk = "1d"
+
+  # (client mode) Query resolution. If empty, it is chosen automatically to
+  # keep each series within 11,000 points. Must be shorter than chunk.
+  step = ""
+
+  # Maximum number of queries in flight across all containers.
+  concurrency = 4
+
+  # Timeout for each individual query attempt.
+  query_timeout = "1m"
+
+  # Number of retries, with exponential backoff, after a failed query.
+  retries = 2
+
+# Minimum data required before a recommendation is considered reliable.
+# Containers without the required metrics get no recommendation at all;
+# containers with too little history are flagged as based on insufficient data.
+[policy]
+  # Hours of metric history required. A --range shorter than this flags
+  # every recommendation as based on insufficient data.
+  min_data_hours = 24
+
+  # Number of distinct pods that must have reported metrics.
+  min_pods = 1
+
+  # Recommend CPU requests only and leave out CPU limits. The limit that would
+  # have been recommended is still reported.
+  no_cpu_limit = false
+
+  # How memory requests are sized. "guaranteed" sets the request equal to the
+  # limit (p99 plus buffer). "burstable" sets the request to the p95 working
+  # set and keeps the limit at p99 plus buffer.
+  memory_sizing = "guaranteed"
+
+  # (Optional) Pod QoS class the recommended resources should produce:
+  # "Guaranteed" or "Burstable". Guaranteed sets every request equal to its
+  # limit. A Deployment can override this with the sculptor.io/qos-class
+  # annotation.
+  qos_class = ""
+
+  # With Guaranteed QoS, round CPU up to whole cores so the kubelet's static
+  # CPU manager policy can give the pod exclusive cores.
+  cpu_manager_static = false
+
+  # Maximum increase of the memory limit after OOM kills. The increase is
+  # derived from the working set before the kills, and this cap keeps a large
+  # container from jumping by half its limit at once. "0" disables the cap.
+  oom_max_increase = "2Gi"
+
+  # (Optional) How long containers run between restarts, e.g. the time between
+  # deploys. When a container's working set grows steadily like a leak, its
+  # memory limit is raised to the working set projected after this uptime.
+  target_uptime = ""
+
+  # (Optional) A weekly window of peak load, e.g. "Mon-Fri 09:00-18:00 +02:00".
+  # Days are Mon..Sun, ranges or "*"; the offset defaults to UTC. Peak usage is
+  # reported next to off-peak usage, and requests and limits are sized for the
+  # peak where it exceeds the whole time range.
+  peak_window = ""
+
+  # (Optional) Planning horizon, e.g. "12w". A trend is fitted to each
+  # workload's total memory and CPU usage over forecast_range and projected
+  # this far ahead, and the output also lists the resources needed then.
+  forecast_horizon = ""
+
+  # Time range the forecast trend is fitted over.
+  forecast_range = "90d"
+
+  # Which pods main containers are sized for. Usage across all pods is that of
+  # the busiest pod, so "max" sizes every pod for it. "quantile" sizes for the
+  # pod_quantile of per-pod usage and "median" for the median pod, so one hot
+  # pod doesn't inflate the rest. The per-pod spread is reported either way.
+  pod_sizing = "max"
+
+  # Quantile of pods pod_sizing = "quantile" sizes for.
+  pod_quantile = 0.9
+
+  # (Optional) How long a one-shot init container may take, e.g. "2m". Its CPU
+  # request is sized to do the work of its heaviest run within this time, and
+  # its limit covers the peak rate of its runs. Empty sizes for the observed
+  # duration.
+  init_target_duration = ""
+
+  # Size Java containers from their JVM settings. The max heap is read from
+  # -Xmx or -XX:MaxRAMPercentage in the command, args and JAVA_TOOL_OPTIONS,
+  # and sized from jvm_memory_used_bytes when the application exports it. The
+  # memory limit then fits the heap plus non-heap and native memory, and the
+  # heap option to set with it is reported.
+  jvm = false
 `
 	content := []byte(defaultContent[1:])
 
@@ -0,0 +1,72 @@
+package entity
+
+import (
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	v1 "k8s.io/api/core/v1"
+	nodev1 "k8s.io/api/node/v1"
+)
+
+// Bundle is a reproducible capture of everything a recommendation is computed
+// from, so the analysis can be rerun later without cluster access.
+type Bundle struct {
+	Manifest   BundleManifest
+	Deployment *appsv1.Deployment
+	Pods       []v1.Pod
+	Events     []v1.Event
+	Series     []RawSeries
+
+	// The cluster objects the assessments read. Those that could not be
+	// read are listed in Manifest.Uncaptured.
+	HPA            *autoscalingv2.HorizontalPodAutoscaler
+	RuntimeClass   *nodev1.RuntimeClass
+	Nodes          []v1.Node
+	LimitRanges    []v1.LimitRange
+	ResourceQuotas []v1.ResourceQuota
+}
+
+// Cluster objects a bundle may fail to capture, as listed in
+// BundleManifest.Uncaptured.
+const (
+	BundleHPA            = "horizontalpodautoscalers"
+	BundleRuntimeClass   = "runtimeclasses"
+	BundleNodes          = "nodes"
+	BundleLimitRanges    = "limitranges"
+	BundleResourceQuotas = "resourcequotas"
+)
+
+// BundleManifest describes how and when a bundle was captured.
+type BundleManifest struct {
+	SculptorVersion string        `json:"sculptorVersion"`
+	CreatedAt       time.Time     `json:"createdAt"`
+	Namespace       string        `json:"namespace"`
+	Deployment      string        `json:"deployment"`
+	TimeRange       string        `json:"timeRange"`
+	Start           time.Time     `json:"start"`
+	End             time.Time     `json:"end"`
+	Step            string        `json:"step"`
+	Queries         []BundleQuery `json:"queries"`
+	Uncaptured      []string      `json:"uncaptured,omitempty"`
+}
+
+// BundleQuery records a single query_range request stored in a bundle.
+type BundleQuery struct {
+	Container string `json:"container"`
+	Metric    string `json:"metric"`
+	Query     string `json:"query"`
+	File      string `json:"file"`
+}
+
+// RawSeries is the unprocessed query_range response for one metric of one
+// container.
+type RawSeries struct {
+	Container string
+	Metric    string
+	Query     string
+	Start     time.Time
+	End       time.Time
+	Step      time.Duration
+	Data      []byte
+}
@@ -2,6 +2,7 @@ package entity
 
 import (
 	"testing"
+	"time"
 
 	"k8s.io/apimachinery/pkg/api/resource"
 )
@@ -60,3 +61,34 @@ func TestRecommendation(t *testing.T) {
 		t.Errorf("Expected IsOOMKilled to be true, got %t", recommendation.IsOOMKilled)
 	}
 }
+
+func TestTimeWindow(t *testing.T) {
+	// Weekdays 09:00-18:00 at UTC+02:00.
+	w := TimeWindow{From: 9 * 60, To: 18 * 60, Offset: 2 * time.Hour}
+	for d := time.Monday; d <= time.Friday; d++ {
+		w.Days[d] = true
+	}
+
+	tests := []struct {
+		at   time.Time
+		want bool
+	}{
+		{time.Date(2026, 10, 19, 7, 0, 0, 0, time.UTC), true},   // Monday 09:00 local
+		{time.Date(2026, 10, 19, 6, 59, 0, 0, time.UTC), false}, // Monday 08:59 local
+		{time.Date(2026, 10, 19, 16, 0, 0, 0, time.UTC), false}, // Monday 18:00 local
+		{time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC), false}, // Sunday
+	}
+	for _, tt := range tests {
+		if got := w.Contains(tt.at); got != tt.want {
+			t.Errorf("Contains(%s): expected %t, got %t", tt.at, tt.want, got)
+		}
+	}
+	if got := w.String(); got != "Mon,Tue,Wed,Thu,Fri 09:00-18:00 UTC+02:00" {
+		t.Errorf("Expected String() to describe the window, got %q", got)
+	}
+
+	night := TimeWindow{Days: [7]bool{true, true, true, true, true, true, true}, From: 22 * 60, To: 6 * 60}
+	if !night.Contains(time.Date(2026, 10, 19, 23, 0, 0, 0, time.UTC)) || !night.Contains(time.Date(2026, 10, 19, 5, 0, 0, 0, time.UTC)) {
+		t.Error("Expected a window spanning midnight to contain 23:00 and 05:00")
+	}
+}
@@ -1,15 +1,466 @@
 package entity
 
-import "k8s.io/apimachinery/pkg/api/resource"
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// ErrNoData is returned by metrics gateways when a query matches no samples.
+var ErrNoData = errors.New("no data")
+
+// DataStatus states whether a recommendation is backed by enough metrics.
+type DataStatus string
+
+const (
+	// DataSufficient means all inputs were available with enough coverage.
+	DataSufficient DataStatus = "sufficient"
+	// DataInsufficient means a recommendation was computed, but from fewer
+	// samples or pods than the policy requires.
+	DataInsufficient DataStatus = "insufficient"
+	// DataMissing means required inputs were unavailable and no resource
+	// values were recommended.
+	DataMissing DataStatus = "missing"
+)
 
 type Recommendation struct {
-	Memory      *resource.Quantity
-	CPU         *CPURecommendation
-	IsOOMKilled bool
+	// Memory is the recommended memory limit.
+	Memory *resource.Quantity
+	// MemoryRequest is the recommended memory request. It equals Memory for
+	// Guaranteed-style sizing.
+	MemoryRequest *resource.Quantity
+	CPU           *CPURecommendation
+	IsOOMKilled   bool
+	// OOMKills lists the OOM kills of the container observed in the time
+	// range, oldest first.
+	OOMKills []OOMKill
+	// OOMSizing explains how the memory limit was raised after OOM kills.
+	OOMSizing *OOMSizing
+	// MemoryTrend describes how the working set grows over pod lifetimes, or
+	// is nil if no lifetime was long enough to analyze.
+	MemoryTrend *MemoryTrend
+	// Seasonality compares usage inside and outside the policy's peak
+	// window, or is nil without one.
+	Seasonality *Seasonality
+	// Forecast projects the recommendation to the policy's planning horizon,
+	// or is nil without one.
+	Forecast *Forecast
+	// HPA describes how a HorizontalPodAutoscaler scaling on the container's
+	// CPU utilization shaped its CPU request, or is nil without one.
+	HPA *HPAScaling
+	// PodDistribution describes how usage is spread across pods, or is nil
+	// if per-pod usage is unknown.
+	PodDistribution *PodDistribution
+	// InitCPU describes the CPU used by the runs of a one-shot init container
+	// its CPU was sized from, or is nil if the defaults were used.
+	InitCPU *InitCPUUsage
+	// EphemeralStorage is the recommended ephemeral storage, or nil without
+	// filesystem usage or evictions.
+	EphemeralStorage *EphemeralStorage
+	// PassthroughRequests and PassthroughLimits are the resources of the
+	// container's pod template that aren't recommended, such as hugepages
+	// and device plugin resources. They are kept unchanged.
+	PassthroughRequests v1.ResourceList
+	PassthroughLimits   v1.ResourceList
+	// HugePages is the usage of each hugepages size the container requests,
+	// or nil if it requests none or the usage is unknown.
+	HugePages []HugePagesUsage
+	// JVM is the heap setting recommended with the memory limit of a Java
+	// container, or nil outside JVM mode or for other containers.
+	JVM          *JVMSizing
+	DataStatus   DataStatus
+	DataIssues   []string
+	DataQuality  *DataQuality
+	MetricErrors []MetricError
+	// Warnings are findings about how the recommendation will behave once
+	// applied, such as defaults injected by the cluster.
+	Warnings []string
+}
+
+// IsMissingData reports whether the recommendation carries no resource values
+// because its inputs were unavailable.
+func (r *Recommendation) IsMissingData() bool {
+	return r.DataStatus == DataMissing
 }
 
 type CPURecommendation struct {
-	Request          *resource.Quantity
-	Limit            *resource.Quantity
+	Request *resource.Quantity
+	// Limit is nil when the policy omits CPU limits.
+	Limit *resource.Quantity
+	// SuggestedLimit is the limit that would have been recommended when the
+	// policy omits CPU limits.
+	SuggestedLimit   *resource.Quantity
 	SpikinessWarning bool
+	// ThrottlingWarning is set when the container was throttled in a
+	// significant share of CFS periods and the limit was raised.
+	ThrottlingWarning bool
+	// ThrottledRatio is the share of CFS periods in which the container was
+	// throttled.
+	ThrottledRatio float64
+}
+
+// Confidence rates how far a recommendation can be trusted given the data
+// it was computed from.
+type Confidence string
+
+const (
+	ConfidenceHigh   Confidence = "high"
+	ConfidenceMedium Confidence = "medium"
+	ConfidenceLow    Confidence = "low"
+)
+
+// DataQuality describes the samples a recommendation was computed from.
+type DataQuality struct {
+	// Span is the time between the first and last observed sample.
+	Span time.Duration
+	// Pods is the number of distinct pods observed.
+	Pods int
+	// Samples is the number of samples observed across all pods. With
+	// client-side aggregation these are points at the query resolution.
+	Samples int
+	// Gaps is the total time within Span during which no pod reported.
+	Gaps time.Duration
+	// Restarts is the number of container restarts in the time range, or
+	// zero if kube-state-metrics is not available.
+	Restarts int
+	// Confidence is derived from the fields above by the recommender.
+	Confidence Confidence
+}
+
+// OOMKill is one OOM kill of a container.
+type OOMKill struct {
+	Pod string
+	// Time is when the container was killed, or the zero time if the source
+	// didn't record it.
+	Time time.Time
+	// Source names where the kill was observed: "container status", "event"
+	// or "metrics".
+	Source string
+}
+
+// ContainerOOMKills are the OOM kills of a container the cluster records, and
+// the container's memory limit in the first killed pod.
+type ContainerOOMKills struct {
+	Kills        []OOMKill
+	CurrentLimit *resource.Quantity
+}
+
+// PreKillMemory describes a container's working set shortly before an OOM
+// kill.
+type PreKillMemory struct {
+	// Peak is the highest working set observed, in bytes.
+	Peak float64
+	// GrowthRate is the rate at which the working set grew up to the peak,
+	// in bytes per second.
+	GrowthRate float64
+}
+
+// OOMSizing explains how the memory limit of an OOM-killed container was
+// raised.
+type OOMSizing struct {
+	// CurrentLimit is the memory limit the container was killed at, or nil if
+	// it had none.
+	CurrentLimit *resource.Quantity
+	// PreKill is the usage before the kill that drove the increase, or nil if
+	// no kill could be analyzed.
+	PreKill *PreKillMemory
+	// Increase is how far the limit was raised above CurrentLimit.
+	Increase *resource.Quantity
+	// Capped is set when Increase was limited by the policy's maximum.
+	Capped bool
+	// Reason explains the choice of Increase.
+	Reason string
+}
+
+// EvictionCause is why the kubelet evicted a pod for its ephemeral storage.
+type EvictionCause string
+
+const (
+	// EvictionContainerLimit means the container used more than its
+	// ephemeral storage limit.
+	EvictionContainerLimit EvictionCause = "container limit"
+	// EvictionPodLimit means the pod used more than the sum of its
+	// containers' ephemeral storage limits.
+	EvictionPodLimit EvictionCause = "pod limit"
+	// EvictionNodePressure means the node ran low on ephemeral storage and
+	// the container used more than it requested.
+	EvictionNodePressure EvictionCause = "node pressure"
+)
+
+// StorageEviction is one eviction of a pod for the ephemeral storage of a
+// container.
+type StorageEviction struct {
+	Pod string
+	// Time is when the pod was evicted, or the zero time if the source
+	// didn't record it.
+	Time  time.Time
+	Cause EvictionCause
+	// Source names where the eviction was observed: "pod status" or "event".
+	Source string
+}
+
+// ContainerStorageEvictions are the ephemeral storage evictions of a
+// container the cluster records, and the container's ephemeral storage limit
+// in the first evicted pod.
+type ContainerStorageEvictions struct {
+	Evictions    []StorageEviction
+	CurrentLimit *resource.Quantity
+}
+
+// EphemeralStorage is the ephemeral storage recommendation of a container.
+type EphemeralStorage struct {
+	// Request and Limit are nil if the container was evicted but its usage
+	// is unknown.
+	Request *resource.Quantity
+	Limit   *resource.Quantity
+	// Peak is the highest usage of the container's writable layer and logs,
+	// in bytes.
+	Peak float64
+	// Evictions lists the evictions of the container's pods for ephemeral
+	// storage that the cluster still records.
+	Evictions []StorageEviction
+	// CurrentLimit is the limit the container was evicted at, or nil if it
+	// had none.
+	CurrentLimit *resource.Quantity
+	// LimitRaised is set when evictions raised the limit above what the
+	// usage alone needs.
+	LimitRaised bool
+}
+
+// JVMMemory is the peak memory a container's JVM reports in use, in bytes.
+type JVMMemory struct {
+	// Heap is the most heap in use, garbage included.
+	Heap float64
+	// NonHeap is the most non-heap memory in use: metaspace, code cache and
+	// compressed class space.
+	NonHeap float64
+}
+
+// JVMSizing is the max heap recommended for a Java container together with
+// its memory limit.
+type JVMSizing struct {
+	// CurrentFlag is the option that sets the max heap today, e.g. "-Xmx1g",
+	// or empty when the JVM's default of 25% of the memory limit applies.
+	CurrentFlag string
+	// CurrentHeap is the max heap today, or nil if it's a share of a memory
+	// limit the container doesn't have.
+	CurrentHeap *resource.Quantity
+	// Usage is the JVM's memory usage, or nil without JVM metrics.
+	Usage *JVMMemory
+	// Heap is the recommended max heap, and Flag the option that sets it.
+	Heap *resource.Quantity
+	Flag string
+	// Overhead is what the memory limit leaves beside the heap for non-heap
+	// and native memory, such as thread stacks, GC structures and direct
+	// buffers.
+	Overhead *resource.Quantity
+	// HeapFull is set when the heap in use reached the current max heap, so
+	// how much the heap needs is unknown.
+	HeapFull bool
+}
+
+// HugePagesUsage is the hugepages usage of a container for one page size.
+type HugePagesUsage struct {
+	// PageSize is the size of the pages, e.g. "2Mi".
+	PageSize string
+	// Peak is the most hugepages memory the container used, in bytes.
+	Peak float64
+	// Failures is the number of hugepages allocations that failed because
+	// the container reached its limit.
+	Failures float64
+}
+
+// MemoryLifetime is a linear fit of a container's working set over the
+// lifetime of one container instance.
+type MemoryLifetime struct {
+	Pod      string
+	Duration time.Duration
+	Samples  int
+	// Start is the fitted working set at the start of the lifetime, in bytes.
+	Start float64
+	// Mean is the average working set, in bytes.
+	Mean float64
+	// GrowthRate is the fitted growth in bytes per second.
+	GrowthRate float64
+	// R2 is the coefficient of determination of the fit: how much of the
+	// variation in the working set the steady growth explains.
+	R2 float64
+}
+
+// MemoryTrend summarizes how a container's working set grows over the
+// lifetimes of its instances.
+type MemoryTrend struct {
+	// Lifetimes is the number of container instances analyzed.
+	Lifetimes int
+	// Growing is the number of those whose working set grew steadily.
+	Growing int
+	// GrowthRate is the fastest growth among the growing lifetimes, in bytes
+	// per second.
+	GrowthRate float64
+	// ProbableLeak is set when most lifetimes grew steadily.
+	ProbableLeak bool
+	// TargetUptime is the uptime the memory limit was projected for, or zero
+	// if the policy sets none.
+	TargetUptime time.Duration
+	// ProjectedPeak is the working set expected after TargetUptime, in bytes.
+	// It is zero without a probable leak or a target uptime.
+	ProjectedPeak float64
+	// LimitRaised is set when the projection raised the memory limit.
+	LimitRaised bool
+}
+
+// Usage holds the percentiles a recommendation is sized from.
+type Usage struct {
+	// MemoryP99 is the p99 working set, in bytes.
+	MemoryP99 float64
+	// CPUP90 and CPUP99 are CPU usage percentiles, in cores.
+	CPUP90 float64
+	CPUP99 float64
+}
+
+// PodUsage is the usage of a container in a single pod.
+type PodUsage struct {
+	Pod string
+	Usage
+	// CPUP50 is the median CPU usage, in cores.
+	CPUP50 float64
+}
+
+// Spread summarizes a value across pods.
+type Spread struct {
+	Min    float64
+	Median float64
+	Max    float64
+}
+
+// PodDistribution describes how a container's usage is spread across the pods
+// of its workload, and which pods it was sized for.
+type PodDistribution struct {
+	Pods      int
+	MemoryP99 Spread
+	CPUP99    Spread
+	// Outlier is the only pod whose usage is far above the median, or empty.
+	Outlier string
+	// Imbalanced is set when several pods use far more than the median.
+	Imbalanced bool
+	// SizedFor names the pods the recommendation is sized for, such as "the
+	// max pod" or "the median pod".
+	SizedFor string
+}
+
+// Seasonality compares a container's usage inside and outside a recurring
+// peak window.
+type Seasonality struct {
+	Window TimeWindow
+	// Peak and OffPeak are nil if the time range held no samples inside or
+	// outside the window.
+	Peak    *Usage
+	OffPeak *Usage
+	// SizedForPeak is set when peak usage raised a recommended value above
+	// its percentile over the whole range.
+	SizedForPeak bool
+}
+
+// Trend is a straight line fitted to a usage series.
+type Trend struct {
+	// Current is the fitted value at the last sample.
+	Current float64
+	// GrowthRate is the slope of the line in units per second.
+	GrowthRate float64
+	// R2 is the coefficient of determination of the fit.
+	R2 float64
+}
+
+// UsageTrend holds the trends of a workload's total memory and CPU usage.
+type UsageTrend struct {
+	// Span is the time between the first and last sample fitted.
+	Span   time.Duration
+	Memory Trend
+	CPU    Trend
+}
+
+// Forecast is a recommendation sized for the usage projected to a planning
+// horizon.
+type Forecast struct {
+	Horizon time.Duration
+	Trend   UsageTrend
+	// MemoryFactor and CPUFactor scale today's recommendation to the
+	// horizon. They are 1 for a trend that declines or doesn't explain the
+	// usage.
+	MemoryFactor  float64
+	CPUFactor     float64
+	Memory        *resource.Quantity
+	MemoryRequest *resource.Quantity
+	CPU           *CPURecommendation
+}
+
+// ReplicaStats summarizes a workload's replica count over a time range.
+type ReplicaStats struct {
+	Min  float64
+	Max  float64
+	Mean float64
+}
+
+// HPAScaling describes a HorizontalPodAutoscaler that scales the workload on
+// CPU utilization, and the replica counts it is expected to settle at.
+type HPAScaling struct {
+	Name string
+	// TargetUtilization is the target average CPU utilization as a fraction
+	// of the CPU requests.
+	TargetUtilization float64
+	MinReplicas       int32
+	MaxReplicas       int32
+	// Replicas is the observed replica count, or nil if unknown.
+	Replicas *ReplicaStats
+	// UnadjustedRequest is the CPU request that would have been recommended
+	// without the HPA.
+	UnadjustedRequest *resource.Quantity
+	// TypicalUsage is the container's CPU usage in an average pod under
+	// typical load, in cores: the mean of its per-pod p50s, or the p50 of
+	// its busiest pod without per-pod data.
+	TypicalUsage float64
+	// CurrentReplicas and ExpectedReplicas are the replica counts the HPA
+	// settles at under typical load with the current and the recommended
+	// CPU requests. Zero means unknown.
+	CurrentReplicas  int32
+	ExpectedReplicas int32
+}
+
+// InitCPUUsage summarizes the CPU used by the runs of an init container.
+type InitCPUUsage struct {
+	// Runs is the number of runs observed.
+	Runs int
+	// CPUSeconds is the CPU time of the run that used the most, and Duration
+	// is how long that run was observed using CPU. Duration is zero if the
+	// run used all its CPU before its first sample.
+	CPUSeconds float64
+	Duration   time.Duration
+	// PeakRate is the highest CPU usage between two samples of any run, in
+	// cores, or zero if no run spanned two samples.
+	PeakRate float64
+	// TargetDuration is the startup time the CPU request was sized for. It is
+	// Duration unless the policy sets a target.
+	TargetDuration time.Duration
+	// TargetUnreachable is set when even the peak rate can't finish the run
+	// within TargetDuration.
+	TargetUnreachable bool
+	// CPUBound is set when the peak rate reached CurrentLimit, the CPU limit
+	// of the pod template, so the runs were held back by it and the limit
+	// was raised.
+	CPUBound     bool
+	CurrentLimit *resource.Quantity
+}
+
+// MetricError records an input that could not be fetched while computing a
+// recommendation.
+type MetricError struct {
+	Metric string
+	Err    error
+}
+
+func (e MetricError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Metric, e.Err)
 }
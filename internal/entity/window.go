@@ -0,0 +1,50 @@
+package entity
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TimeWindow is a window that recurs every week, such as weekdays from 09:00
+// to 18:00.
+type TimeWindow struct {
+	// Days are the weekdays the window is open on, indexed by time.Weekday.
+	Days [7]bool
+	// From and To are minutes since midnight. A window with To before From
+	// spans midnight; Days then applies to the day each instant falls on.
+	From, To int
+	// Offset is the fixed UTC offset the window is defined in.
+	Offset time.Duration
+}
+
+// Contains reports whether t falls inside the window.
+func (w TimeWindow) Contains(t time.Time) bool {
+	local := t.UTC().Add(w.Offset)
+	if !w.Days[local.Weekday()] {
+		return false
+	}
+	minute := local.Hour()*60 + local.Minute()
+	if w.From <= w.To {
+		return minute >= w.From && minute < w.To
+	}
+	return minute >= w.From || minute < w.To
+}
+
+func (w TimeWindow) String() string {
+	var days []string
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if w.Days[d] {
+			days = append(days, d.String()[:3])
+		}
+	}
+	offset := "UTC"
+	if w.Offset != 0 {
+		sign, abs := "+", w.Offset
+		if abs < 0 {
+			sign, abs = "-", -abs
+		}
+		offset = fmt.Sprintf("UTC%s%02d:%02d", sign, int(abs.Hours()), int(abs.Minutes())%60)
+	}
+	return fmt.Sprintf("%s %02d:%02d-%02d:%02d %s", strings.Join(days, ","), w.From/60, w.From%60, w.To/60, w.To%60, offset)
+}
@@ -7,13 +7,22 @@ import (
 	"log/slog"
 	"net/http"
 	"net/url"
+	"slices"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/prometheus/common/model"
 	"github.com/sequring/sculptor/internal/config"
+	"github.com/sequring/sculptor/internal/entity"
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
 	v1 "k8s.io/api/core/v1"
+	nodev1 "k8s.io/api/node/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -21,6 +30,11 @@ import (
 	"k8s.io/client-go/transport/spdy"
 )
 
+// oomEventMatchWindow is how far an OOMKilled event may be from a kill in
+// the container status of the same pod and still report that kill. It
+// matches the window the recommender merges kills from other sources with.
+const oomEventMatchWindow = 5 * time.Minute
+
 type Client struct {
 	Clientset  *kubernetes.Clientset
 	RESTConfig *rest.Config
@@ -67,47 +81,422 @@ func (g *Gateway) GetDeployment(ctx context.Context, namespace, name string) (*a
 	return g.clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
 }
 
-func (g *Gateway) CheckForOOMKilledEvents(ctx context.Context, d *appsv1.Deployment, targetContainerName string) (bool, string, *resource.Quantity, error) {
+// ListPods returns the pods selected by the deployment's label selector.
+func (g *Gateway) ListPods(ctx context.Context, d *appsv1.Deployment) ([]v1.Pod, error) {
 	selector, err := metav1.LabelSelectorAsSelector(d.Spec.Selector)
 	if err != nil {
-		return false, "", nil, fmt.Errorf("failed to build selector from deployment spec: %w", err)
+		return nil, fmt.Errorf("failed to build selector from deployment spec: %w", err)
 	}
 
 	podList, err := g.clientset.CoreV1().Pods(d.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
 	if err != nil {
-		return false, "", nil, fmt.Errorf("failed to list pods for deployment: %w", err)
+		return nil, fmt.Errorf("failed to list pods for deployment: %w", err)
 	}
+	return podList.Items, nil
+}
+
+// ListOOMKilledEvents returns the OOMKilled events recorded for the given pods.
+func (g *Gateway) ListOOMKilledEvents(ctx context.Context, namespace string, pods []v1.Pod) ([]v1.Event, error) {
+	return g.listPodEvents(ctx, namespace, pods, "OOMKilled")
+}
 
-	for _, pod := range podList.Items {
-		fieldSelector := fmt.Sprintf("involvedObject.kind=Pod,involvedObject.name=%s,reason=OOMKilled", pod.Name)
-		eventList, err := g.clientset.CoreV1().Events(d.Namespace).List(ctx, metav1.ListOptions{FieldSelector: fieldSelector})
+// listPodEvents returns the events with the given reason recorded for pods.
+func (g *Gateway) listPodEvents(ctx context.Context, namespace string, pods []v1.Pod, reason string) ([]v1.Event, error) {
+	var events []v1.Event
+	for _, pod := range pods {
+		fieldSelector := fmt.Sprintf("involvedObject.kind=Pod,involvedObject.name=%s,reason=%s", pod.Name, reason)
+		eventList, err := g.clientset.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{FieldSelector: fieldSelector})
 		if err != nil {
 			g.logger.Warn("Could not get events for pod", "pod", pod.Name, "error", err)
 			continue
 		}
+		events = append(events, eventList.Items...)
+	}
+	return events, nil
+}
+
+// ListLimitRanges returns the LimitRanges of a namespace.
+func (g *Gateway) ListLimitRanges(ctx context.Context, namespace string) ([]v1.LimitRange, error) {
+	limitRangeList, err := g.clientset.CoreV1().LimitRanges(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list limit ranges: %w", err)
+	}
+	return limitRangeList.Items, nil
+}
+
+// ListResourceQuotas returns the ResourceQuotas of a namespace.
+func (g *Gateway) ListResourceQuotas(ctx context.Context, namespace string) ([]v1.ResourceQuota, error) {
+	quotaList, err := g.clientset.CoreV1().ResourceQuotas(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list resource quotas: %w", err)
+	}
+	return quotaList.Items, nil
+}
+
+// GetHorizontalPodAutoscaler returns the HorizontalPodAutoscaler that scales
+// the Deployment, or nil if none does.
+func (g *Gateway) GetHorizontalPodAutoscaler(ctx context.Context, d *appsv1.Deployment) (*autoscalingv2.HorizontalPodAutoscaler, error) {
+	hpaList, err := g.clientset.AutoscalingV2().HorizontalPodAutoscalers(d.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list horizontal pod autoscalers: %w", err)
+	}
+	for i, hpa := range hpaList.Items {
+		ref := hpa.Spec.ScaleTargetRef
+		if ref.Kind == "Deployment" && ref.Name == d.Name {
+			return &hpaList.Items[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// GetRuntimeClass returns the RuntimeClass with the given name.
+func (g *Gateway) GetRuntimeClass(ctx context.Context, name string) (*nodev1.RuntimeClass, error) {
+	runtimeClass, err := g.clientset.NodeV1().RuntimeClasses().Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get runtime class: %w", err)
+	}
+	return runtimeClass, nil
+}
+
+// ListNodes returns the nodes a pod with the given spec can be scheduled on:
+// nodes that are Ready and not cordoned, match its nodeSelector and required
+// node affinity, and carry no NoSchedule or NoExecute taint it doesn't
+// tolerate.
+func (g *Gateway) ListNodes(ctx context.Context, spec *v1.PodSpec) ([]v1.Node, error) {
+	nodeList, err := g.clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{LabelSelector: labels.SelectorFromSet(spec.NodeSelector).String()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	var terms []v1.NodeSelectorTerm
+	if a := spec.Affinity; a != nil && a.NodeAffinity != nil && a.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution != nil {
+		terms = a.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	}
+	var nodes []v1.Node
+	for _, node := range nodeList.Items {
+		if node.Spec.Unschedulable || !isReady(&node) || !tolerates(spec.Tolerations, node.Spec.Taints) {
+			continue
+		}
+		if len(terms) > 0 && !matchesAnyTerm(terms, &node) {
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+// isReady reports whether the node's Ready condition is True.
+func isReady(node *v1.Node) bool {
+	for _, c := range node.Status.Conditions {
+		if c.Type == v1.NodeReady {
+			return c.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// tolerates reports whether the tolerations tolerate every taint that keeps
+// pods off a node.
+func tolerates(tolerations []v1.Toleration, taints []v1.Taint) bool {
+	for i := range taints {
+		if taints[i].Effect == v1.TaintEffectPreferNoSchedule {
+			continue
+		}
+		tolerated := false
+		for j := range tolerations {
+			if tolerations[j].ToleratesTaint(&taints[i]) {
+				tolerated = true
+				break
+			}
+		}
+		if !tolerated {
+			return false
+		}
+	}
+	return true
+}
+
+// nodeSelectorOperators maps node selector operators to label selector
+// operators.
+var nodeSelectorOperators = map[v1.NodeSelectorOperator]selection.Operator{
+	v1.NodeSelectorOpIn:           selection.In,
+	v1.NodeSelectorOpNotIn:        selection.NotIn,
+	v1.NodeSelectorOpExists:       selection.Exists,
+	v1.NodeSelectorOpDoesNotExist: selection.DoesNotExist,
+	v1.NodeSelectorOpGt:           selection.GreaterThan,
+	v1.NodeSelectorOpLt:           selection.LessThan,
+}
+
+// matchesAnyTerm reports whether a node matches one of the node selector
+// terms, which are ORed. The requirements within a term are ANDed. Empty
+// terms match no node, and invalid requirements match nothing.
+func matchesAnyTerm(terms []v1.NodeSelectorTerm, node *v1.Node) bool {
+	for _, term := range terms {
+		if len(term.MatchExpressions) == 0 && len(term.MatchFields) == 0 {
+			continue
+		}
+		if matchesRequirements(term.MatchExpressions, node.Labels) && matchesRequirements(term.MatchFields, labels.Set{"metadata.name": node.Name}) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesRequirements(requirements []v1.NodeSelectorRequirement, set labels.Set) bool {
+	for _, r := range requirements {
+		op, ok := nodeSelectorOperators[r.Operator]
+		if !ok {
+			return false
+		}
+		requirement, err := labels.NewRequirement(r.Key, op, r.Values)
+		if err != nil || !requirement.Matches(set) {
+			return false
+		}
+	}
+	return true
+}
+
+// ListOOMKills returns the OOM kills of each container in the deployment's
+// pods within the time range ending now, and the container's memory limit in
+// the first killed pod. Kills are read from the container statuses, which
+// keep the last termination of every container for the life of the pod, and
+// from OOMKilled events, which expire after about an hour. The pods and
+// events are listed once for all the containers.
+func (g *Gateway) ListOOMKills(ctx context.Context, d *appsv1.Deployment, containerNames []string, timeRange string) (map[string]entity.ContainerOOMKills, error) {
+	duration, err := model.ParseDuration(timeRange)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time range %q: %w", timeRange, err)
+	}
+	pods, err := g.ListPods(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+	events, err := g.ListOOMKilledEvents(ctx, d.Namespace, pods)
+	if err != nil {
+		return nil, err
+	}
+	since := time.Now().Add(-time.Duration(duration))
+	kills := make(map[string]entity.ContainerOOMKills, len(containerNames))
+	for _, name := range containerNames {
+		containerKills, currentLimit := OOMKills(pods, events, name, since)
+		kills[name] = entity.ContainerOOMKills{Kills: containerKills, CurrentLimit: currentLimit}
+	}
+	return kills, nil
+}
+
+// OOMKills finds the OOM kills of a container in pod statuses and OOMKilled
+// events, and returns them with the container's memory limit in the first
+// killed pod. An empty container name selects each pod's first container.
+// Events that name another container through their field path are ignored,
+// as are events that report a kill the container status already records.
+// Kills before since are dropped; kills without a time are kept, for the
+// caller to corroborate.
+func OOMKills(pods []v1.Pod, events []v1.Event, containerName string, since time.Time) ([]entity.OOMKill, *resource.Quantity) {
+	var kills []entity.OOMKill
+	var currentLimit *resource.Quantity
+	for _, pod := range pods {
+		name := containerName
+		if name == "" && len(pod.Spec.Containers) > 0 {
+			name = pod.Spec.Containers[0].Name
+		}
+
+		var podKills []entity.OOMKill
+		statuses := append(append([]v1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+		for _, cs := range statuses {
+			if cs.Name != name {
+				continue
+			}
+			for _, terminated := range []*v1.ContainerStateTerminated{cs.State.Terminated, cs.LastTerminationState.Terminated} {
+				if terminated != nil && terminated.Reason == "OOMKilled" {
+					podKills = append(podKills, entity.OOMKill{Pod: pod.Name, Time: terminated.FinishedAt.Time.UTC(), Source: "container status"})
+				}
+			}
+		}
+		statusKills := len(podKills)
+		reported := make([]bool, statusKills)
+		for _, e := range events {
+			if e.Reason != "OOMKilled" || e.InvolvedObject.Kind != "Pod" || e.InvolvedObject.Name != pod.Name {
+				continue
+			}
+			if fieldPath := e.InvolvedObject.FieldPath; fieldPath != "" && !strings.HasSuffix(fieldPath, "{"+name+"}") {
+				continue
+			}
+			kill := entity.OOMKill{Pod: pod.Name, Time: eventTime(e), Source: "event"}
+			if i := sameOOMKill(podKills[:statusKills], reported, kill); i >= 0 {
+				reported[i] = true
+				continue
+			}
+			podKills = append(podKills, kill)
+		}
+		podKills = slices.DeleteFunc(podKills, func(k entity.OOMKill) bool { return !k.Time.IsZero() && k.Time.Before(since) })
+		if len(podKills) == 0 {
+			continue
+		}
+		kills = append(kills, podKills...)
+
+		if currentLimit == nil {
+			for _, c := range append(append([]v1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...) {
+				if c.Name != name {
+					continue
+				}
+				if limit, ok := c.Resources.Limits[v1.ResourceMemory]; ok {
+					currentLimit = &limit
+				}
+				break
+			}
+		}
+	}
+	sort.SliceStable(kills, func(i, j int) bool { return kills[i].Time.Before(kills[j].Time) })
+	return kills, currentLimit
+}
+
+// sameOOMKill returns the index of the first kill not yet reported by an
+// event that is within oomEventMatchWindow of kill, or -1. A kill without a
+// time matches any kill.
+func sameOOMKill(kills []entity.OOMKill, reported []bool, kill entity.OOMKill) int {
+	for i, k := range kills {
+		if reported[i] {
+			continue
+		}
+		if k.Time.IsZero() || kill.Time.IsZero() {
+			return i
+		}
+		if d := k.Time.Sub(kill.Time); d <= oomEventMatchWindow && d >= -oomEventMatchWindow {
+			return i
+		}
+	}
+	return -1
+}
+
+// ListStorageEvictions returns the evictions of the Deployment's pods for the
+// ephemeral storage of each container within the time range ending now, and
+// the container's ephemeral storage limit in the first evicted pod. The pods
+// and events are listed once for all the containers.
+func (g *Gateway) ListStorageEvictions(ctx context.Context, d *appsv1.Deployment, containerNames []string, timeRange string) (map[string]entity.ContainerStorageEvictions, error) {
+	duration, err := model.ParseDuration(timeRange)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time range %q: %w", timeRange, err)
+	}
+	pods, err := g.ListPods(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+	events, err := g.listPodEvents(ctx, d.Namespace, pods, "Evicted")
+	if err != nil {
+		return nil, err
+	}
+	since := time.Now().Add(-time.Duration(duration))
+	evictions := make(map[string]entity.ContainerStorageEvictions, len(containerNames))
+	for _, name := range containerNames {
+		containerEvictions, currentLimit := StorageEvictions(pods, events, name, since)
+		evictions[name] = entity.ContainerStorageEvictions{Evictions: containerEvictions, CurrentLimit: currentLimit}
+	}
+	return evictions, nil
+}
+
+// StorageEvictions finds the evictions for the ephemeral storage of a
+// container in pod statuses and Evicted events, and returns them with the
+// container's ephemeral storage limit in the first evicted pod. A pod is
+// evicted once, so its events are only used when its status doesn't record
+// the eviction. The kubelet doesn't say which container filled a pod that
+// exceeded the total limit of its containers, so that eviction is attributed
+// once, to the pod's first container with an ephemeral storage limit.
+// Evictions before since are dropped; evictions without a time are kept.
+func StorageEvictions(pods []v1.Pod, events []v1.Event, containerName string, since time.Time) ([]entity.StorageEviction, *resource.Quantity) {
+	var evictions []entity.StorageEviction
+	var currentLimit *resource.Quantity
+	for _, pod := range pods {
+		owner := podLimitOwner(pod) == containerName
+		var eviction *entity.StorageEviction
+		if pod.Status.Reason == "Evicted" {
+			if cause, ok := storageEvictionCause(pod.Status.Message, containerName, owner); ok {
+				eviction = &entity.StorageEviction{Pod: pod.Name, Time: evictionTime(pod), Cause: cause, Source: "pod status"}
+			}
+		}
+		for _, e := range events {
+			if eviction != nil {
+				break
+			}
+			if e.Reason != "Evicted" || e.InvolvedObject.Kind != "Pod" || e.InvolvedObject.Name != pod.Name {
+				continue
+			}
+			if cause, ok := storageEvictionCause(e.Message, containerName, owner); ok {
+				eviction = &entity.StorageEviction{Pod: pod.Name, Time: eventTime(e), Cause: cause, Source: "event"}
+			}
+		}
+		if eviction == nil || (!eviction.Time.IsZero() && eviction.Time.Before(since)) {
+			continue
+		}
+		evictions = append(evictions, *eviction)
 
-		if len(eventList.Items) > 0 {
-			var currentLimit *resource.Quantity
-			if len(pod.Spec.Containers) > 0 {
-				if targetContainerName == "" {
-					targetContainerName = pod.Spec.Containers[0].Name
+		if currentLimit == nil {
+			for _, c := range append(append([]v1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...) {
+				if c.Name != containerName {
+					continue
 				}
-				for _, c := range pod.Spec.Containers {
-					if c.Name == targetContainerName {
-						if c.Resources.Limits != nil {
-							if limit, ok := c.Resources.Limits[v1.ResourceMemory]; ok {
-								currentLimit = &limit
-							}
-						}
-						break
-					}
+				if limit, ok := c.Resources.Limits[v1.ResourceEphemeralStorage]; ok {
+					currentLimit = &limit
 				}
+				break
 			}
-			return true, pod.Name, currentLimit, nil
 		}
 	}
+	sort.SliceStable(evictions, func(i, j int) bool { return evictions[i].Time.Before(evictions[j].Time) })
+	return evictions, currentLimit
+}
+
+// storageEvictionCause classifies the message of a kubelet eviction, and
+// reports whether it concerns the ephemeral storage of the container. An
+// eviction for the pod's total limit only concerns the container that owns
+// the pod's evictions.
+func storageEvictionCause(message, containerName string, owner bool) (entity.EvictionCause, bool) {
+	switch {
+	case strings.Contains(message, fmt.Sprintf("Container %s exceeded its local ephemeral storage limit", containerName)):
+		return entity.EvictionContainerLimit, true
+	case owner && strings.Contains(message, "Pod ephemeral local storage usage exceeds the total limit of containers"):
+		return entity.EvictionPodLimit, true
+	case strings.Contains(message, "low on resource: ephemeral-storage") && strings.Contains(message, fmt.Sprintf("Container %s was using", containerName)):
+		return entity.EvictionNodePressure, true
+	}
+	return "", false
+}
+
+// podLimitOwner returns the container that pod-level ephemeral storage
+// evictions are attributed to: the first container, then init container, with
+// an ephemeral storage limit, or the first container if none has one.
+func podLimitOwner(pod v1.Pod) string {
+	for _, c := range append(append([]v1.Container{}, pod.Spec.Containers...), pod.Spec.InitContainers...) {
+		if _, ok := c.Resources.Limits[v1.ResourceEphemeralStorage]; ok {
+			return c.Name
+		}
+	}
+	if len(pod.Spec.Containers) > 0 {
+		return pod.Spec.Containers[0].Name
+	}
+	return ""
+}
+
+// evictionTime returns when the kubelet marked an evicted pod as a disruption
+// target, or the zero time if it didn't.
+func evictionTime(pod v1.Pod) time.Time {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == v1.DisruptionTarget {
+			return c.LastTransitionTime.Time.UTC()
+		}
+	}
+	return time.Time{}
+}
 
-	return false, "", nil, nil
+// eventTime returns the time an event was last observed.
+func eventTime(e v1.Event) time.Time {
+	switch {
+	case !e.LastTimestamp.IsZero():
+		return e.LastTimestamp.Time.UTC()
+	case !e.EventTime.IsZero():
+		return e.EventTime.Time.UTC()
+	default:
+		return e.FirstTimestamp.Time.UTC()
+	}
 }
 
 func (c *Client) StartPortForward(logger *slog.Logger, namespace, serviceName string, port int, stopCh, readyCh chan struct{}) error {
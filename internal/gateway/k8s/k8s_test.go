@@ -4,9 +4,16 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"reflect"
 	"testing"
+	"time"
 
+	"github.com/sequring/sculptor/internal/entity"
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	v1 "k8s.io/api/core/v1"
+	nodev1 "k8s.io/api/node/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	
@@ -68,4 +75,321 @@ func TestGateway_GetDeployment(t *testing.T) {
 	if deployment.Namespace != expectedDeployment.Namespace {
 		t.Errorf("Expected deployment namespace %s, got %s", expectedDeployment.Namespace, deployment.Namespace)
 	}
-}
\ No newline at end of file
+}
+func TestGateway_GetHorizontalPodAutoscaler(t *testing.T) {
+	// Arrange
+	hpa := func(name, kind, target string) *autoscalingv2.HorizontalPodAutoscaler {
+		return &autoscalingv2.HorizontalPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test-namespace"},
+			Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+				ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{Kind: kind, Name: target, APIVersion: "apps/v1"},
+			},
+		}
+	}
+	mockCs := fake.NewSimpleClientset(
+		hpa("other", "Deployment", "other-deployment"),
+		hpa("statefulset", "StatefulSet", "test-deployment"),
+		hpa("test-hpa", "Deployment", "test-deployment"),
+	)
+	gateway := NewGateway(mockCs, slog.Default())
+	d := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-namespace"}}
+
+	// Act
+	got, err := gateway.GetHorizontalPodAutoscaler(context.Background(), d)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if got == nil || got.Name != "test-hpa" {
+		t.Errorf("Expected HPA test-hpa, got %v", got)
+	}
+
+	d.Name = "unscaled"
+	if got, err := gateway.GetHorizontalPodAutoscaler(context.Background(), d); err != nil || got != nil {
+		t.Errorf("Expected no HPA, got %v, %v", got, err)
+	}
+}
+
+func TestGateway_GetRuntimeClass(t *testing.T) {
+	// Arrange
+	mockCs := fake.NewSimpleClientset(&nodev1.RuntimeClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "kata"},
+		Overhead:   &nodev1.Overhead{PodFixed: v1.ResourceList{v1.ResourceCPU: resource.MustParse("250m")}},
+	})
+	gateway := NewGateway(mockCs, slog.Default())
+
+	// Act
+	got, err := gateway.GetRuntimeClass(context.Background(), "kata")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if got.Overhead == nil || got.Overhead.PodFixed.Cpu().MilliValue() != 250 {
+		t.Errorf("Expected an overhead of 250m CPU, got %v", got.Overhead)
+	}
+	if _, err := gateway.GetRuntimeClass(context.Background(), "missing"); err == nil {
+		t.Error("Expected an error for a missing RuntimeClass")
+	}
+}
+
+func TestGateway_ListNodes(t *testing.T) {
+	// Arrange
+	node := func(name string, labels map[string]string, taints ...v1.Taint) *v1.Node {
+		return &v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+			Spec:       v1.NodeSpec{Taints: taints},
+			Status:     v1.NodeStatus{Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}}},
+		}
+	}
+	gpuTaint := v1.Taint{Key: "gpu", Value: "true", Effect: v1.TaintEffectNoSchedule}
+	cordoned := node("cordoned", map[string]string{"pool": "web"})
+	cordoned.Spec.Unschedulable = true
+	notReady := node("web-down", map[string]string{"pool": "web", "zone": "a"})
+	notReady.Status.Conditions[0].Status = v1.ConditionUnknown
+	mockCs := fake.NewSimpleClientset(
+		node("web-1", map[string]string{"pool": "web", "zone": "a"}),
+		node("web-2", map[string]string{"pool": "web", "zone": "b"}),
+		node("web-gpu", map[string]string{"pool": "web", "zone": "a"}, gpuTaint),
+		node("batch", map[string]string{"pool": "batch", "zone": "a"}),
+		cordoned,
+		notReady,
+	)
+	gateway := NewGateway(mockCs, slog.Default())
+	spec := &v1.PodSpec{
+		NodeSelector: map[string]string{"pool": "web"},
+		Affinity: &v1.Affinity{NodeAffinity: &v1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{NodeSelectorTerms: []v1.NodeSelectorTerm{{
+				MatchExpressions: []v1.NodeSelectorRequirement{{Key: "zone", Operator: v1.NodeSelectorOpIn, Values: []string{"a"}}},
+			}}},
+		}},
+	}
+
+	// Act
+	nodes, err := gateway.ListNodes(context.Background(), spec)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(nodes) != 1 || nodes[0].Name != "web-1" {
+		t.Errorf("Expected only web-1, got %v", nodes)
+	}
+
+	spec.Tolerations = []v1.Toleration{{Key: "gpu", Operator: v1.TolerationOpExists}}
+	nodes, _ = gateway.ListNodes(context.Background(), spec)
+	if len(nodes) != 2 {
+		t.Errorf("Expected web-1 and the tolerated web-gpu, got %v", nodes)
+	}
+}
+
+func TestOOMKills(t *testing.T) {
+	// Arrange
+	killedAt := time.Date(2026, 10, 17, 9, 30, 0, 0, time.UTC)
+	eventAt := time.Date(2026, 10, 17, 10, 0, 0, 0, time.UTC)
+	limit := resource.MustParse("256Mi")
+	oomKilled := v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Reason: "OOMKilled", FinishedAt: metav1.NewTime(killedAt)}}
+	staleKill := v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Reason: "OOMKilled", FinishedAt: metav1.NewTime(killedAt.Add(-21 * 24 * time.Hour))}}
+	staleLimit := resource.MustParse("128Mi")
+	pods := []v1.Pod{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "api-1"},
+			Spec: v1.PodSpec{Containers: []v1.Container{
+				{Name: "app", Resources: v1.ResourceRequirements{Limits: v1.ResourceList{v1.ResourceMemory: limit}}},
+				{Name: "sidecar"},
+			}},
+			Status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{
+				{Name: "app", LastTerminationState: oomKilled},
+				{Name: "sidecar"},
+			}},
+		},
+		{
+			// Killed three weeks ago, long before the time range. The
+			// container status keeps the kill for the life of the pod.
+			ObjectMeta: metav1.ObjectMeta{Name: "api-0"},
+			Spec: v1.PodSpec{Containers: []v1.Container{
+				{Name: "app", Resources: v1.ResourceRequirements{Limits: v1.ResourceList{v1.ResourceMemory: staleLimit}}},
+			}},
+			Status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{
+				{Name: "app", LastTerminationState: staleKill},
+			}},
+		},
+		{
+			// Only the sidecar of this pod was killed.
+			ObjectMeta: metav1.ObjectMeta{Name: "api-2"},
+			Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "app"}, {Name: "sidecar"}}},
+			Status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{
+				{Name: "app"},
+				{Name: "sidecar", LastTerminationState: oomKilled},
+			}},
+		},
+	}
+	events := []v1.Event{
+		{
+			Reason:         "OOMKilled",
+			InvolvedObject: v1.ObjectReference{Kind: "Pod", Name: "api-1", FieldPath: "spec.containers{app}"},
+			LastTimestamp:  metav1.NewTime(eventAt),
+		},
+		{
+			Reason:         "OOMKilled",
+			InvolvedObject: v1.ObjectReference{Kind: "Pod", Name: "api-2", FieldPath: "spec.containers{sidecar}"},
+			LastTimestamp:  metav1.NewTime(eventAt),
+		},
+	}
+
+	// Act
+	kills, currentLimit := OOMKills(pods, events, "app", killedAt.Add(-time.Hour))
+
+	// Assert
+	want := []entity.OOMKill{
+		{Pod: "api-1", Time: killedAt, Source: "container status"},
+		{Pod: "api-1", Time: eventAt, Source: "event"},
+	}
+	if !reflect.DeepEqual(kills, want) {
+		t.Errorf("Expected kills %v, got %v", want, kills)
+	}
+	if currentLimit == nil || currentLimit.Cmp(limit) != 0 {
+		t.Errorf("Expected current limit %s, got %v", limit.String(), currentLimit)
+	}
+}
+
+func TestOOMKills_StatusAndEventOfTheSameKill(t *testing.T) {
+	// Arrange
+	killedAt := time.Date(2026, 10, 17, 9, 30, 0, 0, time.UTC)
+	pods := []v1.Pod{{
+		ObjectMeta: metav1.ObjectMeta{Name: "api-1"},
+		Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "app"}}},
+		Status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{{
+			Name:                 "app",
+			LastTerminationState: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Reason: "OOMKilled", FinishedAt: metav1.NewTime(killedAt)}},
+		}}},
+	}}
+	event := func(at time.Time) v1.Event {
+		return v1.Event{
+			Reason:         "OOMKilled",
+			InvolvedObject: v1.ObjectReference{Kind: "Pod", Name: "api-1", FieldPath: "spec.containers{app}"},
+			LastTimestamp:  metav1.NewTime(at),
+		}
+	}
+	// The first event reports the kill the status records; the second one
+	// is an earlier kill the status no longer shows.
+	events := []v1.Event{event(killedAt.Add(time.Minute)), event(killedAt.Add(-time.Hour))}
+
+	// Act
+	kills, _ := OOMKills(pods, events, "app", killedAt.Add(-2*time.Hour))
+
+	// Assert
+	want := []entity.OOMKill{
+		{Pod: "api-1", Time: killedAt.Add(-time.Hour), Source: "event"},
+		{Pod: "api-1", Time: killedAt, Source: "container status"},
+	}
+	if !reflect.DeepEqual(kills, want) {
+		t.Errorf("Expected kills %v, got %v", want, kills)
+	}
+}
+
+func TestStorageEvictions(t *testing.T) {
+	// Arrange
+	evictedAt := time.Date(2026, 10, 17, 9, 30, 0, 0, time.UTC)
+	eventAt := time.Date(2026, 10, 17, 10, 0, 0, 0, time.UTC)
+	limit := resource.MustParse("1Gi")
+	pods := []v1.Pod{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "api-1"},
+			Spec: v1.PodSpec{Containers: []v1.Container{
+				{Name: "app", Resources: v1.ResourceRequirements{Limits: v1.ResourceList{v1.ResourceEphemeralStorage: limit}}},
+			}},
+			Status: v1.PodStatus{
+				Phase:      v1.PodFailed,
+				Reason:     "Evicted",
+				Message:    `Container app exceeded its local ephemeral storage limit "1Gi". `,
+				Conditions: []v1.PodCondition{{Type: v1.DisruptionTarget, LastTransitionTime: metav1.NewTime(evictedAt)}},
+			},
+		},
+		{
+			// Evicted for its memory, not its storage.
+			ObjectMeta: metav1.ObjectMeta{Name: "api-2"},
+			Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "app"}}},
+			Status:     v1.PodStatus{Reason: "Evicted", Message: "The node was low on resource: memory. "},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "api-3"},
+			Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "app"}}},
+		},
+	}
+	events := []v1.Event{
+		{
+			// The pod status already records this eviction.
+			Reason:         "Evicted",
+			Message:        `Container app exceeded its local ephemeral storage limit "1Gi". `,
+			InvolvedObject: v1.ObjectReference{Kind: "Pod", Name: "api-1"},
+			LastTimestamp:  metav1.NewTime(eventAt),
+		},
+		{
+			Reason:         "Evicted",
+			Message:        "The node was low on resource: ephemeral-storage. Threshold quantity: 10Gi, available: 9Gi. Container app was using 8Gi, request is 0, has larger consumption of ephemeral-storage. ",
+			InvolvedObject: v1.ObjectReference{Kind: "Pod", Name: "api-3"},
+			LastTimestamp:  metav1.NewTime(eventAt),
+		},
+	}
+
+	// Act
+	evictions, currentLimit := StorageEvictions(pods, events, "app", evictedAt.Add(-time.Hour))
+
+	// Assert
+	want := []entity.StorageEviction{
+		{Pod: "api-1", Time: evictedAt, Cause: entity.EvictionContainerLimit, Source: "pod status"},
+		{Pod: "api-3", Time: eventAt, Cause: entity.EvictionNodePressure, Source: "event"},
+	}
+	if !reflect.DeepEqual(evictions, want) {
+		t.Errorf("Expected evictions %v, got %v", want, evictions)
+	}
+	if currentLimit == nil || currentLimit.Cmp(limit) != 0 {
+		t.Errorf("Expected current limit %s, got %v", limit.String(), currentLimit)
+	}
+	if evictions, _ := StorageEvictions(pods, events, "sidecar", evictedAt.Add(-time.Hour)); len(evictions) != 0 {
+		t.Errorf("Expected no evictions for another container, got %v", evictions)
+	}
+	if evictions, _ := StorageEvictions(pods, events, "app", eventAt.Add(-time.Minute)); len(evictions) != 1 || evictions[0].Pod != "api-3" {
+		t.Errorf("Expected only the eviction within the range, got %v", evictions)
+	}
+}
+
+func TestStorageEvictions_PodLimit(t *testing.T) {
+	// Arrange
+	evictedAt := time.Date(2026, 10, 17, 9, 30, 0, 0, time.UTC)
+	limit := resource.MustParse("1Gi")
+	pods := []v1.Pod{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "api-1"},
+			Spec: v1.PodSpec{Containers: []v1.Container{
+				{Name: "app"},
+				{Name: "cache", Resources: v1.ResourceRequirements{Limits: v1.ResourceList{v1.ResourceEphemeralStorage: limit}}},
+				{Name: "proxy", Resources: v1.ResourceRequirements{Limits: v1.ResourceList{v1.ResourceEphemeralStorage: limit}}},
+			}},
+			Status: v1.PodStatus{
+				Reason:     "Evicted",
+				Message:    `Pod ephemeral local storage usage exceeds the total limit of containers 2Gi. `,
+				Conditions: []v1.PodCondition{{Type: v1.DisruptionTarget, LastTransitionTime: metav1.NewTime(evictedAt)}},
+			},
+		},
+	}
+
+	// Act
+	evictions, currentLimit := StorageEvictions(pods, nil, "cache", evictedAt.Add(-time.Hour))
+
+	// Assert
+	want := []entity.StorageEviction{{Pod: "api-1", Time: evictedAt, Cause: entity.EvictionPodLimit, Source: "pod status"}}
+	if !reflect.DeepEqual(evictions, want) {
+		t.Errorf("Expected evictions %v, got %v", want, evictions)
+	}
+	if currentLimit == nil || currentLimit.Cmp(limit) != 0 {
+		t.Errorf("Expected current limit %s, got %v", limit.String(), currentLimit)
+	}
+	for _, name := range []string{"app", "proxy"} {
+		if evictions, _ := StorageEvictions(pods, nil, name, evictedAt.Add(-time.Hour)); len(evictions) != 0 {
+			t.Errorf("Expected the pod-limit eviction to be attributed once, got %v for %s", evictions, name)
+		}
+	}
+}
@@ -2,88 +2,891 @@ package prometheus
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log/slog"
 	"math"
+	"strings"
 	"time"
 
 	promapi "github.com/prometheus/client_golang/api"
 	prometheusv1 "github.com/prometheus/client_golang/api/prometheus/v1"
 	"github.com/prometheus/common/model"
+	"github.com/sequring/sculptor/internal/entity"
+	"github.com/sequring/sculptor/internal/gateway/series"
 )
 
+const (
+	// maxPointsPerSeries keeps query_range requests below Prometheus' limit of
+	// 11,000 points per series.
+	maxPointsPerSeries = 11000
+	minRawStep         = 30 * time.Second
+	// trendPoints is the resolution usage trends are fitted at. Trends span
+	// hours to months, so a coarse step is enough and keeps fetches cheap.
+	trendPoints = 1000
+)
+
+const (
+	memoryWorkingSetMetric = "container_memory_working_set_bytes"
+	memoryMaxUsageMetric   = "container_memory_max_usage_bytes"
+	cpuUsageMetric         = "container_cpu_usage_seconds_total"
+	restartsMetric         = "kube_pod_container_status_restarts_total"
+	terminatedReasonMetric = "kube_pod_container_status_last_terminated_reason"
+	cfsThrottledMetric     = "container_cpu_cfs_throttled_periods_total"
+	cfsPeriodsMetric       = "container_cpu_cfs_periods_total"
+	replicasMetric         = "kube_deployment_status_replicas"
+	fsUsageMetric          = "container_fs_usage_bytes"
+	logUsageMetric         = "kubelet_container_log_filesystem_used_bytes"
+	hugetlbMaxUsageMetric  = "container_hugetlb_max_usage_bytes"
+	hugetlbFailcntMetric   = "container_hugetlb_failcnt"
+	jvmMemoryUsedMetric    = "jvm_memory_used_bytes"
+)
+
+// rawMetrics lists the series every recommendation query is computed from.
+var rawMetrics = []string{
+	memoryWorkingSetMetric,
+	memoryMaxUsageMetric,
+	cpuUsageMetric,
+	restartsMetric,
+	terminatedReasonMetric,
+	cfsThrottledMetric,
+	cfsPeriodsMetric,
+	fsUsageMetric,
+	logUsageMetric,
+	jvmMemoryUsedMetric,
+	hugetlbMaxUsageMetric,
+	hugetlbFailcntMetric,
+}
+
+// rawDeploymentMetrics lists the series of the deployment itself that
+// recommendations are computed from.
+var rawDeploymentMetrics = []string{
+	replicasMetric,
+}
+
+// queryRangeResponse mirrors the body of Prometheus' /api/v1/query_range.
+type queryRangeResponse struct {
+	Status string `json:"status"`
+	Data   struct {
+		ResultType string       `json:"resultType"`
+		Result     model.Matrix `json:"result"`
+	} `json:"data"`
+}
+
 type Gateway struct {
-	api    prometheusv1.API
-	logger *slog.Logger
+	api        prometheusv1.API
+	logger     *slog.Logger
+	clientSide *ClientSideConfig
+	now        func() time.Time
+}
+
+// ClientSideConfig controls client-side aggregation, where raw series are
+// fetched with query_range and percentiles are computed in Go instead of
+// with expensive quantile_over_time subqueries.
+type ClientSideConfig struct {
+	// Chunk is the widest time window fetched by a single query_range request.
+	Chunk time.Duration
+	// Step is the query resolution. When zero, it is chosen so every series
+	// stays within maxPointsPerSeries over the whole range.
+	Step time.Duration
+}
+
+// Option configures a Gateway.
+type Option func(*Gateway)
+
+// WithClientSideAggregation switches the gateway to client-side aggregation.
+func WithClientSideAggregation(cfg ClientSideConfig) Option {
+	return func(g *Gateway) {
+		g.clientSide = &cfg
+	}
 }
 
-func NewGateway(address string, logger *slog.Logger) (*Gateway, error) {
+func NewGateway(address string, logger *slog.Logger, opts ...Option) (*Gateway, error) {
 	client, err := promapi.NewClient(promapi.Config{Address: address})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create prometheus client: %w", err)
 	}
-	return &Gateway{
+	g := &Gateway{
 		api:    prometheusv1.NewAPI(client),
 		logger: logger,
-	}, nil
+		now:    time.Now,
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g, nil
 }
 
 func (g *Gateway) GetMemoryMetrics(ctx context.Context, ns, deploymentName, containerName, timeRange string) (float64, error) {
+	if g.clientSide != nil {
+		return g.executeRangeQuery(ctx, "P99 Memory Usage", containerSelector(memoryWorkingSetMetric, ns, deploymentName, containerName), containerName, timeRange, func(points []model.SamplePair) float64 {
+			return series.Quantile(0.99, series.Values(points))
+		})
+	}
 	query := fmt.Sprintf(`max(quantile_over_time(0.99, container_memory_working_set_bytes{namespace="%s", pod=~"^%s-.*", container="%s"}[%s:]))`, ns, deploymentName, containerName, timeRange)
 	return g.executeQuery(ctx, "P99 Memory Usage", query, containerName)
 }
 
+func (g *Gateway) GetMemoryRequestMetrics(ctx context.Context, ns, deploymentName, containerName, timeRange string) (float64, error) {
+	if g.clientSide != nil {
+		return g.executeRangeQuery(ctx, "P95 Memory Usage", containerSelector(memoryWorkingSetMetric, ns, deploymentName, containerName), containerName, timeRange, func(points []model.SamplePair) float64 {
+			return series.Quantile(0.95, series.Values(points))
+		})
+	}
+	query := fmt.Sprintf(`max(quantile_over_time(0.95, container_memory_working_set_bytes{namespace="%s", pod=~"^%s-.*", container="%s"}[%s:]))`, ns, deploymentName, containerName, timeRange)
+	return g.executeQuery(ctx, "P95 Memory Usage", query, containerName)
+}
+
 func (g *Gateway) GetCPURequestMetrics(ctx context.Context, ns, deploymentName, containerName, timeRange string) (float64, error) {
+	if g.clientSide != nil {
+		return g.executeRangeQuery(ctx, "P90 CPU for Request", cpuRateQuery(ns, deploymentName, containerName), containerName, timeRange, func(points []model.SamplePair) float64 {
+			return series.Quantile(0.90, series.Values(points))
+		})
+	}
 	query := fmt.Sprintf(`max(quantile_over_time(0.90, rate(container_cpu_usage_seconds_total{namespace="%s", pod=~"^%s-.*", container="%s"}[5m])[%s:1m]))`, ns, deploymentName, containerName, timeRange)
 	return g.executeQuery(ctx, "P90 CPU for Request", query, containerName)
 }
 
 func (g *Gateway) GetCPULimitMetrics(ctx context.Context, ns, deploymentName, containerName, timeRange string) (float64, error) {
+	if g.clientSide != nil {
+		return g.executeRangeQuery(ctx, "P99 CPU for Limit", cpuRateQuery(ns, deploymentName, containerName), containerName, timeRange, func(points []model.SamplePair) float64 {
+			return series.Quantile(0.99, series.Values(points))
+		})
+	}
 	query := fmt.Sprintf(`max(quantile_over_time(0.99, rate(container_cpu_usage_seconds_total{namespace="%s", pod=~"^%s-.*", container="%s"}[5m])[%s:1m]))`, ns, deploymentName, containerName, timeRange)
 	return g.executeQuery(ctx, "P99 CPU for Limit", query, containerName)
 }
 
 func (g *Gateway) GetCPUMedianMetrics(ctx context.Context, ns, deploymentName, containerName, timeRange string) (float64, error) {
+	if g.clientSide != nil {
+		return g.executeRangeQuery(ctx, "P50 CPU for Spikiness", cpuRateQuery(ns, deploymentName, containerName), containerName, timeRange, func(points []model.SamplePair) float64 {
+			return series.Quantile(0.50, series.Values(points))
+		})
+	}
 	query := fmt.Sprintf(`max(quantile_over_time(0.50, rate(container_cpu_usage_seconds_total{namespace="%s", pod=~"^%s-.*", container="%s"}[5m])[%s:1m]))`, ns, deploymentName, containerName, timeRange)
 	return g.executeQuery(ctx, "P50 CPU for Spikiness", query, containerName)
 }
 
+// GetCPUThrottlingMetrics returns the share of CFS periods in which the
+// container was throttled over the time range. Containers without a CPU limit
+// report no CFS periods and return entity.ErrNoData.
+func (g *Gateway) GetCPUThrottlingMetrics(ctx context.Context, ns, deploymentName, containerName, timeRange string) (float64, error) {
+	throttledSelector := containerSelector(cfsThrottledMetric, ns, deploymentName, containerName)
+	periodsSelector := containerSelector(cfsPeriodsMetric, ns, deploymentName, containerName)
+	if g.clientSide != nil {
+		throttled, err := g.fetchRange(ctx, "CPU Throttled Periods", throttledSelector, containerName, timeRange)
+		if err != nil {
+			return 0, err
+		}
+		periods, err := g.fetchRange(ctx, "CPU Periods", periodsSelector, containerName, timeRange)
+		if err != nil {
+			return 0, err
+		}
+		total := series.TotalIncrease(periods)
+		if total == 0 {
+			g.logger.Info("Query returned no data", "queryName", "CPU Throttling", "container", containerName)
+			return 0, fmt.Errorf("CPU Throttling query for container %s: %w", containerName, entity.ErrNoData)
+		}
+		return series.TotalIncrease(throttled) / total, nil
+	}
+	query := fmt.Sprintf(`sum(increase(%s[%s])) / sum(increase(%s[%s]))`, throttledSelector, timeRange, periodsSelector, timeRange)
+	return g.executeQuery(ctx, "CPU Throttling", query, containerName)
+}
+
 func (g *Gateway) GetInitContainerMemoryMetrics(ctx context.Context, ns, deploymentName, containerName, timeRange string) (float64, error) {
+	if g.clientSide != nil {
+		return g.executeRangeQuery(ctx, "Max Memory Usage for Init Container", containerSelector(memoryMaxUsageMetric, ns, deploymentName, containerName), containerName, timeRange, func(points []model.SamplePair) float64 {
+			return series.Max(series.Values(points))
+		})
+	}
 	query := fmt.Sprintf(`max_over_time(container_memory_max_usage_bytes{namespace="%s", pod=~"^%s-.*", container="%s"}[%s])`, ns, deploymentName, containerName, timeRange)
 	return g.executeQuery(ctx, "Max Memory Usage for Init Container", query, containerName)
 }
 
+// GetEphemeralStorageMetrics returns the peak ephemeral storage a container
+// used: its writable layer and its logs, summed per pod.
+func (g *Gateway) GetEphemeralStorageMetrics(ctx context.Context, ns, deploymentName, containerName, timeRange string) (float64, error) {
+	if g.clientSide != nil {
+		return g.executeRangeQuery(ctx, "Max Ephemeral Storage", ephemeralStorageQuery(ns, deploymentName, containerName), containerName, timeRange, func(points []model.SamplePair) float64 {
+			return series.Max(series.Values(points))
+		})
+	}
+	query := fmt.Sprintf(`max(max_over_time(%s[%s:]))`, ephemeralStorageQuery(ns, deploymentName, containerName), timeRange)
+	return g.executeQuery(ctx, "Max Ephemeral Storage", query, containerName)
+}
+
+// GetJVMMemory returns the peak heap and non-heap memory a container's JVM
+// reports in use, summing the memory pools of each area per pod. The metric
+// is exported by the application, e.g. through Micrometer or the JMX
+// exporter.
+func (g *Gateway) GetJVMMemory(ctx context.Context, ns, deploymentName, containerName, timeRange string) (*entity.JVMMemory, error) {
+	query := fmt.Sprintf(`sum by (pod, area) (%s)`, containerSelector(jvmMemoryUsedMetric, ns, deploymentName, containerName))
+	var peaks map[string]float64
+	if g.clientSide != nil {
+		matrix, err := g.fetchRange(ctx, "JVM Memory", query, containerName, timeRange)
+		if err != nil {
+			return nil, err
+		}
+		peaks = series.MaxBy(matrix, "area")
+	} else {
+		var err error
+		peaks, err = g.queryBy(ctx, "JVM Memory", fmt.Sprintf(`max by (area) (max_over_time(%s[%s:]))`, query, timeRange), containerName, "area")
+		if err != nil {
+			return nil, err
+		}
+	}
+	heap, ok := peaks["heap"]
+	if !ok {
+		g.logger.Info("Query returned no data", "queryName", "JVM Memory", "container", containerName)
+		return nil, fmt.Errorf("JVM Memory query for container %s: %w", containerName, entity.ErrNoData)
+	}
+	return &entity.JVMMemory{Heap: heap, NonHeap: peaks["nonheap"]}, nil
+}
+
+// GetHugePagesUsage returns the peak hugepages usage and allocation failures
+// of a container for every page size, from cAdvisor's hugetlb metrics.
+func (g *Gateway) GetHugePagesUsage(ctx context.Context, ns, deploymentName, containerName, timeRange string) ([]entity.HugePagesUsage, error) {
+	maxUsageSelector := containerSelector(hugetlbMaxUsageMetric, ns, deploymentName, containerName)
+	failcntSelector := containerSelector(hugetlbFailcntMetric, ns, deploymentName, containerName)
+	var usage []entity.HugePagesUsage
+	if g.clientSide != nil {
+		maxUsage, err := g.fetchRange(ctx, "Hugepages Usage", maxUsageSelector, containerName, timeRange)
+		if err != nil {
+			return nil, err
+		}
+		failcnt, err := g.fetchRange(ctx, "Hugepages Failures", failcntSelector, containerName, timeRange)
+		if err != nil {
+			return nil, err
+		}
+		usage = series.HugePagesUsage(maxUsage, failcnt)
+	} else {
+		peaks, err := g.queryBy(ctx, "Hugepages Usage", fmt.Sprintf(`max by (pagesize) (max_over_time(%s[%s]))`, maxUsageSelector, timeRange), containerName, "pagesize")
+		if err != nil {
+			return nil, err
+		}
+		failures, err := g.queryBy(ctx, "Hugepages Failures", fmt.Sprintf(`sum by (pagesize) (increase(%s[%s]))`, failcntSelector, timeRange), containerName, "pagesize")
+		if err != nil {
+			return nil, err
+		}
+		usage = series.MergeHugePagesUsage(peaks, failures)
+	}
+	if len(usage) == 0 {
+		g.logger.Info("Query returned no data", "queryName", "Hugepages Usage", "container", containerName)
+		return nil, fmt.Errorf("Hugepages Usage query for container %s: %w", containerName, entity.ErrNoData)
+	}
+	return usage, nil
+}
+
+// GetInitContainerCPU summarizes the CPU counters of every run of an init
+// container. Runs are short, so the counters are fetched at the finest
+// resolution in both modes.
+func (g *Gateway) GetInitContainerCPU(ctx context.Context, ns, deploymentName, containerName, timeRange string) (*entity.InitCPUUsage, error) {
+	duration, err := model.ParseDuration(timeRange)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time range %q: %w", timeRange, err)
+	}
+	end := g.now()
+	matrix, err := g.fetchBetween(ctx, "Init Container CPU", containerSelector(cpuUsageMetric, ns, deploymentName, containerName), containerName, end.Add(-time.Duration(duration)), end, rawStep(time.Duration(duration)))
+	if err != nil {
+		return nil, err
+	}
+	usage, ok := series.InitCPUUsage(matrix)
+	if !ok {
+		g.logger.Info("Query returned no data", "queryName", "Init Container CPU", "container", containerName)
+		return nil, fmt.Errorf("Init Container CPU query for container %s: %w", containerName, entity.ErrNoData)
+	}
+	return &usage, nil
+}
+
 func (g *Gateway) GetMemoryStdDevMetrics(ctx context.Context, ns, deploymentName, containerName, timeRange string) (float64, error) {
+	if g.clientSide != nil {
+		return g.executeRangeQuery(ctx, "Memory StdDev", containerSelector(memoryWorkingSetMetric, ns, deploymentName, containerName), containerName, timeRange, func(points []model.SamplePair) float64 {
+			return series.StdDev(series.Values(points))
+		})
+	}
 	query := fmt.Sprintf(`stddev_over_time(container_memory_working_set_bytes{namespace="%s", pod=~"^%s-.*", container="%s"}[%s])`, ns, deploymentName, containerName, timeRange)
 	return g.executeQuery(ctx, "Memory StdDev", query, containerName)
 }
 
-func (g *Gateway) executeQuery(ctx context.Context, queryName string, query string, containerName string) (float64, error) {
-	g.logger.Debug("Fetching metrics from Prometheus", "queryName", queryName, "container", containerName, "query", query)
+// GetDataQuality reports how much working-set data exists for a container in
+// the time range: the span between the first and last sample, the number of
+// distinct pods and samples, the time without samples and the number of
+// container restarts.
+func (g *Gateway) GetDataQuality(ctx context.Context, ns, deploymentName, containerName, timeRange string) (*entity.DataQuality, error) {
+	selector := containerSelector(memoryWorkingSetMetric, ns, deploymentName, containerName)
+	if g.clientSide != nil {
+		matrix, err := g.fetchRange(ctx, "Data Coverage", selector, containerName, timeRange)
+		if err != nil {
+			return nil, err
+		}
+		span, pods := series.Coverage(matrix)
+		if pods == 0 {
+			return nil, fmt.Errorf("data coverage query for container %s: %w", containerName, entity.ErrNoData)
+		}
+		step, err := g.clientStep(timeRange)
+		if err != nil {
+			return nil, err
+		}
+		return &entity.DataQuality{
+			Span:    span,
+			Pods:    pods,
+			Samples: series.Samples(matrix),
+			Gaps:    series.Gaps(matrix, step),
+		}, nil
+	}
 
-	result, warnings, err := g.api.Query(ctx, query, time.Now())
+	pods, err := g.executeQuery(ctx, "Observed Pods", fmt.Sprintf(`count(count by (pod) (count_over_time(%s[%s])))`, selector, timeRange), containerName)
 	if err != nil {
-		return 0, fmt.Errorf("failed to query Prometheus for %s on container %s: %w", queryName, containerName, err)
+		return nil, err
 	}
-	if len(warnings) > 0 {
-		g.logger.Warn("Prometheus query returned warnings", "queryName", queryName, "container", containerName, "warnings", warnings)
+	span, err := g.executeQuery(ctx, "Observed Time Span", fmt.Sprintf(`max(max_over_time(timestamp(%[1]s)[%[2]s:1m])) - min(min_over_time(timestamp(%[1]s)[%[2]s:1m]))`, selector, timeRange), containerName)
+	if err != nil {
+		return nil, err
+	}
+	samples, err := g.executeQuery(ctx, "Observed Samples", fmt.Sprintf(`sum(count_over_time(%s[%s]))`, selector, timeRange), containerName)
+	if err != nil {
+		return nil, err
+	}
+	// Every minute in which any pod has a sample within the lookback period
+	// counts as covered; the rest of the span is a gap.
+	covered, err := g.executeQuery(ctx, "Covered Minutes", fmt.Sprintf(`count_over_time(count(%s)[%s:1m])`, selector, timeRange), containerName)
+	if err != nil {
+		return nil, err
 	}
 
-	vector, ok := result.(model.Vector)
+	spanDuration := time.Duration(span * float64(time.Second))
+	return &entity.DataQuality{
+		Span:    spanDuration,
+		Pods:    int(pods),
+		Samples: int(samples),
+		Gaps:    max(spanDuration-time.Duration(covered-1)*time.Minute, 0),
+	}, nil
+}
+
+// GetRestarts returns the number of times a container restarted over the
+// time range, as counted by kube-state-metrics. Without kube-state-metrics it
+// returns entity.ErrNoData.
+func (g *Gateway) GetRestarts(ctx context.Context, ns, deploymentName, containerName, timeRange string) (float64, error) {
+	selector := containerSelector(restartsMetric, ns, deploymentName, containerName)
+	if g.clientSide != nil {
+		restarts, err := g.fetchRange(ctx, "Container Restarts", selector, containerName, timeRange)
+		if err != nil {
+			return 0, err
+		}
+		if len(restarts) == 0 {
+			return 0, fmt.Errorf("restarts query for container %s: %w", containerName, entity.ErrNoData)
+		}
+		return series.TotalIncrease(restarts), nil
+	}
+	return g.executeQuery(ctx, "Container Restarts", fmt.Sprintf(`sum(max_over_time(%[1]s[%[2]s]) - min_over_time(%[1]s[%[2]s]))`, selector, timeRange), containerName)
+}
+
+// GetOOMKills returns the OOM kills of a container recorded by
+// kube-state-metrics over the time range. Kill times can't be computed by an
+// instant query, so the series are fetched with query_range in both modes.
+// Without kube-state-metrics it returns entity.ErrNoData.
+func (g *Gateway) GetOOMKills(ctx context.Context, ns, deploymentName, containerName, timeRange string) ([]entity.OOMKill, error) {
+	restarts, err := g.fetchRange(ctx, "Container Restarts", containerSelector(restartsMetric, ns, deploymentName, containerName), containerName, timeRange)
+	if err != nil {
+		return nil, err
+	}
+	if len(restarts) == 0 {
+		g.logger.Info("Query returned no data", "queryName", "Container Restarts", "container", containerName)
+		return nil, fmt.Errorf("OOM kills query for container %s: %w", containerName, entity.ErrNoData)
+	}
+	reasonSelector := fmt.Sprintf(`%s{namespace="%s", pod=~"^%s-.*", container="%s", reason="OOMKilled"}`, terminatedReasonMetric, ns, deploymentName, containerName)
+	reasons, err := g.fetchRange(ctx, "OOMKilled Terminations", reasonSelector, containerName, timeRange)
+	if err != nil {
+		return nil, err
+	}
+	return series.OOMKills(restarts, reasons), nil
+}
+
+// GetReplicaStats returns the replica count of the Deployment recorded by
+// kube-state-metrics over the time range. Without kube-state-metrics it
+// returns entity.ErrNoData.
+func (g *Gateway) GetReplicaStats(ctx context.Context, ns, deploymentName, timeRange string) (*entity.ReplicaStats, error) {
+	selector := fmt.Sprintf(`%s{namespace="%s", deployment="%s"}`, replicasMetric, ns, deploymentName)
+	matrix, err := g.fetchRange(ctx, "Deployment Replicas", selector, deploymentName, timeRange)
+	if err != nil {
+		return nil, err
+	}
+	stats, ok := series.ReplicaStats(matrix)
+	if !ok {
+		g.logger.Info("Query returned no data", "queryName", "Deployment Replicas", "deployment", deploymentName)
+		return nil, fmt.Errorf("replica count query for deployment %s: %w", deploymentName, entity.ErrNoData)
+	}
+	return &stats, nil
+}
+
+// GetPreKillMemory returns the working set of the killed container in the
+// window before an OOM kill, at the finest resolution Prometheus allows.
+func (g *Gateway) GetPreKillMemory(ctx context.Context, ns, deploymentName, containerName string, kill entity.OOMKill, window time.Duration) (*entity.PreKillMemory, error) {
+	query := fmt.Sprintf(`%s{namespace="%s", pod="%s", container="%s"}`, memoryWorkingSetMetric, ns, kill.Pod, containerName)
+	matrix, err := g.fetchBetween(ctx, "Memory Before OOM Kill", query, containerName, kill.Time.Add(-window), kill.Time, rawStep(window))
+	if err != nil {
+		return nil, err
+	}
+	memory, ok := series.PreKillMemory(matrix)
 	if !ok {
-		return 0, fmt.Errorf("unexpected result type for %s query: %s", queryName, result.Type().String())
+		g.logger.Info("Query returned no data", "queryName", "Memory Before OOM Kill", "container", containerName, "pod", kill.Pod)
+		return nil, fmt.Errorf("memory before OOM kill of pod %s for container %s: %w", kill.Pod, containerName, entity.ErrNoData)
+	}
+	return &memory, nil
+}
+
+// GetMemoryLifetimes fits a line to the working set of every container
+// instance in the time range. The series are fetched with query_range in both
+// modes, at a resolution of about trendPoints points over the range.
+func (g *Gateway) GetMemoryLifetimes(ctx context.Context, ns, deploymentName, containerName, timeRange string) ([]entity.MemoryLifetime, error) {
+	duration, err := model.ParseDuration(timeRange)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time range %q: %w", timeRange, err)
+	}
+	step := max(rawStep(time.Duration(duration)), (time.Duration(duration) / trendPoints).Truncate(time.Second))
+	end := g.now()
+	matrix, err := g.fetchBetween(ctx, "Memory Trend", containerSelector(memoryWorkingSetMetric, ns, deploymentName, containerName), containerName, end.Add(-time.Duration(duration)), end, step)
+	if err != nil {
+		return nil, err
+	}
+	lifetimes := series.MemoryLifetimes(matrix)
+	if len(lifetimes) == 0 {
+		g.logger.Info("Query returned no data", "queryName", "Memory Trend", "container", containerName)
+		return nil, fmt.Errorf("Memory Trend query for container %s: %w", containerName, entity.ErrNoData)
+	}
+	return lifetimes, nil
+}
+
+// GetPodUsage returns the usage percentiles of the container in every pod
+// over the time range, the values the other queries take the maximum of.
+func (g *Gateway) GetPodUsage(ctx context.Context, ns, deploymentName, containerName, timeRange string) ([]entity.PodUsage, error) {
+	memorySelector := containerSelector(memoryWorkingSetMetric, ns, deploymentName, containerName)
+	var pods []entity.PodUsage
+	if g.clientSide != nil {
+		memory, err := g.fetchRange(ctx, "Per-Pod Memory", memorySelector, containerName, timeRange)
+		if err != nil {
+			return nil, err
+		}
+		cpu, err := g.fetchRange(ctx, "Per-Pod CPU", cpuRateQuery(ns, deploymentName, containerName), containerName, timeRange)
+		if err != nil {
+			return nil, err
+		}
+		pods = series.PodUsage(memory, cpu)
+	} else {
+		memory, err := g.queryPods(ctx, "Per-Pod P99 Memory", fmt.Sprintf(`max by (pod) (quantile_over_time(0.99, %s[%s:]))`, memorySelector, timeRange), containerName)
+		if err != nil {
+			return nil, err
+		}
+		cpuP50, err := g.queryPods(ctx, "Per-Pod P50 CPU", fmt.Sprintf(`max by (pod) (quantile_over_time(0.50, %s[%s:1m]))`, cpuRateQuery(ns, deploymentName, containerName), timeRange), containerName)
+		if err != nil {
+			return nil, err
+		}
+		cpuP90, err := g.queryPods(ctx, "Per-Pod P90 CPU", fmt.Sprintf(`max by (pod) (quantile_over_time(0.90, %s[%s:1m]))`, cpuRateQuery(ns, deploymentName, containerName), timeRange), containerName)
+		if err != nil {
+			return nil, err
+		}
+		cpuP99, err := g.queryPods(ctx, "Per-Pod P99 CPU", fmt.Sprintf(`max by (pod) (quantile_over_time(0.99, %s[%s:1m]))`, cpuRateQuery(ns, deploymentName, containerName), timeRange), containerName)
+		if err != nil {
+			return nil, err
+		}
+		pods = series.MergePodUsage(memory, cpuP50, cpuP90, cpuP99)
+	}
+	if len(pods) == 0 {
+		g.logger.Info("Query returned no data", "queryName", "Per-Pod Usage", "container", containerName)
+		return nil, fmt.Errorf("Per-Pod Usage query for container %s: %w", containerName, entity.ErrNoData)
+	}
+	return pods, nil
+}
+
+// GetUsageTrend fits lines to the workload's total working set and CPU usage
+// over the time range. Each step averages usage since the previous one, so
+// the fit sees every sample at a resolution of about trendPoints points.
+func (g *Gateway) GetUsageTrend(ctx context.Context, ns, deploymentName, containerName, timeRange string) (*entity.UsageTrend, error) {
+	duration, err := model.ParseDuration(timeRange)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time range %q: %w", timeRange, err)
+	}
+	step := max(rawStep(time.Duration(duration)), (time.Duration(duration) / trendPoints).Truncate(time.Second))
+	window := model.Duration(step).String()
+	end := g.now()
+	start := end.Add(-time.Duration(duration))
+
+	memoryQuery := fmt.Sprintf(`sum(avg_over_time(%s[%s]))`, containerSelector(memoryWorkingSetMetric, ns, deploymentName, containerName), window)
+	memory, err := g.fetchBetween(ctx, "Memory Usage Trend", memoryQuery, containerName, start, end, step)
+	if err != nil {
+		return nil, err
+	}
+	cpuQuery := fmt.Sprintf(`sum(rate(%s[%s]))`, containerSelector(cpuUsageMetric, ns, deploymentName, containerName), window)
+	cpu, err := g.fetchBetween(ctx, "CPU Usage Trend", cpuQuery, containerName, start, end, step)
+	if err != nil {
+		return nil, err
+	}
+
+	trend, ok := series.UsageTrend(series.Sum(memory), series.Sum(cpu))
+	if !ok {
+		g.logger.Info("Query returned no data", "queryName", "Usage Trend", "container", containerName)
+		return nil, fmt.Errorf("Usage Trend query for container %s: %w", containerName, entity.ErrNoData)
+	}
+	return &trend, nil
+}
+
+// GetWindowUsage returns the usage percentiles over the samples inside the
+// recurring window, or outside it if inside is false. In server mode the
+// samples are selected with PromQL's time functions within the subqueries.
+func (g *Gateway) GetWindowUsage(ctx context.Context, ns, deploymentName, containerName, timeRange string, window entity.TimeWindow, inside bool) (*entity.Usage, error) {
+	queryName := "Peak Window Usage"
+	if !inside {
+		queryName = "Off-Peak Usage"
+	}
+	memorySelector := containerSelector(memoryWorkingSetMetric, ns, deploymentName, containerName)
+	if g.clientSide != nil {
+		memory, err := g.fetchRange(ctx, queryName+" Memory", memorySelector, containerName, timeRange)
+		if err != nil {
+			return nil, err
+		}
+		cpu, err := g.fetchRange(ctx, queryName+" CPU", cpuRateQuery(ns, deploymentName, containerName), containerName, timeRange)
+		if err != nil {
+			return nil, err
+		}
+		usage, ok := series.WindowUsage(memory, cpu, func(t time.Time) bool { return window.Contains(t) == inside })
+		if !ok {
+			g.logger.Info("Query returned no data", "queryName", queryName, "container", containerName)
+			return nil, fmt.Errorf("%s query for container %s: %w", queryName, containerName, entity.ErrNoData)
+		}
+		return &usage, nil
+	}
+
+	filter := "and on()"
+	if !inside {
+		filter = "unless on()"
+	}
+	condition := windowCondition(window)
+	query := func(q float64, expr string) string {
+		return fmt.Sprintf(`max(quantile_over_time(%g, (%s %s %s)[%s:1m]))`, q, expr, filter, condition, timeRange)
+	}
+	var usage entity.Usage
+	var err error
+	if usage.MemoryP99, err = g.executeQuery(ctx, queryName+" P99 Memory", query(0.99, memorySelector), containerName); err != nil {
+		return nil, err
+	}
+	if usage.CPUP90, err = g.executeQuery(ctx, queryName+" P90 CPU", query(0.90, cpuRateQuery(ns, deploymentName, containerName)), containerName); err != nil {
+		return nil, err
+	}
+	if usage.CPUP99, err = g.executeQuery(ctx, queryName+" P99 CPU", query(0.99, cpuRateQuery(ns, deploymentName, containerName)), containerName); err != nil {
+		return nil, err
+	}
+	return &usage, nil
+}
+
+// windowCondition is a PromQL expression that has a sample exactly when the
+// evaluation time falls inside the window.
+func windowCondition(w entity.TimeWindow) string {
+	now := "vector(time())"
+	if w.Offset != 0 {
+		now = fmt.Sprintf("vector(time() + %d)", int64(w.Offset.Seconds()))
+	}
+	var days []string
+	for d, open := range w.Days {
+		if open {
+			days = append(days, fmt.Sprintf("day_of_week(%s) == %d", now, d))
+		}
+	}
+	minute := fmt.Sprintf("(hour(%s) * 60 + minute(%s))", now, now)
+	minutes := fmt.Sprintf("%s >= %d < %d", minute, w.From, w.To)
+	if w.To < w.From {
+		minutes = fmt.Sprintf("%s >= %d or %s < %d", minute, w.From, minute, w.To)
+	}
+	return fmt.Sprintf("((%s) and on() (%s))", strings.Join(days, " or "), minutes)
+}
+
+// GetRawSeries fetches the unaggregated series behind the recommendation
+// queries for one container, ending at end. Each result carries the
+// query_range response body so it can be replayed offline.
+func (g *Gateway) GetRawSeries(ctx context.Context, ns, deploymentName, containerName, timeRange string, end time.Time) ([]entity.RawSeries, error) {
+	r, err := rawRange(timeRange, end)
+	if err != nil {
+		return nil, err
+	}
+	var out []entity.RawSeries
+	for _, metric := range rawMetrics {
+		raw, err := g.fetchRaw(ctx, metric, containerSelector(metric, ns, deploymentName, containerName), containerName, "container "+containerName, r)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, raw)
+	}
+	return out, nil
+}
+
+// GetRawDeploymentSeries fetches the unaggregated series of the deployment
+// itself, such as its replica count, ending at end. The results carry no
+// container.
+func (g *Gateway) GetRawDeploymentSeries(ctx context.Context, ns, deploymentName, timeRange string, end time.Time) ([]entity.RawSeries, error) {
+	r, err := rawRange(timeRange, end)
+	if err != nil {
+		return nil, err
+	}
+	var out []entity.RawSeries
+	for _, metric := range rawDeploymentMetrics {
+		raw, err := g.fetchRaw(ctx, metric, fmt.Sprintf(`%s{namespace="%s", deployment="%s"}`, metric, ns, deploymentName), "", "deployment "+deploymentName, r)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, raw)
+	}
+	return out, nil
+}
+
+// rawRange is the range raw series are exported over: the time range ending
+// at end, at the finest step that keeps series within maxPointsPerSeries.
+func rawRange(timeRange string, end time.Time) (prometheusv1.Range, error) {
+	duration, err := model.ParseDuration(timeRange)
+	if err != nil {
+		return prometheusv1.Range{}, fmt.Errorf("invalid time range %q: %w", timeRange, err)
+	}
+	return prometheusv1.Range{
+		Start: end.Add(-time.Duration(duration)),
+		End:   end,
+		Step:  rawStep(time.Duration(duration)),
+	}, nil
+}
+
+// fetchRaw runs a query_range request for the raw series of subject, such as
+// "container app", and keeps the response body.
+func (g *Gateway) fetchRaw(ctx context.Context, metric, query, containerName, subject string, r prometheusv1.Range) (entity.RawSeries, error) {
+	g.logger.Debug("Fetching raw series from Prometheus", "metric", metric, "subject", subject, "query", query, "step", r.Step)
+
+	result, warnings, err := g.api.QueryRange(ctx, query, r)
+	if err != nil {
+		return entity.RawSeries{}, fmt.Errorf("failed to query Prometheus for raw %s on %s: %w", metric, subject, err)
+	}
+	if len(warnings) > 0 {
+		g.logger.Warn("Prometheus query returned warnings", "metric", metric, "subject", subject, "warnings", warnings)
+	}
+	matrix, ok := result.(model.Matrix)
+	if !ok {
+		return entity.RawSeries{}, fmt.Errorf("unexpected result type for raw %s query: %s", metric, result.Type().String())
+	}
+
+	var resp queryRangeResponse
+	resp.Status = "success"
+	resp.Data.ResultType = model.ValMatrix.String()
+	resp.Data.Result = matrix
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return entity.RawSeries{}, fmt.Errorf("failed to encode raw %s series: %w", metric, err)
+	}
+
+	return entity.RawSeries{
+		Container: containerName,
+		Metric:    metric,
+		Query:     query,
+		Start:     r.Start,
+		End:       r.End,
+		Step:      r.Step,
+		Data:      data,
+	}, nil
+}
+
+// rawStep picks the finest step that keeps a series within
+// maxPointsPerSeries, rounded up to whole seconds.
+func rawStep(duration time.Duration) time.Duration {
+	step := (duration / maxPointsPerSeries).Truncate(time.Second) + time.Second
+	if step < minRawStep {
+		return minRawStep
+	}
+	return step
+}
+
+// stepFor returns the client-side query resolution for a time range.
+func (g *Gateway) stepFor(duration time.Duration) time.Duration {
+	if g.clientSide != nil && g.clientSide.Step > 0 {
+		return g.clientSide.Step
+	}
+	return rawStep(duration)
+}
+
+// clientStep is stepFor for a Prometheus time range string.
+func (g *Gateway) clientStep(timeRange string) (time.Duration, error) {
+	duration, err := model.ParseDuration(timeRange)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time range %q: %w", timeRange, err)
+	}
+	return g.stepFor(time.Duration(duration)), nil
+}
+
+// executeRangeQuery fetches query over the time range, applies reduce to
+// every returned series and returns the maximum across series.
+func (g *Gateway) executeRangeQuery(ctx context.Context, queryName, query, containerName, timeRange string, reduce func([]model.SamplePair) float64) (float64, error) {
+	matrix, err := g.fetchRange(ctx, queryName, query, containerName, timeRange)
+	if err != nil {
+		return 0, err
+	}
+	value := series.MaxOf(matrix, reduce)
+	if math.IsNaN(value) {
+		g.logger.Info("Query returned no data", "queryName", queryName, "container", containerName)
+		return 0, fmt.Errorf("%s query for container %s: %w", queryName, containerName, entity.ErrNoData)
+	}
+	return value, nil
+}
+
+// fetchRange fetches query over the time range in chunks and merges the
+// chunks into one matrix. Failed chunks are skipped so a partial outage still
+// yields a result; the fetch fails only if no chunk succeeds.
+func (g *Gateway) fetchRange(ctx context.Context, queryName, query, containerName, timeRange string) (model.Matrix, error) {
+	duration, err := model.ParseDuration(timeRange)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time range %q: %w", timeRange, err)
+	}
+	end := g.now()
+	return g.fetchBetween(ctx, queryName, query, containerName, end.Add(-time.Duration(duration)), end, g.stepFor(time.Duration(duration)))
+}
+
+// fetchBetween is fetchRange for an explicit window and step.
+func (g *Gateway) fetchBetween(ctx context.Context, queryName, query, containerName string, start, end time.Time, step time.Duration) (model.Matrix, error) {
+	var chunk time.Duration
+	if g.clientSide != nil {
+		chunk = g.clientSide.Chunk
+	}
+	if chunk <= 0 {
+		chunk = end.Sub(start)
+	} else if step > 0 {
+		// Each chunk after the first starts a step past the previous end, so
+		// chunks are whole steps long to keep samples on the same grid.
+		chunk = max(chunk.Truncate(step), step)
+	}
+
+	g.logger.Debug("Fetching range metrics from Prometheus", "queryName", queryName, "container", containerName, "query", query, "step", step, "chunk", chunk)
+
+	streams := make(map[model.Fingerprint]*model.SampleStream)
+	chunks, failed := 0, 0
+	var lastErr error
+	for chunkStart := start; chunkStart.Before(end); chunkStart = chunkStart.Add(chunk) {
+		chunkEnd := chunkStart.Add(chunk)
+		if chunkEnd.After(end) {
+			chunkEnd = end
+		}
+		// Ranges are inclusive, so skip the boundary sample the previous chunk
+		// already returned.
+		r := prometheusv1.Range{Start: chunkStart, End: chunkEnd, Step: step}
+		if chunks > 0 {
+			r.Start = r.Start.Add(step)
+		}
+		chunks++
+
+		result, warnings, err := g.api.QueryRange(ctx, query, r)
+		if err != nil {
+			failed++
+			lastErr = err
+			g.logger.Warn("Prometheus range query chunk failed, continuing with partial data", "queryName", queryName, "container", containerName, "start", r.Start, "end", r.End, "error", err)
+			continue
+		}
+		if len(warnings) > 0 {
+			g.logger.Warn("Prometheus query returned warnings", "queryName", queryName, "container", containerName, "warnings", warnings)
+		}
+		matrix, ok := result.(model.Matrix)
+		if !ok {
+			return nil, fmt.Errorf("unexpected result type for %s query: %s", queryName, result.Type().String())
+		}
+		for _, s := range matrix {
+			fp := s.Metric.Fingerprint()
+			if existing, ok := streams[fp]; ok {
+				existing.Values = append(existing.Values, s.Values...)
+			} else {
+				streams[fp] = s
+			}
+		}
+	}
+
+	if failed == chunks {
+		return nil, fmt.Errorf("failed to query Prometheus for %s on container %s: %w", queryName, containerName, lastErr)
+	}
+	if failed > 0 {
+		g.logger.Warn("Computed metric from partial data", "queryName", queryName, "container", containerName, "failedChunks", failed, "totalChunks", chunks)
+	}
+
+	matrix := make(model.Matrix, 0, len(streams))
+	for _, s := range streams {
+		matrix = append(matrix, s)
+	}
+	return matrix, nil
+}
+
+// containerSelector selects a metric for one container of a deployment's pods.
+func containerSelector(metric, ns, deploymentName, containerName string) string {
+	return fmt.Sprintf(`%s{namespace="%s", pod=~"^%s-.*", container="%s"}`, metric, ns, deploymentName, containerName)
+}
+
+// ephemeralStorageQuery is the per-pod ephemeral storage usage of a
+// container, summed over filesystems and its log files.
+func ephemeralStorageQuery(ns, deploymentName, containerName string) string {
+	return fmt.Sprintf(`sum by (pod) ({__name__=~"%s|%s", namespace="%s", pod=~"^%s-.*", container="%s"})`, fsUsageMetric, logUsageMetric, ns, deploymentName, containerName)
+}
+
+// cpuRateQuery is the per-pod CPU usage rate evaluated at every step, the
+// inner expression of the server-side CPU subqueries.
+func cpuRateQuery(ns, deploymentName, containerName string) string {
+	return fmt.Sprintf(`rate(%s[5m])`, containerSelector(cpuUsageMetric, ns, deploymentName, containerName))
+}
+
+func (g *Gateway) executeQuery(ctx context.Context, queryName string, query string, containerName string) (float64, error) {
+	vector, err := g.queryVector(ctx, queryName, query, containerName)
+	if err != nil {
+		return 0, err
 	}
 
 	if vector.Len() == 0 {
 		g.logger.Info("Query returned no data", "queryName", queryName, "container", containerName)
-		return 0, nil
+		return 0, fmt.Errorf("%s query for container %s: %w", queryName, containerName, entity.ErrNoData)
 	}
 
 	value := float64(vector[0].Value)
 	if math.IsNaN(value) || math.IsInf(value, 0) {
-		g.logger.Warn("Query returned non-numeric value (NaN or Inf), treating as 0", "queryName", queryName, "container", containerName)
-		return 0, nil
+		g.logger.Warn("Query returned non-numeric value (NaN or Inf)", "queryName", queryName, "container", containerName)
+		return 0, fmt.Errorf("%s query for container %s returned %v: %w", queryName, containerName, value, entity.ErrNoData)
 	}
 
 	return value, nil
 }
+
+// queryVector runs an instant query that must return a vector.
+func (g *Gateway) queryVector(ctx context.Context, queryName string, query string, containerName string) (model.Vector, error) {
+	g.logger.Debug("Fetching metrics from Prometheus", "queryName", queryName, "container", containerName, "query", query)
+
+	result, warnings, err := g.api.Query(ctx, query, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query Prometheus for %s on container %s: %w", queryName, containerName, err)
+	}
+	if len(warnings) > 0 {
+		g.logger.Warn("Prometheus query returned warnings", "queryName", queryName, "container", containerName, "warnings", warnings)
+	}
+
+	vector, ok := result.(model.Vector)
+	if !ok {
+		return nil, fmt.Errorf("unexpected result type for %s query: %s", queryName, result.Type().String())
+	}
+	return vector, nil
+}
+
+// queryPods runs an instant query aggregated by pod and returns the finite
+// value of every pod.
+func (g *Gateway) queryPods(ctx context.Context, queryName string, query string, containerName string) (map[string]float64, error) {
+	return g.queryBy(ctx, queryName, query, containerName, "pod")
+}
+
+// queryBy runs an instant query and returns its values keyed by a label.
+func (g *Gateway) queryBy(ctx context.Context, queryName string, query string, containerName string, label model.LabelName) (map[string]float64, error) {
+	vector, err := g.queryVector(ctx, queryName, query, containerName)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]float64, len(vector))
+	for _, sample := range vector {
+		v := float64(sample.Value)
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+		values[string(sample.Metric[label])] = v
+	}
+	return values, nil
+}
@@ -3,18 +3,22 @@ package prometheus
 import (
 	"context"
 	"fmt"
+	"encoding/json"
 	"log/slog"
+	"strings"
 	"testing"
 	"time"
 
 	prometheusv1 "github.com/prometheus/client_golang/api/prometheus/v1"
 	"github.com/prometheus/common/model"
+	"github.com/sequring/sculptor/internal/entity"
 	"github.com/stretchr/testify/assert"
 )
 
 // mockPrometheusAPI is a mock for prometheusv1.API
 type mockPrometheusAPI struct {
-	queryFunc func(ctx context.Context, query string, ts time.Time, opts ...prometheusv1.Option) (model.Value, prometheusv1.Warnings, error)
+	queryFunc      func(ctx context.Context, query string, ts time.Time, opts ...prometheusv1.Option) (model.Value, prometheusv1.Warnings, error)
+	queryRangeFunc func(ctx context.Context, query string, r prometheusv1.Range, opts ...prometheusv1.Option) (model.Value, prometheusv1.Warnings, error)
 }
 
 func (m *mockPrometheusAPI) Query(ctx context.Context, query string, ts time.Time, opts ...prometheusv1.Option) (model.Value, prometheusv1.Warnings, error) {
@@ -57,6 +61,9 @@ func (m *mockPrometheusAPI) LabelValues(ctx context.Context, label string, match
 }
 
 func (m *mockPrometheusAPI) QueryRange(ctx context.Context, query string, r prometheusv1.Range, opts ...prometheusv1.Option) (model.Value, prometheusv1.Warnings, error) {
+	if m.queryRangeFunc != nil {
+		return m.queryRangeFunc(ctx, query, r, opts...)
+	}
 	return nil, nil, nil
 }
 
@@ -134,7 +141,7 @@ func TestGateway_GetMemoryMetrics(t *testing.T) {
 			name:          "Query returns no data",
 			queryResult:   model.Vector{},
 			expectedValue: 0,
-			expectedError: "",
+			expectedError: "P99 Memory Usage query for container test-container: no data",
 		},
 		{
 			name:          "Query returns error",
@@ -175,3 +182,496 @@ func TestGateway_GetMemoryMetrics(t *testing.T) {
 		})
 	}
 }
+
+func TestGateway_GetRawSeries(t *testing.T) {
+	end := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	var ranges []prometheusv1.Range
+	mockAPI := &mockPrometheusAPI{
+		queryRangeFunc: func(ctx context.Context, query string, r prometheusv1.Range, opts ...prometheusv1.Option) (model.Value, prometheusv1.Warnings, error) {
+			ranges = append(ranges, r)
+			name := query[:strings.Index(query, "{")]
+			return model.Matrix{{
+				Metric: model.Metric{model.MetricNameLabel: model.LabelValue(name), "pod": "api-1"},
+				Values: []model.SamplePair{{Timestamp: model.TimeFromUnix(end.Unix()), Value: 42}},
+			}}, nil, nil
+		},
+	}
+	gateway := &Gateway{api: mockAPI, logger: slog.Default()}
+
+	raw, err := gateway.GetRawSeries(context.Background(), "prod", "api", "app", "7d", end)
+
+	assert.NoError(t, err)
+	assert.Len(t, raw, len(rawMetrics))
+	for i, r := range ranges {
+		assert.Equal(t, end.Add(-7*24*time.Hour), r.Start)
+		assert.Equal(t, end, r.End)
+		assert.Equal(t, 55*time.Second, r.Step)
+		assert.Equal(t, rawMetrics[i], raw[i].Metric)
+		assert.Contains(t, raw[i].Query, `namespace="prod", pod=~"^api-.*", container="app"`)
+
+		var resp queryRangeResponse
+		assert.NoError(t, json.Unmarshal(raw[i].Data, &resp))
+		assert.Equal(t, "success", resp.Status)
+		assert.Equal(t, "matrix", resp.Data.ResultType)
+		assert.Len(t, resp.Data.Result, 1)
+	}
+}
+
+func TestGateway_GetRawDeploymentSeries(t *testing.T) {
+	end := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	var queries []string
+	mockAPI := &mockPrometheusAPI{
+		queryRangeFunc: func(ctx context.Context, query string, r prometheusv1.Range, opts ...prometheusv1.Option) (model.Value, prometheusv1.Warnings, error) {
+			queries = append(queries, query)
+			return model.Matrix{{
+				Metric: model.Metric{model.MetricNameLabel: replicasMetric, "deployment": "api"},
+				Values: []model.SamplePair{{Timestamp: model.TimeFromUnix(end.Unix()), Value: 3}},
+			}}, nil, nil
+		},
+	}
+	gateway := &Gateway{api: mockAPI, logger: slog.Default()}
+
+	raw, err := gateway.GetRawDeploymentSeries(context.Background(), "prod", "api", "7d", end)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`kube_deployment_status_replicas{namespace="prod", deployment="api"}`}, queries)
+	if assert.Len(t, raw, 1) {
+		assert.Equal(t, replicasMetric, raw[0].Metric)
+		assert.Empty(t, raw[0].Container)
+		assert.Equal(t, 55*time.Second, raw[0].Step)
+	}
+}
+
+func TestRawStep(t *testing.T) {
+	assert.Equal(t, minRawStep, rawStep(time.Hour))
+	assert.Equal(t, 236*time.Second, rawStep(30*24*time.Hour))
+}
+
+func TestGateway_ClientSideAggregation(t *testing.T) {
+	end := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	var ranges []prometheusv1.Range
+	mockAPI := &mockPrometheusAPI{
+		queryFunc: func(ctx context.Context, query string, ts time.Time, opts ...prometheusv1.Option) (model.Value, prometheusv1.Warnings, error) {
+			t.Fatalf("client-side mode must not issue instant queries, got %s", query)
+			return nil, nil, nil
+		},
+		queryRangeFunc: func(ctx context.Context, query string, r prometheusv1.Range, opts ...prometheusv1.Option) (model.Value, prometheusv1.Warnings, error) {
+			ranges = append(ranges, r)
+			if len(ranges) == 2 {
+				return nil, nil, fmt.Errorf("timeout")
+			}
+			// Each chunk contributes one sample per pod; pod b is hotter.
+			v := model.SampleValue(len(ranges))
+			return model.Matrix{
+				{Metric: model.Metric{"pod": "api-a"}, Values: []model.SamplePair{{Timestamp: model.TimeFromUnix(r.Start.Unix()), Value: v}}},
+				{Metric: model.Metric{"pod": "api-b"}, Values: []model.SamplePair{{Timestamp: model.TimeFromUnix(r.Start.Unix()), Value: v * 10}}},
+			}, nil, nil
+		},
+	}
+	gateway := &Gateway{
+		api:        mockAPI,
+		logger:     slog.Default(),
+		clientSide: &ClientSideConfig{Chunk: 24 * time.Hour, Step: time.Minute},
+		now:        func() time.Time { return end },
+	}
+
+	value, err := gateway.GetInitContainerMemoryMetrics(context.Background(), "prod", "api", "app", "3d")
+
+	assert.NoError(t, err)
+	// Chunk 2 failed, so the maximum comes from pod b in chunk 3.
+	assert.Equal(t, 30.0, value)
+	assert.Len(t, ranges, 3)
+	assert.Equal(t, end.Add(-72*time.Hour), ranges[0].Start)
+	assert.Equal(t, end.Add(-48*time.Hour), ranges[0].End)
+	assert.Equal(t, end.Add(-48*time.Hour).Add(time.Minute), ranges[1].Start)
+	assert.Equal(t, end, ranges[2].End)
+	for _, r := range ranges {
+		assert.Equal(t, time.Minute, r.Step)
+	}
+}
+
+func TestGateway_ClientSideAggregation_ChunkRoundedToStep(t *testing.T) {
+	end := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		chunk      time.Duration
+		step       time.Duration
+		wantChunks int
+	}{
+		{name: "chunk shorter than the step", chunk: 30 * time.Minute, step: 2 * time.Hour, wantChunks: 3},
+		{name: "chunk not a multiple of the step", chunk: 90 * time.Minute, step: time.Hour, wantChunks: 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ranges []prometheusv1.Range
+			mockAPI := &mockPrometheusAPI{
+				queryRangeFunc: func(ctx context.Context, query string, r prometheusv1.Range, opts ...prometheusv1.Option) (model.Value, prometheusv1.Warnings, error) {
+					ranges = append(ranges, r)
+					return model.Matrix{{Metric: model.Metric{"pod": "api-a"}, Values: []model.SamplePair{{Timestamp: model.TimeFromUnix(r.Start.Unix()), Value: 1}}}}, nil, nil
+				},
+			}
+			gateway := &Gateway{
+				api:        mockAPI,
+				logger:     slog.Default(),
+				clientSide: &ClientSideConfig{Chunk: tt.chunk, Step: tt.step},
+				now:        func() time.Time { return end },
+			}
+
+			_, err := gateway.GetInitContainerMemoryMetrics(context.Background(), "prod", "api", "app", "6h")
+
+			assert.NoError(t, err)
+			assert.Len(t, ranges, tt.wantChunks)
+			for _, r := range ranges {
+				assert.False(t, r.Start.After(r.End), "chunk starts after it ends: %v", r)
+				assert.Zero(t, r.Start.Sub(end.Add(-6*time.Hour))%tt.step, "chunk start off the step grid: %v", r.Start)
+			}
+		})
+	}
+}
+
+func TestGateway_ClientSideAggregation_AllChunksFail(t *testing.T) {
+	var queries []string
+	mockAPI := &mockPrometheusAPI{
+		queryRangeFunc: func(ctx context.Context, query string, r prometheusv1.Range, opts ...prometheusv1.Option) (model.Value, prometheusv1.Warnings, error) {
+			queries = append(queries, query)
+			return nil, nil, fmt.Errorf("timeout")
+		},
+	}
+	gateway := &Gateway{
+		api:        mockAPI,
+		logger:     slog.Default(),
+		clientSide: &ClientSideConfig{},
+		now:        time.Now,
+	}
+
+	_, err := gateway.GetCPULimitMetrics(context.Background(), "prod", "api", "app", "7d")
+
+	assert.ErrorContains(t, err, "failed to query Prometheus for P99 CPU for Limit on container app: timeout")
+	assert.Equal(t, []string{`rate(container_cpu_usage_seconds_total{namespace="prod", pod=~"^api-.*", container="app"}[5m])`}, queries)
+}
+
+func TestGateway_GetDataQuality(t *testing.T) {
+	results := map[string]float64{
+		"count(count by (pod)":   3,
+		"max(max_over_time(":     3600,
+		"sum(count_over_time(":   180,
+		"count_over_time(count(": 51,
+	}
+	mockAPI := &mockPrometheusAPI{
+		queryFunc: func(ctx context.Context, query string, ts time.Time, opts ...prometheusv1.Option) (model.Value, prometheusv1.Warnings, error) {
+			for prefix, value := range results {
+				if strings.HasPrefix(query, prefix) {
+					return model.Vector{{Value: model.SampleValue(value)}}, nil, nil
+				}
+			}
+			// No kube-state-metrics: the restarts query has no data.
+			return model.Vector{}, nil, nil
+		},
+	}
+	gateway := &Gateway{api: mockAPI, logger: slog.Default()}
+
+	quality, err := gateway.GetDataQuality(context.Background(), "prod", "api", "app", "1h")
+
+	assert.NoError(t, err)
+	assert.Equal(t, &entity.DataQuality{
+		Span:    time.Hour,
+		Pods:    3,
+		Samples: 180,
+		Gaps:    10 * time.Minute,
+	}, quality)
+}
+
+func TestGateway_GetRestarts_ClientSide(t *testing.T) {
+	mockAPI := &mockPrometheusAPI{
+		queryRangeFunc: func(ctx context.Context, query string, r prometheusv1.Range, opts ...prometheusv1.Option) (model.Value, prometheusv1.Warnings, error) {
+			return nil, nil, fmt.Errorf("timeout")
+		},
+	}
+	gateway := &Gateway{
+		api:        mockAPI,
+		logger:     slog.Default(),
+		clientSide: &ClientSideConfig{},
+		now:        time.Now,
+	}
+
+	_, err := gateway.GetRestarts(context.Background(), "prod", "api", "app", "1h")
+
+	assert.ErrorContains(t, err, "timeout")
+	assert.NotErrorIs(t, err, entity.ErrNoData)
+}
+
+func TestGateway_GetCPUThrottlingMetrics_ClientSide(t *testing.T) {
+	end := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	mockAPI := &mockPrometheusAPI{
+		queryRangeFunc: func(ctx context.Context, query string, r prometheusv1.Range, opts ...prometheusv1.Option) (model.Value, prometheusv1.Warnings, error) {
+			// The throttled counter grows at a tenth of the periods counter.
+			scale := model.SampleValue(100)
+			if strings.HasPrefix(query, cfsThrottledMetric) {
+				scale = 10
+			}
+			return model.Matrix{{
+				Metric: model.Metric{"pod": "api-a"},
+				Values: []model.SamplePair{
+					{Timestamp: model.TimeFromUnix(r.Start.Unix()), Value: 0},
+					{Timestamp: model.TimeFromUnix(r.End.Unix()), Value: scale},
+				},
+			}}, nil, nil
+		},
+	}
+	gateway := &Gateway{
+		api:        mockAPI,
+		logger:     slog.Default(),
+		clientSide: &ClientSideConfig{},
+		now:        func() time.Time { return end },
+	}
+
+	ratio, err := gateway.GetCPUThrottlingMetrics(context.Background(), "prod", "api", "app", "1h")
+
+	assert.NoError(t, err)
+	assert.InDelta(t, 0.1, ratio, 1e-9)
+}
+
+func TestGateway_GetOOMKills(t *testing.T) {
+	end := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	var queries []string
+	mockAPI := &mockPrometheusAPI{
+		queryRangeFunc: func(ctx context.Context, query string, r prometheusv1.Range, opts ...prometheusv1.Option) (model.Value, prometheusv1.Warnings, error) {
+			queries = append(queries, query)
+			// The container restarted once, halfway through the range, after
+			// being OOMKilled.
+			start, mid := model.TimeFromUnix(r.Start.Unix()), model.TimeFromUnix(r.Start.Add(30*time.Minute).Unix())
+			values := []model.SamplePair{{Timestamp: start, Value: 0}, {Timestamp: mid, Value: 1}}
+			if strings.HasPrefix(query, terminatedReasonMetric) {
+				values = []model.SamplePair{{Timestamp: mid, Value: 1}}
+			}
+			return model.Matrix{{Metric: model.Metric{"pod": "api-a"}, Values: values}}, nil, nil
+		},
+	}
+	gateway := &Gateway{
+		api:    mockAPI,
+		logger: slog.Default(),
+		now:    func() time.Time { return end },
+	}
+
+	kills, err := gateway.GetOOMKills(context.Background(), "prod", "api", "app", "1h")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []entity.OOMKill{{Pod: "api-a", Time: end.Add(-30 * time.Minute), Source: "metrics"}}, kills)
+	if assert.Len(t, queries, 2) {
+		assert.Contains(t, queries[1], `reason="OOMKilled"`)
+	}
+}
+
+func TestGateway_GetPreKillMemory(t *testing.T) {
+	killedAt := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	var gotQuery string
+	var gotRange prometheusv1.Range
+	mockAPI := &mockPrometheusAPI{
+		queryRangeFunc: func(ctx context.Context, query string, r prometheusv1.Range, opts ...prometheusv1.Option) (model.Value, prometheusv1.Warnings, error) {
+			gotQuery, gotRange = query, r
+			return model.Matrix{{
+				Metric: model.Metric{"pod": "api-a"},
+				Values: []model.SamplePair{
+					{Timestamp: model.TimeFromUnix(r.End.Add(-time.Minute).Unix()), Value: 900},
+					{Timestamp: model.TimeFromUnix(r.End.Unix()), Value: 960},
+				},
+			}}, nil, nil
+		},
+	}
+	gateway := &Gateway{api: mockAPI, logger: slog.Default(), now: time.Now}
+
+	memory, err := gateway.GetPreKillMemory(context.Background(), "prod", "api", "app", entity.OOMKill{Pod: "api-a", Time: killedAt}, 30*time.Minute)
+
+	assert.NoError(t, err)
+	assert.Equal(t, &entity.PreKillMemory{Peak: 960, GrowthRate: 1}, memory)
+	assert.Contains(t, gotQuery, `pod="api-a"`)
+	assert.Equal(t, killedAt.Add(-30*time.Minute), gotRange.Start)
+	assert.Equal(t, killedAt, gotRange.End)
+}
+
+func TestGateway_GetWindowUsage(t *testing.T) {
+	var queries []string
+	mockAPI := &mockPrometheusAPI{
+		queryFunc: func(ctx context.Context, query string, ts time.Time, opts ...prometheusv1.Option) (model.Value, prometheusv1.Warnings, error) {
+			queries = append(queries, query)
+			return model.Vector{{Value: 2}}, nil, nil
+		},
+	}
+	gateway := &Gateway{api: mockAPI, logger: slog.Default(), now: time.Now}
+	window := entity.TimeWindow{Days: [7]bool{time.Monday: true, time.Tuesday: true}, From: 22 * 60, To: 2 * 60, Offset: 2 * time.Hour}
+
+	usage, err := gateway.GetWindowUsage(context.Background(), "prod", "api", "app", "7d", window, false)
+
+	assert.NoError(t, err)
+	assert.Equal(t, &entity.Usage{MemoryP99: 2, CPUP90: 2, CPUP99: 2}, usage)
+	if assert.Len(t, queries, 3) {
+		assert.Contains(t, queries[0], "quantile_over_time(0.99,")
+		assert.Contains(t, queries[0], "unless on() ((day_of_week(vector(time() + 7200)) == 1 or day_of_week(vector(time() + 7200)) == 2)")
+		assert.Contains(t, queries[0], ">= 1320 or (hour(vector(time() + 7200)) * 60 + minute(vector(time() + 7200))) < 120)))[7d:1m]")
+		assert.Contains(t, queries[1], "quantile_over_time(0.9,")
+	}
+}
+
+func TestGateway_GetUsageTrend(t *testing.T) {
+	end := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	var queries []string
+	mockAPI := &mockPrometheusAPI{
+		queryRangeFunc: func(ctx context.Context, query string, r prometheusv1.Range, opts ...prometheusv1.Option) (model.Value, prometheusv1.Warnings, error) {
+			queries = append(queries, query)
+			var values []model.SamplePair
+			for ts, v := r.Start, 100.0; !ts.After(r.End); ts, v = ts.Add(r.Step), v+1 {
+				values = append(values, model.SamplePair{Timestamp: model.TimeFromUnix(ts.Unix()), Value: model.SampleValue(v)})
+			}
+			return model.Matrix{{Metric: model.Metric{}, Values: values}}, nil, nil
+		},
+	}
+	gateway := &Gateway{api: mockAPI, logger: slog.Default(), now: func() time.Time { return end }}
+
+	trend, err := gateway.GetUsageTrend(context.Background(), "prod", "api", "app", "90d")
+
+	assert.NoError(t, err)
+	if assert.Len(t, queries, 2) {
+		assert.Contains(t, queries[0], `sum(avg_over_time(container_memory_working_set_bytes{namespace="prod", pod=~"^api-.*", container="app"}[2h9m36s]))`)
+		assert.Contains(t, queries[1], `sum(rate(container_cpu_usage_seconds_total{namespace="prod", pod=~"^api-.*", container="app"}[2h9m36s]))`)
+	}
+	assert.Equal(t, 90*24*time.Hour, trend.Span)
+	assert.InDelta(t, 1.0/(2*3600+9*60+36), trend.Memory.GrowthRate, 1e-12)
+	assert.InDelta(t, 1, trend.CPU.R2, 1e-9)
+}
+
+func TestGateway_GetReplicaStats(t *testing.T) {
+	var gotQuery string
+	mockAPI := &mockPrometheusAPI{
+		queryRangeFunc: func(ctx context.Context, query string, r prometheusv1.Range, opts ...prometheusv1.Option) (model.Value, prometheusv1.Warnings, error) {
+			gotQuery = query
+			return model.Matrix{{
+				Metric: model.Metric{"deployment": "api"},
+				Values: []model.SamplePair{
+					{Timestamp: model.TimeFromUnix(r.Start.Unix()), Value: 2},
+					{Timestamp: model.TimeFromUnix(r.End.Unix()), Value: 4},
+				},
+			}}, nil, nil
+		},
+	}
+	gateway := &Gateway{api: mockAPI, logger: slog.Default(), now: time.Now}
+
+	stats, err := gateway.GetReplicaStats(context.Background(), "prod", "api", "1d")
+
+	assert.NoError(t, err)
+	assert.Equal(t, &entity.ReplicaStats{Min: 2, Max: 4, Mean: 3}, stats)
+	assert.Equal(t, `kube_deployment_status_replicas{namespace="prod", deployment="api"}`, gotQuery)
+}
+
+func TestGateway_GetEphemeralStorageMetrics(t *testing.T) {
+	var gotQuery string
+	mockAPI := &mockPrometheusAPI{
+		queryFunc: func(ctx context.Context, query string, ts time.Time, opts ...prometheusv1.Option) (model.Value, prometheusv1.Warnings, error) {
+			gotQuery = query
+			return model.Vector{{Value: 1.5 * 1024 * 1024 * 1024}}, nil, nil
+		},
+	}
+	gateway := &Gateway{api: mockAPI, logger: slog.Default(), now: time.Now}
+
+	value, err := gateway.GetEphemeralStorageMetrics(context.Background(), "prod", "api", "app", "7d")
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1.5*1024*1024*1024, value)
+	assert.Equal(t, `max(max_over_time(sum by (pod) ({__name__=~"container_fs_usage_bytes|kubelet_container_log_filesystem_used_bytes", namespace="prod", pod=~"^api-.*", container="app"})[7d:]))`, gotQuery)
+}
+
+func TestGateway_GetJVMMemory(t *testing.T) {
+	var gotQuery string
+	mockAPI := &mockPrometheusAPI{
+		queryFunc: func(ctx context.Context, query string, ts time.Time, opts ...prometheusv1.Option) (model.Value, prometheusv1.Warnings, error) {
+			gotQuery = query
+			return model.Vector{
+				{Metric: model.Metric{"area": "heap"}, Value: 512 * 1024 * 1024},
+				{Metric: model.Metric{"area": "nonheap"}, Value: 128 * 1024 * 1024},
+			}, nil, nil
+		},
+	}
+	gateway := &Gateway{api: mockAPI, logger: slog.Default()}
+
+	usage, err := gateway.GetJVMMemory(context.Background(), "prod", "api", "app", "7d")
+
+	assert.NoError(t, err)
+	assert.Equal(t, &entity.JVMMemory{Heap: 512 * 1024 * 1024, NonHeap: 128 * 1024 * 1024}, usage)
+	assert.Equal(t, `max by (area) (max_over_time(sum by (pod, area) (jvm_memory_used_bytes{namespace="prod", pod=~"^api-.*", container="app"})[7d:]))`, gotQuery)
+}
+
+func TestGateway_GetJVMMemory_NoData(t *testing.T) {
+	mockAPI := &mockPrometheusAPI{
+		queryFunc: func(ctx context.Context, query string, ts time.Time, opts ...prometheusv1.Option) (model.Value, prometheusv1.Warnings, error) {
+			return model.Vector{}, nil, nil
+		},
+	}
+	gateway := &Gateway{api: mockAPI, logger: slog.Default()}
+
+	_, err := gateway.GetJVMMemory(context.Background(), "prod", "api", "app", "7d")
+
+	assert.ErrorIs(t, err, entity.ErrNoData)
+}
+
+func TestGateway_GetHugePagesUsage(t *testing.T) {
+	var queries []string
+	mockAPI := &mockPrometheusAPI{
+		queryFunc: func(ctx context.Context, query string, ts time.Time, opts ...prometheusv1.Option) (model.Value, prometheusv1.Warnings, error) {
+			queries = append(queries, query)
+			if strings.Contains(query, "failcnt") {
+				return model.Vector{{Metric: model.Metric{"pagesize": "2MB"}, Value: 4}}, nil, nil
+			}
+			return model.Vector{{Metric: model.Metric{"pagesize": "2MB"}, Value: 64 * 1024 * 1024}}, nil, nil
+		},
+	}
+	gateway := &Gateway{api: mockAPI, logger: slog.Default()}
+
+	usage, err := gateway.GetHugePagesUsage(context.Background(), "prod", "api", "app", "7d")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []entity.HugePagesUsage{{PageSize: "2Mi", Peak: 64 * 1024 * 1024, Failures: 4}}, usage)
+	assert.Equal(t, []string{
+		`max by (pagesize) (max_over_time(container_hugetlb_max_usage_bytes{namespace="prod", pod=~"^api-.*", container="app"}[7d]))`,
+		`sum by (pagesize) (increase(container_hugetlb_failcnt{namespace="prod", pod=~"^api-.*", container="app"}[7d]))`,
+	}, queries)
+}
+
+func TestGateway_GetPodUsage(t *testing.T) {
+	var queries []string
+	mockAPI := &mockPrometheusAPI{
+		queryFunc: func(ctx context.Context, query string, ts time.Time, opts ...prometheusv1.Option) (model.Value, prometheusv1.Warnings, error) {
+			queries = append(queries, query)
+			scale := model.SampleValue(len(queries))
+			return model.Vector{
+				{Metric: model.Metric{"pod": "api-2"}, Value: 2 * scale},
+				{Metric: model.Metric{"pod": "api-1"}, Value: 1 * scale},
+			}, nil, nil
+		},
+	}
+	gateway := &Gateway{api: mockAPI, logger: slog.Default()}
+
+	pods, err := gateway.GetPodUsage(context.Background(), "prod", "api", "app", "7d")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []entity.PodUsage{
+		{Pod: "api-1", Usage: entity.Usage{MemoryP99: 1, CPUP90: 3, CPUP99: 4}, CPUP50: 2},
+		{Pod: "api-2", Usage: entity.Usage{MemoryP99: 2, CPUP90: 6, CPUP99: 8}, CPUP50: 4},
+	}, pods)
+	assert.Len(t, queries, 4)
+	assert.True(t, strings.HasPrefix(queries[0], `max by (pod) (quantile_over_time(0.99, container_memory_working_set_bytes{`))
+	assert.True(t, strings.HasPrefix(queries[1], `max by (pod) (quantile_over_time(0.50, `))
+	assert.True(t, strings.HasPrefix(queries[2], `max by (pod) (quantile_over_time(0.90, `))
+}
+
+func TestGateway_GetPodUsage_NoData(t *testing.T) {
+	mockAPI := &mockPrometheusAPI{
+		queryFunc: func(ctx context.Context, query string, ts time.Time, opts ...prometheusv1.Option) (model.Value, prometheusv1.Warnings, error) {
+			return model.Vector{}, nil, nil
+		},
+	}
+	gateway := &Gateway{api: mockAPI, logger: slog.Default()}
+
+	_, err := gateway.GetPodUsage(context.Background(), "prod", "api", "app", "7d")
+
+	assert.ErrorIs(t, err, entity.ErrNoData)
+}
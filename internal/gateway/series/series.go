@@ -0,0 +1,617 @@
+package series
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/sequring/sculptor/internal/entity"
+)
+
+// Values returns the sample values of the given points, dropping NaN and Inf.
+func Values(points []model.SamplePair) []float64 {
+	values := make([]float64, 0, len(points))
+	for _, p := range points {
+		v := float64(p.Value)
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+		values = append(values, v)
+	}
+	return values
+}
+
+// Between returns the points whose timestamps fall within [start, end].
+func Between(points []model.SamplePair, start, end time.Time) []model.SamplePair {
+	from, to := model.TimeFromUnixNano(start.UnixNano()), model.TimeFromUnixNano(end.UnixNano())
+	var out []model.SamplePair
+	for _, p := range points {
+		if p.Timestamp.Before(from) || p.Timestamp.After(to) {
+			continue
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// Rate evaluates the per-second rate of a counter at every sample, looking back
+// over the given window like PromQL's rate(). Counter resets are handled by
+// treating a decrease as a restart from zero. Samples without at least one
+// predecessor inside the window produce no value.
+func Rate(points []model.SamplePair, window time.Duration) []float64 {
+	return Values(RatePoints(points, window))
+}
+
+// RatePoints is Rate with each rate kept at the timestamp of its sample.
+func RatePoints(points []model.SamplePair, window time.Duration) []model.SamplePair {
+	var rates []model.SamplePair
+	first := 0
+	for i := range points {
+		windowStart := points[i].Timestamp.Add(-window)
+		for first < i && !points[first].Timestamp.After(windowStart) {
+			first++
+		}
+		if i-first < 1 {
+			continue
+		}
+
+		var increase float64
+		for k := first + 1; k <= i; k++ {
+			delta := float64(points[k].Value - points[k-1].Value)
+			if delta < 0 {
+				delta = float64(points[k].Value)
+			}
+			increase += delta
+		}
+
+		elapsed := points[i].Timestamp.Sub(points[first].Timestamp).Seconds()
+		if elapsed <= 0 {
+			continue
+		}
+		rates = append(rates, model.SamplePair{Timestamp: points[i].Timestamp, Value: model.SampleValue(increase / elapsed)})
+	}
+	return rates
+}
+
+// Within returns the points whose timestamps satisfy contains.
+func Within(points []model.SamplePair, contains func(time.Time) bool) []model.SamplePair {
+	var out []model.SamplePair
+	for _, p := range points {
+		if contains(p.Timestamp.Time()) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// Quantile returns the q-quantile of values using the same linear
+// interpolation as PromQL's quantile_over_time. It returns NaN for no values.
+func Quantile(q float64, values []float64) float64 {
+	if len(values) == 0 {
+		return math.NaN()
+	}
+	if q < 0 {
+		return math.Inf(-1)
+	}
+	if q > 1 {
+		return math.Inf(1)
+	}
+
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+
+	rank := q * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	weight := rank - float64(lower)
+	return sorted[lower]*(1-weight) + sorted[upper]*weight
+}
+
+// Max returns the largest of values, or NaN for no values.
+func Max(values []float64) float64 {
+	if len(values) == 0 {
+		return math.NaN()
+	}
+	maxValue := values[0]
+	for _, v := range values[1:] {
+		if v > maxValue {
+			maxValue = v
+		}
+	}
+	return maxValue
+}
+
+// StdDev returns the population standard deviation of values, matching
+// PromQL's stddev_over_time. It returns NaN for no values.
+func StdDev(values []float64) float64 {
+	if len(values) == 0 {
+		return math.NaN()
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+
+	var squares float64
+	for _, v := range values {
+		squares += (v - mean) * (v - mean)
+	}
+	return math.Sqrt(squares / float64(len(values)))
+}
+
+// MaxOf applies reduce to every series and returns the largest finite result,
+// mirroring a PromQL max(...) across series. It returns NaN if no series
+// yields a finite value.
+func MaxOf(matrix model.Matrix, reduce func([]model.SamplePair) float64) float64 {
+	result := math.NaN()
+	for _, s := range matrix {
+		value := reduce(s.Values)
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			continue
+		}
+		if math.IsNaN(result) || value > result {
+			result = value
+		}
+	}
+	return result
+}
+
+// Coverage returns the time between the first and last sample across all
+// series and the number of distinct values of the "pod" label.
+func Coverage(matrix model.Matrix) (time.Duration, int) {
+	var first, last model.Time
+	pods := make(map[model.LabelValue]struct{})
+	for _, s := range matrix {
+		if len(s.Values) == 0 {
+			continue
+		}
+		pods[s.Metric["pod"]] = struct{}{}
+		if start := s.Values[0].Timestamp; first == 0 || start.Before(first) {
+			first = start
+		}
+		if end := s.Values[len(s.Values)-1].Timestamp; end.After(last) {
+			last = end
+		}
+	}
+	if len(pods) == 0 {
+		return 0, 0
+	}
+	return last.Sub(first), len(pods)
+}
+
+// Samples returns the number of samples across all series.
+func Samples(matrix model.Matrix) int {
+	var n int
+	for _, s := range matrix {
+		n += len(s.Values)
+	}
+	return n
+}
+
+// Gaps returns the total time during which no series had a sample, counting
+// only the part of each silence that exceeds the expected interval between
+// samples.
+func Gaps(matrix model.Matrix, interval time.Duration) time.Duration {
+	var timestamps []model.Time
+	for _, s := range matrix {
+		for _, p := range s.Values {
+			timestamps = append(timestamps, p.Timestamp)
+		}
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i].Before(timestamps[j]) })
+
+	var gaps time.Duration
+	for i := 1; i < len(timestamps); i++ {
+		if delta := timestamps[i].Sub(timestamps[i-1]); delta > interval {
+			gaps += delta - interval
+		}
+	}
+	return gaps
+}
+
+// Increase returns the total increase of a counter over the points. Counter
+// resets are handled like in Rate.
+func Increase(points []model.SamplePair) float64 {
+	var increase float64
+	for i := 1; i < len(points); i++ {
+		delta := float64(points[i].Value - points[i-1].Value)
+		if delta < 0 {
+			delta = float64(points[i].Value)
+		}
+		increase += delta
+	}
+	return increase
+}
+
+// TotalIncrease returns the sum of Increase over all series.
+func TotalIncrease(matrix model.Matrix) float64 {
+	var increase float64
+	for _, s := range matrix {
+		increase += Increase(s.Values)
+	}
+	return increase
+}
+
+// OOMKills pairs kube-state-metrics' restart counters with its
+// last_terminated_reason{reason="OOMKilled"} gauges: every restart at a step
+// where the pod's gauge is 1 was an OOM kill. Restarts before the first point
+// of a series can't be placed in time and are not reported. Kills are
+// returned oldest first.
+func OOMKills(restarts, reasons model.Matrix) []entity.OOMKill {
+	oomKilled := make(map[model.LabelValue]map[model.Time]bool)
+	for _, s := range reasons {
+		pod := s.Metric["pod"]
+		if oomKilled[pod] == nil {
+			oomKilled[pod] = make(map[model.Time]bool)
+		}
+		for _, p := range s.Values {
+			if p.Value == 1 {
+				oomKilled[pod][p.Timestamp] = true
+			}
+		}
+	}
+
+	var kills []entity.OOMKill
+	for _, s := range restarts {
+		pod := s.Metric["pod"]
+		for i := 1; i < len(s.Values); i++ {
+			if !oomKilled[pod][s.Values[i].Timestamp] {
+				continue
+			}
+			delta := s.Values[i].Value - s.Values[i-1].Value
+			if delta < 0 {
+				delta = s.Values[i].Value
+			}
+			for n := 0; n < int(delta); n++ {
+				kills = append(kills, entity.OOMKill{Pod: string(pod), Time: s.Values[i].Timestamp.Time().UTC(), Source: "metrics"})
+			}
+		}
+	}
+	sort.SliceStable(kills, func(i, j int) bool { return kills[i].Time.Before(kills[j].Time) })
+	return kills
+}
+
+// PreKillMemory returns the highest value across the matrix and the rate, in
+// units per second, at which its series grew up to that value. Samples after
+// the peak are ignored, since a killed container restarts with little memory.
+// ok is false if the matrix holds no samples.
+func PreKillMemory(matrix model.Matrix) (memory entity.PreKillMemory, ok bool) {
+	for _, s := range matrix {
+		peakIdx := -1
+		for i, p := range s.Values {
+			if peakIdx < 0 || p.Value > s.Values[peakIdx].Value {
+				peakIdx = i
+			}
+		}
+		if peakIdx < 0 {
+			continue
+		}
+		peak := float64(s.Values[peakIdx].Value)
+		if ok && peak <= memory.Peak {
+			continue
+		}
+		memory = entity.PreKillMemory{Peak: peak, GrowthRate: math.Max(Slope(s.Values[:peakIdx+1]), 0)}
+		ok = true
+	}
+	return memory, ok
+}
+
+// Slope returns the least-squares slope of the points in units per second,
+// or zero for fewer than two points.
+func Slope(points []model.SamplePair) float64 {
+	slope, _, _ := Regression(points)
+	return slope
+}
+
+// Regression fits a line to the points by least squares. It returns the
+// slope in units per second, the fitted value at the first point and the
+// coefficient of determination, which is 1 for a perfect fit and 0 for a fit
+// no better than the mean. Fewer than two points, or points at a single
+// time, give a flat line.
+func Regression(points []model.SamplePair) (slope, intercept, r2 float64) {
+	if len(points) == 0 {
+		return 0, 0, 0
+	}
+	t0 := points[0].Timestamp
+	var sumX, sumY float64
+	for _, p := range points {
+		sumX += p.Timestamp.Sub(t0).Seconds()
+		sumY += float64(p.Value)
+	}
+	n := float64(len(points))
+	meanX, meanY := sumX/n, sumY/n
+	var cov, varX, varY float64
+	for _, p := range points {
+		dx := p.Timestamp.Sub(t0).Seconds() - meanX
+		dy := float64(p.Value) - meanY
+		cov += dx * dy
+		varX += dx * dx
+		varY += dy * dy
+	}
+	if varX == 0 {
+		return 0, meanY, 0
+	}
+	slope = cov / varX
+	if varY > 0 {
+		r2 = cov * cov / (varX * varY)
+	}
+	return slope, meanY - slope*meanX, r2
+}
+
+// MemoryLifetimes fits a line to every series of the matrix with at least
+// two points, each series being one container instance.
+func MemoryLifetimes(matrix model.Matrix) []entity.MemoryLifetime {
+	var lifetimes []entity.MemoryLifetime
+	for _, s := range matrix {
+		if len(s.Values) < 2 {
+			continue
+		}
+		duration := s.Values[len(s.Values)-1].Timestamp.Sub(s.Values[0].Timestamp)
+		slope, intercept, r2 := Regression(s.Values)
+		var sum float64
+		for _, p := range s.Values {
+			sum += float64(p.Value)
+		}
+		lifetimes = append(lifetimes, entity.MemoryLifetime{
+			Pod:        string(s.Metric["pod"]),
+			Duration:   duration,
+			Samples:    len(s.Values),
+			Start:      intercept,
+			Mean:       sum / float64(len(s.Values)),
+			GrowthRate: slope,
+			R2:         r2,
+		})
+	}
+	return lifetimes
+}
+
+// WindowUsage computes the usage percentiles from the working set and CPU rate
+// samples that satisfy contains, taking the maximum across series. ok is
+// false if either matrix holds no such samples.
+func WindowUsage(memory, cpuRates model.Matrix, contains func(time.Time) bool) (usage entity.Usage, ok bool) {
+	quantile := func(matrix model.Matrix, q float64) float64 {
+		return MaxOf(matrix, func(points []model.SamplePair) float64 {
+			return Quantile(q, Values(Within(points, contains)))
+		})
+	}
+	usage = entity.Usage{
+		MemoryP99: quantile(memory, 0.99),
+		CPUP90:    quantile(cpuRates, 0.90),
+		CPUP99:    quantile(cpuRates, 0.99),
+	}
+	if math.IsNaN(usage.MemoryP99) || math.IsNaN(usage.CPUP90) || math.IsNaN(usage.CPUP99) {
+		return entity.Usage{}, false
+	}
+	return usage, true
+}
+
+// Sum adds up the series of the matrix at every timestamp, like a PromQL
+// sum(...) across series evaluated at aligned steps. Points are returned in
+// time order.
+func Sum(matrix model.Matrix) []model.SamplePair {
+	totals := make(map[model.Time]model.SampleValue)
+	for _, s := range matrix {
+		for _, p := range s.Values {
+			totals[p.Timestamp] += p.Value
+		}
+	}
+	points := make([]model.SamplePair, 0, len(totals))
+	for ts, v := range totals {
+		points = append(points, model.SamplePair{Timestamp: ts, Value: v})
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Timestamp.Before(points[j].Timestamp) })
+	return points
+}
+
+// SumBy adds up the series of the matrix that share the values of labels at
+// every timestamp, like a PromQL sum by (...). The resulting series carry
+// only those labels.
+func SumBy(matrix model.Matrix, labels ...model.LabelName) model.Matrix {
+	groups := make(map[model.Fingerprint]*model.SampleStream)
+	members := make(map[model.Fingerprint]model.Matrix)
+	for _, s := range matrix {
+		metric := model.Metric{}
+		for _, label := range labels {
+			if v, ok := s.Metric[label]; ok {
+				metric[label] = v
+			}
+		}
+		fp := metric.Fingerprint()
+		if _, ok := groups[fp]; !ok {
+			groups[fp] = &model.SampleStream{Metric: metric}
+		}
+		members[fp] = append(members[fp], s)
+	}
+	out := make(model.Matrix, 0, len(groups))
+	for fp, group := range groups {
+		group.Values = Sum(members[fp])
+		out = append(out, group)
+	}
+	sort.Sort(out)
+	return out
+}
+
+// UsageTrend fits lines to a workload's total memory and CPU usage. ok is
+// false unless both hold at least two points.
+func UsageTrend(memory, cpu []model.SamplePair) (trend entity.UsageTrend, ok bool) {
+	if len(memory) < 2 || len(cpu) < 2 {
+		return entity.UsageTrend{}, false
+	}
+	first := min(memory[0].Timestamp, cpu[0].Timestamp)
+	last := max(memory[len(memory)-1].Timestamp, cpu[len(cpu)-1].Timestamp)
+	return entity.UsageTrend{Span: last.Sub(first), Memory: fit(memory), CPU: fit(cpu)}, true
+}
+
+// fit returns the regression line of the points, evaluated at the last point.
+func fit(points []model.SamplePair) entity.Trend {
+	slope, intercept, r2 := Regression(points)
+	elapsed := points[len(points)-1].Timestamp.Sub(points[0].Timestamp).Seconds()
+	return entity.Trend{Current: intercept + slope*elapsed, GrowthRate: slope, R2: r2}
+}
+
+// ReplicaStats summarizes replica count samples across the matrix. ok is
+// false if the matrix holds no samples.
+func ReplicaStats(matrix model.Matrix) (stats entity.ReplicaStats, ok bool) {
+	var values []float64
+	for _, s := range matrix {
+		values = append(values, Values(s.Values)...)
+	}
+	if len(values) == 0 {
+		return entity.ReplicaStats{}, false
+	}
+	var sum float64
+	stats.Min = values[0]
+	for _, v := range values {
+		stats.Min = math.Min(stats.Min, v)
+		sum += v
+	}
+	stats.Max = Max(values)
+	stats.Mean = sum / float64(len(values))
+	return stats, true
+}
+
+// PodUsage computes the usage percentiles of every pod from its working set
+// and CPU rate samples, taking the maximum across a pod's series. Pods
+// missing from either matrix are left out. Pods are sorted by name.
+func PodUsage(memory, cpuRates model.Matrix) []entity.PodUsage {
+	perPod := func(matrix model.Matrix, q float64) map[string]float64 {
+		values := make(map[string]float64)
+		for _, s := range matrix {
+			pod := string(s.Metric["pod"])
+			v := Quantile(q, Values(s.Values))
+			if math.IsNaN(v) {
+				continue
+			}
+			if current, ok := values[pod]; !ok || v > current {
+				values[pod] = v
+			}
+		}
+		return values
+	}
+	return MergePodUsage(perPod(memory, 0.99), perPod(cpuRates, 0.50), perPod(cpuRates, 0.90), perPod(cpuRates, 0.99))
+}
+
+// MergePodUsage combines per-pod percentiles into the usage of every pod
+// present in all of them, sorted by pod name.
+func MergePodUsage(memoryP99, cpuP50, cpuP90, cpuP99 map[string]float64) []entity.PodUsage {
+	var pods []entity.PodUsage
+	for pod, memory := range memoryP99 {
+		p50, ok := cpuP50[pod]
+		p90, ok2 := cpuP90[pod]
+		p99, ok3 := cpuP99[pod]
+		if !ok || !ok2 || !ok3 {
+			continue
+		}
+		pods = append(pods, entity.PodUsage{Pod: pod, Usage: entity.Usage{MemoryP99: memory, CPUP90: p90, CPUP99: p99}, CPUP50: p50})
+	}
+	sort.Slice(pods, func(i, j int) bool { return pods[i].Pod < pods[j].Pod })
+	return pods
+}
+
+// InitCPUUsage summarizes the CPU counters of an init container, each series
+// being one run. A run's CPU time is its last counter value, since the
+// counter starts at zero, and it used CPU until the counter last rose. ok is
+// false if no run used any CPU.
+func InitCPUUsage(counters model.Matrix) (usage entity.InitCPUUsage, ok bool) {
+	for _, s := range counters {
+		if len(s.Values) == 0 {
+			continue
+		}
+		cpuSeconds := float64(s.Values[0].Value) + Increase(s.Values)
+		if cpuSeconds <= 0 {
+			continue
+		}
+		usage.Runs++
+		last := 0
+		for i := 1; i < len(s.Values); i++ {
+			dt := s.Values[i].Timestamp.Sub(s.Values[i-1].Timestamp).Seconds()
+			delta := float64(s.Values[i].Value - s.Values[i-1].Value)
+			if delta <= 0 || dt <= 0 {
+				continue
+			}
+			last = i
+			usage.PeakRate = max(usage.PeakRate, delta/dt)
+		}
+		if cpuSeconds > usage.CPUSeconds {
+			usage.CPUSeconds = cpuSeconds
+			usage.Duration = s.Values[last].Timestamp.Sub(s.Values[0].Timestamp)
+		}
+	}
+	return usage, usage.Runs > 0
+}
+
+// HugePagesUsage computes the hugepages usage of a container for every page
+// size from its max usage gauges and failure counters, taking the maximum
+// across series and summing failures. Page sizes are sorted.
+func HugePagesUsage(maxUsage, failcnt model.Matrix) []entity.HugePagesUsage {
+	peaks := MaxBy(maxUsage, "pagesize")
+	failures := make(map[string]float64)
+	for _, s := range failcnt {
+		failures[string(s.Metric["pagesize"])] += Increase(s.Values)
+	}
+	return MergeHugePagesUsage(peaks, failures)
+}
+
+// MergeHugePagesUsage combines the peak usage and failures of every page
+// size with a known peak, sorted by page size. Page sizes are normalized
+// from cAdvisor's pagesize labels, such as 2MB, to the quantities of
+// hugepages resource names, such as 2Mi.
+func MergeHugePagesUsage(peaks, failures map[string]float64) []entity.HugePagesUsage {
+	byPageSize := make(map[string]*entity.HugePagesUsage, len(peaks))
+	for label, peak := range peaks {
+		pageSize := normalizePageSize(label)
+		if u, ok := byPageSize[pageSize]; ok {
+			u.Peak = max(u.Peak, peak)
+			continue
+		}
+		byPageSize[pageSize] = &entity.HugePagesUsage{PageSize: pageSize, Peak: peak}
+	}
+	for label, failed := range failures {
+		if u, ok := byPageSize[normalizePageSize(label)]; ok {
+			u.Failures += failed
+		}
+	}
+	var usage []entity.HugePagesUsage
+	for _, u := range byPageSize {
+		usage = append(usage, *u)
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].PageSize < usage[j].PageSize })
+	return usage
+}
+
+// normalizePageSize turns a cAdvisor page size, which uses binary multiples
+// with decimal suffixes such as kB, MB and GB, into a quantity such as 2Mi.
+// Page sizes already in that form are kept.
+func normalizePageSize(label string) string {
+	size, ok := strings.CutSuffix(label, "B")
+	if !ok || size == "" {
+		return label
+	}
+	switch size[len(size)-1] {
+	case 'k', 'K':
+		return size[:len(size)-1] + "Ki"
+	case 'M', 'G', 'T', 'P':
+		return size + "i"
+	}
+	return label
+}
+
+// MaxBy returns the maximum value of the series for every value of a label.
+func MaxBy(matrix model.Matrix, label model.LabelName) map[string]float64 {
+	peaks := make(map[string]float64)
+	for _, s := range matrix {
+		v := Max(Values(s.Values))
+		if math.IsNaN(v) {
+			continue
+		}
+		key := string(s.Metric[label])
+		if peak, ok := peaks[key]; !ok || v > peak {
+			peaks[key] = v
+		}
+	}
+	return peaks
+}
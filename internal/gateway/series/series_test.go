@@ -0,0 +1,329 @@
+package series
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/sequring/sculptor/internal/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func points(step time.Duration, values ...float64) []model.SamplePair {
+	start := model.TimeFromUnix(1_700_000_000)
+	out := make([]model.SamplePair, 0, len(values))
+	for i, v := range values {
+		out = append(out, model.SamplePair{Timestamp: start.Add(time.Duration(i) * step), Value: model.SampleValue(v)})
+	}
+	return out
+}
+
+func TestQuantile(t *testing.T) {
+	values := []float64{4, 1, 3, 2, 5}
+
+	assert.Equal(t, 1.0, Quantile(0, values))
+	assert.Equal(t, 3.0, Quantile(0.5, values))
+	assert.Equal(t, 5.0, Quantile(1, values))
+	assert.InDelta(t, 4.96, Quantile(0.99, values), 1e-9)
+	assert.True(t, math.IsNaN(Quantile(0.5, nil)))
+	assert.Equal(t, []float64{4, 1, 3, 2, 5}, values, "input must not be reordered")
+}
+
+func TestRate(t *testing.T) {
+	// A counter growing by 30 every 30s is a steady rate of 1/s.
+	rates := Rate(points(30*time.Second, 0, 30, 60, 90, 120), 5*time.Minute)
+	assert.Len(t, rates, 4)
+	for _, r := range rates {
+		assert.InDelta(t, 1.0, r, 1e-9)
+	}
+
+	// A reset to 10 counts as an increase of 10.
+	rates = Rate(points(30*time.Second, 100, 130, 10), 5*time.Minute)
+	assert.InDelta(t, 40.0/60.0, rates[len(rates)-1], 1e-9)
+
+	// Samples further apart than the window produce no rate.
+	assert.Empty(t, Rate(points(10*time.Minute, 0, 600, 1200), 5*time.Minute))
+}
+
+func TestMaxAndStdDev(t *testing.T) {
+	values := []float64{2, 4, 4, 4, 5, 5, 7, 9}
+
+	assert.Equal(t, 9.0, Max(values))
+	assert.Equal(t, 2.0, StdDev(values))
+	assert.True(t, math.IsNaN(Max(nil)))
+	assert.True(t, math.IsNaN(StdDev(nil)))
+}
+
+func TestValuesAndBetween(t *testing.T) {
+	pts := points(time.Minute, 1, math.NaN(), 3, math.Inf(1), 5)
+
+	assert.Equal(t, []float64{1, 3, 5}, Values(pts))
+
+	start := pts[1].Timestamp.Time()
+	end := pts[3].Timestamp.Time()
+	assert.Len(t, Between(pts, start, end), 3)
+}
+
+func TestSamplesAndGaps(t *testing.T) {
+	// Two pods scraped every minute; the second pod's first sample comes 10
+	// minutes after the first pod's last one.
+	first := points(time.Minute, 1, 1, 1)
+	second := points(time.Minute, 1, 1)
+	for i := range second {
+		second[i].Timestamp = second[i].Timestamp.Add(12 * time.Minute)
+	}
+	matrix := model.Matrix{{Values: first}, {Values: second}}
+
+	assert.Equal(t, 5, Samples(matrix))
+	assert.Equal(t, 9*time.Minute, Gaps(matrix, time.Minute))
+	assert.Equal(t, 5*time.Minute, Gaps(matrix, 5*time.Minute))
+	assert.Zero(t, Gaps(nil, time.Minute))
+}
+
+func TestIncrease(t *testing.T) {
+	assert.Equal(t, 2.0, Increase(points(time.Minute, 3, 4, 5)))
+	// A reset to 1 counts as an increase of 1.
+	assert.Equal(t, 2.0, Increase(points(time.Minute, 3, 4, 1)))
+	assert.Zero(t, Increase(nil))
+
+	matrix := model.Matrix{{Values: points(time.Minute, 0, 2)}, {Values: points(time.Minute, 5, 6)}}
+	assert.Equal(t, 3.0, TotalIncrease(matrix))
+}
+
+func TestOOMKills(t *testing.T) {
+	restarts := model.Matrix{
+		{Metric: model.Metric{"pod": "api-1"}, Values: points(time.Minute, 0, 1, 1, 3)},
+		{Metric: model.Metric{"pod": "api-2"}, Values: points(time.Minute, 0, 0, 1, 1)},
+	}
+	// api-1 was OOMKilled at the 2nd and 4th points; api-2's restart was not
+	// an OOM kill.
+	reasons := model.Matrix{
+		{Metric: model.Metric{"pod": "api-1"}, Values: points(time.Minute, 0, 1, 0, 1)},
+	}
+
+	kills := OOMKills(restarts, reasons)
+
+	start := time.Unix(1_700_000_000, 0).UTC()
+	assert.Equal(t, []entity.OOMKill{
+		{Pod: "api-1", Time: start.Add(time.Minute), Source: "metrics"},
+		{Pod: "api-1", Time: start.Add(3 * time.Minute), Source: "metrics"},
+		{Pod: "api-1", Time: start.Add(3 * time.Minute), Source: "metrics"},
+	}, kills)
+	assert.Empty(t, OOMKills(restarts, nil))
+}
+
+func TestMaxBy(t *testing.T) {
+	matrix := model.Matrix{
+		{Metric: model.Metric{"pod": "api-1", "area": "heap"}, Values: points(time.Minute, 100, 300, 200)},
+		{Metric: model.Metric{"pod": "api-2", "area": "heap"}, Values: points(time.Minute, 250)},
+		{Metric: model.Metric{"pod": "api-1", "area": "nonheap"}, Values: points(time.Minute, 50, 60)},
+	}
+
+	assert.Equal(t, map[string]float64{"heap": 300, "nonheap": 60}, MaxBy(matrix, "area"))
+	assert.Empty(t, MaxBy(nil, "area"))
+}
+
+func TestHugePagesUsage(t *testing.T) {
+	maxUsage := model.Matrix{
+		{Metric: model.Metric{"pod": "api-1", "pagesize": "2MB"}, Values: points(time.Minute, 10, 40, 20)},
+		{Metric: model.Metric{"pod": "api-2", "pagesize": "2MB"}, Values: points(time.Minute, 30, 50)},
+		{Metric: model.Metric{"pod": "api-1", "pagesize": "1GB"}, Values: points(time.Minute, 0, 0)},
+	}
+	failcnt := model.Matrix{
+		{Metric: model.Metric{"pod": "api-1", "pagesize": "2MB"}, Values: points(time.Minute, 0, 2)},
+		{Metric: model.Metric{"pod": "api-2", "pagesize": "2MB"}, Values: points(time.Minute, 1, 2)},
+	}
+
+	usage := HugePagesUsage(maxUsage, failcnt)
+
+	assert.Equal(t, []entity.HugePagesUsage{
+		{PageSize: "1Gi", Peak: 0},
+		{PageSize: "2Mi", Peak: 50, Failures: 3},
+	}, usage)
+	assert.Empty(t, HugePagesUsage(nil, failcnt))
+}
+
+func TestNormalizePageSize(t *testing.T) {
+	assert.Equal(t, "64Ki", normalizePageSize("64kB"))
+	assert.Equal(t, "2Mi", normalizePageSize("2MB"))
+	assert.Equal(t, "1Gi", normalizePageSize("1GB"))
+	assert.Equal(t, "2Mi", normalizePageSize("2Mi"))
+}
+
+func TestSlope(t *testing.T) {
+	assert.InDelta(t, 1.0/60, Slope(points(time.Minute, 10, 11, 12, 13)), 1e-12)
+	assert.Zero(t, Slope(points(time.Minute, 10)))
+}
+
+func TestPreKillMemory(t *testing.T) {
+	matrix := model.Matrix{
+		// Grows by 60 per minute up to the kill, then restarts low.
+		{Values: points(time.Minute, 100, 160, 220, 280, 10)},
+		{Values: points(time.Minute, 50, 50)},
+	}
+
+	memory, ok := PreKillMemory(matrix)
+
+	assert.True(t, ok)
+	assert.Equal(t, 280.0, memory.Peak)
+	assert.InDelta(t, 1.0, memory.GrowthRate, 1e-9)
+	_, ok = PreKillMemory(nil)
+	assert.False(t, ok)
+}
+
+func TestRegression(t *testing.T) {
+	slope, intercept, r2 := Regression(points(time.Minute, 10, 12, 14, 16))
+	assert.InDelta(t, 2.0/60, slope, 1e-12)
+	assert.InDelta(t, 10, intercept, 1e-9)
+	assert.InDelta(t, 1, r2, 1e-12)
+
+	// A flat, noisy series has no trend.
+	slope, _, r2 = Regression(points(time.Minute, 10, 12, 10, 12))
+	assert.InDelta(t, 0, slope*60, 0.5)
+	assert.Less(t, r2, 0.5)
+}
+
+func TestMemoryLifetimes(t *testing.T) {
+	matrix := model.Matrix{
+		{Metric: model.Metric{"pod": "api-1"}, Values: points(time.Hour, 100, 200, 300, 400)},
+		// A single point can't be fitted.
+		{Metric: model.Metric{"pod": "api-2"}, Values: points(time.Hour, 100)},
+	}
+
+	lifetimes := MemoryLifetimes(matrix)
+
+	if assert.Len(t, lifetimes, 1) {
+		assert.Equal(t, "api-1", lifetimes[0].Pod)
+		assert.Equal(t, 3*time.Hour, lifetimes[0].Duration)
+		assert.Equal(t, 4, lifetimes[0].Samples)
+		assert.InDelta(t, 100, lifetimes[0].Start, 1e-9)
+		assert.InDelta(t, 250, lifetimes[0].Mean, 1e-9)
+		assert.InDelta(t, 100.0/3600, lifetimes[0].GrowthRate, 1e-12)
+	}
+}
+
+func TestWindowUsage(t *testing.T) {
+	memory := model.Matrix{{Metric: model.Metric{"pod": "api-1"}, Values: points(time.Hour, 100, 900, 950, 200)}}
+	cpu := model.Matrix{{Metric: model.Metric{"pod": "api-1"}, Values: points(time.Hour, 0.1, 0.8, 0.8, 0.2)}}
+	start := model.TimeFromUnix(1_700_000_000).Time()
+	inPeak := func(t time.Time) bool { return !t.Before(start.Add(time.Hour)) && t.Before(start.Add(3*time.Hour)) }
+
+	peak, ok := WindowUsage(memory, cpu, inPeak)
+
+	assert.True(t, ok)
+	assert.InDelta(t, 949.5, peak.MemoryP99, 1e-9)
+	assert.InDelta(t, 0.8, peak.CPUP90, 1e-9)
+
+	offPeak, ok := WindowUsage(memory, cpu, func(t time.Time) bool { return !inPeak(t) })
+
+	assert.True(t, ok)
+	assert.InDelta(t, 199, offPeak.MemoryP99, 1e-9)
+
+	_, ok = WindowUsage(memory, cpu, func(time.Time) bool { return false })
+
+	assert.False(t, ok)
+}
+
+func TestSum(t *testing.T) {
+	matrix := model.Matrix{
+		{Metric: model.Metric{"pod": "api-1"}, Values: points(time.Minute, 1, 2, 3)},
+		{Metric: model.Metric{"pod": "api-2"}, Values: points(time.Minute, 10, 20)},
+	}
+
+	assert.Equal(t, []float64{11, 22, 3}, Values(Sum(matrix)))
+	assert.Empty(t, Sum(nil))
+}
+
+func TestSumBy(t *testing.T) {
+	matrix := model.Matrix{
+		{Metric: model.Metric{"pod": "api-1", "device": "/dev/sda"}, Values: points(time.Minute, 1, 2)},
+		{Metric: model.Metric{"pod": "api-1", "device": "/dev/sdb"}, Values: points(time.Minute, 10, 20)},
+		{Metric: model.Metric{"pod": "api-2", "device": "/dev/sda"}, Values: points(time.Minute, 5)},
+	}
+
+	sums := SumBy(matrix, "pod")
+
+	if !assert.Len(t, sums, 2) {
+		return
+	}
+	assert.Equal(t, model.Metric{"pod": "api-1"}, sums[0].Metric)
+	assert.Equal(t, []float64{11, 22}, Values(sums[0].Values))
+	assert.Equal(t, model.Metric{"pod": "api-2"}, sums[1].Metric)
+	assert.Equal(t, []float64{5}, Values(sums[1].Values))
+	assert.Empty(t, SumBy(nil, "pod"))
+}
+
+func TestUsageTrend(t *testing.T) {
+	memory := points(time.Hour, 100, 110, 120, 130)
+	cpu := points(time.Hour, 1, 1, 1, 1)
+
+	trend, ok := UsageTrend(memory, cpu)
+
+	assert.True(t, ok)
+	assert.Equal(t, 3*time.Hour, trend.Span)
+	assert.InDelta(t, 130, trend.Memory.Current, 1e-9)
+	assert.InDelta(t, 10.0/3600, trend.Memory.GrowthRate, 1e-12)
+	assert.InDelta(t, 1, trend.Memory.R2, 1e-9)
+	assert.InDelta(t, 1, trend.CPU.Current, 1e-9)
+	assert.Zero(t, trend.CPU.GrowthRate)
+
+	_, ok = UsageTrend(memory[:1], cpu)
+
+	assert.False(t, ok)
+}
+
+func TestReplicaStats(t *testing.T) {
+	matrix := model.Matrix{{Metric: model.Metric{"deployment": "api"}, Values: points(time.Minute, 2, 4, 6, 4)}}
+
+	stats, ok := ReplicaStats(matrix)
+
+	assert.True(t, ok)
+	assert.Equal(t, entity.ReplicaStats{Min: 2, Max: 6, Mean: 4}, stats)
+
+	_, ok = ReplicaStats(nil)
+
+	assert.False(t, ok)
+}
+
+func TestPodUsage(t *testing.T) {
+	memory := model.Matrix{
+		{Metric: model.Metric{"pod": "api-2"}, Values: points(time.Minute, 200, 200)},
+		// A restarted container has a second series in the same pod.
+		{Metric: model.Metric{"pod": "api-1"}, Values: points(time.Minute, 100, 100)},
+		{Metric: model.Metric{"pod": "api-1"}, Values: points(time.Minute, 150, 150)},
+		{Metric: model.Metric{"pod": "api-3"}, Values: points(time.Minute, 300)},
+	}
+	cpu := model.Matrix{
+		{Metric: model.Metric{"pod": "api-1"}, Values: points(time.Minute, 1, 1)},
+		{Metric: model.Metric{"pod": "api-2"}, Values: points(time.Minute, 2, 2)},
+	}
+
+	pods := PodUsage(memory, cpu)
+
+	assert.Equal(t, []entity.PodUsage{
+		{Pod: "api-1", Usage: entity.Usage{MemoryP99: 150, CPUP90: 1, CPUP99: 1}, CPUP50: 1},
+		{Pod: "api-2", Usage: entity.Usage{MemoryP99: 200, CPUP90: 2, CPUP99: 2}, CPUP50: 2},
+	}, pods)
+}
+
+func TestInitCPUUsage(t *testing.T) {
+	counters := model.Matrix{
+		// Uses 30s of CPU over two minutes, then idles until it is gone.
+		{Metric: model.Metric{"pod": "api-1"}, Values: points(time.Minute, 6, 24, 36, 36, 36)},
+		// Finished before its second sample.
+		{Metric: model.Metric{"pod": "api-2"}, Values: points(time.Minute, 12)},
+		{Metric: model.Metric{"pod": "api-3"}, Values: points(time.Minute, 0, 0)},
+	}
+
+	usage, ok := InitCPUUsage(counters)
+
+	assert.True(t, ok)
+	assert.Equal(t, 2, usage.Runs)
+	assert.InDelta(t, 36, usage.CPUSeconds, 1e-9)
+	assert.Equal(t, 2*time.Minute, usage.Duration)
+	assert.InDelta(t, 0.3, usage.PeakRate, 1e-9)
+
+	_, ok = InitCPUUsage(model.Matrix{counters[2]})
+	assert.False(t, ok)
+}
@@ -0,0 +1,140 @@
+package snapshot
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/common/model"
+)
+
+// parseOpenMetrics reads an OpenMetrics (or Prometheus text) exposition dump
+// and groups its samples into series. Every sample must carry a timestamp,
+// since a dump without one cannot be placed on the analysis time range.
+// OpenMetrics timestamps are seconds; Prometheus text timestamps are
+// milliseconds and are recognised by their magnitude.
+func parseOpenMetrics(r io.Reader) (model.Matrix, int, error) {
+	streams := make(map[model.Fingerprint]*model.SampleStream)
+	var order []model.Fingerprint
+	skipped := 0
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		metric, rest, err := parseSeriesName(line)
+		if err != nil {
+			return nil, 0, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+
+		// Drop an exemplar, if any.
+		if idx := strings.Index(rest, " # "); idx >= 0 {
+			rest = rest[:idx]
+		}
+		fields := strings.Fields(rest)
+		if len(fields) < 2 {
+			skipped++
+			continue
+		}
+
+		value, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return nil, 0, fmt.Errorf("line %d: invalid sample value %q: %w", lineNo, fields[0], err)
+		}
+		ts, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, 0, fmt.Errorf("line %d: invalid timestamp %q: %w", lineNo, fields[1], err)
+		}
+		if ts > 1e11 {
+			ts /= 1000
+		}
+
+		fp := metric.Fingerprint()
+		stream, ok := streams[fp]
+		if !ok {
+			stream = &model.SampleStream{Metric: metric}
+			streams[fp] = stream
+			order = append(order, fp)
+		}
+		stream.Values = append(stream.Values, model.SamplePair{
+			Timestamp: model.TimeFromUnixNano(int64(ts * 1e9)),
+			Value:     model.SampleValue(value),
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	matrix := make(model.Matrix, 0, len(order))
+	for _, fp := range order {
+		matrix = append(matrix, streams[fp])
+	}
+	return matrix, skipped, nil
+}
+
+// parseSeriesName splits `name{label="value",...} rest` into its metric and
+// the remaining text.
+func parseSeriesName(line string) (model.Metric, string, error) {
+	metric := model.Metric{}
+
+	end := strings.IndexAny(line, "{ ")
+	if end < 0 {
+		return nil, "", fmt.Errorf("missing sample value")
+	}
+	metric[model.MetricNameLabel] = model.LabelValue(line[:end])
+	if line[end] == ' ' {
+		return metric, line[end:], nil
+	}
+
+	i := end + 1
+	for {
+		for i < len(line) && (line[i] == ' ' || line[i] == ',') {
+			i++
+		}
+		if i >= len(line) {
+			return nil, "", fmt.Errorf("unterminated label set")
+		}
+		if line[i] == '}' {
+			return metric, line[i+1:], nil
+		}
+
+		eq := strings.IndexByte(line[i:], '=')
+		if eq < 0 {
+			return nil, "", fmt.Errorf("malformed label at offset %d", i)
+		}
+		name := strings.TrimSpace(line[i : i+eq])
+		i += eq + 1
+		if i >= len(line) || line[i] != '"' {
+			return nil, "", fmt.Errorf("label %q has no quoted value", name)
+		}
+		i++
+
+		var value strings.Builder
+		for ; i < len(line) && line[i] != '"'; i++ {
+			if line[i] == '\\' && i+1 < len(line) {
+				i++
+				switch line[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(line[i])
+				}
+				continue
+			}
+			value.WriteByte(line[i])
+		}
+		if i >= len(line) {
+			return nil, "", fmt.Errorf("unterminated value for label %q", name)
+		}
+		i++
+		metric[model.LabelName(name)] = model.LabelValue(value.String())
+	}
+}
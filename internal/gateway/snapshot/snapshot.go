@@ -0,0 +1,765 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/sequring/sculptor/internal/entity"
+	"github.com/sequring/sculptor/internal/gateway/k8s"
+	"github.com/sequring/sculptor/internal/gateway/series"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	v1 "k8s.io/api/core/v1"
+	nodev1 "k8s.io/api/node/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	memoryWorkingSetMetric = "container_memory_working_set_bytes"
+	memoryMaxUsageMetric   = "container_memory_max_usage_bytes"
+	cpuUsageMetric         = "container_cpu_usage_seconds_total"
+	restartsMetric         = "kube_pod_container_status_restarts_total"
+	terminatedReasonMetric = "kube_pod_container_status_last_terminated_reason"
+	cfsThrottledMetric     = "container_cpu_cfs_throttled_periods_total"
+	cfsPeriodsMetric       = "container_cpu_cfs_periods_total"
+	fsUsageMetric          = "container_fs_usage_bytes"
+	logUsageMetric         = "kubelet_container_log_filesystem_used_bytes"
+	jvmMemoryUsedMetric    = "jvm_memory_used_bytes"
+	hugetlbMaxUsageMetric  = "container_hugetlb_max_usage_bytes"
+	hugetlbFailcntMetric   = "container_hugetlb_failcnt"
+	replicasMetric         = "kube_deployment_status_replicas"
+	cpuRateWindow          = 5 * time.Minute
+	manifestFile           = "manifest.json"
+)
+
+// gapInterval matches Prometheus' lookback period: silences shorter than this
+// are not counted as gaps.
+const gapInterval = 5 * time.Minute
+
+// Gateway serves a Deployment manifest and previously exported metrics from
+// disk, so recommendations can be computed without cluster or Prometheus
+// access. It implements both usecase.DeploymentGateway and
+// usecase.MetricsGateway.
+type Gateway struct {
+	deployment *appsv1.Deployment
+	pods       []v1.Pod
+	events     []v1.Event
+	manifest   *entity.BundleManifest
+	series     model.Matrix
+	end        time.Time
+	logger     *slog.Logger
+
+	hpas           []autoscalingv2.HorizontalPodAutoscaler
+	runtimeClasses []nodev1.RuntimeClass
+	nodes          []v1.Node
+	limitRanges    []v1.LimitRange
+	quotas         []v1.ResourceQuota
+	// captured records the kinds of the lists loaded, telling an empty list
+	// apart from one the snapshot doesn't hold.
+	captured map[string]bool
+}
+
+// queryRangeResponse is the body returned by Prometheus' /api/v1/query_range.
+type queryRangeResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	Data   struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+// NewGateway loads a snapshot directory or a .tar.gz bundle written by the
+// export command. Files are recognised by extension: .yaml/.yml/.json
+// manifests of kind Deployment, PodList, EventList,
+// HorizontalPodAutoscalerList, RuntimeClassList, NodeList, LimitRangeList or
+// ResourceQuotaList, other .json files as
+// query_range responses and .txt/.om/.prom files as OpenMetrics dumps. A
+// bundle manifest.json, if present, fixes the end of the analysis range.
+func NewGateway(path string, logger *slog.Logger) (*Gateway, error) {
+	g := &Gateway{logger: logger, captured: make(map[string]bool)}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	if info.IsDir() {
+		err = g.loadDir(path)
+	} else {
+		err = g.loadArchive(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if g.deployment == nil {
+		return nil, fmt.Errorf("snapshot %s contains no Deployment manifest", path)
+	}
+
+	if g.manifest != nil && !g.manifest.End.IsZero() {
+		g.end = g.manifest.End
+	} else {
+		for _, s := range g.series {
+			if len(s.Values) == 0 {
+				continue
+			}
+			if last := s.Values[len(s.Values)-1].Timestamp.Time(); last.After(g.end) {
+				g.end = last
+			}
+		}
+	}
+
+	logger.Info("Loaded metrics snapshot", "path", path, "deployment", g.deployment.Name, "series", len(g.series), "end", g.end.UTC().Format(time.RFC3339))
+	return g, nil
+}
+
+func (g *Gateway) loadDir(dir string) error {
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if err := g.load(p, data); err != nil {
+			return fmt.Errorf("failed to load %s: %w", p, err)
+		}
+		return nil
+	})
+}
+
+func (g *Gateway) loadArchive(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("snapshot %s is neither a directory nor a .tar.gz bundle: %w", path, err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read bundle %s: %w", path, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return fmt.Errorf("failed to read %s from bundle: %w", header.Name, err)
+		}
+		if err := g.load(header.Name, data); err != nil {
+			return fmt.Errorf("failed to load %s: %w", header.Name, err)
+		}
+	}
+}
+
+func (g *Gateway) load(path string, data []byte) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return g.loadManifest(path, data)
+	case ".json":
+		if filepath.Base(path) == manifestFile {
+			var manifest entity.BundleManifest
+			if err := json.Unmarshal(data, &manifest); err != nil {
+				return err
+			}
+			g.manifest = &manifest
+			return nil
+		}
+		var typeMeta metav1.TypeMeta
+		if err := json.Unmarshal(data, &typeMeta); err == nil && typeMeta.Kind != "" {
+			return g.loadManifest(path, data)
+		}
+		return g.loadQueryRange(data)
+	case ".txt", ".om", ".prom":
+		matrix, skipped, err := parseOpenMetrics(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		if skipped > 0 {
+			g.logger.Warn("Skipped OpenMetrics samples without a timestamp", "file", path, "count", skipped)
+		}
+		g.series = append(g.series, matrix...)
+		return nil
+	default:
+		g.logger.Debug("Ignoring unrecognised snapshot file", "file", path)
+		return nil
+	}
+}
+
+func (g *Gateway) loadManifest(path string, data []byte) error {
+	var typeMeta metav1.TypeMeta
+	if err := yaml.Unmarshal(data, &typeMeta); err != nil {
+		return err
+	}
+	switch typeMeta.Kind {
+	case "Deployment":
+	case "PodList":
+		var pods v1.PodList
+		if err := yaml.Unmarshal(data, &pods); err != nil {
+			return err
+		}
+		g.pods = append(g.pods, pods.Items...)
+		return nil
+	case "EventList":
+		var events v1.EventList
+		if err := yaml.Unmarshal(data, &events); err != nil {
+			return err
+		}
+		g.events = append(g.events, events.Items...)
+		return nil
+	case "HorizontalPodAutoscalerList":
+		var hpas autoscalingv2.HorizontalPodAutoscalerList
+		if err := yaml.Unmarshal(data, &hpas); err != nil {
+			return err
+		}
+		g.hpas = append(g.hpas, hpas.Items...)
+		g.captured[typeMeta.Kind] = true
+		return nil
+	case "RuntimeClassList":
+		var runtimeClasses nodev1.RuntimeClassList
+		if err := yaml.Unmarshal(data, &runtimeClasses); err != nil {
+			return err
+		}
+		g.runtimeClasses = append(g.runtimeClasses, runtimeClasses.Items...)
+		g.captured[typeMeta.Kind] = true
+		return nil
+	case "NodeList":
+		var nodes v1.NodeList
+		if err := yaml.Unmarshal(data, &nodes); err != nil {
+			return err
+		}
+		g.nodes = append(g.nodes, nodes.Items...)
+		g.captured[typeMeta.Kind] = true
+		return nil
+	case "LimitRangeList":
+		var limitRanges v1.LimitRangeList
+		if err := yaml.Unmarshal(data, &limitRanges); err != nil {
+			return err
+		}
+		g.limitRanges = append(g.limitRanges, limitRanges.Items...)
+		g.captured[typeMeta.Kind] = true
+		return nil
+	case "ResourceQuotaList":
+		var quotas v1.ResourceQuotaList
+		if err := yaml.Unmarshal(data, &quotas); err != nil {
+			return err
+		}
+		g.quotas = append(g.quotas, quotas.Items...)
+		g.captured[typeMeta.Kind] = true
+		return nil
+	default:
+		g.logger.Debug("Ignoring unsupported manifest", "file", path, "kind", typeMeta.Kind)
+		return nil
+	}
+	if g.deployment != nil {
+		return fmt.Errorf("snapshot contains more than one Deployment manifest")
+	}
+
+	var d appsv1.Deployment
+	if err := yaml.Unmarshal(data, &d); err != nil {
+		return err
+	}
+	g.deployment = &d
+	return nil
+}
+
+func (g *Gateway) loadQueryRange(data []byte) error {
+	var resp queryRangeResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return err
+	}
+	if resp.Status != "success" {
+		return fmt.Errorf("query_range response has status %q: %s", resp.Status, resp.Error)
+	}
+	if resp.Data.ResultType != model.ValMatrix.String() {
+		return fmt.Errorf("unsupported result type %q, expected matrix", resp.Data.ResultType)
+	}
+
+	var matrix model.Matrix
+	if err := json.Unmarshal(resp.Data.Result, &matrix); err != nil {
+		return err
+	}
+	g.series = append(g.series, matrix...)
+	return nil
+}
+
+func (g *Gateway) GetDeployment(ctx context.Context, namespace, name string) (*appsv1.Deployment, error) {
+	if g.deployment.Name != name || (g.deployment.Namespace != "" && g.deployment.Namespace != namespace) {
+		return nil, errors.NewNotFound(appsv1.Resource("deployments"), name)
+	}
+	d := g.deployment.DeepCopy()
+	d.Namespace = namespace
+	return d, nil
+}
+
+// ListOOMKills replays the OOM kills of each container recorded in the pod
+// statuses and OOMKilled events captured in an export bundle, within the time
+// range ending at the end of the snapshot. Snapshots without pods or events
+// report no OOM kills.
+func (g *Gateway) ListOOMKills(ctx context.Context, d *appsv1.Deployment, containerNames []string, timeRange string) (map[string]entity.ContainerOOMKills, error) {
+	duration, err := model.ParseDuration(timeRange)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time range %q: %w", timeRange, err)
+	}
+	since := g.end.Add(-time.Duration(duration))
+	kills := make(map[string]entity.ContainerOOMKills, len(containerNames))
+	for _, name := range containerNames {
+		containerKills, currentLimit := k8s.OOMKills(g.pods, g.events, name, since)
+		kills[name] = entity.ContainerOOMKills{Kills: containerKills, CurrentLimit: currentLimit}
+	}
+	return kills, nil
+}
+
+// ListStorageEvictions replays the ephemeral storage evictions of each
+// container recorded in the pod statuses captured in an export bundle, within
+// the time range ending at the end of the snapshot.
+func (g *Gateway) ListStorageEvictions(ctx context.Context, d *appsv1.Deployment, containerNames []string, timeRange string) (map[string]entity.ContainerStorageEvictions, error) {
+	duration, err := model.ParseDuration(timeRange)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time range %q: %w", timeRange, err)
+	}
+	since := g.end.Add(-time.Duration(duration))
+	evictions := make(map[string]entity.ContainerStorageEvictions, len(containerNames))
+	for _, name := range containerNames {
+		containerEvictions, currentLimit := k8s.StorageEvictions(g.pods, g.events, name, since)
+		evictions[name] = entity.ContainerStorageEvictions{Evictions: containerEvictions, CurrentLimit: currentLimit}
+	}
+	return evictions, nil
+}
+
+// GetHorizontalPodAutoscaler returns the captured HorizontalPodAutoscaler
+// that scales the Deployment, or nil if none does.
+func (g *Gateway) GetHorizontalPodAutoscaler(ctx context.Context, d *appsv1.Deployment) (*autoscalingv2.HorizontalPodAutoscaler, error) {
+	if !g.captured["HorizontalPodAutoscalerList"] {
+		return nil, notCaptured("HorizontalPodAutoscalers")
+	}
+	for i, hpa := range g.hpas {
+		ref := hpa.Spec.ScaleTargetRef
+		if ref.Kind == "Deployment" && ref.Name == d.Name {
+			return &g.hpas[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// GetRuntimeClass returns the captured RuntimeClass with the given name.
+func (g *Gateway) GetRuntimeClass(ctx context.Context, name string) (*nodev1.RuntimeClass, error) {
+	if !g.captured["RuntimeClassList"] {
+		return nil, notCaptured("RuntimeClasses")
+	}
+	for i, runtimeClass := range g.runtimeClasses {
+		if runtimeClass.Name == name {
+			return &g.runtimeClasses[i], nil
+		}
+	}
+	return nil, errors.NewNotFound(nodev1.Resource("runtimeclasses"), name)
+}
+
+// ListNodes returns the captured nodes. The export already kept only the
+// nodes the pod template can be scheduled on, and recommendations don't
+// change where a pod can run.
+func (g *Gateway) ListNodes(ctx context.Context, spec *v1.PodSpec) ([]v1.Node, error) {
+	if !g.captured["NodeList"] {
+		return nil, notCaptured("nodes")
+	}
+	return g.nodes, nil
+}
+
+// ListLimitRanges returns the captured LimitRanges.
+func (g *Gateway) ListLimitRanges(ctx context.Context, namespace string) ([]v1.LimitRange, error) {
+	if !g.captured["LimitRangeList"] {
+		return nil, notCaptured("LimitRanges")
+	}
+	return g.limitRanges, nil
+}
+
+// ListResourceQuotas returns the captured ResourceQuotas.
+func (g *Gateway) ListResourceQuotas(ctx context.Context, namespace string) ([]v1.ResourceQuota, error) {
+	if !g.captured["ResourceQuotaList"] {
+		return nil, notCaptured("ResourceQuotas")
+	}
+	return g.quotas, nil
+}
+
+// notCaptured reports cluster objects the snapshot doesn't hold, so the
+// checks that need them say they were skipped instead of passing.
+func notCaptured(kind string) error {
+	return fmt.Errorf("%s are not available offline: the snapshot doesn't capture them", kind)
+}
+
+func (g *Gateway) GetMemoryMetrics(ctx context.Context, ns, deploymentName, containerName, timeRange string) (float64, error) {
+	return g.aggregate("P99 Memory Usage", memoryWorkingSetMetric, ns, deploymentName, containerName, timeRange, func(points []model.SamplePair) float64 {
+		return series.Quantile(0.99, series.Values(points))
+	})
+}
+
+func (g *Gateway) GetMemoryRequestMetrics(ctx context.Context, ns, deploymentName, containerName, timeRange string) (float64, error) {
+	return g.aggregate("P95 Memory Usage", memoryWorkingSetMetric, ns, deploymentName, containerName, timeRange, func(points []model.SamplePair) float64 {
+		return series.Quantile(0.95, series.Values(points))
+	})
+}
+
+func (g *Gateway) GetCPURequestMetrics(ctx context.Context, ns, deploymentName, containerName, timeRange string) (float64, error) {
+	return g.aggregate("P90 CPU for Request", cpuUsageMetric, ns, deploymentName, containerName, timeRange, func(points []model.SamplePair) float64 {
+		return series.Quantile(0.90, series.Rate(points, cpuRateWindow))
+	})
+}
+
+func (g *Gateway) GetCPULimitMetrics(ctx context.Context, ns, deploymentName, containerName, timeRange string) (float64, error) {
+	return g.aggregate("P99 CPU for Limit", cpuUsageMetric, ns, deploymentName, containerName, timeRange, func(points []model.SamplePair) float64 {
+		return series.Quantile(0.99, series.Rate(points, cpuRateWindow))
+	})
+}
+
+func (g *Gateway) GetCPUMedianMetrics(ctx context.Context, ns, deploymentName, containerName, timeRange string) (float64, error) {
+	return g.aggregate("P50 CPU for Spikiness", cpuUsageMetric, ns, deploymentName, containerName, timeRange, func(points []model.SamplePair) float64 {
+		return series.Quantile(0.50, series.Rate(points, cpuRateWindow))
+	})
+}
+
+// GetCPUThrottlingMetrics returns the share of CFS periods in which the
+// container was throttled over the time range.
+func (g *Gateway) GetCPUThrottlingMetrics(ctx context.Context, ns, deploymentName, containerName, timeRange string) (float64, error) {
+	throttled, err := g.selectSeries(cfsThrottledMetric, ns, deploymentName, containerName, timeRange)
+	if err != nil {
+		return 0, err
+	}
+	periods, err := g.selectSeries(cfsPeriodsMetric, ns, deploymentName, containerName, timeRange)
+	if err != nil {
+		return 0, err
+	}
+	total := series.TotalIncrease(periods)
+	if total == 0 {
+		g.logger.Info("Snapshot has no data for query", "queryName", "CPU Throttling", "container", containerName)
+		return 0, fmt.Errorf("CPU Throttling query for container %s: %w", containerName, entity.ErrNoData)
+	}
+	return series.TotalIncrease(throttled) / total, nil
+}
+
+func (g *Gateway) GetInitContainerMemoryMetrics(ctx context.Context, ns, deploymentName, containerName, timeRange string) (float64, error) {
+	return g.aggregate("Max Memory Usage for Init Container", memoryMaxUsageMetric, ns, deploymentName, containerName, timeRange, func(points []model.SamplePair) float64 {
+		return series.Max(series.Values(points))
+	})
+}
+
+// GetInitContainerCPU summarizes the CPU counters of every run of an init
+// container captured in the snapshot.
+func (g *Gateway) GetInitContainerCPU(ctx context.Context, ns, deploymentName, containerName, timeRange string) (*entity.InitCPUUsage, error) {
+	matched, err := g.selectSeries(cpuUsageMetric, ns, deploymentName, containerName, timeRange)
+	if err != nil {
+		return nil, err
+	}
+	usage, ok := series.InitCPUUsage(matched)
+	if !ok {
+		g.logger.Info("Snapshot has no data for query", "queryName", "Init Container CPU", "container", containerName)
+		return nil, fmt.Errorf("Init Container CPU query for container %s: %w", containerName, entity.ErrNoData)
+	}
+	return &usage, nil
+}
+
+// GetDataQuality reports the span and pod count of the working-set samples
+// captured for a container.
+func (g *Gateway) GetDataQuality(ctx context.Context, ns, deploymentName, containerName, timeRange string) (*entity.DataQuality, error) {
+	matched, err := g.selectSeries(memoryWorkingSetMetric, ns, deploymentName, containerName, timeRange)
+	if err != nil {
+		return nil, err
+	}
+	span, pods := series.Coverage(matched)
+	if pods == 0 {
+		return nil, fmt.Errorf("data coverage query for container %s: %w", containerName, entity.ErrNoData)
+	}
+	return &entity.DataQuality{
+		Span:    span,
+		Pods:    pods,
+		Samples: series.Samples(matched),
+		Gaps:    series.Gaps(matched, gapInterval),
+	}, nil
+}
+
+// GetRestarts returns the restarts of a container recorded by
+// kube-state-metrics in the snapshot, or entity.ErrNoData if it holds no
+// restart counters.
+func (g *Gateway) GetRestarts(ctx context.Context, ns, deploymentName, containerName, timeRange string) (float64, error) {
+	restarts, err := g.selectSeries(restartsMetric, ns, deploymentName, containerName, timeRange)
+	if err != nil {
+		return 0, err
+	}
+	if len(restarts) == 0 {
+		return 0, fmt.Errorf("restarts query for container %s: %w", containerName, entity.ErrNoData)
+	}
+	return series.TotalIncrease(restarts), nil
+}
+
+// GetOOMKills returns the OOM kills recorded by kube-state-metrics in the
+// snapshot, or entity.ErrNoData if it holds no restart counters.
+func (g *Gateway) GetOOMKills(ctx context.Context, ns, deploymentName, containerName, timeRange string) ([]entity.OOMKill, error) {
+	restarts, err := g.selectSeries(restartsMetric, ns, deploymentName, containerName, timeRange)
+	if err != nil {
+		return nil, err
+	}
+	if len(restarts) == 0 {
+		g.logger.Info("Snapshot has no data for query", "queryName", "Container Restarts", "container", containerName)
+		return nil, fmt.Errorf("OOM kills query for container %s: %w", containerName, entity.ErrNoData)
+	}
+	terminations, err := g.selectSeries(terminatedReasonMetric, ns, deploymentName, containerName, timeRange)
+	if err != nil {
+		return nil, err
+	}
+	var reasons model.Matrix
+	for _, s := range terminations {
+		if s.Metric["reason"] == "OOMKilled" {
+			reasons = append(reasons, s)
+		}
+	}
+	return series.OOMKills(restarts, reasons), nil
+}
+
+// GetPreKillMemory returns the working set of the killed container in the
+// window before an OOM kill.
+func (g *Gateway) GetPreKillMemory(ctx context.Context, ns, deploymentName, containerName string, kill entity.OOMKill, window time.Duration) (*entity.PreKillMemory, error) {
+	var matched model.Matrix
+	for _, s := range g.series {
+		if matches(s.Metric, memoryWorkingSetMetric, ns, deploymentName, containerName) && string(s.Metric["pod"]) == kill.Pod {
+			matched = append(matched, &model.SampleStream{Metric: s.Metric, Values: series.Between(s.Values, kill.Time.Add(-window), kill.Time)})
+		}
+	}
+	memory, ok := series.PreKillMemory(matched)
+	if !ok {
+		g.logger.Info("Snapshot has no data for query", "queryName", "Memory Before OOM Kill", "container", containerName, "pod", kill.Pod)
+		return nil, fmt.Errorf("memory before OOM kill of pod %s for container %s: %w", kill.Pod, containerName, entity.ErrNoData)
+	}
+	return &memory, nil
+}
+
+// GetMemoryLifetimes fits a line to the working set of every container
+// instance captured in the snapshot.
+func (g *Gateway) GetMemoryLifetimes(ctx context.Context, ns, deploymentName, containerName, timeRange string) ([]entity.MemoryLifetime, error) {
+	matched, err := g.selectSeries(memoryWorkingSetMetric, ns, deploymentName, containerName, timeRange)
+	if err != nil {
+		return nil, err
+	}
+	lifetimes := series.MemoryLifetimes(matched)
+	if len(lifetimes) == 0 {
+		g.logger.Info("Snapshot has no data for query", "queryName", "Memory Trend", "container", containerName)
+		return nil, fmt.Errorf("Memory Trend query for container %s: %w", containerName, entity.ErrNoData)
+	}
+	return lifetimes, nil
+}
+
+// GetWindowUsage returns the usage percentiles over the samples inside the
+// recurring window, or outside it if inside is false.
+func (g *Gateway) GetWindowUsage(ctx context.Context, ns, deploymentName, containerName, timeRange string, window entity.TimeWindow, inside bool) (*entity.Usage, error) {
+	memory, err := g.selectSeries(memoryWorkingSetMetric, ns, deploymentName, containerName, timeRange)
+	if err != nil {
+		return nil, err
+	}
+	counters, err := g.selectSeries(cpuUsageMetric, ns, deploymentName, containerName, timeRange)
+	if err != nil {
+		return nil, err
+	}
+	cpu := make(model.Matrix, 0, len(counters))
+	for _, s := range counters {
+		cpu = append(cpu, &model.SampleStream{Metric: s.Metric, Values: series.RatePoints(s.Values, cpuRateWindow)})
+	}
+	usage, ok := series.WindowUsage(memory, cpu, func(t time.Time) bool { return window.Contains(t) == inside })
+	if !ok {
+		g.logger.Info("Snapshot has no data for query", "queryName", "Window Usage", "container", containerName)
+		return nil, fmt.Errorf("Window Usage query for container %s: %w", containerName, entity.ErrNoData)
+	}
+	return &usage, nil
+}
+
+// GetPodUsage returns the usage percentiles of the container in every pod
+// over the time range.
+func (g *Gateway) GetPodUsage(ctx context.Context, ns, deploymentName, containerName, timeRange string) ([]entity.PodUsage, error) {
+	memory, err := g.selectSeries(memoryWorkingSetMetric, ns, deploymentName, containerName, timeRange)
+	if err != nil {
+		return nil, err
+	}
+	counters, err := g.selectSeries(cpuUsageMetric, ns, deploymentName, containerName, timeRange)
+	if err != nil {
+		return nil, err
+	}
+	cpu := make(model.Matrix, 0, len(counters))
+	for _, s := range counters {
+		cpu = append(cpu, &model.SampleStream{Metric: s.Metric, Values: series.RatePoints(s.Values, cpuRateWindow)})
+	}
+	pods := series.PodUsage(memory, cpu)
+	if len(pods) == 0 {
+		g.logger.Info("Snapshot has no data for query", "queryName", "Per-Pod Usage", "container", containerName)
+		return nil, fmt.Errorf("Per-Pod Usage query for container %s: %w", containerName, entity.ErrNoData)
+	}
+	return pods, nil
+}
+
+// GetUsageTrend fits lines to the workload's total working set and CPU usage
+// over the part of the time range the snapshot covers.
+func (g *Gateway) GetUsageTrend(ctx context.Context, ns, deploymentName, containerName, timeRange string) (*entity.UsageTrend, error) {
+	memory, err := g.selectSeries(memoryWorkingSetMetric, ns, deploymentName, containerName, timeRange)
+	if err != nil {
+		return nil, err
+	}
+	counters, err := g.selectSeries(cpuUsageMetric, ns, deploymentName, containerName, timeRange)
+	if err != nil {
+		return nil, err
+	}
+	cpu := make(model.Matrix, 0, len(counters))
+	for _, s := range counters {
+		cpu = append(cpu, &model.SampleStream{Metric: s.Metric, Values: series.RatePoints(s.Values, cpuRateWindow)})
+	}
+	trend, ok := series.UsageTrend(series.Sum(memory), series.Sum(cpu))
+	if !ok {
+		g.logger.Info("Snapshot has no data for query", "queryName", "Usage Trend", "container", containerName)
+		return nil, fmt.Errorf("Usage Trend query for container %s: %w", containerName, entity.ErrNoData)
+	}
+	return &trend, nil
+}
+
+// GetEphemeralStorageMetrics returns the peak ephemeral storage a container
+// used: its writable layer and its logs, summed per pod.
+func (g *Gateway) GetEphemeralStorageMetrics(ctx context.Context, ns, deploymentName, containerName, timeRange string) (float64, error) {
+	fsUsage, err := g.selectSeries(fsUsageMetric, ns, deploymentName, containerName, timeRange)
+	if err != nil {
+		return 0, err
+	}
+	logUsage, err := g.selectSeries(logUsageMetric, ns, deploymentName, containerName, timeRange)
+	if err != nil {
+		return 0, err
+	}
+	result := series.MaxOf(series.SumBy(append(fsUsage, logUsage...), "pod"), func(points []model.SamplePair) float64 {
+		return series.Max(series.Values(points))
+	})
+	if math.IsNaN(result) {
+		g.logger.Info("Snapshot has no data for query", "queryName", "Max Ephemeral Storage", "container", containerName)
+		return 0, fmt.Errorf("Max Ephemeral Storage query for container %s: %w", containerName, entity.ErrNoData)
+	}
+	return result, nil
+}
+
+// GetJVMMemory returns the peak heap and non-heap memory a container's JVM
+// reported in use, summing the memory pools of each area per pod.
+func (g *Gateway) GetJVMMemory(ctx context.Context, ns, deploymentName, containerName, timeRange string) (*entity.JVMMemory, error) {
+	matched, err := g.selectSeries(jvmMemoryUsedMetric, ns, deploymentName, containerName, timeRange)
+	if err != nil {
+		return nil, err
+	}
+	peaks := series.MaxBy(series.SumBy(matched, "pod", "area"), "area")
+	heap, ok := peaks["heap"]
+	if !ok {
+		g.logger.Info("Snapshot has no data for query", "queryName", "JVM Memory", "container", containerName)
+		return nil, fmt.Errorf("JVM Memory query for container %s: %w", containerName, entity.ErrNoData)
+	}
+	return &entity.JVMMemory{Heap: heap, NonHeap: peaks["nonheap"]}, nil
+}
+
+// GetHugePagesUsage returns the peak hugepages usage and allocation failures
+// of a container for every page size captured in the snapshot.
+func (g *Gateway) GetHugePagesUsage(ctx context.Context, ns, deploymentName, containerName, timeRange string) ([]entity.HugePagesUsage, error) {
+	maxUsage, err := g.selectSeries(hugetlbMaxUsageMetric, ns, deploymentName, containerName, timeRange)
+	if err != nil {
+		return nil, err
+	}
+	failcnt, err := g.selectSeries(hugetlbFailcntMetric, ns, deploymentName, containerName, timeRange)
+	if err != nil {
+		return nil, err
+	}
+	usage := series.HugePagesUsage(maxUsage, failcnt)
+	if len(usage) == 0 {
+		g.logger.Info("Snapshot has no data for query", "queryName", "Hugepages Usage", "container", containerName)
+		return nil, fmt.Errorf("Hugepages Usage query for container %s: %w", containerName, entity.ErrNoData)
+	}
+	return usage, nil
+}
+
+// GetReplicaStats returns the replica counts of the Deployment recorded by
+// kube-state-metrics in the snapshot.
+func (g *Gateway) GetReplicaStats(ctx context.Context, ns, deploymentName, timeRange string) (*entity.ReplicaStats, error) {
+	duration, err := model.ParseDuration(timeRange)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time range %q: %w", timeRange, err)
+	}
+	start := g.end.Add(-time.Duration(duration))
+
+	var matched model.Matrix
+	for _, s := range g.series {
+		if string(s.Metric[model.MetricNameLabel]) == replicasMetric && string(s.Metric["namespace"]) == ns && string(s.Metric["deployment"]) == deploymentName {
+			matched = append(matched, &model.SampleStream{Metric: s.Metric, Values: series.Between(s.Values, start, g.end)})
+		}
+	}
+	stats, ok := series.ReplicaStats(matched)
+	if !ok {
+		g.logger.Info("Snapshot has no data for query", "queryName", "Deployment Replicas", "deployment", deploymentName)
+		return nil, fmt.Errorf("replica count query for deployment %s: %w", deploymentName, entity.ErrNoData)
+	}
+	return &stats, nil
+}
+
+// aggregate applies reduce to every matching series within the time range,
+// ending at the newest sample in the snapshot, and returns the maximum across
+// series. This mirrors the max(...) wrapping of the live Prometheus queries.
+func (g *Gateway) aggregate(queryName, metricName, ns, deploymentName, containerName, timeRange string, reduce func([]model.SamplePair) float64) (float64, error) {
+	matched, err := g.selectSeries(metricName, ns, deploymentName, containerName, timeRange)
+	if err != nil {
+		return 0, err
+	}
+
+	result := series.MaxOf(matched, reduce)
+	if math.IsNaN(result) {
+		g.logger.Info("Snapshot has no data for query", "queryName", queryName, "container", containerName)
+		return 0, fmt.Errorf("%s query for container %s: %w", queryName, containerName, entity.ErrNoData)
+	}
+	return result, nil
+}
+
+// selectSeries returns the series of a metric for one container, trimmed to
+// the time range ending at the end of the snapshot.
+func (g *Gateway) selectSeries(metricName, ns, deploymentName, containerName, timeRange string) (model.Matrix, error) {
+	duration, err := model.ParseDuration(timeRange)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time range %q: %w", timeRange, err)
+	}
+	start := g.end.Add(-time.Duration(duration))
+
+	var matched model.Matrix
+	for _, s := range g.series {
+		if !matches(s.Metric, metricName, ns, deploymentName, containerName) {
+			continue
+		}
+		matched = append(matched, &model.SampleStream{Metric: s.Metric, Values: series.Between(s.Values, start, g.end)})
+	}
+	return matched, nil
+}
+
+func matches(metric model.Metric, metricName, ns, deploymentName, containerName string) bool {
+	return string(metric[model.MetricNameLabel]) == metricName &&
+		string(metric["namespace"]) == ns &&
+		strings.HasPrefix(string(metric["pod"]), deploymentName+"-") &&
+		string(metric["container"]) == containerName
+}
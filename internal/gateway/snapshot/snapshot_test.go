@@ -0,0 +1,396 @@
+package snapshot
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sequring/sculptor/internal/entity"
+	"github.com/sequring/sculptor/internal/presenter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const testDeployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: api
+  namespace: prod
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+`
+
+func newTestLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+}
+
+// queryRangeJSON builds a query_range response for one series with a value
+// per minute.
+func queryRangeJSON(metric, pod string, values ...float64) string {
+	var pairs []string
+	for i, v := range values {
+		pairs = append(pairs, fmt.Sprintf(`[%d,"%g"]`, 1_700_000_000+i*60, v))
+	}
+	return fmt.Sprintf(`{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"__name__":%q,"namespace":"prod","pod":%q,"container":"app"},"values":[%s]}]}}`,
+		metric, pod, strings.Join(pairs, ","))
+}
+
+// labeledQueryRangeJSON is queryRangeJSON for a series with extra labels.
+func labeledQueryRangeJSON(metric, pod string, labels map[string]string, values ...float64) string {
+	var pairs []string
+	for i, v := range values {
+		pairs = append(pairs, fmt.Sprintf(`[%d,"%g"]`, 1_700_000_000+i*60, v))
+	}
+	var extra string
+	for name, value := range labels {
+		extra += fmt.Sprintf(`,%q:%q`, name, value)
+	}
+	return fmt.Sprintf(`{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"__name__":%q,"namespace":"prod","pod":%q,"container":"app"%s},"values":[%s]}]}}`,
+		metric, pod, extra, strings.Join(pairs, ","))
+}
+
+func TestNewGateway(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "deployment.yaml", testDeployment)
+	writeFile(t, dir, "metrics/memory.json", queryRangeJSON(memoryWorkingSetMetric, "api-1", 100, 200, 300))
+
+	g, err := NewGateway(dir, newTestLogger())
+	require.NoError(t, err)
+
+	d, err := g.GetDeployment(context.Background(), "prod", "api")
+	require.NoError(t, err)
+	assert.Equal(t, "app", d.Spec.Template.Spec.Containers[0].Name)
+
+	_, err = g.GetDeployment(context.Background(), "prod", "other")
+	assert.Error(t, err)
+}
+
+func TestNewGateway_MissingDeployment(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "memory.json", queryRangeJSON(memoryWorkingSetMetric, "api-1", 100))
+
+	_, err := NewGateway(dir, newTestLogger())
+	assert.ErrorContains(t, err, "contains no Deployment manifest")
+}
+
+func TestGateway_MetricsFromQueryRange(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "deployment.yaml", testDeployment)
+	writeFile(t, dir, "memory-1.json", queryRangeJSON(memoryWorkingSetMetric, "api-1", 100, 200, 300))
+	writeFile(t, dir, "memory-2.json", queryRangeJSON(memoryWorkingSetMetric, "api-2", 50, 50, 50))
+	writeFile(t, dir, "other.json", queryRangeJSON(memoryWorkingSetMetric, "worker-1", 9000, 9000, 9000))
+	// A counter rising by 30 per minute is 0.5 cores.
+	writeFile(t, dir, "cpu.json", queryRangeJSON(cpuUsageMetric, "api-1", 0, 30, 60, 90, 120))
+
+	g, err := NewGateway(dir, newTestLogger())
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	mem, err := g.GetMemoryMetrics(ctx, "prod", "api", "app", "1h")
+	require.NoError(t, err)
+	assert.InDelta(t, 298, mem, 1e-9)
+
+	cpu, err := g.GetCPULimitMetrics(ctx, "prod", "api", "app", "1h")
+	require.NoError(t, err)
+	assert.InDelta(t, 0.5, cpu, 1e-9)
+
+	_, err = g.GetInitContainerMemoryMetrics(ctx, "prod", "api", "app", "1h")
+	assert.ErrorIs(t, err, entity.ErrNoData)
+
+	_, err = g.GetMemoryMetrics(ctx, "prod", "api", "app", "soon")
+	assert.Error(t, err)
+}
+
+func TestGateway_GetDataQuality(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "deployment.yaml", testDeployment)
+	writeFile(t, dir, "memory-1.json", queryRangeJSON(memoryWorkingSetMetric, "api-1", 100, 200, 300))
+	// api-2 reports at minutes 10 and 11, leaving a silence of 8 minutes after
+	// api-1's last sample at minute 2.
+	writeFile(t, dir, "memory-2.json", `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"__name__":"container_memory_working_set_bytes","namespace":"prod","pod":"api-2","container":"app"},"values":[[1700000600,"50"],[1700000660,"50"]]}]}}`)
+	writeFile(t, dir, "restarts.json", queryRangeJSON(restartsMetric, "api-1", 0, 1, 1, 2))
+
+	g, err := NewGateway(dir, newTestLogger())
+	require.NoError(t, err)
+
+	quality, err := g.GetDataQuality(context.Background(), "prod", "api", "app", "1h")
+	require.NoError(t, err)
+	assert.Equal(t, &entity.DataQuality{
+		Span:    11 * time.Minute,
+		Pods:    2,
+		Samples: 5,
+		Gaps:    3 * time.Minute,
+	}, quality)
+
+	restarts, err := g.GetRestarts(context.Background(), "prod", "api", "app", "1h")
+	require.NoError(t, err)
+	assert.Equal(t, 2.0, restarts)
+}
+
+func TestGateway_GetEphemeralStorageMetrics(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "deployment.yaml", testDeployment)
+	writeFile(t, dir, "fs-1.json", queryRangeJSON(fsUsageMetric, "api-1", 100, 300, 200))
+	writeFile(t, dir, "logs-1.json", queryRangeJSON(logUsageMetric, "api-1", 50, 50, 150))
+	writeFile(t, dir, "fs-2.json", queryRangeJSON(fsUsageMetric, "api-2", 320, 0, 0))
+
+	g, err := NewGateway(dir, newTestLogger())
+	require.NoError(t, err)
+
+	// api-1 peaks at 350 (300 + 50) and api-2 at 320.
+	storage, err := g.GetEphemeralStorageMetrics(context.Background(), "prod", "api", "app", "1h")
+	require.NoError(t, err)
+	assert.Equal(t, 350.0, storage)
+
+	_, err = g.GetEphemeralStorageMetrics(context.Background(), "prod", "api", "sidecar", "1h")
+	assert.ErrorIs(t, err, entity.ErrNoData)
+}
+
+func TestGateway_GetJVMMemory(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "deployment.yaml", testDeployment)
+	writeFile(t, dir, "eden.json", labeledQueryRangeJSON(jvmMemoryUsedMetric, "api-1", map[string]string{"area": "heap", "id": "G1 Eden Space"}, 100, 400))
+	writeFile(t, dir, "old.json", labeledQueryRangeJSON(jvmMemoryUsedMetric, "api-1", map[string]string{"area": "heap", "id": "G1 Old Gen"}, 500, 300))
+	writeFile(t, dir, "metaspace.json", labeledQueryRangeJSON(jvmMemoryUsedMetric, "api-1", map[string]string{"area": "nonheap", "id": "Metaspace"}, 80, 90))
+
+	g, err := NewGateway(dir, newTestLogger())
+	require.NoError(t, err)
+
+	// The heap pools add up to 600 and 700 per pod.
+	jvm, err := g.GetJVMMemory(context.Background(), "prod", "api", "app", "1h")
+	require.NoError(t, err)
+	assert.Equal(t, &entity.JVMMemory{Heap: 700, NonHeap: 90}, jvm)
+
+	_, err = g.GetJVMMemory(context.Background(), "prod", "api", "sidecar", "1h")
+	assert.ErrorIs(t, err, entity.ErrNoData)
+}
+
+func TestGateway_GetHugePagesUsage(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "deployment.yaml", testDeployment)
+	writeFile(t, dir, "hugetlb-usage.json", labeledQueryRangeJSON(hugetlbMaxUsageMetric, "api-1", map[string]string{"pagesize": "2MB"}, 0, 64<<20, 32<<20))
+	writeFile(t, dir, "hugetlb-failcnt.json", labeledQueryRangeJSON(hugetlbFailcntMetric, "api-1", map[string]string{"pagesize": "2MB"}, 0, 1, 3))
+
+	g, err := NewGateway(dir, newTestLogger())
+	require.NoError(t, err)
+
+	usage, err := g.GetHugePagesUsage(context.Background(), "prod", "api", "app", "1h")
+	require.NoError(t, err)
+	assert.Equal(t, []entity.HugePagesUsage{{PageSize: "2Mi", Peak: 64 << 20, Failures: 3}}, usage)
+
+	_, err = g.GetHugePagesUsage(context.Background(), "prod", "api", "sidecar", "1h")
+	assert.ErrorIs(t, err, entity.ErrNoData)
+}
+
+func TestGateway_GetCPUThrottlingMetrics(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "deployment.yaml", testDeployment)
+	writeFile(t, dir, "periods.json", queryRangeJSON(cfsPeriodsMetric, "api-1", 0, 600, 1200))
+	writeFile(t, dir, "throttled.json", queryRangeJSON(cfsThrottledMetric, "api-1", 0, 150, 300))
+
+	g, err := NewGateway(dir, newTestLogger())
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	ratio, err := g.GetCPUThrottlingMetrics(ctx, "prod", "api", "app", "1h")
+	require.NoError(t, err)
+	assert.InDelta(t, 0.25, ratio, 1e-9)
+
+	_, err = g.GetCPUThrottlingMetrics(ctx, "prod", "other", "app", "1h")
+	assert.ErrorIs(t, err, entity.ErrNoData)
+}
+
+func TestGateway_GetOOMKills(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "deployment.yaml", testDeployment)
+	writeFile(t, dir, "ksm.om", `kube_pod_container_status_restarts_total{namespace="prod",pod="api-1",container="app"} 0 1700000000
+kube_pod_container_status_restarts_total{namespace="prod",pod="api-1",container="app"} 1 1700000060
+kube_pod_container_status_restarts_total{namespace="prod",pod="api-1",container="app"} 2 1700000120
+kube_pod_container_status_last_terminated_reason{namespace="prod",pod="api-1",container="app",reason="OOMKilled"} 1 1700000060
+kube_pod_container_status_last_terminated_reason{namespace="prod",pod="api-1",container="app",reason="Error"} 1 1700000120
+# EOF
+`)
+
+	g, err := NewGateway(dir, newTestLogger())
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	kills, err := g.GetOOMKills(ctx, "prod", "api", "app", "1h")
+	require.NoError(t, err)
+	assert.Equal(t, []entity.OOMKill{{Pod: "api-1", Time: time.Unix(1700000060, 0).UTC(), Source: "metrics"}}, kills)
+
+	_, err = g.GetOOMKills(ctx, "prod", "other", "app", "1h")
+	assert.ErrorIs(t, err, entity.ErrNoData)
+}
+
+func TestGateway_MetricsFromOpenMetrics(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "deployment.yaml", testDeployment)
+	writeFile(t, dir, "dump.om", `# TYPE container_memory_max_usage_bytes gauge
+container_memory_max_usage_bytes{namespace="prod",pod="api-1",container="app"} 1024 1700000000
+container_memory_max_usage_bytes{namespace="prod",pod="api-1",container="app"} 4096 1700000060.5 # {trace_id="abc"} 1
+container_memory_max_usage_bytes{namespace="prod",pod="api-1",container="app"} 2048 1700000120000
+container_memory_max_usage_bytes{namespace="prod",pod="api-1",container="app"} 8192
+# EOF
+`)
+
+	g, err := NewGateway(dir, newTestLogger())
+	require.NoError(t, err)
+
+	value, err := g.GetInitContainerMemoryMetrics(context.Background(), "prod", "api", "app", "1h")
+	require.NoError(t, err)
+	assert.Equal(t, 4096.0, value)
+}
+
+func TestParseOpenMetrics_Labels(t *testing.T) {
+	matrix, skipped, err := parseOpenMetrics(strings.NewReader(`up{job="a\"b",instance="x,y"} 1 1700000000` + "\n"))
+	require.NoError(t, err)
+	assert.Equal(t, 0, skipped)
+	require.Len(t, matrix, 1)
+	assert.Equal(t, `a"b`, string(matrix[0].Metric["job"]))
+	assert.Equal(t, "x,y", string(matrix[0].Metric["instance"]))
+
+	_, _, err = parseOpenMetrics(strings.NewReader(`up{job="a" 1 1700000000` + "\n"))
+	assert.Error(t, err)
+}
+
+func TestNewGateway_ExportBundleRoundTrip(t *testing.T) {
+	end := time.Unix(1_700_000_000+10*60, 0).UTC()
+	limit := resource.MustParse("256Mi")
+	bundle := &entity.Bundle{
+		Manifest: entity.BundleManifest{
+			SculptorVersion: "test",
+			CreatedAt:       end,
+			Namespace:       "prod",
+			Deployment:      "api",
+			TimeRange:       "1h",
+			End:             end,
+			Uncaptured:      []string{entity.BundleResourceQuotas},
+		},
+		Deployment: &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "prod"},
+			Spec: appsv1.DeploymentSpec{
+				Template: v1.PodTemplateSpec{
+					Spec: v1.PodSpec{Containers: []v1.Container{{Name: "app"}}},
+				},
+			},
+		},
+		Pods: []v1.Pod{{
+			ObjectMeta: metav1.ObjectMeta{Name: "api-1"},
+			Spec: v1.PodSpec{Containers: []v1.Container{{
+				Name:      "app",
+				Resources: v1.ResourceRequirements{Limits: v1.ResourceList{v1.ResourceMemory: limit}},
+			}}},
+		}},
+		Events: []v1.Event{{
+			Reason:         "OOMKilled",
+			InvolvedObject: v1.ObjectReference{Kind: "Pod", Name: "api-1"},
+		}},
+		Series: []entity.RawSeries{{
+			Container: "app",
+			Metric:    memoryWorkingSetMetric,
+			Data:      []byte(queryRangeJSON(memoryWorkingSetMetric, "api-1", 100, 200, 300)),
+		}, {
+			Metric: replicasMetric,
+			Data:   []byte(`{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"__name__":"kube_deployment_status_replicas","namespace":"prod","deployment":"api"},"values":[[1700000000,"2"],[1700000060,"4"]]}]}}`),
+		}},
+		HPA: &autoscalingv2.HorizontalPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{Name: "api"},
+			Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+				ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{Kind: "Deployment", Name: "api"},
+				MaxReplicas:    10,
+			},
+		},
+		Nodes: []v1.Node{{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}}},
+	}
+
+	path := filepath.Join(t.TempDir(), "api-bundle.tar.gz")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	require.NoError(t, presenter.NewBundlePresenter(f).Render(bundle))
+	require.NoError(t, f.Close())
+
+	g, err := NewGateway(path, newTestLogger())
+	require.NoError(t, err)
+	assert.Equal(t, end, g.end)
+	require.NotNil(t, g.manifest)
+	assert.Equal(t, "metrics/app/container_memory_working_set_bytes.json", g.manifest.Queries[0].File)
+
+	ctx := context.Background()
+	d, err := g.GetDeployment(ctx, "prod", "api")
+	require.NoError(t, err)
+
+	kills, err := g.ListOOMKills(ctx, d, []string{"app"}, "1h")
+	require.NoError(t, err)
+	require.Len(t, kills["app"].Kills, 1)
+	assert.Equal(t, "api-1", kills["app"].Kills[0].Pod)
+	assert.Equal(t, "event", kills["app"].Kills[0].Source)
+	assert.Equal(t, 0, kills["app"].CurrentLimit.Cmp(limit))
+
+	mem, err := g.GetMemoryMetrics(ctx, "prod", "api", "app", "1h")
+	require.NoError(t, err)
+	assert.InDelta(t, 298, mem, 1e-9)
+
+	hpa, err := g.GetHorizontalPodAutoscaler(ctx, d)
+	require.NoError(t, err)
+	require.NotNil(t, hpa)
+	assert.Equal(t, int32(10), hpa.Spec.MaxReplicas)
+
+	replicas, err := g.GetReplicaStats(ctx, "prod", "api", "1h")
+	require.NoError(t, err)
+	assert.Equal(t, 4.0, replicas.Max)
+
+	nodes, err := g.ListNodes(ctx, &d.Spec.Template.Spec)
+	require.NoError(t, err)
+	assert.Len(t, nodes, 1)
+
+	limitRanges, err := g.ListLimitRanges(ctx, "prod")
+	require.NoError(t, err)
+	assert.Empty(t, limitRanges)
+
+	_, err = g.GetRuntimeClass(ctx, "kata")
+	assert.Error(t, err)
+
+	_, err = g.ListResourceQuotas(ctx, "prod")
+	assert.ErrorContains(t, err, "not available offline")
+}
+
+func TestGateway_ClusterObjectsNotCaptured(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "deployment.yaml", testDeployment)
+
+	g, err := NewGateway(dir, newTestLogger())
+	require.NoError(t, err)
+	ctx := context.Background()
+	d, err := g.GetDeployment(ctx, "prod", "api")
+	require.NoError(t, err)
+
+	_, err = g.GetHorizontalPodAutoscaler(ctx, d)
+	assert.ErrorContains(t, err, "not available offline")
+	_, err = g.ListNodes(ctx, &d.Spec.Template.Spec)
+	assert.ErrorContains(t, err, "not available offline")
+	_, err = g.ListLimitRanges(ctx, "prod")
+	assert.ErrorContains(t, err, "not available offline")
+	_, err = g.GetReplicaStats(ctx, "prod", "api", "1h")
+	assert.ErrorIs(t, err, entity.ErrNoData)
+}
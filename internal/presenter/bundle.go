@@ -0,0 +1,142 @@
+package presenter
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"time"
+
+	"github.com/sequring/sculptor/internal/entity"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	v1 "k8s.io/api/core/v1"
+	nodev1 "k8s.io/api/node/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Bundle file layout, as read back by the snapshot gateway.
+const (
+	bundleManifestFile       = "manifest.json"
+	bundleDeploymentFile     = "deployment.yaml"
+	bundlePodsFile           = "pods.yaml"
+	bundleEventsFile         = "events.yaml"
+	bundleHPAFile            = "hpa.yaml"
+	bundleRuntimeClassesFile = "runtimeclasses.yaml"
+	bundleNodesFile          = "nodes.yaml"
+	bundleLimitRangesFile    = "limitranges.yaml"
+	bundleQuotasFile         = "resourcequotas.yaml"
+	bundleMetricsDir         = "metrics"
+)
+
+// BundlePresenter writes an export bundle as a gzip-compressed tar archive.
+type BundlePresenter struct {
+	writer io.Writer
+}
+
+func NewBundlePresenter(writer io.Writer) *BundlePresenter {
+	return &BundlePresenter{writer: writer}
+}
+
+func (p *BundlePresenter) Render(b *entity.Bundle) error {
+	gz := gzip.NewWriter(p.writer)
+	tw := tar.NewWriter(gz)
+	modTime := b.Manifest.CreatedAt
+
+	manifest := b.Manifest
+	manifest.Queries = nil
+	for _, s := range b.Series {
+		file := path.Join(bundleMetricsDir, s.Container, s.Metric+".json")
+		if err := writeTarFile(tw, file, s.Data, modTime); err != nil {
+			return err
+		}
+		manifest.Queries = append(manifest.Queries, entity.BundleQuery{
+			Container: s.Container,
+			Metric:    s.Metric,
+			Query:     s.Query,
+			File:      file,
+		})
+	}
+
+	deployment := b.Deployment.DeepCopy()
+	deployment.TypeMeta = metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"}
+	pods := &v1.PodList{TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "PodList"}, Items: b.Pods}
+	events := &v1.EventList{TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "EventList"}, Items: b.Events}
+
+	type object struct {
+		name string
+		obj  interface{}
+	}
+	objects := []object{
+		{bundleDeploymentFile, deployment},
+		{bundlePodsFile, pods},
+		{bundleEventsFile, events},
+	}
+	// Cluster objects are written as lists, empty if there are none, so the
+	// snapshot gateway can tell them apart from objects it wasn't given.
+	hpas := &autoscalingv2.HorizontalPodAutoscalerList{TypeMeta: metav1.TypeMeta{APIVersion: "autoscaling/v2", Kind: "HorizontalPodAutoscalerList"}}
+	if b.HPA != nil {
+		hpas.Items = append(hpas.Items, *b.HPA)
+	}
+	runtimeClasses := &nodev1.RuntimeClassList{TypeMeta: metav1.TypeMeta{APIVersion: "node.k8s.io/v1", Kind: "RuntimeClassList"}}
+	if b.RuntimeClass != nil {
+		runtimeClasses.Items = append(runtimeClasses.Items, *b.RuntimeClass)
+	}
+	clusterObjects := []struct {
+		kind string
+		name string
+		obj  interface{}
+	}{
+		{entity.BundleHPA, bundleHPAFile, hpas},
+		{entity.BundleRuntimeClass, bundleRuntimeClassesFile, runtimeClasses},
+		{entity.BundleNodes, bundleNodesFile, &v1.NodeList{TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "NodeList"}, Items: b.Nodes}},
+		{entity.BundleLimitRanges, bundleLimitRangesFile, &v1.LimitRangeList{TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "LimitRangeList"}, Items: b.LimitRanges}},
+		{entity.BundleResourceQuotas, bundleQuotasFile, &v1.ResourceQuotaList{TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "ResourceQuotaList"}, Items: b.ResourceQuotas}},
+	}
+	for _, o := range clusterObjects {
+		if !slices.Contains(b.Manifest.Uncaptured, o.kind) {
+			objects = append(objects, object{o.name, o.obj})
+		}
+	}
+	for _, o := range objects {
+		data, err := yaml.Marshal(o.obj)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", o.name, err)
+		}
+		if err := writeTarFile(tw, o.name, data, modTime); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode bundle manifest: %w", err)
+	}
+	if err := writeTarFile(tw, bundleManifestFile, data, modTime); err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to finalize bundle: %w", err)
+	}
+	return gz.Close()
+}
+
+func writeTarFile(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0o644,
+		Size:    int64(len(data)),
+		ModTime: modTime,
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write %s to bundle: %w", name, err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("failed to write %s to bundle: %w", name, err)
+	}
+	return nil
+}
@@ -2,10 +2,13 @@ package presenter
 
 import (
 	"bytes"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/sequring/sculptor/internal/entity"
 	"github.com/sequring/sculptor/internal/usecase"
+	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 )
 
@@ -102,3 +105,612 @@ func TestYAMLPresenter_BuildOutputContainers(t *testing.T) {
 		t.Error("Expected non-empty output, got empty string")
 	}
 }
+
+func TestYAMLPresenter_RenderDataStatus(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewYAMLPresenter(false, &buf)
+
+	err := p.Render(&usecase.AllRecommendations{
+		MainContainers: []usecase.NamedRecommendation{
+			{
+				ContainerName: "main-app",
+				Recommendation: &entity.Recommendation{
+					Memory:     mustParseQuantity("256Mi"),
+					CPU:        &entity.CPURecommendation{Request: mustParseQuantity("100m"), Limit: mustParseQuantity("200m")},
+					DataStatus: entity.DataInsufficient,
+					DataIssues: []string{"only 2h of data"},
+					DataQuality: &entity.DataQuality{
+						Span:       2 * time.Hour,
+						Pods:       1,
+						Samples:    120,
+						Gaps:       10 * time.Minute,
+						Restarts:   3,
+						Confidence: entity.ConfidenceLow,
+					},
+				},
+			},
+			{
+				ContainerName: "sidecar",
+				Recommendation: &entity.Recommendation{
+					DataStatus: entity.DataMissing,
+					DataIssues: []string{"no memory data"},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+
+	output := buf.String()
+	if !strings.Contains(output, "'main-app' is based on insufficient data (only 2h of data)") {
+		t.Errorf("expected insufficient data warning for main-app, got:\n%s", output)
+	}
+	if !strings.Contains(output, "No recommendation for container 'sidecar'") {
+		t.Errorf("expected missing data warning for sidecar, got:\n%s", output)
+	}
+	if strings.Contains(output, "name: sidecar") {
+		t.Errorf("expected sidecar to be omitted from the snippet, got:\n%s", output)
+	}
+	if !strings.Contains(output, "#   main-app: 2h of data from 1 pod(s), 120 samples, 10m of gaps, 3 restart(s), confidence low") {
+		t.Errorf("expected data quality comment for main-app, got:\n%s", output)
+	}
+	if !strings.Contains(output, "name: main-app") {
+		t.Errorf("expected main-app in the snippet, got:\n%s", output)
+	}
+}
+
+func TestYAMLPresenter_RenderOmittedCPULimit(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewYAMLPresenter(false, &buf)
+
+	err := p.Render(&usecase.AllRecommendations{
+		MainContainers: []usecase.NamedRecommendation{{
+			ContainerName: "main-app",
+			Recommendation: &entity.Recommendation{
+				Memory:     mustParseQuantity("256Mi"),
+				CPU:        &entity.CPURecommendation{Request: mustParseQuantity("100m"), SuggestedLimit: mustParseQuantity("400m")},
+				DataStatus: entity.DataSufficient,
+				Warnings:   []string{"LimitRange 'defaults' in namespace 'test-ns' injects a default CPU limit of 500m into containers without one"},
+			},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+
+	output := buf.String()
+	if !strings.Contains(output, "#   main-app: 400m") {
+		t.Errorf("expected the suggested limit as a comment, got:\n%s", output)
+	}
+	if !strings.Contains(output, "LimitRange 'defaults'") {
+		t.Errorf("expected the LimitRange warning, got:\n%s", output)
+	}
+	limits := output[strings.Index(output, "limits:"):strings.Index(output, "requests:")]
+	if strings.Contains(limits, "cpu") {
+		t.Errorf("expected no CPU limit in the snippet, got:\n%s", output)
+	}
+}
+
+func TestYAMLPresenter_RenderOOMSizing(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewYAMLPresenter(false, &buf)
+
+	err := p.Render(&usecase.AllRecommendations{
+		MainContainers: []usecase.NamedRecommendation{{
+			ContainerName: "main-app",
+			Recommendation: &entity.Recommendation{
+				Memory:      mustParseQuantity("18Gi"),
+				CPU:         &entity.CPURecommendation{Request: mustParseQuantity("100m"), Limit: mustParseQuantity("400m")},
+				DataStatus:  entity.DataSufficient,
+				IsOOMKilled: true,
+				OOMSizing: &entity.OOMSizing{
+					CurrentLimit: mustParseQuantity("16Gi"),
+					Increase:     mustParseQuantity("2Gi"),
+					Capped:       true,
+					Reason:       "no working set data before the kills; raised by 50%, capped at 2Gi by policy",
+				},
+			},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+
+	if output := buf.String(); !strings.Contains(output, "#   main-app: 16Gi -> 18Gi (+2Gi), no working set data") {
+		t.Errorf("expected the OOM sizing as a comment, got:\n%s", output)
+	}
+}
+
+func TestYAMLPresenter_RenderOOMKilledWithMissingData(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewYAMLPresenter(false, &buf)
+
+	err := p.Render(&usecase.AllRecommendations{
+		MainContainers: []usecase.NamedRecommendation{{
+			ContainerName: "main-app",
+			Recommendation: &entity.Recommendation{
+				DataStatus:  entity.DataMissing,
+				DataIssues:  []string{"no CPU usage samples"},
+				IsOOMKilled: true,
+				OOMKills:    []entity.OOMKill{{Pod: "api-1", Time: time.Date(2026, 10, 17, 9, 30, 0, 0, time.UTC)}},
+			},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+
+	if output := buf.String(); !strings.Contains(output, "Container 'main-app' was OOMKilled 1 time(s)") {
+		t.Errorf("expected the OOM kill warning despite missing data, got:\n%s", output)
+	}
+}
+
+func TestYAMLPresenter_RenderOOMKilledSidecar(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewYAMLPresenter(false, &buf)
+
+	err := p.Render(&usecase.AllRecommendations{
+		InitContainers: []usecase.NamedRecommendation{{
+			ContainerName: "log-shipper",
+			Recommendation: &entity.Recommendation{
+				Memory:      mustParseQuantity("192Mi"),
+				CPU:         &entity.CPURecommendation{Request: mustParseQuantity("50m"), Limit: mustParseQuantity("100m")},
+				DataStatus:  entity.DataSufficient,
+				IsOOMKilled: true,
+				OOMKills:    []entity.OOMKill{{Pod: "api-1", Time: time.Date(2026, 10, 17, 9, 30, 0, 0, time.UTC)}},
+				OOMSizing: &entity.OOMSizing{
+					CurrentLimit: mustParseQuantity("128Mi"),
+					Increase:     mustParseQuantity("64Mi"),
+					Reason:       "no working set data before the kills; raised by 50%",
+				},
+			},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+
+	output := buf.String()
+	if !strings.Contains(output, "Container 'log-shipper' was OOMKilled 1 time(s)") {
+		t.Errorf("expected an OOM kill warning for the sidecar, got:\n%s", output)
+	}
+	if !strings.Contains(output, "#   log-shipper: 128Mi -> 192Mi (+64Mi), no working set data") {
+		t.Errorf("expected the sidecar's OOM sizing as a comment, got:\n%s", output)
+	}
+}
+
+func TestResourceLists_SeparateMemoryRequest(t *testing.T) {
+	requests, limits, err := resourceLists(&entity.Recommendation{
+		Memory:        mustParseQuantity("512Mi"),
+		MemoryRequest: mustParseQuantity("300Mi"),
+		CPU:           &entity.CPURecommendation{Request: mustParseQuantity("100m"), Limit: mustParseQuantity("200m")},
+	})
+	if err != nil {
+		t.Fatalf("resourceLists failed: %v", err)
+	}
+
+	if got := requests[v1.ResourceMemory]; got.String() != "300Mi" {
+		t.Errorf("expected memory request 300Mi, got %s", got.String())
+	}
+	if got := limits[v1.ResourceMemory]; got.String() != "512Mi" {
+		t.Errorf("expected memory limit 512Mi, got %s", got.String())
+	}
+}
+
+func TestQoSWarnings(t *testing.T) {
+	warnings := qosWarnings(&usecase.QoSAssessment{
+		Target:      v1.PodQOSGuaranteed,
+		Current:     v1.PodQOSGuaranteed,
+		Recommended: v1.PodQOSBurstable,
+	})
+
+	if len(warnings) != 2 {
+		t.Fatalf("expected 2 warnings, got %v", warnings)
+	}
+	if !strings.Contains(warnings[0], "not the target Guaranteed") {
+		t.Errorf("expected a target mismatch warning, got %q", warnings[0])
+	}
+	if !strings.Contains(warnings[1], "from Guaranteed to Burstable") {
+		t.Errorf("expected a QoS change warning, got %q", warnings[1])
+	}
+	if qosWarnings(nil) != nil {
+		t.Error("expected no warnings without an assessment")
+	}
+}
+
+func TestOOMKillWarning(t *testing.T) {
+	start := time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)
+	var kills []entity.OOMKill
+	for i := 0; i < 7; i++ {
+		kills = append(kills, entity.OOMKill{Pod: "api-1", Time: start.Add(time.Duration(i) * time.Hour)})
+	}
+	rec := usecase.NamedRecommendation{
+		ContainerName:  "app",
+		Recommendation: &entity.Recommendation{IsOOMKilled: true, OOMKills: kills},
+	}
+
+	warning := oomKillWarning(rec)
+
+	if !strings.Contains(warning, "OOMKilled 7 time(s)") {
+		t.Errorf("expected the kill count in %q", warning)
+	}
+	if !strings.Contains(warning, "last 5 kills: api-1 at 2026-10-17T02:00:00Z") {
+		t.Errorf("expected the 5 most recent kills in %q", warning)
+	}
+	if strings.Contains(warning, "T01:00:00Z") {
+		t.Errorf("expected older kills to be left out of %q", warning)
+	}
+}
+
+func TestMemoryLeakWarning(t *testing.T) {
+	trend := &entity.MemoryTrend{
+		Lifetimes:    4,
+		Growing:      3,
+		GrowthRate:   12 * 1024 * 1024 / 3600.0,
+		ProbableLeak: true,
+		TargetUptime: 7 * 24 * time.Hour,
+		LimitRaised:  true,
+	}
+
+	warning := memoryLeakWarning("app", trend, mustParseQuantity("2Gi"))
+
+	if !strings.Contains(warning, "3 of 4 pod lifetimes, by up to 12.0Mi/h") {
+		t.Errorf("expected the growth in %q", warning)
+	}
+	if !strings.Contains(warning, "raised to 2048Mi to last 1w between restarts") {
+		t.Errorf("expected the projected limit in %q", warning)
+	}
+}
+
+func TestSeasonalityComments(t *testing.T) {
+	window := entity.TimeWindow{From: 9 * 60, To: 18 * 60}
+	for d := time.Monday; d <= time.Friday; d++ {
+		window.Days[d] = true
+	}
+	recs := &usecase.AllRecommendations{
+		MainContainers: []usecase.NamedRecommendation{
+			{
+				ContainerName: "api",
+				Recommendation: &entity.Recommendation{Seasonality: &entity.Seasonality{
+					Window:       window,
+					Peak:         &entity.Usage{MemoryP99: 512 * 1024 * 1024, CPUP90: 0.4, CPUP99: 0.8},
+					OffPeak:      &entity.Usage{MemoryP99: 256 * 1024 * 1024, CPUP90: 0.1, CPUP99: 0.2},
+					SizedForPeak: true,
+				}},
+			},
+			{
+				ContainerName:  "worker",
+				Recommendation: &entity.Recommendation{Seasonality: &entity.Seasonality{Window: window}},
+			},
+		},
+	}
+
+	comments := string(seasonalityComments(recs))
+
+	if !strings.Contains(comments, "# Peak window Mon,Tue,Wed,Thu,Fri 09:00-18:00 UTC") {
+		t.Errorf("expected the window header, got:\n%s", comments)
+	}
+	if !strings.Contains(comments, "#   api: peak 512Mi/400m/800m, off-peak 256Mi/100m/200m, sized for the peak") {
+		t.Errorf("expected peak vs off-peak usage for api, got:\n%s", comments)
+	}
+	if !strings.Contains(comments, "#   worker: peak no data, off-peak no data") {
+		t.Errorf("expected no data for worker, got:\n%s", comments)
+	}
+}
+
+func TestForecastComments(t *testing.T) {
+	recs := &usecase.AllRecommendations{
+		MainContainers: []usecase.NamedRecommendation{{
+			ContainerName: "api",
+			Recommendation: &entity.Recommendation{Forecast: &entity.Forecast{
+				Horizon: 12 * 7 * 24 * time.Hour,
+				Trend: entity.UsageTrend{
+					Memory: entity.Trend{Current: 1000, GrowthRate: 20.0 / (7 * 24 * 3600), R2: 0.9},
+					CPU:    entity.Trend{Current: 1, R2: 0.1},
+				},
+				MemoryFactor: 1.24,
+				CPUFactor:    1,
+				Memory:       mustParseQuantity("640Mi"),
+				CPU:          &entity.CPURecommendation{Request: mustParseQuantity("250m")},
+			}},
+		}},
+	}
+
+	comments := string(forecastComments(recs))
+
+	if !strings.Contains(comments, "# Forecast for +12w") {
+		t.Errorf("expected the horizon, got:\n%s", comments)
+	}
+	if !strings.Contains(comments, "#   api: memory +2.0%/week (R² 0.90) x1.24, CPU +0.0%/week (R² 0.10) x1.00") {
+		t.Errorf("expected the growth of api, got:\n%s", comments)
+	}
+	if !strings.Contains(comments, "#     requests: cpu 250m, memory 640Mi; limits: memory 640Mi") {
+		t.Errorf("expected the forecast resources of api, got:\n%s", comments)
+	}
+}
+
+func TestHPAComments(t *testing.T) {
+	recs := &usecase.AllRecommendations{
+		MainContainers: []usecase.NamedRecommendation{{
+			ContainerName: "api",
+			Recommendation: &entity.Recommendation{
+				CPU: &entity.CPURecommendation{Request: mustParseQuantity("400m")},
+				HPA: &entity.HPAScaling{
+					Name:              "api-hpa",
+					TargetUtilization: 0.5,
+					MinReplicas:       2,
+					MaxReplicas:       10,
+					Replicas:          &entity.ReplicaStats{Min: 2, Max: 6, Mean: 4},
+					UnadjustedRequest: mustParseQuantity("300m"),
+					CurrentReplicas:   2,
+					ExpectedReplicas:  4,
+				},
+			},
+		}},
+	}
+
+	comments := string(hpaComments(recs))
+
+	if !strings.Contains(comments, "# HPA 'api-hpa' targets 50% CPU utilization (2-10 replicas, observed 2-6, mean 4.0):") {
+		t.Errorf("expected the HPA header, got:\n%s", comments)
+	}
+	if !strings.Contains(comments, "#   expected replicas under typical load: 2 -> 4") {
+		t.Errorf("expected the replica impact, got:\n%s", comments)
+	}
+	if !strings.Contains(comments, "#   api: CPU request 400m puts p50 usage at the target (300m without the HPA)") {
+		t.Errorf("expected the request of api, got:\n%s", comments)
+	}
+}
+
+func TestPodDistributionComments(t *testing.T) {
+	recs := &usecase.AllRecommendations{
+		MainContainers: []usecase.NamedRecommendation{{
+			ContainerName: "api",
+			Recommendation: &entity.Recommendation{
+				PodDistribution: &entity.PodDistribution{
+					Pods:      3,
+					MemoryP99: entity.Spread{Min: 100 * 1024 * 1024, Median: 120 * 1024 * 1024, Max: 400 * 1024 * 1024},
+					CPUP99:    entity.Spread{Min: 0.1, Median: 0.2, Max: 0.25},
+					Outlier:   "api-7d9f-x2",
+					SizedFor:  "the median pod",
+				},
+			},
+		}},
+	}
+
+	comments := string(podDistributionComments(recs))
+
+	if !strings.Contains(comments, "# Per-pod p99 (min/median/max):") {
+		t.Errorf("expected the distribution header, got:\n%s", comments)
+	}
+	if !strings.Contains(comments, "#   api: memory 100Mi/120Mi/400Mi, CPU 100m/200m/250m across 3 pods, sized for the median pod (outlier: api-7d9f-x2)") {
+		t.Errorf("expected the distribution of api, got:\n%s", comments)
+	}
+}
+
+func TestInitCPUComments(t *testing.T) {
+	recs := &usecase.AllRecommendations{
+		InitContainers: []usecase.NamedRecommendation{{
+			ContainerName: "migrate",
+			Recommendation: &entity.Recommendation{
+				InitCPU: &entity.InitCPUUsage{
+					Runs:           5,
+					CPUSeconds:     120,
+					Duration:       4 * time.Minute,
+					PeakRate:       1.5,
+					TargetDuration: 2 * time.Minute,
+				},
+			},
+		}},
+	}
+
+	comments := string(initCPUComments(recs))
+
+	if !strings.Contains(comments, "# Init container CPU (heaviest run):") {
+		t.Errorf("expected the init CPU header, got:\n%s", comments)
+	}
+	if !strings.Contains(comments, "#   migrate: 120s of CPU over 4m, peak 1.50 cores across 5 runs; request sized to finish within 2m") {
+		t.Errorf("expected the CPU of migrate, got:\n%s", comments)
+	}
+}
+
+func TestPodRequestsComments(t *testing.T) {
+	pr := &usecase.PodRequests{
+		RuntimeClass: "kata",
+		Overhead:     v1.ResourceList{v1.ResourceCPU: resource.MustParse("250m"), v1.ResourceMemory: resource.MustParse("160Mi")},
+		Current:      v1.ResourceList{v1.ResourceCPU: resource.MustParse("2250m"), v1.ResourceMemory: resource.MustParse("2208Mi")},
+		Recommended:  v1.ResourceList{v1.ResourceCPU: resource.MustParse("1250m"), v1.ResourceMemory: resource.MustParse("672Mi")},
+		InitBound:    []v1.ResourceName{v1.ResourceCPU},
+	}
+
+	comments := string(podRequestsComments(pr))
+
+	if !strings.Contains(comments, "# Pod requests for scheduling: CPU 2250m -> 1250m, memory 2208Mi -> 672Mi") {
+		t.Errorf("expected the pod requests, got:\n%s", comments)
+	}
+	if !strings.Contains(comments, "#   including pod overhead of CPU 250m, memory 160Mi from RuntimeClass 'kata'") {
+		t.Errorf("expected the overhead, got:\n%s", comments)
+	}
+	if !strings.Contains(comments, "#   set by an init container: cpu") {
+		t.Errorf("expected the init-bound resources, got:\n%s", comments)
+	}
+}
+
+func TestPodRequestsWarnings_NodeFit(t *testing.T) {
+	pr := &usecase.PodRequests{
+		Recommended:  v1.ResourceList{v1.ResourceCPU: resource.MustParse("2"), v1.ResourceMemory: resource.MustParse("14Gi")},
+		Nodes:        3,
+		FittingNodes: 0,
+		LargestFit:   v1.ResourceList{v1.ResourceCPU: resource.MustParse("3920m"), v1.ResourceMemory: resource.MustParse("7901020Ki")},
+	}
+
+	warnings := podRequestsWarnings(pr)
+
+	want := "Recommended pod requests (CPU 2, memory 14336Mi) fit none of the 3 node(s) the pod can be scheduled on; the largest pod requests that fit are memory 7715Mi"
+	if len(warnings) != 1 || warnings[0] != want {
+		t.Errorf("got %v, want [%s]", warnings, want)
+	}
+
+	pr.Recommended[v1.ResourceEphemeralStorage] = resource.MustParse("50Gi")
+	pr.LargestFit[v1.ResourceEphemeralStorage] = resource.MustParse("20Gi")
+	warnings = podRequestsWarnings(pr)
+	if len(warnings) != 1 || !strings.HasSuffix(warnings[0], "the largest pod requests that fit are memory 7715Mi, ephemeral-storage 20Gi") {
+		t.Errorf("expected the largest ephemeral storage that fits, got %v", warnings)
+	}
+
+	pr.FittingNodes = 1
+	if warnings := podRequestsWarnings(pr); len(warnings) != 0 {
+		t.Errorf("expected no warnings when a node fits, got %v", warnings)
+	}
+}
+
+func TestQuotaCommentsAndWarnings(t *testing.T) {
+	q := &usecase.QuotaAssessment{
+		Replicas: 4,
+		Surge:    1,
+		Quotas: []usecase.QuotaProjection{{
+			Name: "compute",
+			Resources: []usecase.QuotaResource{
+				{Name: v1.ResourceRequestsCPU, Hard: resource.MustParse("8"), Used: resource.MustParse("5"), Projected: resource.MustParse("7"), Rollout: resource.MustParse("8500m")},
+				{Name: v1.ResourceRequestsMemory, Hard: resource.MustParse("8Gi"), Used: resource.MustParse("6Gi"), Projected: resource.MustParse("9Gi"), Rollout: resource.MustParse("9Gi")},
+			},
+		}},
+	}
+
+	comments := string(quotaComments(q))
+	warnings := quotaWarnings(q)
+
+	if want := "# ResourceQuota 'compute' at 4 replica(s): requests.cpu 5 -> 7 of 8, requests.memory 6144Mi -> 9216Mi of 8192Mi"; !strings.Contains(comments, want) {
+		t.Errorf("expected %q in %q", want, comments)
+	}
+	if len(warnings) != 2 {
+		t.Fatalf("expected a projection and a rollout warning, got %v", warnings)
+	}
+	if !strings.Contains(warnings[0], "requests.memory 9216Mi of 8192Mi") || !strings.Contains(warnings[1], "requests.cpu 8500m of 8") {
+		t.Errorf("unexpected warnings: %v", warnings)
+	}
+}
+
+func TestYAMLPresenter_RenderEphemeralStorage(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewYAMLPresenter(false, &buf)
+	evictedAt := time.Date(2026, 10, 17, 9, 30, 0, 0, time.UTC)
+
+	err := p.Render(&usecase.AllRecommendations{
+		MainContainers: []usecase.NamedRecommendation{{
+			ContainerName: "api",
+			Recommendation: &entity.Recommendation{
+				Memory: mustParseQuantity("256Mi"),
+				CPU:    &entity.CPURecommendation{Request: mustParseQuantity("100m"), Limit: mustParseQuantity("200m")},
+				EphemeralStorage: &entity.EphemeralStorage{
+					Request:      mustParseQuantity("1200Mi"),
+					Limit:        mustParseQuantity("3Gi"),
+					Peak:         1000 * 1024 * 1024,
+					Evictions:    []entity.StorageEviction{{Pod: "api-1", Time: evictedAt, Cause: entity.EvictionContainerLimit}},
+					CurrentLimit: mustParseQuantity("2Gi"),
+					LimitRaised:  true,
+				},
+			},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+
+	output := buf.String()
+	for _, want := range []string{
+		"ephemeral-storage: 1200Mi",
+		"ephemeral-storage: 3Gi",
+		"#   api: peak 1000Mi, limit raised from 2Gi after evictions",
+		"Pods of container 'api' were evicted 1 time(s) for ephemeral storage (evictions: api-1 at 2026-10-17T09:30:00Z, container limit)",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected %q in output:\n%s", want, output)
+		}
+	}
+}
+
+func TestYAMLPresenter_RenderPassthroughResources(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewYAMLPresenter(false, &buf)
+	passthrough := v1.ResourceList{"hugepages-2Mi": *mustParseQuantity("256Mi"), "nvidia.com/gpu": *mustParseQuantity("1")}
+
+	err := p.Render(&usecase.AllRecommendations{
+		MainContainers: []usecase.NamedRecommendation{{
+			ContainerName: "api",
+			Recommendation: &entity.Recommendation{
+				Memory:              mustParseQuantity("256Mi"),
+				CPU:                 &entity.CPURecommendation{Request: mustParseQuantity("100m"), Limit: mustParseQuantity("200m")},
+				PassthroughRequests: passthrough,
+				PassthroughLimits:   passthrough,
+				HugePages:           []entity.HugePagesUsage{{PageSize: "2Mi", Peak: 200 * 1024 * 1024, Failures: 2}},
+			},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+
+	output := buf.String()
+	for _, want := range []string{
+		"hugepages-2Mi: 256Mi",
+		"nvidia.com/gpu: \"1\"",
+		"# Hugepages (kept as requested):",
+		"#   api: hugepages-2Mi peak 200Mi of 256Mi, 2 failed allocation(s)",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected %q in output:\n%s", want, output)
+		}
+	}
+	if strings.Count(output, "nvidia.com/gpu") != 2 {
+		t.Errorf("expected nvidia.com/gpu in requests and limits:\n%s", output)
+	}
+}
+
+func TestYAMLPresenter_RenderJVM(t *testing.T) {
+	var buf bytes.Buffer
+	p := NewYAMLPresenter(false, &buf)
+
+	err := p.Render(&usecase.AllRecommendations{
+		MainContainers: []usecase.NamedRecommendation{
+			{
+				ContainerName: "api",
+				Recommendation: &entity.Recommendation{
+					Memory: mustParseQuantity("1070Mi"),
+					CPU:    &entity.CPURecommendation{Request: mustParseQuantity("100m"), Limit: mustParseQuantity("200m")},
+					JVM: &entity.JVMSizing{
+						CurrentFlag: "-Xmx1g",
+						CurrentHeap: mustParseQuantity("1Gi"),
+						Usage:       &entity.JVMMemory{Heap: 500 * 1024 * 1024, NonHeap: 100 * 1024 * 1024},
+						Heap:        mustParseQuantity("650Mi"),
+						Flag:        "-Xmx650m",
+						Overhead:    mustParseQuantity("420Mi"),
+					},
+				},
+			},
+			{
+				ContainerName: "worker",
+				Recommendation: &entity.Recommendation{
+					Memory: mustParseQuantity("1Gi"),
+					CPU:    &entity.CPURecommendation{Request: mustParseQuantity("100m"), Limit: mustParseQuantity("200m")},
+					JVM:    &entity.JVMSizing{Heap: mustParseQuantity("256Mi"), Overhead: mustParseQuantity("768Mi")},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+
+	output := buf.String()
+	for _, want := range []string{
+		"# JVM heap (set with the memory limit):",
+		"#   api: -Xmx650m, max heap 650Mi, 420Mi for non-heap and native memory (was -Xmx1g); peak heap 500Mi, non-heap 100Mi",
+		"#   worker: default -XX:MaxRAMPercentage=25, max heap 256Mi, 768Mi for non-heap and native memory; no JVM metrics",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected %q in output:\n%s", want, output)
+		}
+	}
+}
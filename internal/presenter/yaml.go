@@ -3,9 +3,15 @@ package presenter
 import (
 	"fmt"
 	"io"
+	"maps"
 	"math"
 	"os"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/prometheus/common/model"
+	"github.com/sequring/sculptor/internal/entity"
 	"github.com/sequring/sculptor/internal/usecase"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -152,30 +158,19 @@ func (p *YAMLPresenter) Render(recs *usecase.AllRecommendations) error {
 		if rec.Recommendation == nil {
 			continue
 		}
-
-		if rec.Recommendation.IsOOMKilled {
-			allWarnings = append(allWarnings, fmt.Sprintf("OOMKilled event detected for container '%s'", rec.ContainerName))
-		}
-		if rec.Recommendation.CPU.SpikinessWarning {
-			allWarnings = append(allWarnings, fmt.Sprintf("High CPU spikiness detected for container '%s'", rec.ContainerName))
+		allWarnings = append(allWarnings, metricErrorWarnings(rec)...)
+		allWarnings = append(allWarnings, dataStatusWarnings(rec)...)
+		allWarnings = append(allWarnings, rec.Recommendation.Warnings...)
+		allWarnings = append(allWarnings, longRunningWarnings(rec)...)
+		if rec.Recommendation.IsMissingData() {
+			continue
 		}
 
-		memString := formatMemoryHumanReadable(rec.Recommendation.Memory)
-		prettyMem, err := resource.ParseQuantity(memString)
+		requests, limits, err := resourceLists(rec.Recommendation)
 		if err != nil {
 			return fmt.Errorf("parsing memory for %s: %w", rec.ContainerName, err)
 		}
 
-		requests := v1.ResourceList{
-			v1.ResourceCPU:    *rec.Recommendation.CPU.Request,
-			v1.ResourceMemory: prettyMem,
-		}
-
-		limits := v1.ResourceList{
-			v1.ResourceCPU:    *rec.Recommendation.CPU.Limit,
-			v1.ResourceMemory: prettyMem,
-		}
-
 		output.AddContainer(rec.ContainerName, false, requests, limits)
 	}
 
@@ -184,43 +179,107 @@ func (p *YAMLPresenter) Render(recs *usecase.AllRecommendations) error {
 		if rec.Recommendation == nil {
 			continue
 		}
+		allWarnings = append(allWarnings, metricErrorWarnings(rec)...)
+		allWarnings = append(allWarnings, dataStatusWarnings(rec)...)
+		allWarnings = append(allWarnings, rec.Recommendation.Warnings...)
+		allWarnings = append(allWarnings, longRunningWarnings(rec)...)
+		if rec.Recommendation.IsMissingData() {
+			continue
+		}
 
-		memString := formatMemoryHumanReadable(rec.Recommendation.Memory)
-		prettyMem, err := resource.ParseQuantity(memString)
+		requests, limits, err := resourceLists(rec.Recommendation)
 		if err != nil {
 			return fmt.Errorf("parsing memory for init container %s: %w", rec.ContainerName, err)
 		}
 
-		requests := v1.ResourceList{
-			v1.ResourceCPU:    *rec.Recommendation.CPU.Request,
-			v1.ResourceMemory: prettyMem,
-		}
-
-		limits := v1.ResourceList{
-			v1.ResourceCPU:    *rec.Recommendation.CPU.Limit,
-			v1.ResourceMemory: prettyMem,
-		}
-
 		output.AddContainer(rec.ContainerName, true, requests, limits)
 	}
 
+	allWarnings = append(allWarnings, qosWarnings(recs.QoS)...)
+	allWarnings = append(allWarnings, podRequestsWarnings(recs.PodRequests)...)
+	allWarnings = append(allWarnings, quotaWarnings(recs.Quota)...)
 	p.printWarnings(allWarnings)
 
+	if len(output.Containers) == 0 && len(output.InitContainers) == 0 {
+		if !p.silent {
+			fmt.Fprintln(p.writer, "No recommendations could be generated: no container has enough metric data.")
+		}
+		return nil
+	}
+
 	yamlBytes, err := output.ToYAML()
 	if err != nil {
 		return fmt.Errorf("failed to marshal YAML: %w", err)
 	}
 
-	p.printYAML(yamlBytes)
+	comments := append(qosComment(recs.QoS), podRequestsComments(recs.PodRequests)...)
+	comments = append(comments, quotaComments(recs.Quota)...)
+	comments = append(comments, dataQualityComments(recs)...)
+	comments = append(comments, omittedCPULimitComments(recs)...)
+	comments = append(comments, oomSizingComments(recs)...)
+	comments = append(comments, jvmComments(recs)...)
+	comments = append(comments, ephemeralStorageComments(recs)...)
+	comments = append(comments, hugePagesComments(recs)...)
+	comments = append(comments, seasonalityComments(recs)...)
+	comments = append(comments, podDistributionComments(recs)...)
+	comments = append(comments, hpaComments(recs)...)
+	comments = append(comments, forecastComments(recs)...)
+	comments = append(comments, initCPUComments(recs)...)
+	p.printYAML(append(comments, yamlBytes...))
 	return nil
 }
 
+// resourceLists builds the requests and limits of a recommendation, with
+// memory rounded up to a human-readable unit. A missing memory request means
+// the request equals the limit; a missing CPU limit and unsized ephemeral
+// storage are left out. Resources carried through from the pod template are
+// kept as they are.
+func resourceLists(rec *entity.Recommendation) (v1.ResourceList, v1.ResourceList, error) {
+	memLimit, err := resource.ParseQuantity(formatMemoryHumanReadable(rec.Memory))
+	if err != nil {
+		return nil, nil, err
+	}
+	memRequest := memLimit
+	if rec.MemoryRequest != nil {
+		memRequest, err = resource.ParseQuantity(formatMemoryHumanReadable(rec.MemoryRequest))
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	requests := v1.ResourceList{
+		v1.ResourceCPU:    *rec.CPU.Request,
+		v1.ResourceMemory: memRequest,
+	}
+	limits := v1.ResourceList{
+		v1.ResourceMemory: memLimit,
+	}
+	if rec.CPU.Limit != nil {
+		limits[v1.ResourceCPU] = *rec.CPU.Limit
+	}
+	if storage := rec.EphemeralStorage; storage != nil && storage.Request != nil {
+		if requests[v1.ResourceEphemeralStorage], err = resource.ParseQuantity(formatMemoryHumanReadable(storage.Request)); err != nil {
+			return nil, nil, err
+		}
+		if limits[v1.ResourceEphemeralStorage], err = resource.ParseQuantity(formatMemoryHumanReadable(storage.Limit)); err != nil {
+			return nil, nil, err
+		}
+	}
+	for name, q := range rec.PassthroughRequests {
+		requests[name] = q
+	}
+	for name, q := range rec.PassthroughLimits {
+		limits[name] = q
+	}
+	return requests, limits, nil
+}
+
 func (p *YAMLPresenter) printWarnings(warnings []string) {
 	if len(warnings) == 0 {
 		return
 	}
 	if p.silent {
-		fmt.Fprintln(os.Stderr, "Warning: Issues like OOMKilled or CPU spikiness were detected. Review recommendations carefully.")
+		fmt.Fprintln(os.Stderr, "Warning: Issues like OOMKilled, CPU spikiness, CPU throttling, failed metric queries or insufficient data were detected. Review recommendations carefully.")
 	} else {
 		for _, warning := range warnings {
 			fmt.Fprintf(p.writer, "\033[33m--- WARNING: %s ---\033[0m\n", warning)
@@ -228,6 +287,594 @@ func (p *YAMLPresenter) printWarnings(warnings []string) {
 	}
 }
 
+// longRunningWarnings flags the OOM kills, evictions, memory leaks, CPU
+// spikiness and throttling found while sizing a main container or native
+// sidecar. One-shot init containers carry none of them.
+func longRunningWarnings(rec usecase.NamedRecommendation) []string {
+	var warnings []string
+	if rec.Recommendation.IsOOMKilled {
+		warnings = append(warnings, oomKillWarning(rec))
+	}
+	if storage := rec.Recommendation.EphemeralStorage; storage != nil && len(storage.Evictions) > 0 {
+		warnings = append(warnings, storageEvictionWarning(rec.ContainerName, storage))
+	}
+	if rec.Recommendation.IsMissingData() {
+		return warnings
+	}
+	if trend := rec.Recommendation.MemoryTrend; trend != nil && trend.ProbableLeak {
+		warnings = append(warnings, memoryLeakWarning(rec.ContainerName, trend, rec.Recommendation.Memory))
+	}
+	if rec.Recommendation.CPU.SpikinessWarning {
+		warnings = append(warnings, fmt.Sprintf("High CPU spikiness detected for container '%s'", rec.ContainerName))
+	}
+	if rec.Recommendation.CPU.ThrottlingWarning && rec.Recommendation.CPU.Limit != nil {
+		warnings = append(warnings, fmt.Sprintf("CPU throttling detected for container '%s' (%.0f%% of periods throttled), CPU limit raised; consider removing the CPU limit", rec.ContainerName, rec.Recommendation.CPU.ThrottledRatio*100))
+	}
+	return warnings
+}
+
+// allContainers returns the recommendations of main and init containers, so
+// comments cover native sidecars alongside the main containers.
+func allContainers(recs *usecase.AllRecommendations) []usecase.NamedRecommendation {
+	return append(append([]usecase.NamedRecommendation{}, recs.MainContainers...), recs.InitContainers...)
+}
+
+func dataStatusWarnings(rec usecase.NamedRecommendation) []string {
+	issues := strings.Join(rec.Recommendation.DataIssues, "; ")
+	switch rec.Recommendation.DataStatus {
+	case entity.DataMissing:
+		return []string{fmt.Sprintf("No recommendation for container '%s', required metrics are missing (%s)", rec.ContainerName, issues)}
+	case entity.DataInsufficient:
+		return []string{fmt.Sprintf("Recommendation for container '%s' is based on insufficient data (%s)", rec.ContainerName, issues)}
+	}
+	return nil
+}
+
+// qosComment states, as a YAML comment, the QoS class the recommended
+// resources produce.
+func qosComment(qos *usecase.QoSAssessment) []byte {
+	if qos == nil {
+		return nil
+	}
+	return []byte(fmt.Sprintf("# QoS class: %s (current: %s)\n", qos.Recommended, qos.Current))
+}
+
+func qosWarnings(qos *usecase.QoSAssessment) []string {
+	if qos == nil {
+		return nil
+	}
+	var warnings []string
+	if qos.Target != "" && qos.Recommended != qos.Target {
+		warnings = append(warnings, fmt.Sprintf("Recommended resources produce QoS class %s, not the target %s", qos.Recommended, qos.Target))
+	}
+	if qos.Recommended != qos.Current {
+		warnings = append(warnings, fmt.Sprintf("Recommended resources change the QoS class from %s to %s", qos.Current, qos.Recommended))
+	}
+	return warnings
+}
+
+// podRequestsComments states, as YAML comments, the requests the scheduler
+// reserves for each pod before and after the recommendations.
+func podRequestsComments(pr *usecase.PodRequests) []byte {
+	if pr == nil {
+		return nil
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Pod requests for scheduling: CPU %s -> %s, memory %s -> %s\n",
+		formatCPU(pr.Current, v1.ResourceCPU), formatCPU(pr.Recommended, v1.ResourceCPU),
+		formatMemory(pr.Current, v1.ResourceMemory), formatMemory(pr.Recommended, v1.ResourceMemory))
+	if len(pr.Overhead) > 0 {
+		fmt.Fprintf(&b, "#   including pod overhead of CPU %s, memory %s", formatCPU(pr.Overhead, v1.ResourceCPU), formatMemory(pr.Overhead, v1.ResourceMemory))
+		if pr.RuntimeClass != "" {
+			fmt.Fprintf(&b, " from RuntimeClass '%s'", pr.RuntimeClass)
+		}
+		b.WriteString("\n")
+	}
+	if len(pr.InitBound) > 0 {
+		names := make([]string, len(pr.InitBound))
+		for i, name := range pr.InitBound {
+			names[i] = string(name)
+		}
+		fmt.Fprintf(&b, "#   set by an init container: %s\n", strings.Join(names, ", "))
+	}
+	if pr.Nodes > 0 {
+		fmt.Fprintf(&b, "#   fits %d of %d schedulable node(s)\n", pr.FittingNodes, pr.Nodes)
+	}
+	return []byte(b.String())
+}
+
+func podRequestsWarnings(pr *usecase.PodRequests) []string {
+	if pr == nil {
+		return nil
+	}
+	var warnings []string
+	if pr.OverheadErr != nil {
+		warnings = append(warnings, fmt.Sprintf("Could not read RuntimeClass '%s', pod requests leave out its overhead: %v", pr.RuntimeClass, pr.OverheadErr))
+	}
+	if pr.NodesErr != nil {
+		warnings = append(warnings, fmt.Sprintf("Could not list nodes to check that the recommended pod requests fit: %v", pr.NodesErr))
+	}
+	if pr.Nodes > 0 && pr.FittingNodes == 0 {
+		var largest []string
+		if cpu, ok := pr.LargestFit[v1.ResourceCPU]; ok && cpu.Cmp(pr.Recommended[v1.ResourceCPU]) < 0 {
+			largest = append(largest, "CPU "+formatCPU(pr.LargestFit, v1.ResourceCPU))
+		}
+		if memory, ok := pr.LargestFit[v1.ResourceMemory]; ok && memory.Cmp(pr.Recommended[v1.ResourceMemory]) < 0 {
+			largest = append(largest, "memory "+formatMemoryFloor(pr.LargestFit, v1.ResourceMemory))
+		}
+		for _, name := range slices.Sorted(maps.Keys(pr.LargestFit)) {
+			if name == v1.ResourceCPU || name == v1.ResourceMemory {
+				continue
+			}
+			if q := pr.LargestFit[name]; q.Cmp(pr.Recommended[name]) < 0 {
+				largest = append(largest, fmt.Sprintf("%s %s", name, q.String()))
+			}
+		}
+		warning := fmt.Sprintf("Recommended pod requests (CPU %s, memory %s) fit none of the %d node(s) the pod can be scheduled on",
+			formatCPU(pr.Recommended, v1.ResourceCPU), formatMemory(pr.Recommended, v1.ResourceMemory), pr.Nodes)
+		if len(largest) > 0 {
+			warning += "; the largest pod requests that fit are " + strings.Join(largest, ", ")
+		}
+		warnings = append(warnings, warning)
+	}
+	for _, issue := range pr.LimitRangeIssues {
+		warnings = append(warnings, "Recommended pod resources would be rejected: "+issue)
+	}
+	return warnings
+}
+
+// quotaComments states, as YAML comments, the usage of each ResourceQuota
+// before and after the recommendations are applied to every replica.
+func quotaComments(q *usecase.QuotaAssessment) []byte {
+	if q == nil || len(q.Quotas) == 0 {
+		return nil
+	}
+	var b strings.Builder
+	for _, quota := range q.Quotas {
+		usage := make([]string, len(quota.Resources))
+		for i, r := range quota.Resources {
+			usage[i] = fmt.Sprintf("%s %s -> %s of %s", r.Name, formatQuota(r.Name, r.Used), formatQuota(r.Name, r.Projected), formatQuota(r.Name, r.Hard))
+		}
+		fmt.Fprintf(&b, "# ResourceQuota '%s' at %d replica(s): %s\n", quota.Name, q.Replicas, strings.Join(usage, ", "))
+	}
+	return []byte(b.String())
+}
+
+func quotaWarnings(q *usecase.QuotaAssessment) []string {
+	if q == nil {
+		return nil
+	}
+	var warnings []string
+	if q.Err != nil {
+		warnings = append(warnings, fmt.Sprintf("Could not list ResourceQuotas to project their usage: %v", q.Err))
+	}
+	for _, quota := range q.Quotas {
+		var exceeded, rollout []string
+		for _, r := range quota.Resources {
+			switch {
+			case r.Exceeded():
+				exceeded = append(exceeded, fmt.Sprintf("%s %s of %s", r.Name, formatQuota(r.Name, r.Projected), formatQuota(r.Name, r.Hard)))
+			case r.RolloutExceeded():
+				rollout = append(rollout, fmt.Sprintf("%s %s of %s", r.Name, formatQuota(r.Name, r.Rollout), formatQuota(r.Name, r.Hard)))
+			}
+		}
+		if len(exceeded) > 0 {
+			warnings = append(warnings, fmt.Sprintf("Recommended resources for %d replica(s) exceed ResourceQuota '%s' (%s); pods beyond the quota will be rejected", q.Replicas, quota.Name, strings.Join(exceeded, ", ")))
+		}
+		if len(rollout) > 0 {
+			warnings = append(warnings, fmt.Sprintf("A rolling update with %d extra pod(s) exceeds ResourceQuota '%s' (%s); lower maxSurge or raise the quota before applying", q.Surge, quota.Name, strings.Join(rollout, ", ")))
+		}
+		for _, name := range quota.MissingLimits {
+			warnings = append(warnings, fmt.Sprintf("ResourceQuota '%s' tracks %s but a recommended container sets no such limit and no LimitRange defaults one; its pods will be rejected", quota.Name, name))
+		}
+	}
+	return warnings
+}
+
+// formatQuota formats the usage of a quota resource like the pod resource it
+// counts.
+func formatQuota(name v1.ResourceName, q resource.Quantity) string {
+	list := v1.ResourceList{name: q}
+	if strings.HasSuffix(string(name), "cpu") {
+		return formatCPU(list, name)
+	}
+	return formatMemory(list, name)
+}
+
+// formatCPU formats the CPU of a resource list in millicores.
+func formatCPU(list v1.ResourceList, name v1.ResourceName) string {
+	q := list[name]
+	return resource.NewMilliQuantity(q.MilliValue(), resource.DecimalSI).String()
+}
+
+// formatMemory formats the memory of a resource list in a human-readable unit.
+func formatMemory(list v1.ResourceList, name v1.ResourceName) string {
+	q := list[name]
+	return formatMemoryHumanReadable(&q)
+}
+
+// formatMemoryFloor formats the memory of a resource list rounded down to Mi,
+// for limits that must not be exceeded.
+func formatMemoryFloor(list v1.ResourceList, name v1.ResourceName) string {
+	q := list[name]
+	return fmt.Sprintf("%dMi", q.Value()/(1024*1024))
+}
+
+// dataQualityComments summarizes the data behind each recommendation as YAML
+// comments, so the snippet stays valid when pasted into a manifest.
+func dataQualityComments(recs *usecase.AllRecommendations) []byte {
+	var b strings.Builder
+	for _, rec := range allContainers(recs) {
+		if rec.Recommendation == nil || rec.Recommendation.DataQuality == nil {
+			continue
+		}
+		if b.Len() == 0 {
+			b.WriteString("# Data quality:\n")
+		}
+		q := rec.Recommendation.DataQuality
+		fmt.Fprintf(&b, "#   %s: %s of data from %d pod(s), %d samples, %s of gaps, %d restart(s), confidence %s\n",
+			rec.ContainerName, model.Duration(q.Span), q.Pods, q.Samples, model.Duration(q.Gaps), q.Restarts, q.Confidence)
+	}
+	return []byte(b.String())
+}
+
+// omittedCPULimitComments reports, as YAML comments, the CPU limits the
+// policy left out of the snippet.
+func omittedCPULimitComments(recs *usecase.AllRecommendations) []byte {
+	var b strings.Builder
+	for _, rec := range allContainers(recs) {
+		if rec.Recommendation == nil || rec.Recommendation.CPU == nil || rec.Recommendation.CPU.SuggestedLimit == nil {
+			continue
+		}
+		if b.Len() == 0 {
+			b.WriteString("# CPU limits omitted by policy, the recommended limits would be:\n")
+		}
+		fmt.Fprintf(&b, "#   %s: %s\n", rec.ContainerName, rec.Recommendation.CPU.SuggestedLimit.String())
+	}
+	return []byte(b.String())
+}
+
+// oomSizingComments explains, as YAML comments, how the memory limits of
+// OOM-killed containers were raised.
+func oomSizingComments(recs *usecase.AllRecommendations) []byte {
+	var b strings.Builder
+	for _, rec := range allContainers(recs) {
+		if rec.Recommendation == nil || rec.Recommendation.OOMSizing == nil || rec.Recommendation.Memory == nil {
+			continue
+		}
+		if b.Len() == 0 {
+			b.WriteString("# Memory limits raised after OOM kills:\n")
+		}
+		sizing := rec.Recommendation.OOMSizing
+		if sizing.CurrentLimit == nil {
+			fmt.Fprintf(&b, "#   %s: %s, %s\n", rec.ContainerName, rec.Recommendation.Memory.String(), sizing.Reason)
+			continue
+		}
+		fmt.Fprintf(&b, "#   %s: %s -> %s (+%s), %s\n", rec.ContainerName, sizing.CurrentLimit.String(), rec.Recommendation.Memory.String(), sizing.Increase.String(), sizing.Reason)
+	}
+	return []byte(b.String())
+}
+
+// jvmComments states, as YAML comments, the heap option to set with the
+// memory limit of each Java container, and the JVM memory it's based on.
+func jvmComments(recs *usecase.AllRecommendations) []byte {
+	var b strings.Builder
+	for _, rec := range allContainers(recs) {
+		if rec.Recommendation == nil || rec.Recommendation.IsMissingData() || rec.Recommendation.JVM == nil {
+			continue
+		}
+		if b.Len() == 0 {
+			b.WriteString("# JVM heap (set with the memory limit):\n")
+		}
+		jvm := rec.Recommendation.JVM
+		fmt.Fprintf(&b, "#   %s: %s, max heap %s, %s for non-heap and native memory", rec.ContainerName, formatJVMFlag(jvm.Flag), formatMemoryHumanReadable(jvm.Heap), formatMemoryHumanReadable(jvm.Overhead))
+		if jvm.Flag != jvm.CurrentFlag {
+			fmt.Fprintf(&b, " (was %s)", formatJVMFlag(jvm.CurrentFlag))
+		}
+		if jvm.Usage != nil {
+			fmt.Fprintf(&b, "; peak heap %s, non-heap %s", formatMemoryHumanReadable(resource.NewQuantity(int64(jvm.Usage.Heap), resource.BinarySI)), formatMemoryHumanReadable(resource.NewQuantity(int64(jvm.Usage.NonHeap), resource.BinarySI)))
+		} else {
+			b.WriteString("; no JVM metrics")
+		}
+		b.WriteString("\n")
+	}
+	return []byte(b.String())
+}
+
+// formatJVMFlag names the heap option, or the JVM's default when none is
+// set.
+func formatJVMFlag(flag string) string {
+	if flag == "" {
+		return "default -XX:MaxRAMPercentage=25"
+	}
+	return flag
+}
+
+// ephemeralStorageComments states, as YAML comments, the peak ephemeral
+// storage each main container and native sidecar used and how evictions
+// raised its limit.
+func ephemeralStorageComments(recs *usecase.AllRecommendations) []byte {
+	var b strings.Builder
+	for _, rec := range allContainers(recs) {
+		if rec.Recommendation == nil || rec.Recommendation.IsMissingData() || rec.Recommendation.EphemeralStorage == nil {
+			continue
+		}
+		if b.Len() == 0 {
+			b.WriteString("# Ephemeral storage (writable layer and logs):\n")
+		}
+		storage := rec.Recommendation.EphemeralStorage
+		if storage.Request == nil {
+			fmt.Fprintf(&b, "#   %s: usage unknown, not sized\n", rec.ContainerName)
+			continue
+		}
+		fmt.Fprintf(&b, "#   %s: peak %s", rec.ContainerName, formatMemoryHumanReadable(resource.NewQuantity(int64(storage.Peak), resource.BinarySI)))
+		if storage.LimitRaised {
+			fmt.Fprintf(&b, ", limit raised from %s after evictions", storage.CurrentLimit.String())
+		}
+		b.WriteString("\n")
+	}
+	return []byte(b.String())
+}
+
+// hugePagesComments states, as YAML comments, the peak hugepages usage of
+// each main container and native sidecar against the hugepages it requests.
+func hugePagesComments(recs *usecase.AllRecommendations) []byte {
+	var b strings.Builder
+	for _, rec := range allContainers(recs) {
+		if rec.Recommendation == nil || rec.Recommendation.IsMissingData() {
+			continue
+		}
+		for _, u := range rec.Recommendation.HugePages {
+			name := v1.ResourceName(v1.ResourceHugePagesPrefix + u.PageSize)
+			limit, ok := rec.Recommendation.PassthroughLimits[name]
+			if !ok {
+				continue
+			}
+			if b.Len() == 0 {
+				b.WriteString("# Hugepages (kept as requested):\n")
+			}
+			fmt.Fprintf(&b, "#   %s: %s peak %s of %s", rec.ContainerName, name, formatMemoryHumanReadable(resource.NewQuantity(int64(u.Peak), resource.BinarySI)), limit.String())
+			if u.Failures > 0 {
+				fmt.Fprintf(&b, ", %.0f failed allocation(s)", u.Failures)
+			}
+			b.WriteString("\n")
+		}
+	}
+	return []byte(b.String())
+}
+
+// seasonalityComments compares, as YAML comments, the usage of each main
+// container and native sidecar inside and outside the peak window.
+func seasonalityComments(recs *usecase.AllRecommendations) []byte {
+	var b strings.Builder
+	for _, rec := range allContainers(recs) {
+		if rec.Recommendation == nil || rec.Recommendation.Seasonality == nil {
+			continue
+		}
+		s := rec.Recommendation.Seasonality
+		if b.Len() == 0 {
+			fmt.Fprintf(&b, "# Peak window %s (memory p99, CPU p90, CPU p99):\n", s.Window)
+		}
+		sized := ""
+		if s.SizedForPeak {
+			sized = ", sized for the peak"
+		}
+		fmt.Fprintf(&b, "#   %s: peak %s, off-peak %s%s\n", rec.ContainerName, formatUsage(s.Peak), formatUsage(s.OffPeak), sized)
+	}
+	return []byte(b.String())
+}
+
+// formatUsage formats usage percentiles as memory and CPU quantities.
+func formatUsage(u *entity.Usage) string {
+	if u == nil {
+		return "no data"
+	}
+	memory := resource.NewQuantity(int64(u.MemoryP99), resource.BinarySI)
+	cpuP90 := resource.NewMilliQuantity(int64(math.Ceil(u.CPUP90*1000)), resource.DecimalSI)
+	cpuP99 := resource.NewMilliQuantity(int64(math.Ceil(u.CPUP99*1000)), resource.DecimalSI)
+	return fmt.Sprintf("%s/%s/%s", formatMemoryHumanReadable(memory), cpuP90.String(), cpuP99.String())
+}
+
+// podDistributionComments lists, as YAML comments, how the p99 usage of each
+// main container and native sidecar is spread across its pods.
+func podDistributionComments(recs *usecase.AllRecommendations) []byte {
+	var b strings.Builder
+	for _, rec := range allContainers(recs) {
+		if rec.Recommendation == nil || rec.Recommendation.PodDistribution == nil {
+			continue
+		}
+		d := rec.Recommendation.PodDistribution
+		if b.Len() == 0 {
+			b.WriteString("# Per-pod p99 (min/median/max):\n")
+		}
+		memory := func(v float64) string {
+			return formatMemoryHumanReadable(resource.NewQuantity(int64(v), resource.BinarySI))
+		}
+		cpu := func(v float64) string {
+			return resource.NewMilliQuantity(int64(math.Ceil(v*1000)), resource.DecimalSI).String()
+		}
+		fmt.Fprintf(&b, "#   %s: memory %s/%s/%s, CPU %s/%s/%s across %d pods, sized for %s", rec.ContainerName,
+			memory(d.MemoryP99.Min), memory(d.MemoryP99.Median), memory(d.MemoryP99.Max),
+			cpu(d.CPUP99.Min), cpu(d.CPUP99.Median), cpu(d.CPUP99.Max), d.Pods, d.SizedFor)
+		switch {
+		case d.Outlier != "":
+			fmt.Fprintf(&b, " (outlier: %s)", d.Outlier)
+		case d.Imbalanced:
+			b.WriteString(" (imbalanced)")
+		}
+		b.WriteString("\n")
+	}
+	return []byte(b.String())
+}
+
+// hpaComments explains, as YAML comments, the CPU requests sized for an HPA
+// and the replica counts it is expected to settle at.
+func hpaComments(recs *usecase.AllRecommendations) []byte {
+	var b strings.Builder
+	for _, rec := range allContainers(recs) {
+		if rec.Recommendation == nil || rec.Recommendation.HPA == nil || rec.Recommendation.CPU == nil {
+			continue
+		}
+		h := rec.Recommendation.HPA
+		if b.Len() == 0 {
+			fmt.Fprintf(&b, "# HPA '%s' targets %.0f%% CPU utilization (%d-%d replicas", h.Name, h.TargetUtilization*100, h.MinReplicas, h.MaxReplicas)
+			if h.Replicas != nil {
+				fmt.Fprintf(&b, ", observed %.0f-%.0f, mean %.1f", h.Replicas.Min, h.Replicas.Max, h.Replicas.Mean)
+			}
+			b.WriteString("):\n")
+			if h.CurrentReplicas > 0 {
+				fmt.Fprintf(&b, "#   expected replicas under typical load: %d -> %d\n", h.CurrentReplicas, h.ExpectedReplicas)
+			} else {
+				fmt.Fprintf(&b, "#   expected replicas under typical load: %d\n", h.ExpectedReplicas)
+			}
+		}
+		fmt.Fprintf(&b, "#   %s: CPU request %s puts p50 usage at the target (%s without the HPA)\n", rec.ContainerName, rec.Recommendation.CPU.Request.String(), h.UnadjustedRequest.String())
+	}
+	return []byte(b.String())
+}
+
+// initCPUComments lists, as YAML comments, the CPU used by the heaviest run
+// of each one-shot init container and the startup time its CPU is sized for.
+func initCPUComments(recs *usecase.AllRecommendations) []byte {
+	var b strings.Builder
+	for _, rec := range recs.InitContainers {
+		if rec.Recommendation == nil || rec.Recommendation.InitCPU == nil {
+			continue
+		}
+		u := rec.Recommendation.InitCPU
+		if b.Len() == 0 {
+			b.WriteString("# Init container CPU (heaviest run):\n")
+		}
+		fmt.Fprintf(&b, "#   %s: %.0fs of CPU over %s", rec.ContainerName, u.CPUSeconds, model.Duration(u.Duration))
+		if u.PeakRate > 0 {
+			fmt.Fprintf(&b, ", peak %.2f cores", u.PeakRate)
+		}
+		fmt.Fprintf(&b, " across %d runs; request sized to finish within %s", u.Runs, model.Duration(u.TargetDuration))
+		switch {
+		case u.TargetUnreachable:
+			b.WriteString(" (unreachable)")
+		case u.CPUBound:
+			fmt.Fprintf(&b, " (held back by its CPU limit of %s, limit raised)", u.CurrentLimit.String())
+		}
+		b.WriteString("\n")
+	}
+	return []byte(b.String())
+}
+
+// forecastComments lists, as YAML comments, the resources each main
+// container and native sidecar needs at the forecast horizon and the growth they are based on.
+func forecastComments(recs *usecase.AllRecommendations) []byte {
+	var b strings.Builder
+	for _, rec := range allContainers(recs) {
+		if rec.Recommendation == nil || rec.Recommendation.Forecast == nil {
+			continue
+		}
+		f := rec.Recommendation.Forecast
+		requests, limits, err := resourceLists(&entity.Recommendation{Memory: f.Memory, MemoryRequest: f.MemoryRequest, CPU: f.CPU})
+		if err != nil {
+			continue
+		}
+		if b.Len() == 0 {
+			fmt.Fprintf(&b, "# Forecast for +%s (the snippet below sizes for today):\n", model.Duration(f.Horizon))
+		}
+		fmt.Fprintf(&b, "#   %s: memory %s, CPU %s\n", rec.ContainerName, formatGrowth(f.Trend.Memory, f.MemoryFactor), formatGrowth(f.Trend.CPU, f.CPUFactor))
+		fmt.Fprintf(&b, "#     requests: %s; limits: %s\n", formatResourceList(requests), formatResourceList(limits))
+	}
+	return []byte(b.String())
+}
+
+// formatGrowth formats a trend as weekly growth relative to today's usage,
+// with its fit and the factor it scales resources by.
+func formatGrowth(t entity.Trend, factor float64) string {
+	if t.Current <= 0 {
+		return "no usage"
+	}
+	weekly := t.GrowthRate * (7 * 24 * time.Hour).Seconds() / t.Current * 100
+	return fmt.Sprintf("%+.1f%%/week (R² %.2f) x%.2f", weekly, t.R2, factor)
+}
+
+// formatResourceList formats CPU and memory of a resource list, e.g.
+// "cpu 250m, memory 512Mi".
+func formatResourceList(list v1.ResourceList) string {
+	var parts []string
+	for _, name := range []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory} {
+		if q, ok := list[name]; ok {
+			parts = append(parts, fmt.Sprintf("%s %s", name, q.String()))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// memoryLeakWarning flags a probable memory leak and, if the limit was
+// projected to a target uptime, the limit it needs.
+func memoryLeakWarning(containerName string, trend *entity.MemoryTrend, limit *resource.Quantity) string {
+	warning := fmt.Sprintf("Probable memory leak in container '%s': working set grew steadily in %d of %d pod lifetimes, by up to %.1fMi/h",
+		containerName, trend.Growing, trend.Lifetimes, trend.GrowthRate*3600/(1024*1024))
+	if trend.LimitRaised {
+		warning += fmt.Sprintf("; memory limit raised to %s to last %s between restarts", formatMemoryHumanReadable(limit), model.Duration(trend.TargetUptime))
+	}
+	return warning
+}
+
+// maxListedOOMKills caps the kills listed in an OOM warning, and the
+// evictions listed in an eviction warning.
+const maxListedOOMKills = 5
+
+// oomKillWarning reports how often a container was OOMKilled, listing the
+// most recent kills.
+func oomKillWarning(rec usecase.NamedRecommendation) string {
+	kills := rec.Recommendation.OOMKills
+	if len(kills) == 0 {
+		return fmt.Sprintf("OOMKill detected for container '%s'", rec.ContainerName)
+	}
+	listed := kills[max(len(kills)-maxListedOOMKills, 0):]
+	times := make([]string, 0, len(listed))
+	for _, k := range listed {
+		at := "unknown time"
+		if !k.Time.IsZero() {
+			at = k.Time.UTC().Format(time.RFC3339)
+		}
+		times = append(times, fmt.Sprintf("%s at %s", k.Pod, at))
+	}
+	label := "kills"
+	if len(listed) < len(kills) {
+		label = fmt.Sprintf("last %d kills", len(listed))
+	}
+	return fmt.Sprintf("Container '%s' was OOMKilled %d time(s) (%s: %s)", rec.ContainerName, len(kills), label, strings.Join(times, ", "))
+}
+
+// storageEvictionWarning lists the ephemeral storage evictions of a container
+// and their causes.
+func storageEvictionWarning(containerName string, storage *entity.EphemeralStorage) string {
+	evictions := storage.Evictions
+	listed := evictions[max(len(evictions)-maxListedOOMKills, 0):]
+	described := make([]string, 0, len(listed))
+	for _, e := range listed {
+		at := "unknown time"
+		if !e.Time.IsZero() {
+			at = e.Time.UTC().Format(time.RFC3339)
+		}
+		described = append(described, fmt.Sprintf("%s at %s, %s", e.Pod, at, e.Cause))
+	}
+	label := "evictions"
+	if len(listed) < len(evictions) {
+		label = fmt.Sprintf("last %d evictions", len(listed))
+	}
+	warning := fmt.Sprintf("Pods of container '%s' were evicted %d time(s) for ephemeral storage (%s: %s)", containerName, len(evictions), label, strings.Join(described, "; "))
+	if storage.Request == nil {
+		warning += "; no filesystem usage metrics to size it from"
+	}
+	return warning
+}
+
+func metricErrorWarnings(rec usecase.NamedRecommendation) []string {
+	var warnings []string
+	for _, e := range rec.Recommendation.MetricErrors {
+		warnings = append(warnings, fmt.Sprintf("Could not fetch %s for container '%s': %v", e.Metric, rec.ContainerName, e.Err))
+	}
+	return warnings
+}
+
 func (p *YAMLPresenter) printYAML(yamlBytes []byte) {
 	if !p.silent {
 		fmt.Fprintln(p.writer, "\n--- Recommended Resource Snippet (paste into your Deployment YAML) ---")
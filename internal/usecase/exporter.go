@@ -0,0 +1,125 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/sequring/sculptor/internal/entity"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+)
+
+type ExporterUseCase struct {
+	k8sGateway  ExportDeploymentGateway
+	promGateway RawMetricsGateway
+	version     string
+	logger      *slog.Logger
+}
+
+func NewExporterUseCase(k8sGateway ExportDeploymentGateway, promGateway RawMetricsGateway, version string, logger *slog.Logger) *ExporterUseCase {
+	return &ExporterUseCase{
+		k8sGateway:  k8sGateway,
+		promGateway: promGateway,
+		version:     version,
+		logger:      logger,
+	}
+}
+
+// Export captures the deployment spec, its pods, OOM events, the cluster
+// objects the assessments read and the raw series of the deployment and every
+// analyzed container, ending at now.
+func (uc *ExporterUseCase) Export(ctx context.Context, params DeploymentParams, now time.Time) (*entity.Bundle, error) {
+	d, err := uc.k8sGateway.GetDeployment(ctx, params.Namespace, params.DeploymentName)
+	if err != nil {
+		return nil, fmt.Errorf("could not get deployment: %w", err)
+	}
+
+	var containers []string
+	for _, list := range [][]v1.Container{d.Spec.Template.Spec.InitContainers, d.Spec.Template.Spec.Containers} {
+		for _, c := range list {
+			if params.TargetContainer == "" || c.Name == params.TargetContainer {
+				containers = append(containers, c.Name)
+			}
+		}
+	}
+	if len(containers) == 0 {
+		return nil, fmt.Errorf("container '%s' not found in deployment '%s'", params.TargetContainer, params.DeploymentName)
+	}
+
+	pods, err := uc.k8sGateway.ListPods(ctx, d)
+	if err != nil {
+		return nil, fmt.Errorf("could not list pods: %w", err)
+	}
+	events, err := uc.k8sGateway.ListOOMKilledEvents(ctx, params.Namespace, pods)
+	if err != nil {
+		return nil, fmt.Errorf("could not list OOMKilled events: %w", err)
+	}
+
+	end := now.UTC().Truncate(time.Second)
+	bundle := &entity.Bundle{
+		Manifest: entity.BundleManifest{
+			SculptorVersion: uc.version,
+			CreatedAt:       end,
+			Namespace:       params.Namespace,
+			Deployment:      params.DeploymentName,
+			TimeRange:       params.TimeRange,
+			End:             end,
+		},
+		Deployment: d,
+		Pods:       pods,
+		Events:     events,
+	}
+	uc.captureClusterObjects(ctx, params.Namespace, d, bundle)
+
+	for _, containerName := range containers {
+		uc.logger.Info("Exporting raw series", "container", containerName, "range", params.TimeRange)
+		series, err := uc.promGateway.GetRawSeries(ctx, params.Namespace, params.DeploymentName, containerName, params.TimeRange, end)
+		if err != nil {
+			return nil, fmt.Errorf("could not export metrics for container '%s': %w", containerName, err)
+		}
+		bundle.Series = append(bundle.Series, series...)
+	}
+	replicas, err := uc.promGateway.GetRawDeploymentSeries(ctx, params.Namespace, params.DeploymentName, params.TimeRange, end)
+	if err != nil {
+		return nil, fmt.Errorf("could not export metrics for deployment '%s': %w", params.DeploymentName, err)
+	}
+	bundle.Series = append(bundle.Series, replicas...)
+
+	if len(bundle.Series) > 0 {
+		bundle.Manifest.Start = bundle.Series[0].Start
+		bundle.Manifest.Step = bundle.Series[0].Step.String()
+	}
+	return bundle, nil
+}
+
+// captureClusterObjects adds the HorizontalPodAutoscaler, RuntimeClass, nodes,
+// LimitRanges and ResourceQuotas the assessments read to the bundle. Objects
+// that can't be read, often for lack of RBAC access, are listed as uncaptured
+// instead of failing the export.
+func (uc *ExporterUseCase) captureClusterObjects(ctx context.Context, namespace string, d *appsv1.Deployment, bundle *entity.Bundle) {
+	uncaptured := func(kind string, err error) {
+		uc.logger.Warn("Could not capture cluster objects, offline analysis will skip the checks that need them", "kind", kind, "error", err)
+		bundle.Manifest.Uncaptured = append(bundle.Manifest.Uncaptured, kind)
+	}
+
+	var err error
+	if bundle.HPA, err = uc.k8sGateway.GetHorizontalPodAutoscaler(ctx, d); err != nil {
+		uncaptured(entity.BundleHPA, err)
+	}
+	if name := d.Spec.Template.Spec.RuntimeClassName; name != nil {
+		if bundle.RuntimeClass, err = uc.k8sGateway.GetRuntimeClass(ctx, *name); err != nil {
+			uncaptured(entity.BundleRuntimeClass, err)
+		}
+	}
+	if bundle.Nodes, err = uc.k8sGateway.ListNodes(ctx, &d.Spec.Template.Spec); err != nil {
+		uncaptured(entity.BundleNodes, err)
+	}
+	if bundle.LimitRanges, err = uc.k8sGateway.ListLimitRanges(ctx, namespace); err != nil {
+		uncaptured(entity.BundleLimitRanges, err)
+	}
+	if bundle.ResourceQuotas, err = uc.k8sGateway.ListResourceQuotas(ctx, namespace); err != nil {
+		uncaptured(entity.BundleResourceQuotas, err)
+	}
+}
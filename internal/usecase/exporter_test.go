@@ -0,0 +1,180 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sequring/sculptor/internal/entity"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	v1 "k8s.io/api/core/v1"
+	nodev1 "k8s.io/api/node/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// --- Mock Implementations ---
+
+type mockExportDeploymentGateway struct {
+	deployment *appsv1.Deployment
+	pods       []v1.Pod
+	events     []v1.Event
+	hpa        *autoscalingv2.HorizontalPodAutoscaler
+	nodes      []v1.Node
+	nodesErr   error
+}
+
+func (m *mockExportDeploymentGateway) GetDeployment(ctx context.Context, namespace, name string) (*appsv1.Deployment, error) {
+	if m.deployment == nil {
+		return nil, fmt.Errorf("deployment not found")
+	}
+	return m.deployment, nil
+}
+
+func (m *mockExportDeploymentGateway) ListPods(ctx context.Context, d *appsv1.Deployment) ([]v1.Pod, error) {
+	return m.pods, nil
+}
+
+func (m *mockExportDeploymentGateway) ListOOMKilledEvents(ctx context.Context, namespace string, pods []v1.Pod) ([]v1.Event, error) {
+	return m.events, nil
+}
+
+func (m *mockExportDeploymentGateway) GetHorizontalPodAutoscaler(ctx context.Context, d *appsv1.Deployment) (*autoscalingv2.HorizontalPodAutoscaler, error) {
+	return m.hpa, nil
+}
+
+func (m *mockExportDeploymentGateway) GetRuntimeClass(ctx context.Context, name string) (*nodev1.RuntimeClass, error) {
+	return nil, fmt.Errorf("runtime class not found")
+}
+
+func (m *mockExportDeploymentGateway) ListNodes(ctx context.Context, spec *v1.PodSpec) ([]v1.Node, error) {
+	return m.nodes, m.nodesErr
+}
+
+func (m *mockExportDeploymentGateway) ListLimitRanges(ctx context.Context, namespace string) ([]v1.LimitRange, error) {
+	return nil, nil
+}
+
+func (m *mockExportDeploymentGateway) ListResourceQuotas(ctx context.Context, namespace string) ([]v1.ResourceQuota, error) {
+	return nil, nil
+}
+
+type mockRawMetricsGateway struct {
+	containers []string
+	ends       []time.Time
+}
+
+func (m *mockRawMetricsGateway) GetRawSeries(ctx context.Context, namespace, deploymentName, containerName, timeRange string, end time.Time) ([]entity.RawSeries, error) {
+	m.containers = append(m.containers, containerName)
+	m.ends = append(m.ends, end)
+	return []entity.RawSeries{{
+		Container: containerName,
+		Metric:    "container_memory_working_set_bytes",
+		Start:     end.Add(-time.Hour),
+		End:       end,
+		Step:      30 * time.Second,
+	}}, nil
+}
+
+func (m *mockRawMetricsGateway) GetRawDeploymentSeries(ctx context.Context, namespace, deploymentName, timeRange string, end time.Time) ([]entity.RawSeries, error) {
+	return []entity.RawSeries{{
+		Metric: "kube_deployment_status_replicas",
+		Start:  end.Add(-time.Hour),
+		End:    end,
+		Step:   30 * time.Second,
+	}}, nil
+}
+
+// --- Test Suite ---
+
+func TestExporterUseCase_Export(t *testing.T) {
+	// Arrange
+	deploymentGW := &mockExportDeploymentGateway{
+		deployment: &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-ns"},
+			Spec: appsv1.DeploymentSpec{
+				Template: v1.PodTemplateSpec{
+					Spec: v1.PodSpec{
+						InitContainers: []v1.Container{{Name: "init-setup"}},
+						Containers:     []v1.Container{{Name: "main-app"}},
+					},
+				},
+			},
+		},
+		pods:     []v1.Pod{{ObjectMeta: metav1.ObjectMeta{Name: "test-deployment-abc"}}},
+		events:   []v1.Event{{Reason: "OOMKilled"}},
+		hpa:      &autoscalingv2.HorizontalPodAutoscaler{ObjectMeta: metav1.ObjectMeta{Name: "test-hpa"}},
+		nodesErr: fmt.Errorf("nodes is forbidden"),
+	}
+	metricsGW := &mockRawMetricsGateway{}
+	uc := NewExporterUseCase(deploymentGW, metricsGW, "v1.2.3", newTestLogger())
+	now := time.Date(2025, 6, 1, 12, 0, 0, 500, time.UTC)
+
+	// Act
+	bundle, err := uc.Export(context.Background(), DeploymentParams{
+		Namespace:      "test-ns",
+		DeploymentName: "test-deployment",
+		TimeRange:      "1h",
+	}, now)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(metricsGW.containers) != 2 || metricsGW.containers[0] != "init-setup" || metricsGW.containers[1] != "main-app" {
+		t.Errorf("expected series for init-setup and main-app, got %v", metricsGW.containers)
+	}
+	wantEnd := now.Truncate(time.Second)
+	for _, end := range metricsGW.ends {
+		if !end.Equal(wantEnd) {
+			t.Errorf("expected every query to end at %s, got %s", wantEnd, end)
+		}
+	}
+	if bundle.Manifest.SculptorVersion != "v1.2.3" || bundle.Manifest.TimeRange != "1h" {
+		t.Errorf("unexpected manifest: %+v", bundle.Manifest)
+	}
+	if !bundle.Manifest.Start.Equal(wantEnd.Add(-time.Hour)) || bundle.Manifest.Step != "30s" {
+		t.Errorf("unexpected manifest range: start %s, step %s", bundle.Manifest.Start, bundle.Manifest.Step)
+	}
+	if len(bundle.Pods) != 1 || len(bundle.Events) != 1 || len(bundle.Series) != 3 {
+		t.Errorf("expected 1 pod, 1 event and 3 series, got %d, %d and %d", len(bundle.Pods), len(bundle.Events), len(bundle.Series))
+	}
+	if bundle.Series[2].Metric != "kube_deployment_status_replicas" {
+		t.Errorf("expected the replica series last, got %s", bundle.Series[2].Metric)
+	}
+	if bundle.HPA == nil || bundle.HPA.Name != "test-hpa" {
+		t.Errorf("expected the HPA to be captured, got %v", bundle.HPA)
+	}
+	// The pod template names no RuntimeClass, so only the nodes are missing.
+	if len(bundle.Manifest.Uncaptured) != 1 || bundle.Manifest.Uncaptured[0] != entity.BundleNodes {
+		t.Errorf("expected only the nodes to be uncaptured, got %v", bundle.Manifest.Uncaptured)
+	}
+}
+
+func TestExporterUseCase_Export_ContainerNotFound(t *testing.T) {
+	// Arrange
+	deploymentGW := &mockExportDeploymentGateway{
+		deployment: &appsv1.Deployment{
+			Spec: appsv1.DeploymentSpec{
+				Template: v1.PodTemplateSpec{
+					Spec: v1.PodSpec{Containers: []v1.Container{{Name: "main-app"}}},
+				},
+			},
+		},
+	}
+	uc := NewExporterUseCase(deploymentGW, &mockRawMetricsGateway{}, "dev", newTestLogger())
+
+	// Act
+	_, err := uc.Export(context.Background(), DeploymentParams{
+		Namespace:       "test-ns",
+		DeploymentName:  "test-deployment",
+		TargetContainer: "missing",
+		TimeRange:       "1h",
+	}, time.Now())
+
+	// Assert
+	if err == nil {
+		t.Fatal("expected an error for a missing container")
+	}
+}
@@ -0,0 +1,135 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sequring/sculptor/internal/entity"
+)
+
+// FetchConfig bounds how metrics are fetched from the MetricsGateway.
+type FetchConfig struct {
+	// Concurrency is the maximum number of queries in flight.
+	Concurrency int
+	// QueryTimeout limits each individual attempt of a query.
+	QueryTimeout time.Duration
+	// Retries is the number of additional attempts after a failed query.
+	Retries int
+	// Backoff is the delay before the first retry; it doubles on every retry.
+	Backoff time.Duration
+}
+
+var defaultFetchConfig = FetchConfig{
+	Concurrency:  4,
+	QueryTimeout: time.Minute,
+	Retries:      2,
+	Backoff:      500 * time.Millisecond,
+}
+
+// Option configures a RecommenderUseCase.
+type Option func(*RecommenderUseCase)
+
+// WithFetchConfig overrides how metrics are fetched. A zero concurrency,
+// timeout or backoff keeps its default; Retries is always applied.
+func WithFetchConfig(cfg FetchConfig) Option {
+	return func(uc *RecommenderUseCase) {
+		if cfg.Concurrency > 0 {
+			uc.fetch.Concurrency = cfg.Concurrency
+		}
+		if cfg.QueryTimeout > 0 {
+			uc.fetch.QueryTimeout = cfg.QueryTimeout
+		}
+		uc.fetch.Retries = max(cfg.Retries, 0)
+		if cfg.Backoff > 0 {
+			uc.fetch.Backoff = cfg.Backoff
+		}
+	}
+}
+
+// metricFetch is a single metric query together with its outcome.
+type metricFetch struct {
+	container string
+	metric    string
+	query     func(ctx context.Context) (float64, error)
+	value     float64
+	err       error
+}
+
+// fetchMetrics runs all fetches concurrently, bounded by the configured
+// concurrency, and stores each value or error on its metricFetch.
+func (uc *RecommenderUseCase) fetchMetrics(ctx context.Context, fetches []*metricFetch) {
+	sem := make(chan struct{}, uc.fetch.Concurrency)
+	var wg sync.WaitGroup
+	for _, f := range fetches {
+		wg.Add(1)
+		go func(f *metricFetch) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				f.err = ctx.Err()
+				return
+			}
+			defer func() { <-sem }()
+			f.value, f.err = uc.fetchWithRetry(ctx, f)
+		}(f)
+	}
+	wg.Wait()
+}
+
+func (uc *RecommenderUseCase) fetchWithRetry(ctx context.Context, f *metricFetch) (float64, error) {
+	backoff := uc.fetch.Backoff
+	var err error
+	for attempt := 0; attempt <= uc.fetch.Retries; attempt++ {
+		if attempt > 0 {
+			uc.logger.Warn("Retrying metric query", "container", f.container, "metric", f.metric, "attempt", attempt, "backoff", backoff, "error", err)
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return 0, ctx.Err()
+			}
+			backoff *= 2
+		}
+
+		queryCtx, cancel := context.WithTimeout(ctx, uc.fetch.QueryTimeout)
+		var value float64
+		value, err = f.query(queryCtx)
+		cancel()
+		if err == nil || errors.Is(err, entity.ErrNoData) {
+			return value, err
+		}
+	}
+	return 0, err
+}
+
+// failedFetches converts the errors of completed fetches into metric errors,
+// skipping nil fetches, successful ones and queries that merely found no data.
+func failedFetches(fetches ...*metricFetch) []entity.MetricError {
+	var errs []entity.MetricError
+	for _, f := range fetches {
+		if f != nil && f.err != nil && !errors.Is(f.err, entity.ErrNoData) {
+			errs = append(errs, entity.MetricError{Metric: f.metric, Err: f.err})
+		}
+	}
+	return errs
+}
+
+// missingFetches describes required fetches that produced no value, either
+// because the query found no data or because it failed.
+func missingFetches(fetches ...*metricFetch) []string {
+	var issues []string
+	for _, f := range fetches {
+		if f == nil || f.err == nil {
+			continue
+		}
+		if errors.Is(f.err, entity.ErrNoData) {
+			issues = append(issues, fmt.Sprintf("no %s data", f.metric))
+		} else {
+			issues = append(issues, fmt.Sprintf("%s query failed", f.metric))
+		}
+	}
+	return issues
+}
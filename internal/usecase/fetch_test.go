@@ -0,0 +1,138 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newFetchTestUseCase(cfg FetchConfig) *RecommenderUseCase {
+	return NewRecommenderUseCase(&mockDeploymentGateway{}, &mockMetricsGateway{}, newTestLogger(), WithFetchConfig(cfg))
+}
+
+func TestFetchMetrics_BoundedConcurrency(t *testing.T) {
+	// Arrange
+	uc := newFetchTestUseCase(FetchConfig{Concurrency: 2})
+	var inFlight, maxInFlight int32
+	var fetches []*metricFetch
+	for i := 0; i < 10; i++ {
+		value := float64(i)
+		fetches = append(fetches, &metricFetch{metric: fmt.Sprintf("m%d", i), query: func(ctx context.Context) (float64, error) {
+			n := atomic.AddInt32(&inFlight, 1)
+			defer atomic.AddInt32(&inFlight, -1)
+			for {
+				old := atomic.LoadInt32(&maxInFlight)
+				if n <= old || atomic.CompareAndSwapInt32(&maxInFlight, old, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			return value, nil
+		}})
+	}
+
+	// Act
+	uc.fetchMetrics(context.Background(), fetches)
+
+	// Assert
+	if maxInFlight > 2 {
+		t.Errorf("expected at most 2 queries in flight, got %d", maxInFlight)
+	}
+	for i, f := range fetches {
+		if f.err != nil || f.value != float64(i) {
+			t.Errorf("fetch %d: got value %v, err %v", i, f.value, f.err)
+		}
+	}
+}
+
+func TestFetchMetrics_RetriesWithBackoff(t *testing.T) {
+	// Arrange
+	uc := newFetchTestUseCase(FetchConfig{Retries: 2, Backoff: time.Millisecond})
+	attempts := 0
+	f := &metricFetch{metric: "flaky", query: func(ctx context.Context) (float64, error) {
+		attempts++
+		if attempts < 3 {
+			return 0, fmt.Errorf("transient")
+		}
+		return 42, nil
+	}}
+
+	// Act
+	uc.fetchMetrics(context.Background(), []*metricFetch{f})
+
+	// Assert
+	if f.err != nil || f.value != 42 {
+		t.Errorf("expected 42 after retries, got value %v, err %v", f.value, f.err)
+	}
+	if attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestFetchMetrics_PerQueryTimeout(t *testing.T) {
+	// Arrange
+	uc := newFetchTestUseCase(FetchConfig{QueryTimeout: 10 * time.Millisecond, Retries: 0})
+	f := &metricFetch{metric: "slow", query: func(ctx context.Context) (float64, error) {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	}}
+
+	// Act
+	uc.fetchMetrics(context.Background(), []*metricFetch{f})
+
+	// Assert
+	if !errors.Is(f.err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", f.err)
+	}
+}
+
+func TestRecommenderUseCase_CalculateForDeployment_MetricErrors(t *testing.T) {
+	// Arrange
+	baseDeployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-ns"},
+		Spec: appsv1.DeploymentSpec{
+			Template: v1.PodTemplateSpec{
+				Spec: v1.PodSpec{
+					Containers: []v1.Container{{Name: "main-app"}, {Name: "sidecar"}},
+				},
+			},
+		},
+	}
+
+	deploymentGW := &mockDeploymentGateway{deployment: baseDeployment, checkOOMErr: fmt.Errorf("forbidden")}
+	metricsGW := &mockMetricsGateway{getMetricsErr: fmt.Errorf("prometheus unavailable")}
+	uc := NewRecommenderUseCase(deploymentGW, metricsGW, newTestLogger(), WithFetchConfig(FetchConfig{Retries: 0}))
+
+	params := DeploymentParams{
+		Namespace:      "test-ns",
+		DeploymentName: "test-deployment",
+		TimeRange:      "7d",
+	}
+
+	// Act
+	recommendations, err := uc.CalculateForDeployment(context.Background(), params)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(recommendations) != 2 {
+		t.Fatalf("expected 2 recommendations, got %d", len(recommendations))
+	}
+	for _, rec := range recommendations {
+		// OOM check plus memory, P90, P99 and P50 CPU.
+		if got := len(rec.Recommendation.MetricErrors); got != 5 {
+			t.Errorf("%s: expected 5 metric errors, got %d: %v", rec.ContainerName, got, rec.Recommendation.MetricErrors)
+		}
+	}
+	if recommendations[0].ContainerName != "main-app" || recommendations[1].ContainerName != "sidecar" {
+		t.Errorf("expected recommendations in container order, got %s, %s", recommendations[0].ContainerName, recommendations[1].ContainerName)
+	}
+}
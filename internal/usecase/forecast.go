@@ -0,0 +1,99 @@
+package usecase
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/sequring/sculptor/internal/entity"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	// forecastDefaultRange is the time range trends are fitted over when the
+	// policy doesn't set one.
+	forecastDefaultRange = "90d"
+	// forecastMinR2 is the share of variation a trend must explain to be
+	// projected. Usage that mostly varies around a level has no growth to
+	// plan for.
+	forecastMinR2 = 0.3
+)
+
+// forecastRange returns the time range usage trends are fitted over.
+func (uc *RecommenderUseCase) forecastRange() string {
+	if uc.policy.ForecastRange != "" {
+		return uc.policy.ForecastRange
+	}
+	return forecastDefaultRange
+}
+
+// forecast scales a recommendation by the growth its workload's usage trend
+// projects over the policy's horizon. It returns nil without a horizon, a
+// trend or resource values to scale.
+func (uc *RecommenderUseCase) forecast(trend *entity.UsageTrend, rec *entity.Recommendation) *entity.Forecast {
+	if uc.policy.ForecastHorizon <= 0 || trend == nil || rec.IsMissingData() || rec.Memory == nil || rec.CPU == nil {
+		return nil
+	}
+	f := &entity.Forecast{
+		Horizon:      uc.policy.ForecastHorizon,
+		Trend:        *trend,
+		MemoryFactor: growthFactor(trend.Memory, uc.policy.ForecastHorizon),
+		CPUFactor:    growthFactor(trend.CPU, uc.policy.ForecastHorizon),
+	}
+	f.Memory = scaleMemory(rec.Memory, f.MemoryFactor)
+	f.MemoryRequest = scaleMemory(rec.MemoryRequest, f.MemoryFactor)
+	f.CPU = &entity.CPURecommendation{
+		Request:        scaleCPU(rec.CPU.Request, f.CPUFactor),
+		Limit:          scaleCPU(rec.CPU.Limit, f.CPUFactor),
+		SuggestedLimit: scaleCPU(rec.CPU.SuggestedLimit, f.CPUFactor),
+	}
+	return f
+}
+
+// growthFactor is the usage a trend projects at the horizon relative to the
+// usage it fits today. Trends that decline or don't explain the usage give 1,
+// so a forecast never sizes below today.
+func growthFactor(t entity.Trend, horizon time.Duration) float64 {
+	if t.Current <= 0 || t.GrowthRate <= 0 || t.R2 < forecastMinR2 {
+		return 1
+	}
+	return (t.Current + t.GrowthRate*horizon.Seconds()) / t.Current
+}
+
+// scaleMemory multiplies a memory quantity by factor, rounded up to whole
+// mebibytes.
+func scaleMemory(q *resource.Quantity, factor float64) *resource.Quantity {
+	if q == nil {
+		return nil
+	}
+	bytes := int64(math.Ceil(float64(q.Value())*factor/mebibyte)) * mebibyte
+	return resource.NewQuantity(bytes, resource.BinarySI)
+}
+
+// scaleCPU multiplies a CPU quantity by factor, rounded up to whole
+// millicores, or to whole cores if the quantity already was, so that pinned
+// CPUs stay pinned.
+func scaleCPU(q *resource.Quantity, factor float64) *resource.Quantity {
+	if q == nil {
+		return nil
+	}
+	milli := int64(math.Ceil(float64(q.MilliValue()) * factor))
+	if q.MilliValue()%1000 == 0 {
+		milli = (milli + 999) / 1000 * 1000
+	}
+	return resource.NewMilliQuantity(milli, resource.DecimalSI)
+}
+
+// forecastWarnings flags trends fitted over much less data than the forecast
+// range asks for.
+func (uc *RecommenderUseCase) forecastWarnings(containerName string, f *entity.Forecast) []string {
+	if f == nil {
+		return nil
+	}
+	duration, err := model.ParseDuration(uc.forecastRange())
+	if err != nil || f.Trend.Span*2 >= time.Duration(duration) {
+		return nil
+	}
+	return []string{fmt.Sprintf("Forecast for container '%s' is fitted over %s of data, less than half the %s forecast range", containerName, model.Duration(f.Trend.Span.Round(time.Minute)), uc.forecastRange())}
+}
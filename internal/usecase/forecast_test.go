@@ -0,0 +1,102 @@
+package usecase
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sequring/sculptor/internal/entity"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const week = 7 * 24 * time.Hour
+
+func TestGrowthFactor(t *testing.T) {
+	tests := []struct {
+		name  string
+		trend entity.Trend
+		want  float64
+	}{
+		{name: "growing", trend: entity.Trend{Current: 100, GrowthRate: 10 / week.Seconds(), R2: 0.8}, want: 2.2},
+		{name: "declining", trend: entity.Trend{Current: 100, GrowthRate: -10 / week.Seconds(), R2: 0.8}, want: 1},
+		{name: "no clear trend", trend: entity.Trend{Current: 100, GrowthRate: 10 / week.Seconds(), R2: 0.1}, want: 1},
+		{name: "no usage", trend: entity.Trend{GrowthRate: 1, R2: 1}, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := growthFactor(tt.trend, 12*week); got < tt.want-1e-9 || got > tt.want+1e-9 {
+				t.Errorf("growthFactor() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScaleCPU(t *testing.T) {
+	if got := scaleCPU(resource.NewMilliQuantity(250, resource.DecimalSI), 1.1); got.MilliValue() != 275 {
+		t.Errorf("expected 275m, got %s", got.String())
+	}
+	if got := scaleCPU(resource.NewMilliQuantity(2000, resource.DecimalSI), 1.1); got.MilliValue() != 3000 {
+		t.Errorf("expected whole cores to stay whole, got %s", got.String())
+	}
+	if scaleCPU(nil, 2) != nil {
+		t.Error("expected nil for no quantity")
+	}
+}
+
+func TestRecommenderUseCase_CalculateForDeployment_Forecast(t *testing.T) {
+	// Arrange
+	deploymentGW := &mockDeploymentGateway{
+		deployment: &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-ns"},
+			Spec: appsv1.DeploymentSpec{
+				Template: v1.PodTemplateSpec{
+					Spec: v1.PodSpec{Containers: []v1.Container{{Name: "main-app"}}},
+				},
+			},
+		},
+	}
+	metricsGW := &mockMetricsGateway{
+		memValue:    500 * mebibyte,
+		cpuP90Value: 0.2,
+		cpuP99Value: 0.4,
+		cpuP50Value: 0.2,
+		usageTrend: &entity.UsageTrend{
+			Span:   30 * 24 * time.Hour,
+			Memory: entity.Trend{Current: 1000 * mebibyte, GrowthRate: 50 * mebibyte / week.Seconds(), R2: 0.9},
+			CPU:    entity.Trend{Current: 1, GrowthRate: 0.01 / week.Seconds(), R2: 0.05},
+		},
+	}
+	uc := NewRecommenderUseCase(deploymentGW, metricsGW, newTestLogger(), WithPolicy(Policy{ForecastHorizon: 4 * week}))
+
+	// Act
+	recs, err := uc.CalculateForDeployment(context.Background(), DeploymentParams{
+		Namespace:      "test-ns",
+		DeploymentName: "test-deployment",
+		TimeRange:      "7d",
+	})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rec := recs[0].Recommendation
+	f := rec.Forecast
+	if f == nil {
+		t.Fatal("expected a forecast")
+	}
+	// 1000Mi growing 50Mi/week for 4 weeks is 20% more than today's 600Mi.
+	if want := int64(720 * mebibyte); f.Memory.Value() != want {
+		t.Errorf("forecast memory: got %d, want %d", f.Memory.Value(), want)
+	}
+	if f.CPUFactor != 1 || f.CPU.Request.Cmp(*rec.CPU.Request) != 0 {
+		t.Errorf("expected CPU without a clear trend to stay at today's request, got factor %v and %s", f.CPUFactor, f.CPU.Request.String())
+	}
+	if len(rec.Warnings) != 1 || !strings.Contains(rec.Warnings[0], "less than half the 90d forecast range") {
+		t.Errorf("expected a short trend warning, got %v", rec.Warnings)
+	}
+}
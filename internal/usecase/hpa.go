@@ -0,0 +1,177 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/sequring/sculptor/internal/entity"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// hpaPlan is a HorizontalPodAutoscaler that scales a Deployment on CPU
+// utilization, with the replica counts observed over the time range.
+type hpaPlan struct {
+	name string
+	// utilization is the target average CPU utilization as a fraction of
+	// the CPU requests.
+	utilization float64
+	// container is the only container counted by a ContainerResource
+	// metric. Empty counts every container of the pod.
+	container    string
+	minReplicas  int32
+	maxReplicas  int32
+	replicas     *metricFetch
+	replicaStats *entity.ReplicaStats
+}
+
+// cpuUtilizationHPA returns the CPU utilization target of an HPA, or nil if
+// it doesn't scale on CPU utilization. Other targets don't depend on the CPU
+// request.
+func cpuUtilizationHPA(hpa *autoscalingv2.HorizontalPodAutoscaler) *hpaPlan {
+	if hpa == nil {
+		return nil
+	}
+	for _, m := range hpa.Spec.Metrics {
+		var name v1.ResourceName
+		var target autoscalingv2.MetricTarget
+		var container string
+		switch {
+		case m.Type == autoscalingv2.ResourceMetricSourceType && m.Resource != nil:
+			name, target = m.Resource.Name, m.Resource.Target
+		case m.Type == autoscalingv2.ContainerResourceMetricSourceType && m.ContainerResource != nil:
+			name, target, container = m.ContainerResource.Name, m.ContainerResource.Target, m.ContainerResource.Container
+		default:
+			continue
+		}
+		if name != v1.ResourceCPU || target.Type != autoscalingv2.UtilizationMetricType || target.AverageUtilization == nil || *target.AverageUtilization <= 0 {
+			continue
+		}
+		h := &hpaPlan{
+			name:        hpa.Name,
+			utilization: float64(*target.AverageUtilization) / 100,
+			container:   container,
+			minReplicas: 1,
+			maxReplicas: hpa.Spec.MaxReplicas,
+		}
+		if hpa.Spec.MinReplicas != nil {
+			h.minReplicas = *hpa.Spec.MinReplicas
+		}
+		return h
+	}
+	return nil
+}
+
+// covers reports whether the HPA's utilization counts the container.
+func (h *hpaPlan) covers(containerName string) bool {
+	return h != nil && (h.container == "" || h.container == containerName)
+}
+
+// scaling describes the HPA for a container whose request it shaped.
+func (h *hpaPlan) scaling(unadjustedRequest *resource.Quantity) *entity.HPAScaling {
+	return &entity.HPAScaling{
+		Name:              h.name,
+		TargetUtilization: h.utilization,
+		MinReplicas:       h.minReplicas,
+		MaxReplicas:       h.maxReplicas,
+		Replicas:          h.replicaStats,
+		UnadjustedRequest: unadjustedRequest,
+	}
+}
+
+// settle returns the replica count at which total CPU usage is the target
+// share of the per-pod request, within the HPA's bounds.
+func (h *hpaPlan) settle(totalUsage, request float64) int32 {
+	replicas := int32(math.Ceil(totalUsage / (h.utilization * request)))
+	return min(max(replicas, h.minReplicas), h.maxReplicas)
+}
+
+// observedReplicas returns the mean replica count over the time range, or the
+// Deployment's current count if the history is unknown.
+func (h *hpaPlan) observedReplicas(d *appsv1.Deployment) float64 {
+	if h.replicaStats != nil {
+		return h.replicaStats.Mean
+	}
+	if d.Status.Replicas > 0 {
+		return float64(d.Status.Replicas)
+	}
+	if d.Spec.Replicas != nil {
+		return float64(*d.Spec.Replicas)
+	}
+	return 1
+}
+
+// typicalCPU returns the CPU usage of an average pod under typical load: the
+// mean of the per-pod p50s, or busiestP50, the p50 across all pods, which is
+// that of the busiest pod, without per-pod usage.
+func typicalCPU(pods []entity.PodUsage, busiestP50 float64) float64 {
+	if len(pods) == 0 {
+		return busiestP50
+	}
+	var sum float64
+	for _, p := range pods {
+		sum += p.CPUP50
+	}
+	return sum / float64(len(pods))
+}
+
+// AssessHPA estimates the replica counts the HPA settles at under typical
+// load: the observed replicas, each running at the typical usage of every
+// container the HPA counts, with the current and the recommended requests of
+// those containers. Main containers and native sidecars are summed together,
+// as the HPA does, so it runs once on the final recommendations.
+func (uc *RecommenderUseCase) AssessHPA(ctx context.Context, params DeploymentParams, recs *AllRecommendations) error {
+	var shaped []NamedRecommendation
+	for _, rec := range append(append([]NamedRecommendation{}, recs.MainContainers...), recs.InitContainers...) {
+		if rec.Recommendation != nil && rec.Recommendation.HPA != nil {
+			shaped = append(shaped, rec)
+		}
+	}
+	if len(shaped) == 0 {
+		return nil
+	}
+	d, err := uc.k8sGateway.GetDeployment(ctx, params.Namespace, params.DeploymentName)
+	if err != nil {
+		return fmt.Errorf("could not get deployment: %w", err)
+	}
+
+	scaling := shaped[0].Recommendation.HPA
+	h := &hpaPlan{
+		name:         scaling.Name,
+		utilization:  scaling.TargetUtilization,
+		minReplicas:  scaling.MinReplicas,
+		maxReplicas:  scaling.MaxReplicas,
+		replicaStats: scaling.Replicas,
+	}
+	var usage, current, recommended float64
+	currentKnown := true
+	for _, rec := range shaped {
+		usage += rec.Recommendation.HPA.TypicalUsage
+		recommended += rec.Recommendation.CPU.Request.AsApproximateFloat64()
+		if request := containerCPURequest(d, rec.ContainerName); request != nil && !request.IsZero() {
+			current += request.AsApproximateFloat64()
+		} else {
+			currentKnown = false
+		}
+	}
+
+	totalUsage := h.observedReplicas(d) * usage
+	expected := h.settle(totalUsage, recommended)
+	var currentReplicas int32
+	if currentKnown {
+		currentReplicas = h.settle(totalUsage, current)
+	}
+	atMax := h.replicaStats != nil && h.replicaStats.Max >= float64(h.maxReplicas)
+	for _, rec := range shaped {
+		rec.Recommendation.HPA.CurrentReplicas = currentReplicas
+		rec.Recommendation.HPA.ExpectedReplicas = expected
+		if atMax {
+			rec.Recommendation.Warnings = append(rec.Recommendation.Warnings, fmt.Sprintf("HPA '%s' reached its maximum of %d replicas, so the CPU usage of container '%s' may be higher than it would be with more replicas", h.name, h.maxReplicas, rec.ContainerName))
+		}
+	}
+	uc.logger.Info("Estimated HPA replica impact", "hpa", h.name, "currentReplicas", currentReplicas, "expectedReplicas", expected)
+	return nil
+}
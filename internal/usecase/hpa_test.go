@@ -0,0 +1,243 @@
+package usecase
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sequring/sculptor/internal/entity"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func cpuUtilizationMetric(utilization int32) autoscalingv2.MetricSpec {
+	return autoscalingv2.MetricSpec{
+		Type: autoscalingv2.ResourceMetricSourceType,
+		Resource: &autoscalingv2.ResourceMetricSource{
+			Name:   v1.ResourceCPU,
+			Target: autoscalingv2.MetricTarget{Type: autoscalingv2.UtilizationMetricType, AverageUtilization: &utilization},
+		},
+	}
+}
+
+func TestCPUUtilizationHPA(t *testing.T) {
+	minReplicas := int32(2)
+	averageValue := resource.MustParse("500m")
+	tests := []struct {
+		name    string
+		metrics []autoscalingv2.MetricSpec
+		want    *hpaPlan
+	}{
+		{
+			name:    "CPU utilization",
+			metrics: []autoscalingv2.MetricSpec{cpuUtilizationMetric(70)},
+			want:    &hpaPlan{name: "api", utilization: 0.7, minReplicas: 2, maxReplicas: 10},
+		},
+		{
+			name: "container CPU utilization",
+			metrics: []autoscalingv2.MetricSpec{{
+				Type: autoscalingv2.ContainerResourceMetricSourceType,
+				ContainerResource: &autoscalingv2.ContainerResourceMetricSource{
+					Name:      v1.ResourceCPU,
+					Container: "app",
+					Target:    cpuUtilizationMetric(50).Resource.Target,
+				},
+			}},
+			want: &hpaPlan{name: "api", utilization: 0.5, container: "app", minReplicas: 2, maxReplicas: 10},
+		},
+		{
+			name: "CPU average value",
+			metrics: []autoscalingv2.MetricSpec{{
+				Type: autoscalingv2.ResourceMetricSourceType,
+				Resource: &autoscalingv2.ResourceMetricSource{
+					Name:   v1.ResourceCPU,
+					Target: autoscalingv2.MetricTarget{Type: autoscalingv2.AverageValueMetricType, AverageValue: &averageValue},
+				},
+			}},
+		},
+		{
+			name: "memory utilization",
+			metrics: []autoscalingv2.MetricSpec{{
+				Type: autoscalingv2.ResourceMetricSourceType,
+				Resource: &autoscalingv2.ResourceMetricSource{
+					Name:   v1.ResourceMemory,
+					Target: cpuUtilizationMetric(80).Resource.Target,
+				},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hpa := &autoscalingv2.HorizontalPodAutoscaler{
+				ObjectMeta: metav1.ObjectMeta{Name: "api"},
+				Spec:       autoscalingv2.HorizontalPodAutoscalerSpec{MinReplicas: &minReplicas, MaxReplicas: 10, Metrics: tt.metrics},
+			}
+
+			got := cpuUtilizationHPA(hpa)
+
+			if tt.want == nil {
+				if got != nil {
+					t.Errorf("expected no CPU utilization target, got %+v", got)
+				}
+				return
+			}
+			if got == nil || *got != *tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHPAPlan_Settle(t *testing.T) {
+	h := &hpaPlan{utilization: 0.5, minReplicas: 2, maxReplicas: 5}
+
+	if got := h.settle(1.6, 0.4); got != 5 {
+		t.Errorf("expected 8 replicas to be capped at 5, got %d", got)
+	}
+	if got := h.settle(0.3, 0.4); got != 2 {
+		t.Errorf("expected 2 replicas at the minimum, got %d", got)
+	}
+	if got := h.settle(1.0, 0.5); got != 4 {
+		t.Errorf("expected 4 replicas, got %d", got)
+	}
+}
+
+func TestRecommenderUseCase_CalculateForAll_HPA(t *testing.T) {
+	// Arrange
+	minReplicas := int32(2)
+	deploymentGW := &mockDeploymentGateway{
+		deployment: &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-ns"},
+			Spec: appsv1.DeploymentSpec{
+				Template: v1.PodTemplateSpec{
+					Spec: v1.PodSpec{Containers: []v1.Container{{
+						Name:      "main-app",
+						Resources: v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")}},
+					}}},
+				},
+			},
+		},
+		hpa: &autoscalingv2.HorizontalPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-hpa"},
+			Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+				MinReplicas: &minReplicas,
+				MaxReplicas: 6,
+				Metrics:     []autoscalingv2.MetricSpec{cpuUtilizationMetric(50)},
+			},
+		},
+	}
+	metricsGW := &mockMetricsGateway{
+		memValue:     200 * mebibyte,
+		cpuP90Value:  0.3,
+		cpuP99Value:  0.35,
+		cpuP50Value:  0.2,
+		replicaStats: &entity.ReplicaStats{Min: 2, Max: 6, Mean: 4},
+	}
+	uc := NewRecommenderUseCase(deploymentGW, metricsGW, newTestLogger())
+
+	// Act
+	recs, err := uc.CalculateForAll(context.Background(), "test-ns", "test-deployment", "", "7d")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rec := recs.MainContainers[0].Recommendation
+	// p50 of 200m at a 50% target.
+	if got := rec.CPU.Request.MilliValue(); got != 400 {
+		t.Errorf("CPU request: got %dm, want 400m", got)
+	}
+	if got := rec.CPU.Limit.MilliValue(); got != 400 {
+		t.Errorf("CPU limit: got %dm, want it raised to the 400m request", got)
+	}
+	if rec.HPA == nil {
+		t.Fatal("expected the HPA to be reported")
+	}
+	if got := rec.HPA.UnadjustedRequest.MilliValue(); got != 300 {
+		t.Errorf("unadjusted request: got %dm, want 300m", got)
+	}
+	// 4 replicas at 200m is 800m in total: 2 replicas of 1 CPU at 50%, or
+	// 4 replicas of 400m.
+	if rec.HPA.CurrentReplicas != 2 || rec.HPA.ExpectedReplicas != 4 {
+		t.Errorf("replicas: got %d -> %d, want 2 -> 4", rec.HPA.CurrentReplicas, rec.HPA.ExpectedReplicas)
+	}
+	if len(rec.Warnings) != 1 || !strings.Contains(rec.Warnings[0], "reached its maximum of 6 replicas") {
+		t.Errorf("expected a max replicas warning, got %v", rec.Warnings)
+	}
+}
+
+func TestRecommenderUseCase_CalculateForAll_HPAWithSidecar(t *testing.T) {
+	// Arrange
+	always := v1.ContainerRestartPolicyAlways
+	deploymentGW := &mockDeploymentGateway{
+		deployment: &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-ns"},
+			Spec: appsv1.DeploymentSpec{
+				Template: v1.PodTemplateSpec{
+					Spec: v1.PodSpec{
+						InitContainers: []v1.Container{{
+							Name:          "proxy",
+							RestartPolicy: &always,
+							Resources:     v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")}},
+						}},
+						Containers: []v1.Container{{
+							Name:      "main-app",
+							Resources: v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")}},
+						}},
+					},
+				},
+			},
+		},
+		hpa: &autoscalingv2.HorizontalPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-hpa"},
+			Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+				MaxReplicas: 20,
+				Metrics:     []autoscalingv2.MetricSpec{cpuUtilizationMetric(50)},
+			},
+		},
+	}
+	// The busiest pod's p50 is 200m, but the average pod uses 100m.
+	metricsGW := &mockMetricsGateway{
+		memValue:    200 * mebibyte,
+		cpuP90Value: 0.3,
+		cpuP99Value: 0.35,
+		cpuP50Value: 0.2,
+		podUsage: []entity.PodUsage{
+			{Pod: "api-1", Usage: entity.Usage{MemoryP99: 200 * mebibyte, CPUP90: 0.3, CPUP99: 0.35}, CPUP50: 0.2},
+			{Pod: "api-2", Usage: entity.Usage{MemoryP99: 200 * mebibyte, CPUP90: 0.1, CPUP99: 0.1}, CPUP50: 0.05},
+			{Pod: "api-3", Usage: entity.Usage{MemoryP99: 200 * mebibyte, CPUP90: 0.1, CPUP99: 0.1}, CPUP50: 0.05},
+		},
+		replicaStats: &entity.ReplicaStats{Min: 8, Max: 8, Mean: 8},
+	}
+	uc := NewRecommenderUseCase(deploymentGW, metricsGW, newTestLogger())
+
+	// Act
+	recs, err := uc.CalculateForAll(context.Background(), "test-ns", "test-deployment", "", "7d")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	main, sidecar := recs.MainContainers[0].Recommendation, recs.InitContainers[0].Recommendation
+	if main.HPA == nil || sidecar.HPA == nil {
+		t.Fatal("expected the HPA to be reported for both containers")
+	}
+	// 8 replicas at 100m in each container is 1.6 CPU in total: 2 replicas of
+	// 2 CPU at 50%, or 4 replicas of 800m.
+	for _, h := range []*entity.HPAScaling{main.HPA, sidecar.HPA} {
+		if h.CurrentReplicas != 2 || h.ExpectedReplicas != 4 {
+			t.Errorf("replicas: got %d -> %d, want 2 -> 4", h.CurrentReplicas, h.ExpectedReplicas)
+		}
+	}
+	// Main containers and sidecars share the deployment's lookups.
+	if deploymentGW.hpaLookups != 1 || metricsGW.replicaQueries != 1 {
+		t.Errorf("expected one HPA lookup and one replica query, got %d and %d", deploymentGW.hpaLookups, metricsGW.replicaQueries)
+	}
+	if deploymentGW.oomKillLists != 1 || deploymentGW.evictionLists != 1 {
+		t.Errorf("expected the pods' kills and evictions to be listed once, got %d and %d", deploymentGW.oomKillLists, deploymentGW.evictionLists)
+	}
+}
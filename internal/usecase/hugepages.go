@@ -0,0 +1,53 @@
+package usecase
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sequring/sculptor/internal/entity"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// hugePagesUnusedPercent is the share of requested hugepages below which the
+// peak usage is reported as wasted: hugepages are reserved on the node
+// whether they are used or not.
+const hugePagesUnusedPercent = 50
+
+// requestsHugePages reports whether a container requests or limits hugepages.
+func requestsHugePages(c *v1.Container) bool {
+	if c == nil {
+		return false
+	}
+	for _, list := range []v1.ResourceList{c.Resources.Requests, c.Resources.Limits} {
+		for name := range list {
+			if strings.HasPrefix(string(name), v1.ResourceHugePagesPrefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hugePagesWarnings warns about hugepages allocations that failed at the
+// container's limit, and about hugepages the container requests but leaves
+// mostly unused. Hugepages are kept as requested either way.
+func hugePagesWarnings(containerName string, usage []entity.HugePagesUsage, limits v1.ResourceList) []string {
+	var warnings []string
+	for _, u := range usage {
+		name := v1.ResourceName(v1.ResourceHugePagesPrefix + u.PageSize)
+		limit, ok := limits[name]
+		if !ok {
+			continue
+		}
+		if u.Failures > 0 {
+			warnings = append(warnings, fmt.Sprintf("Container '%s' failed %.0f %s allocation(s) at its limit of %s. Raise the hugepages request and limit.", containerName, u.Failures, name, limit.String()))
+			continue
+		}
+		if u.Peak < limit.AsApproximateFloat64()*hugePagesUnusedPercent/100 {
+			peak := resource.NewQuantity(int64(u.Peak), resource.BinarySI)
+			warnings = append(warnings, fmt.Sprintf("Container '%s' used at most %s of the %s of %s it reserves. Consider lowering the hugepages request and limit.", containerName, peak.String(), limit.String(), name))
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,41 @@
+package usecase
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sequring/sculptor/internal/entity"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestHugePagesWarnings(t *testing.T) {
+	limits := v1.ResourceList{"hugepages-2Mi": *mustParseQuantity("256Mi"), "hugepages-1Gi": *mustParseQuantity("4Gi")}
+
+	tests := []struct {
+		name  string
+		usage []entity.HugePagesUsage
+		want  string
+	}{
+		{name: "well used", usage: []entity.HugePagesUsage{{PageSize: "2Mi", Peak: 200 * mebibyte}}},
+		{name: "mostly unused", usage: []entity.HugePagesUsage{{PageSize: "2Mi", Peak: 64 * mebibyte}}, want: "used at most 64Mi of the 256Mi"},
+		{name: "failed allocations", usage: []entity.HugePagesUsage{{PageSize: "2Mi", Peak: 256 * mebibyte, Failures: 3}}, want: "failed 3 hugepages-2Mi allocation(s)"},
+		{name: "1Gi pages mostly unused", usage: []entity.HugePagesUsage{{PageSize: "1Gi", Peak: 1024 * mebibyte}}, want: "used at most 1Gi of the 4Gi"},
+		{name: "page size not requested", usage: []entity.HugePagesUsage{{PageSize: "64Ki", Peak: 0}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings := hugePagesWarnings("app", tt.usage, limits)
+
+			if tt.want == "" {
+				if len(warnings) != 0 {
+					t.Errorf("expected no warnings, got %v", warnings)
+				}
+				return
+			}
+			if len(warnings) != 1 || !strings.Contains(warnings[0], tt.want) {
+				t.Errorf("expected a warning containing %q, got %v", tt.want, warnings)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package usecase
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/sequring/sculptor/internal/entity"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// initCPUBoundPercent of the current CPU limit reached by the peak rate means
+// the runs were held back by the limit rather than by their own work.
+const initCPUBoundPercent = 90
+
+// initCPU sizes the CPU of a one-shot init container from the CPU its runs
+// used. The request is the CPU rate that does the heaviest run's work within
+// the policy's target startup time, or within its observed duration without
+// one, since requesting more than a run can use doesn't start the pod any
+// sooner. The limit leaves room for the observed peak rate. A run whose peak
+// rate reached the current limit was held back by it, so its peak says
+// nothing about what it could use: the request is sized for the target as
+// is, and the limit raised above the current one. Without CPU data the
+// defaults are returned and usage is nil.
+func (uc *RecommenderUseCase) initCPU(usage *entity.InitCPUUsage, currentLimit *resource.Quantity) (request, limit *resource.Quantity, _ *entity.InitCPUUsage) {
+	defaultRequest := resource.MustParse(initCPURequestDefault)
+	defaultLimit := resource.MustParse(initCPULimitDefault)
+
+	target := uc.policy.InitTargetDuration
+	if target <= 0 && usage != nil {
+		target = usage.Duration
+	}
+	if usage == nil || usage.CPUSeconds <= 0 || target <= 0 {
+		return &defaultRequest, &defaultLimit, nil
+	}
+
+	usage.TargetDuration = target
+	if currentLimit != nil && !currentLimit.IsZero() && usage.PeakRate >= currentLimit.AsApproximateFloat64()*initCPUBoundPercent/100 {
+		usage.CPUBound = true
+		usage.CurrentLimit = currentLimit
+	}
+	rate := usage.CPUSeconds / target.Seconds()
+	if usage.PeakRate > 0 && rate > usage.PeakRate && !usage.CPUBound {
+		usage.TargetUnreachable = uc.policy.InitTargetDuration > 0
+		rate = usage.PeakRate
+	}
+	requestMilli := max(int64(math.Ceil(rate*1000)), minCPURequestMilli)
+
+	limitMilli := defaultLimit.MilliValue()
+	if usage.PeakRate > 0 {
+		limitMilli = max(int64(math.Ceil(usage.PeakRate*1000)), minCPULimitMilli)
+	}
+	if usage.CPUBound {
+		limitMilli = max(limitMilli, int64(math.Ceil(currentLimit.AsApproximateFloat64()*cpuThrottlingMultiplier*1000)))
+	}
+	limitMilli = max(limitMilli, requestMilli)
+
+	return resource.NewMilliQuantity(requestMilli, resource.DecimalSI), resource.NewMilliQuantity(limitMilli, resource.DecimalSI), usage
+}
+
+// initCPUWarnings explains when an init container can't finish within the
+// target startup time.
+func initCPUWarnings(containerName string, usage *entity.InitCPUUsage) []string {
+	if usage == nil || !usage.TargetUnreachable {
+		return nil
+	}
+	expected := time.Duration(usage.CPUSeconds / usage.PeakRate * float64(time.Second)).Round(time.Second)
+	return []string{fmt.Sprintf("Init container '%s' used %.0fs of CPU at up to %.2f cores and can't finish within %s; expect about %s", containerName, usage.CPUSeconds, usage.PeakRate, model.Duration(usage.TargetDuration), model.Duration(expected))}
+}
@@ -0,0 +1,151 @@
+package usecase
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sequring/sculptor/internal/entity"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestInitCPU(t *testing.T) {
+	tests := []struct {
+		name            string
+		target          time.Duration
+		currentLimit    string
+		usage           *entity.InitCPUUsage
+		wantRequest     int64
+		wantLimit       int64
+		wantUnreachable bool
+		wantCPUBound    bool
+	}{
+		{
+			name:        "no data",
+			wantRequest: 100,
+			wantLimit:   1000,
+		},
+		{
+			name:        "observed duration",
+			usage:       &entity.InitCPUUsage{Runs: 1, CPUSeconds: 120, Duration: 4 * time.Minute, PeakRate: 1.5},
+			wantRequest: 500,
+			wantLimit:   1500,
+		},
+		{
+			name:        "within target",
+			target:      2 * time.Minute,
+			usage:       &entity.InitCPUUsage{Runs: 1, CPUSeconds: 120, Duration: 4 * time.Minute, PeakRate: 1.5},
+			wantRequest: 1000,
+			wantLimit:   1500,
+		},
+		{
+			name:            "target beyond the peak rate",
+			target:          time.Minute,
+			usage:           &entity.InitCPUUsage{Runs: 1, CPUSeconds: 120, Duration: 4 * time.Minute, PeakRate: 1.5},
+			wantRequest:     1500,
+			wantLimit:       1500,
+			wantUnreachable: true,
+		},
+		{
+			name:            "target beyond the peak rate below the limit",
+			target:          time.Minute,
+			currentLimit:    "4",
+			usage:           &entity.InitCPUUsage{Runs: 1, CPUSeconds: 120, Duration: 4 * time.Minute, PeakRate: 1.5},
+			wantRequest:     1500,
+			wantLimit:       1500,
+			wantUnreachable: true,
+		},
+		{
+			name:         "held back by the limit",
+			target:       time.Minute,
+			currentLimit: "1500m",
+			usage:        &entity.InitCPUUsage{Runs: 1, CPUSeconds: 120, Duration: 4 * time.Minute, PeakRate: 1.45},
+			wantRequest:  2000,
+			wantLimit:    2250,
+			wantCPUBound: true,
+		},
+		{
+			name:         "held back by the limit without a target",
+			currentLimit: "500m",
+			usage:        &entity.InitCPUUsage{Runs: 1, CPUSeconds: 120, Duration: 4 * time.Minute, PeakRate: 0.5},
+			wantRequest:  500,
+			wantLimit:    750,
+			wantCPUBound: true,
+		},
+		{
+			name:        "finished before its second sample",
+			target:      time.Minute,
+			usage:       &entity.InitCPUUsage{Runs: 1, CPUSeconds: 3},
+			wantRequest: 50,
+			wantLimit:   1000,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc := NewRecommenderUseCase(nil, nil, newTestLogger(), WithPolicy(Policy{InitTargetDuration: tt.target}))
+
+			var currentLimit *resource.Quantity
+			if tt.currentLimit != "" {
+				currentLimit = mustParseQuantity(tt.currentLimit)
+			}
+
+			request, limit, usage := uc.initCPU(tt.usage, currentLimit)
+
+			if request.MilliValue() != tt.wantRequest || limit.MilliValue() != tt.wantLimit {
+				t.Errorf("got %s/%s, want %dm/%dm", request.String(), limit.String(), tt.wantRequest, tt.wantLimit)
+			}
+			if usage != nil && usage.TargetUnreachable != tt.wantUnreachable {
+				t.Errorf("TargetUnreachable: got %v, want %v", usage.TargetUnreachable, tt.wantUnreachable)
+			}
+			if usage != nil && usage.CPUBound != tt.wantCPUBound {
+				t.Errorf("CPUBound: got %v, want %v", usage.CPUBound, tt.wantCPUBound)
+			}
+		})
+	}
+}
+
+func TestRecommenderUseCase_CalculateForInitContainers_CPU(t *testing.T) {
+	// Arrange
+	deploymentGW := &mockDeploymentGateway{
+		deployment: &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-ns"},
+			Spec: appsv1.DeploymentSpec{
+				Template: v1.PodTemplateSpec{
+					Spec: v1.PodSpec{InitContainers: []v1.Container{{Name: "migrate"}}},
+				},
+			},
+		},
+	}
+	metricsGW := &mockMetricsGateway{
+		initMemValue: 50 * mebibyte,
+		initCPU:      &entity.InitCPUUsage{Runs: 3, CPUSeconds: 120, Duration: 4 * time.Minute, PeakRate: 1.5},
+	}
+	uc := NewRecommenderUseCase(deploymentGW, metricsGW, newTestLogger(), WithPolicy(Policy{InitTargetDuration: time.Minute}))
+
+	// Act
+	recs, err := uc.CalculateForInitContainers(context.Background(), DeploymentParams{
+		Namespace:      "test-ns",
+		DeploymentName: "test-deployment",
+		TimeRange:      "7d",
+	})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rec := recs[0].Recommendation
+	if got := rec.CPU.Request.MilliValue(); got != 1500 {
+		t.Errorf("CPU request: got %dm, want the 1500m peak rate", got)
+	}
+	if rec.InitCPU == nil || rec.InitCPU.TargetDuration != time.Minute {
+		t.Fatalf("expected the init CPU usage with its target, got %+v", rec.InitCPU)
+	}
+	if len(rec.Warnings) != 1 || !strings.Contains(rec.Warnings[0], "can't finish within 1m; expect about 1m20s") {
+		t.Errorf("expected an unreachable target warning, got %v", rec.Warnings)
+	}
+}
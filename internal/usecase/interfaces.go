@@ -2,9 +2,13 @@ package usecase
 
 import (
 	"context"
+	"time"
 
+	"github.com/sequring/sculptor/internal/entity"
 	appsv1 "k8s.io/api/apps/v1"
-	"k8s.io/apimachinery/pkg/api/resource"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	v1 "k8s.io/api/core/v1"
+	nodev1 "k8s.io/api/node/v1"
 )
 
 // DeploymentParams represents reusable deployment arguments.
@@ -19,23 +23,69 @@ type DeploymentParams struct {
 type AllRecommendations struct {
 	MainContainers []NamedRecommendation
 	InitContainers []NamedRecommendation
+	// QoS is set by AssessQoS.
+	QoS *QoSAssessment
+	// PodRequests is set by AssessPodRequests.
+	PodRequests *PodRequests
+	// Quota is set by AssessQuota.
+	Quota *QuotaAssessment
 }
 
 type DeploymentGateway interface {
 	GetDeployment(ctx context.Context, namespace, name string) (*appsv1.Deployment, error)
-	CheckForOOMKilledEvents(ctx context.Context, d *appsv1.Deployment, targetContainerName string) (bool, string, *resource.Quantity, error)
+	ListOOMKills(ctx context.Context, d *appsv1.Deployment, containerNames []string, timeRange string) (map[string]entity.ContainerOOMKills, error)
+	ListStorageEvictions(ctx context.Context, d *appsv1.Deployment, containerNames []string, timeRange string) (map[string]entity.ContainerStorageEvictions, error)
+	ListLimitRanges(ctx context.Context, namespace string) ([]v1.LimitRange, error)
+	ListResourceQuotas(ctx context.Context, namespace string) ([]v1.ResourceQuota, error)
+	GetHorizontalPodAutoscaler(ctx context.Context, d *appsv1.Deployment) (*autoscalingv2.HorizontalPodAutoscaler, error)
+	GetRuntimeClass(ctx context.Context, name string) (*nodev1.RuntimeClass, error)
+	ListNodes(ctx context.Context, spec *v1.PodSpec) ([]v1.Node, error)
 }
 
 type MetricsGateway interface {
 	GetMemoryMetrics(ctx context.Context, namespace, deploymentName, containerName, timeRange string) (float64, error)
+	GetMemoryRequestMetrics(ctx context.Context, namespace, deploymentName, containerName, timeRange string) (float64, error)
 	GetCPURequestMetrics(ctx context.Context, namespace, deploymentName, containerName, timeRange string) (float64, error)
 	GetCPULimitMetrics(ctx context.Context, namespace, deploymentName, containerName, timeRange string) (float64, error)
 	GetCPUMedianMetrics(ctx context.Context, namespace, deploymentName, containerName, timeRange string) (float64, error)
+	GetCPUThrottlingMetrics(ctx context.Context, namespace, deploymentName, containerName, timeRange string) (float64, error)
+	GetJVMMemory(ctx context.Context, namespace, deploymentName, containerName, timeRange string) (*entity.JVMMemory, error)
+	GetHugePagesUsage(ctx context.Context, namespace, deploymentName, containerName, timeRange string) ([]entity.HugePagesUsage, error)
+	GetEphemeralStorageMetrics(ctx context.Context, namespace, deploymentName, containerName, timeRange string) (float64, error)
 	GetInitContainerMemoryMetrics(ctx context.Context, namespace, deploymentName, containerName, timeRange string) (float64, error)
+	GetInitContainerCPU(ctx context.Context, namespace, deploymentName, containerName, timeRange string) (*entity.InitCPUUsage, error)
+	GetDataQuality(ctx context.Context, namespace, deploymentName, containerName, timeRange string) (*entity.DataQuality, error)
+	GetRestarts(ctx context.Context, namespace, deploymentName, containerName, timeRange string) (float64, error)
+	GetOOMKills(ctx context.Context, namespace, deploymentName, containerName, timeRange string) ([]entity.OOMKill, error)
+	GetMemoryLifetimes(ctx context.Context, namespace, deploymentName, containerName, timeRange string) ([]entity.MemoryLifetime, error)
+	GetWindowUsage(ctx context.Context, namespace, deploymentName, containerName, timeRange string, window entity.TimeWindow, inside bool) (*entity.Usage, error)
+	GetUsageTrend(ctx context.Context, namespace, deploymentName, containerName, timeRange string) (*entity.UsageTrend, error)
+	GetPodUsage(ctx context.Context, namespace, deploymentName, containerName, timeRange string) ([]entity.PodUsage, error)
+	GetReplicaStats(ctx context.Context, namespace, deploymentName, timeRange string) (*entity.ReplicaStats, error)
+	GetPreKillMemory(ctx context.Context, namespace, deploymentName, containerName string, kill entity.OOMKill, window time.Duration) (*entity.PreKillMemory, error)
+}
+
+// ExportDeploymentGateway provides the cluster state captured in an export bundle.
+type ExportDeploymentGateway interface {
+	GetDeployment(ctx context.Context, namespace, name string) (*appsv1.Deployment, error)
+	ListPods(ctx context.Context, d *appsv1.Deployment) ([]v1.Pod, error)
+	ListOOMKilledEvents(ctx context.Context, namespace string, pods []v1.Pod) ([]v1.Event, error)
+	GetHorizontalPodAutoscaler(ctx context.Context, d *appsv1.Deployment) (*autoscalingv2.HorizontalPodAutoscaler, error)
+	GetRuntimeClass(ctx context.Context, name string) (*nodev1.RuntimeClass, error)
+	ListNodes(ctx context.Context, spec *v1.PodSpec) ([]v1.Node, error)
+	ListLimitRanges(ctx context.Context, namespace string) ([]v1.LimitRange, error)
+	ListResourceQuotas(ctx context.Context, namespace string) ([]v1.ResourceQuota, error)
+}
+
+// RawMetricsGateway provides the unaggregated series behind MetricsGateway.
+type RawMetricsGateway interface {
+	GetRawSeries(ctx context.Context, namespace, deploymentName, containerName, timeRange string, end time.Time) ([]entity.RawSeries, error)
+	GetRawDeploymentSeries(ctx context.Context, namespace, deploymentName, timeRange string, end time.Time) ([]entity.RawSeries, error)
 }
 
 type Recommender interface {
 	CalculateForDeployment(ctx context.Context, params DeploymentParams) ([]NamedRecommendation, error)
 	CalculateForInitContainers(ctx context.Context, params DeploymentParams) ([]NamedRecommendation, error)
 	CalculateForAll(ctx context.Context, namespace, deploymentName, targetContainerName, timeRange string) (*AllRecommendations, error)
+	Assess(ctx context.Context, params DeploymentParams, recs *AllRecommendations) error
 }
@@ -0,0 +1,252 @@
+package usecase
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/sequring/sculptor/internal/entity"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	// jvmHeapBufferPercent covers the peak heap in use, garbage included, so
+	// the collector doesn't run back to back.
+	jvmHeapBufferPercent = 130
+	// jvmNonHeapBufferPercent covers metaspace and code cache growing as
+	// classes load and code is compiled.
+	jvmNonHeapBufferPercent = 120
+	// jvmNativeOverheadPercent of the heap is the least native memory
+	// reserved for thread stacks, GC structures and direct buffers.
+	jvmNativeOverheadPercent = 10
+	minJVMNativeBytes        = 64 * mebibyte
+	minJVMHeapBytes          = 64 * mebibyte
+	// jvmFullHeapPercent of the max heap in use means the heap was full.
+	jvmFullHeapPercent = 90
+	// jvmUnknownNonHeapBytes is reserved for non-heap memory without JVM
+	// metrics to measure it.
+	jvmUnknownNonHeapBytes = 192 * mebibyte
+	// jvmDefaultMaxRAMPercentage is the share of the memory limit the JVM
+	// uses for the heap without -Xmx or -XX:MaxRAMPercentage.
+	jvmDefaultMaxRAMPercentage = 25.0
+)
+
+// jvmOptionsEnv are the environment variables JVM options are read from,
+// in the order the JVM applies them. Options on the command line come last
+// and win.
+var jvmOptionsEnv = []string{"JAVA_TOOL_OPTIONS", "JDK_JAVA_OPTIONS", "JAVA_OPTS"}
+
+// jvmOptions are the max heap options of a Java container, as written.
+type jvmOptions struct {
+	maxHeap              *resource.Quantity
+	maxHeapFlag          string
+	maxRAMPercentage     float64
+	maxRAMPercentageFlag string
+}
+
+// parseJVMOptions reads the max heap options of a container from its JVM
+// option environment variables, command and args. It returns nil if the
+// container doesn't look like it runs a JVM. Options set through env
+// references or files aren't seen.
+func parseJVMOptions(c *v1.Container) *jvmOptions {
+	if c == nil {
+		return nil
+	}
+	var tokens []string
+	isJava := false
+	for _, name := range jvmOptionsEnv {
+		for _, env := range c.Env {
+			if env.Name == name {
+				isJava = true
+				tokens = append(tokens, strings.Fields(env.Value)...)
+			}
+		}
+	}
+	for _, arg := range append(append([]string{}, c.Command...), c.Args...) {
+		tokens = append(tokens, strings.Fields(arg)...)
+	}
+
+	opts := &jvmOptions{}
+	for _, token := range tokens {
+		token = strings.Trim(token, `"'`)
+		switch {
+		case path.Base(token) == "java":
+			isJava = true
+		case strings.HasPrefix(token, "-Xmx"), strings.HasPrefix(token, "-XX:MaxHeapSize="):
+			size := strings.TrimPrefix(strings.TrimPrefix(token, "-Xmx"), "-XX:MaxHeapSize=")
+			if q, ok := parseJVMSize(size); ok {
+				opts.maxHeap, opts.maxHeapFlag = q, token
+				isJava = true
+			}
+		case strings.HasPrefix(token, "-XX:MaxRAMPercentage="):
+			percentage, err := strconv.ParseFloat(strings.TrimPrefix(token, "-XX:MaxRAMPercentage="), 64)
+			if err == nil && percentage > 0 && percentage <= 100 {
+				opts.maxRAMPercentage, opts.maxRAMPercentageFlag = percentage, token
+				isJava = true
+			}
+		}
+	}
+	if !isJava {
+		return nil
+	}
+	return opts
+}
+
+// parseJVMSize parses a JVM memory size such as 512m or 2G.
+func parseJVMSize(s string) (*resource.Quantity, bool) {
+	if s == "" {
+		return nil, false
+	}
+	multiplier := int64(1)
+	switch s[len(s)-1] {
+	case 'k', 'K':
+		multiplier = 1024
+	case 'm', 'M':
+		multiplier = mebibyte
+	case 'g', 'G':
+		multiplier = 1024 * mebibyte
+	case 't', 'T':
+		multiplier = 1024 * 1024 * mebibyte
+	}
+	if multiplier > 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 {
+		return nil, false
+	}
+	return resource.NewQuantity(n*multiplier, resource.BinarySI), true
+}
+
+// heap returns the max heap the options configure for a memory limit, or nil
+// if it's a share of a limit the container doesn't have, and the option
+// that sets it. -Xmx wins over -XX:MaxRAMPercentage, as in the JVM.
+func (o *jvmOptions) heap(memoryLimit *resource.Quantity) (*resource.Quantity, string) {
+	if o.maxHeap != nil {
+		return o.maxHeap, o.maxHeapFlag
+	}
+	if memoryLimit == nil {
+		return nil, o.maxRAMPercentageFlag
+	}
+	return resource.NewQuantity(int64(memoryLimit.AsApproximateFloat64()*o.percentage()/100), resource.BinarySI), o.maxRAMPercentageFlag
+}
+
+// percentage returns the share of the memory limit the heap gets without
+// -Xmx.
+func (o *jvmOptions) percentage() float64 {
+	if o.maxRAMPercentage > 0 {
+		return o.maxRAMPercentage
+	}
+	return jvmDefaultMaxRAMPercentage
+}
+
+// sizeJVM recommends the max heap of a Java container and replaces its
+// memory limit with one that fits the heap, non-heap and native memory.
+// With JVM metrics, the heap is sized from the peak heap in use, and the
+// overhead from the peak non-heap plus the rest of the p99 working set.
+// Without them, a heap set with -Xmx is kept and the limit raised to fit it,
+// and a heap set as a share of the limit follows the working set sizing. An
+// OOM-killed container keeps at least the limit sized from its kills.
+func (uc *RecommenderUseCase) sizeJVM(plan *mainContainerPlan, rec *entity.Recommendation) {
+	opts := plan.jvmOptions
+	if rec.IsMissingData() || (opts == nil && plan.jvmUsage == nil) {
+		return
+	}
+	if opts == nil {
+		opts = &jvmOptions{}
+	}
+	currentHeap, currentFlag := opts.heap(plan.memoryLimitSpec)
+	sizing := &entity.JVMSizing{CurrentFlag: currentFlag, CurrentHeap: currentHeap, Usage: plan.jvmUsage}
+	rec.JVM = sizing
+
+	var heapBytes, overheadBytes int64
+	switch usage := plan.jvmUsage; {
+	case usage != nil:
+		heapBytes = max(int64(usage.Heap*jvmHeapBufferPercent/100), minJVMHeapBytes)
+		if currentHeap != nil && usage.Heap >= currentHeap.AsApproximateFloat64()*jvmFullHeapPercent/100 {
+			// A full heap may be garbage the collector hasn't needed to
+			// reclaim yet, so it tells nothing about the heap needed.
+			sizing.HeapFull = true
+			heapBytes = currentHeap.Value()
+		}
+		var native float64
+		if plan.memory.err == nil {
+			native = plan.memory.value - usage.Heap - usage.NonHeap
+		}
+		overheadBytes = int64(usage.NonHeap*jvmNonHeapBufferPercent/100) + jvmNativeBytes(heapBytes, native)
+	case opts.maxHeap != nil:
+		heapBytes = opts.maxHeap.Value()
+		overheadBytes = jvmUnknownNonHeapBytes + jvmNativeBytes(heapBytes, 0)
+	default:
+		heapBytes = int64(rec.Memory.AsApproximateFloat64() * opts.percentage() / 100)
+		sizing.Heap = resource.NewQuantity(heapBytes, resource.BinarySI)
+		sizing.Flag = currentFlag
+		sizing.Overhead = resource.NewQuantity(rec.Memory.Value()-heapBytes, resource.BinarySI)
+		return
+	}
+
+	heapBytes = int64(math.Ceil(float64(heapBytes)/mebibyte)) * mebibyte
+	limitBytes := int64(math.Ceil(float64(heapBytes+overheadBytes)/mebibyte)) * mebibyte
+	if rec.IsOOMKilled {
+		limitBytes = max(limitBytes, rec.Memory.Value())
+	}
+	switch {
+	case opts.maxHeap != nil && opts.maxHeap.Value() == heapBytes:
+		sizing.Flag = opts.maxHeapFlag
+	case opts.maxHeap != nil:
+		sizing.Flag = fmt.Sprintf("-Xmx%dm", heapBytes/mebibyte)
+	default:
+		percentage := math.Floor(float64(heapBytes)/float64(limitBytes)*1000) / 10
+		sizing.Flag = jvmPercentageFlag(percentage)
+		heapBytes = int64(float64(limitBytes) * percentage / 100)
+	}
+	sizing.Heap = resource.NewQuantity(heapBytes, resource.BinarySI)
+	sizing.Overhead = resource.NewQuantity(limitBytes-heapBytes, resource.BinarySI)
+
+	rec.Memory = resource.NewQuantity(limitBytes, resource.BinarySI)
+	if uc.policy.MemorySizing != MemoryBurstable || rec.MemoryRequest == nil || rec.MemoryRequest.Cmp(*rec.Memory) > 0 {
+		rec.MemoryRequest = rec.Memory
+	}
+}
+
+// jvmNativeBytes returns the native memory reserved beside heap and
+// non-heap: what the container used beyond them, and at least a share of the
+// heap.
+func jvmNativeBytes(heapBytes int64, observed float64) int64 {
+	return max(int64(observed), heapBytes*jvmNativeOverheadPercent/100, minJVMNativeBytes)
+}
+
+func jvmPercentageFlag(percentage float64) string {
+	return "-XX:MaxRAMPercentage=" + strconv.FormatFloat(percentage, 'f', -1, 64)
+}
+
+// jvmWarnings warns about a heap that was full, a heap kept without JVM
+// metrics, and current options that would leave the recommended limit too
+// little room beside the heap.
+func jvmWarnings(containerName string, rec *entity.Recommendation, opts *jvmOptions) []string {
+	sizing := rec.JVM
+	if sizing == nil {
+		return nil
+	}
+	if opts == nil {
+		opts = &jvmOptions{}
+	}
+	var warnings []string
+	if sizing.HeapFull {
+		warnings = append(warnings, fmt.Sprintf("The JVM heap of container '%s' was full, at %.0fMi of its max heap of %s. The heap is kept as it is, since a full heap may be garbage the collector hasn't reclaimed; check the GC time before raising it.", containerName, sizing.Usage.Heap/mebibyte, sizing.CurrentHeap.String()))
+	}
+	if sizing.Usage == nil && opts.maxHeap != nil {
+		warnings = append(warnings, fmt.Sprintf("No JVM metrics for container '%s'. Its max heap is kept at %s with %s reserved for non-heap and native memory; export jvm_memory_used_bytes to size the heap.", containerName, sizing.Heap.String(), sizing.Overhead.String()))
+	}
+	if heap, _ := opts.heap(rec.Memory); sizing.Flag != sizing.CurrentFlag && heap != nil && heap.Cmp(*sizing.Heap) > 0 {
+		current := sizing.CurrentFlag
+		if current == "" {
+			current = "default max heap"
+		}
+		warnings = append(warnings, fmt.Sprintf("With its current %s, the JVM heap of container '%s' would take %s of the recommended memory limit of %s, too little for non-heap and native memory. Apply %s together with the limit.", current, containerName, heap.String(), rec.Memory.String(), sizing.Flag))
+	}
+	return warnings
+}
@@ -0,0 +1,211 @@
+package usecase
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sequring/sculptor/internal/entity"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseJVMOptions(t *testing.T) {
+	tests := []struct {
+		name           string
+		container      v1.Container
+		wantNil        bool
+		wantHeap       string
+		wantFlag       string
+		wantPercentage float64
+	}{
+		{
+			name:      "not java",
+			container: v1.Container{Command: []string{"/app/server", "--port=8080"}},
+			wantNil:   true,
+		},
+		{
+			name:      "java without heap options",
+			container: v1.Container{Command: []string{"/usr/bin/java", "-jar", "app.jar"}},
+		},
+		{
+			name:      "xmx in JAVA_TOOL_OPTIONS",
+			container: v1.Container{Env: []v1.EnvVar{{Name: "JAVA_TOOL_OPTIONS", Value: "-XX:+UseG1GC -Xmx2g"}}},
+			wantHeap:  "2Gi",
+			wantFlag:  "-Xmx2g",
+		},
+		{
+			name: "command line wins over env",
+			container: v1.Container{
+				Env:     []v1.EnvVar{{Name: "JAVA_TOOL_OPTIONS", Value: "-Xmx2g"}},
+				Command: []string{"sh", "-c", "exec java -Xmx512m -jar app.jar"},
+			},
+			wantHeap: "512Mi",
+			wantFlag: "-Xmx512m",
+		},
+		{
+			name:           "max RAM percentage",
+			container:      v1.Container{Args: []string{"-XX:MaxRAMPercentage=75.0"}, Command: []string{"java"}},
+			wantPercentage: 75,
+		},
+		{
+			name:      "invalid size is ignored",
+			container: v1.Container{Command: []string{"java", "-Xmxlots"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := parseJVMOptions(&tt.container)
+
+			if tt.wantNil {
+				if opts != nil {
+					t.Errorf("expected no JVM options, got %+v", opts)
+				}
+				return
+			}
+			if opts == nil {
+				t.Fatal("expected JVM options, got nil")
+			}
+			if tt.wantHeap == "" && opts.maxHeap != nil {
+				t.Errorf("expected no max heap, got %s", opts.maxHeap.String())
+			}
+			if tt.wantHeap != "" && (opts.maxHeap == nil || opts.maxHeap.Cmp(*mustParseQuantity(tt.wantHeap)) != 0) {
+				t.Errorf("max heap: got %v, want %s", opts.maxHeap, tt.wantHeap)
+			}
+			if opts.maxHeapFlag != tt.wantFlag {
+				t.Errorf("flag: got %q, want %q", opts.maxHeapFlag, tt.wantFlag)
+			}
+			if opts.maxRAMPercentage != tt.wantPercentage {
+				t.Errorf("percentage: got %v, want %v", opts.maxRAMPercentage, tt.wantPercentage)
+			}
+		})
+	}
+}
+
+func jvmDeployment(c v1.Container) *appsv1.Deployment {
+	c.Name = "app"
+	c.Resources.Limits = v1.ResourceList{v1.ResourceMemory: *mustParseQuantity("2Gi")}
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-ns"},
+		Spec: appsv1.DeploymentSpec{
+			Template: v1.PodTemplateSpec{Spec: v1.PodSpec{Containers: []v1.Container{c}}},
+		},
+	}
+}
+
+func TestRecommenderUseCase_CalculateForDeployment_JVM(t *testing.T) {
+	usage := &entity.JVMMemory{Heap: 500 * mebibyte, NonHeap: 100 * mebibyte}
+
+	tests := []struct {
+		name        string
+		container   v1.Container
+		usage       *entity.JVMMemory
+		wantMemory  string
+		wantFlag    string
+		wantWarning string
+	}{
+		{
+			// Heap 500Mi * 1.3 = 650Mi. Native is the p99 working set beyond
+			// heap and non-heap: 900Mi - 600Mi = 300Mi. Non-heap 100Mi * 1.2.
+			name:        "xmx sized from JVM metrics",
+			container:   v1.Container{Env: []v1.EnvVar{{Name: "JAVA_TOOL_OPTIONS", Value: "-Xmx1g"}}},
+			usage:       usage,
+			wantMemory:  "1070Mi",
+			wantFlag:    "-Xmx650m",
+			wantWarning: "With its current -Xmx1g, the JVM heap of container 'app' would take 1Gi",
+		},
+		{
+			name:        "max RAM percentage sized from JVM metrics",
+			container:   v1.Container{Command: []string{"java", "-XX:MaxRAMPercentage=75", "-jar", "app.jar"}},
+			usage:       usage,
+			wantMemory:  "1070Mi",
+			wantFlag:    "-XX:MaxRAMPercentage=60.7",
+			wantWarning: "Apply -XX:MaxRAMPercentage=60.7 together with the limit",
+		},
+		{
+			name:        "full heap is kept",
+			container:   v1.Container{Command: []string{"java", "-Xmx512m"}},
+			usage:       usage,
+			wantMemory:  "932Mi",
+			wantFlag:    "-Xmx512m",
+			wantWarning: "The JVM heap of container 'app' was full, at 500Mi of its max heap of 512Mi",
+		},
+		{
+			// 1Gi heap, 192Mi for non-heap and 10% of the heap for native.
+			name:        "xmx kept without JVM metrics",
+			container:   v1.Container{Command: []string{"java", "-Xmx1g"}},
+			wantMemory:  "1319Mi",
+			wantFlag:    "-Xmx1g",
+			wantWarning: "No JVM metrics for container 'app'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			deploymentGW := &mockDeploymentGateway{deployment: jvmDeployment(tt.container)}
+			metricsGW := &mockMetricsGateway{
+				memValue:    900 * mebibyte,
+				cpuP90Value: 0.2,
+				cpuP99Value: 0.4,
+				cpuP50Value: 0.25,
+				jvmMemory:   tt.usage,
+			}
+			uc := NewRecommenderUseCase(deploymentGW, metricsGW, newTestLogger(), WithPolicy(Policy{JVM: true}))
+
+			// Act
+			recs, err := uc.CalculateForDeployment(context.Background(), DeploymentParams{Namespace: "test-ns", DeploymentName: "test-deployment", TimeRange: "7d"})
+
+			// Assert
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			rec := recs[0].Recommendation
+			if rec.JVM == nil {
+				t.Fatal("expected JVM sizing, got nil")
+			}
+			if rec.Memory.Cmp(*mustParseQuantity(tt.wantMemory)) != 0 {
+				t.Errorf("Memory: got %s, want %s", rec.Memory.String(), tt.wantMemory)
+			}
+			if rec.MemoryRequest.Cmp(*rec.Memory) != 0 {
+				t.Errorf("Memory request: got %s, want the limit", rec.MemoryRequest.String())
+			}
+			if rec.JVM.Flag != tt.wantFlag {
+				t.Errorf("Flag: got %q, want %q", rec.JVM.Flag, tt.wantFlag)
+			}
+			found := false
+			for _, w := range rec.Warnings {
+				found = found || strings.Contains(w, tt.wantWarning)
+			}
+			if !found {
+				t.Errorf("expected a warning containing %q, got %v", tt.wantWarning, rec.Warnings)
+			}
+		})
+	}
+}
+
+func TestRecommenderUseCase_CalculateForDeployment_JVMOff(t *testing.T) {
+	// Arrange
+	deploymentGW := &mockDeploymentGateway{deployment: jvmDeployment(v1.Container{Command: []string{"java", "-Xmx1g"}})}
+	metricsGW := &mockMetricsGateway{
+		memValue:    900 * mebibyte,
+		cpuP90Value: 0.2,
+		cpuP99Value: 0.4,
+		cpuP50Value: 0.25,
+		jvmMemory:   &entity.JVMMemory{Heap: 500 * mebibyte},
+	}
+	uc := NewRecommenderUseCase(deploymentGW, metricsGW, newTestLogger())
+
+	// Act
+	recs, err := uc.CalculateForDeployment(context.Background(), DeploymentParams{Namespace: "test-ns", DeploymentName: "test-deployment", TimeRange: "7d"})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if recs[0].Recommendation.JVM != nil {
+		t.Errorf("expected no JVM sizing outside JVM mode, got %+v", recs[0].Recommendation.JVM)
+	}
+}
@@ -0,0 +1,199 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// applyLimitRanges adjusts recs so the Container limits of the namespace's
+// LimitRanges admit them: values below the minimum are raised to it, values
+// above the maximum lowered to it, and requests raised until the limit is
+// within the max limit/request ratio. Each adjustment is warned about.
+func (uc *RecommenderUseCase) applyLimitRanges(ctx context.Context, namespace string, recs []NamedRecommendation) {
+	if len(recs) == 0 {
+		return
+	}
+	limitRanges, err := uc.k8sGateway.ListLimitRanges(ctx, namespace)
+	if err != nil {
+		uc.logger.Warn("Could not check recommendations against LimitRanges", "namespace", namespace, "error", err)
+		return
+	}
+
+	for _, lr := range limitRanges {
+		for _, item := range lr.Spec.Limits {
+			if item.Type != v1.LimitTypeContainer {
+				continue
+			}
+			for _, rec := range recs {
+				r := rec.Recommendation
+				if r == nil || r.IsMissingData() || r.CPU == nil {
+					continue
+				}
+				requests, limits := recommendedResources(rec)
+				adjustments := clampToLimitRange(item, requests, limits)
+				if len(adjustments) == 0 {
+					continue
+				}
+				setRecommendedResources(rec, requests, limits)
+				r.Warnings = append(r.Warnings, fmt.Sprintf("Adjusted container '%s' to LimitRange '%s' in namespace '%s': %s", rec.ContainerName, lr.Name, namespace, strings.Join(adjustments, "; ")))
+			}
+		}
+	}
+}
+
+// limitRangeResources are the resources recommendations are checked against
+// LimitRanges for.
+var limitRangeResources = []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory, v1.ResourceEphemeralStorage}
+
+// clampToLimitRange adjusts requests and limits in place to the constraints
+// of a LimitRange item, and describes each adjustment. A missing limit is
+// taken to be the item's default, which admission injects.
+func clampToLimitRange(item v1.LimitRangeItem, requests, limits v1.ResourceList) []string {
+	var adjustments []string
+	for _, name := range limitRangeResources {
+		if _, ok := requests[name]; !ok {
+			continue
+		}
+		if minimum, ok := item.Min[name]; ok {
+			if request := requests[name]; request.Cmp(minimum) < 0 {
+				requests[name] = minimum
+				adjustments = append(adjustments, fmt.Sprintf("%s request raised to the minimum of %s", name, minimum.String()))
+			}
+			if limit, ok := limits[name]; ok && limit.Cmp(minimum) < 0 {
+				limits[name] = minimum
+				adjustments = append(adjustments, fmt.Sprintf("%s limit raised to the minimum of %s", name, minimum.String()))
+			}
+		}
+		if maximum, ok := item.Max[name]; ok {
+			if limit, ok := limits[name]; ok && limit.Cmp(maximum) > 0 {
+				limits[name] = maximum
+				adjustments = append(adjustments, fmt.Sprintf("%s limit lowered to the maximum of %s, below what the container needs", name, maximum.String()))
+			}
+			if request := requests[name]; request.Cmp(maximum) > 0 {
+				requests[name] = maximum
+				adjustments = append(adjustments, fmt.Sprintf("%s request lowered to the maximum of %s, below what the container needs", name, maximum.String()))
+			}
+		}
+		if maxRatio, ok := item.MaxLimitRequestRatio[name]; ok && maxRatio.Sign() > 0 {
+			limit, ok := limits[name]
+			if !ok {
+				limit, ok = item.Default[name]
+			}
+			request := requests[name]
+			if !ok || request.IsZero() {
+				continue
+			}
+			r := maxRatio.AsApproximateFloat64()
+			if limit.AsApproximateFloat64()/request.AsApproximateFloat64() <= r {
+				continue
+			}
+			raised := ratioRequest(name, limit, r)
+			requests[name] = *raised
+			adjustments = append(adjustments, fmt.Sprintf("%s request raised to %s to keep the limit within %s times the request", name, raised.String(), maxRatio.String()))
+		}
+	}
+	return adjustments
+}
+
+// podLimitRangeIssues checks the effective requests and limits of a pod
+// against the Pod limits of LimitRanges, which admission enforces on the
+// pod's totals. Which container should give way is not obvious, so the
+// violations are only described.
+func podLimitRangeIssues(limitRanges []v1.LimitRange, requests, limits v1.ResourceList) []string {
+	var issues []string
+	for _, lr := range limitRanges {
+		for _, item := range lr.Spec.Limits {
+			if item.Type != v1.LimitTypePod {
+				continue
+			}
+			for _, name := range limitRangeResources {
+				request, hasRequest := requests[name]
+				limit := limits[name]
+				if minimum, ok := item.Min[name]; ok {
+					if hasRequest && request.Cmp(minimum) < 0 {
+						issues = append(issues, fmt.Sprintf("LimitRange '%s' requires a pod %s request of at least %s, the pod requests %s", lr.Name, name, minimum.String(), request.String()))
+					}
+					if !limit.IsZero() && limit.Cmp(minimum) < 0 {
+						issues = append(issues, fmt.Sprintf("LimitRange '%s' requires a pod %s limit of at least %s, the pod's limit is %s", lr.Name, name, minimum.String(), limit.String()))
+					}
+				}
+				if maximum, ok := item.Max[name]; ok {
+					switch {
+					case limit.IsZero():
+						issues = append(issues, fmt.Sprintf("LimitRange '%s' caps the pod %s limit at %s, but the pod sets no %s limit", lr.Name, name, maximum.String(), name))
+					case limit.Cmp(maximum) > 0:
+						issues = append(issues, fmt.Sprintf("LimitRange '%s' caps the pod %s limit at %s, the pod's limit is %s", lr.Name, name, maximum.String(), limit.String()))
+					}
+					if hasRequest && request.Cmp(maximum) > 0 {
+						issues = append(issues, fmt.Sprintf("LimitRange '%s' caps the pod %s request at %s, the pod requests %s", lr.Name, name, maximum.String(), request.String()))
+					}
+				}
+				if maxRatio, ok := item.MaxLimitRequestRatio[name]; ok && maxRatio.Sign() > 0 && hasRequest && !request.IsZero() && !limit.IsZero() {
+					if limit.AsApproximateFloat64()/request.AsApproximateFloat64() > maxRatio.AsApproximateFloat64() {
+						issues = append(issues, fmt.Sprintf("LimitRange '%s' allows a pod %s limit of at most %s times the request, the pod's is %s for a request of %s", lr.Name, name, maxRatio.String(), limit.String(), request.String()))
+					}
+				}
+			}
+		}
+	}
+	return issues
+}
+
+// ratioRequest returns the smallest request whose limit is at most maxRatio
+// times larger.
+func ratioRequest(name v1.ResourceName, limit resource.Quantity, maxRatio float64) *resource.Quantity {
+	if name == v1.ResourceCPU {
+		return resource.NewMilliQuantity(int64(math.Ceil(float64(limit.MilliValue())/maxRatio)), resource.DecimalSI)
+	}
+	return resource.NewQuantity(int64(math.Ceil(float64(limit.Value())/maxRatio)), resource.BinarySI)
+}
+
+// recommendedResources returns the requests and limits of a recommendation,
+// including the resources carried through from the pod template. A missing
+// memory request equals the limit; a missing CPU limit and unsized ephemeral
+// storage are left out.
+func recommendedResources(rec NamedRecommendation) (requests, limits v1.ResourceList) {
+	r := rec.Recommendation
+	requests = v1.ResourceList{v1.ResourceCPU: *r.CPU.Request, v1.ResourceMemory: *r.Memory}
+	if r.MemoryRequest != nil {
+		requests[v1.ResourceMemory] = *r.MemoryRequest
+	}
+	limits = v1.ResourceList{v1.ResourceMemory: *r.Memory}
+	if r.CPU.Limit != nil {
+		limits[v1.ResourceCPU] = *r.CPU.Limit
+	}
+	if storage := r.EphemeralStorage; storage != nil && storage.Request != nil {
+		requests[v1.ResourceEphemeralStorage] = *storage.Request
+		limits[v1.ResourceEphemeralStorage] = *storage.Limit
+	}
+	for name, q := range r.PassthroughRequests {
+		requests[name] = q
+	}
+	for name, q := range r.PassthroughLimits {
+		limits[name] = q
+	}
+	return requests, limits
+}
+
+// setRecommendedResources stores requests and limits on a recommendation.
+func setRecommendedResources(rec NamedRecommendation, requests, limits v1.ResourceList) {
+	r := rec.Recommendation
+	cpuRequest := requests[v1.ResourceCPU]
+	r.CPU.Request = &cpuRequest
+	if cpuLimit, ok := limits[v1.ResourceCPU]; ok {
+		r.CPU.Limit = &cpuLimit
+	}
+	memory := limits[v1.ResourceMemory]
+	memoryRequest := requests[v1.ResourceMemory]
+	r.Memory = &memory
+	r.MemoryRequest = &memoryRequest
+	if storage := r.EphemeralStorage; storage != nil && storage.Request != nil {
+		storageRequest, storageLimit := requests[v1.ResourceEphemeralStorage], limits[v1.ResourceEphemeralStorage]
+		storage.Request, storage.Limit = &storageRequest, &storageLimit
+	}
+}
@@ -0,0 +1,167 @@
+package usecase
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sequring/sculptor/internal/entity"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestClampToLimitRange(t *testing.T) {
+	tests := []struct {
+		name         string
+		item         v1.LimitRangeItem
+		limits       v1.ResourceList
+		wantRequest  string
+		wantLimit    string
+		wantAdjusted bool
+	}{
+		{
+			name:        "within bounds",
+			item:        v1.LimitRangeItem{Min: v1.ResourceList{v1.ResourceCPU: resource.MustParse("50m")}, Max: v1.ResourceList{v1.ResourceCPU: resource.MustParse("4")}},
+			limits:      v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")},
+			wantRequest: "200m",
+			wantLimit:   "1",
+		},
+		{
+			name:         "raised to the minimum",
+			item:         v1.LimitRangeItem{Min: v1.ResourceList{v1.ResourceCPU: resource.MustParse("500m")}},
+			limits:       v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")},
+			wantRequest:  "500m",
+			wantLimit:    "1",
+			wantAdjusted: true,
+		},
+		{
+			name:         "lowered to the maximum",
+			item:         v1.LimitRangeItem{Max: v1.ResourceList{v1.ResourceCPU: resource.MustParse("800m")}},
+			limits:       v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")},
+			wantRequest:  "200m",
+			wantLimit:    "800m",
+			wantAdjusted: true,
+		},
+		{
+			name:         "request raised to the max ratio",
+			item:         v1.LimitRangeItem{MaxLimitRequestRatio: v1.ResourceList{v1.ResourceCPU: resource.MustParse("2")}},
+			limits:       v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")},
+			wantRequest:  "500m",
+			wantLimit:    "1",
+			wantAdjusted: true,
+		},
+		{
+			name:         "max ratio of the default limit",
+			item:         v1.LimitRangeItem{MaxLimitRequestRatio: v1.ResourceList{v1.ResourceCPU: resource.MustParse("4")}, Default: v1.ResourceList{v1.ResourceCPU: resource.MustParse("2")}},
+			limits:       v1.ResourceList{},
+			wantRequest:  "500m",
+			wantAdjusted: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := v1.ResourceList{v1.ResourceCPU: resource.MustParse("200m")}
+
+			adjustments := clampToLimitRange(tt.item, requests, tt.limits)
+
+			request := requests[v1.ResourceCPU]
+			if want := resource.MustParse(tt.wantRequest); request.Cmp(want) != 0 {
+				t.Errorf("request: got %s, want %s", request.String(), tt.wantRequest)
+			}
+			if limit, ok := tt.limits[v1.ResourceCPU]; tt.wantLimit != "" && (!ok || limit.Cmp(resource.MustParse(tt.wantLimit)) != 0) {
+				t.Errorf("limit: got %s, want %s", limit.String(), tt.wantLimit)
+			}
+			if got := len(adjustments) > 0; got != tt.wantAdjusted {
+				t.Errorf("adjusted: got %v, want %v", adjustments, tt.wantAdjusted)
+			}
+		})
+	}
+}
+
+func TestRecommenderUseCase_ApplyLimitRanges(t *testing.T) {
+	// Arrange
+	deploymentGW := &mockDeploymentGateway{limitRanges: []v1.LimitRange{{
+		ObjectMeta: metav1.ObjectMeta{Name: "limits"},
+		Spec: v1.LimitRangeSpec{Limits: []v1.LimitRangeItem{
+			{Type: v1.LimitTypePod, Max: v1.ResourceList{v1.ResourceMemory: resource.MustParse("64Mi")}},
+			{Type: v1.LimitTypeContainer, Max: v1.ResourceList{v1.ResourceMemory: resource.MustParse("1Gi")}},
+		}},
+	}}}
+	uc := NewRecommenderUseCase(deploymentGW, &mockMetricsGateway{}, newTestLogger())
+	rec := &entity.Recommendation{
+		Memory:     mustParseQuantity("2Gi"),
+		CPU:        &entity.CPURecommendation{Request: mustParseQuantity("100m"), Limit: mustParseQuantity("500m")},
+		DataStatus: entity.DataSufficient,
+	}
+
+	// Act
+	uc.applyLimitRanges(context.Background(), "test-ns", []NamedRecommendation{{ContainerName: "app", Recommendation: rec}})
+
+	// Assert
+	if want := resource.MustParse("1Gi"); rec.Memory.Cmp(want) != 0 || rec.MemoryRequest.Cmp(want) != 0 {
+		t.Errorf("memory: got limit %s, request %s, want both %s", rec.Memory.String(), rec.MemoryRequest.String(), want.String())
+	}
+	if rec.CPU.Limit.MilliValue() != 500 {
+		t.Errorf("CPU limit: got %s, want 500m", rec.CPU.Limit.String())
+	}
+	if len(rec.Warnings) != 1 || !strings.Contains(rec.Warnings[0], "LimitRange 'limits'") {
+		t.Errorf("expected a warning about LimitRange 'limits', got %v", rec.Warnings)
+	}
+}
+
+func TestPodLimitRangeIssues(t *testing.T) {
+	limitRanges := []v1.LimitRange{{
+		ObjectMeta: metav1.ObjectMeta{Name: "pods"},
+		Spec: v1.LimitRangeSpec{Limits: []v1.LimitRangeItem{
+			{Type: v1.LimitTypeContainer, Max: v1.ResourceList{v1.ResourceMemory: resource.MustParse("64Mi")}},
+			{
+				Type:                 v1.LimitTypePod,
+				Min:                  v1.ResourceList{v1.ResourceCPU: resource.MustParse("100m")},
+				Max:                  v1.ResourceList{v1.ResourceMemory: resource.MustParse("1Gi")},
+				MaxLimitRequestRatio: v1.ResourceList{v1.ResourceCPU: resource.MustParse("2")},
+			},
+		}},
+	}}
+
+	tests := []struct {
+		name     string
+		requests v1.ResourceList
+		limits   v1.ResourceList
+		want     []string
+	}{
+		{
+			name:     "within bounds",
+			requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("500m"), v1.ResourceMemory: resource.MustParse("512Mi")},
+			limits:   v1.ResourceList{v1.ResourceCPU: resource.MustParse("1"), v1.ResourceMemory: resource.MustParse("1Gi")},
+		},
+		{
+			name:     "pod totals out of bounds",
+			requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("50m"), v1.ResourceMemory: resource.MustParse("512Mi")},
+			limits:   v1.ResourceList{v1.ResourceCPU: resource.MustParse("1"), v1.ResourceMemory: resource.MustParse("2Gi")},
+			want:     []string{"pod cpu request of at least 100m", "pod cpu limit of at most 2 times the request", "caps the pod memory limit at 1Gi, the pod's limit is 2Gi"},
+		},
+		{
+			name:     "no memory limit",
+			requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("500m"), v1.ResourceMemory: resource.MustParse("512Mi")},
+			limits:   v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")},
+			want:     []string{"the pod sets no memory limit"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issues := podLimitRangeIssues(limitRanges, tt.requests, tt.limits)
+
+			if len(issues) != len(tt.want) {
+				t.Fatalf("expected %d issues, got %v", len(tt.want), issues)
+			}
+			for i, want := range tt.want {
+				if !strings.Contains(issues[i], want) {
+					t.Errorf("issue %d: got %q, want it to contain %q", i, issues[i], want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package usecase
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/sequring/sculptor/internal/entity"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	// oomKillMatchWindow is how far apart two reports of a kill in the same
+	// pod may be and still be treated as one kill. Metrics place a kill at
+	// the step the restart was scraped, so their times lag the container
+	// status.
+	oomKillMatchWindow = 5 * time.Minute
+	// oomPreKillWindow is how much working set history before a kill is
+	// analyzed.
+	oomPreKillWindow = 30 * time.Minute
+	// maxAnalyzedOOMKills is how many of the most recent kills are analyzed.
+	maxAnalyzedOOMKills = 5
+	// oomNearLimitRatio is the share of the limit the working set must reach
+	// before a kill for the kill to be explained by steady growth.
+	oomNearLimitRatio = 0.9
+	// oomMinIncreaseRatio is the smallest increase, relative to the current
+	// limit, after a kill explained by growth.
+	oomMinIncreaseRatio = 0.1
+	// oomGrowthHeadroom is how long the raised limit should absorb the
+	// growth observed before a kill.
+	oomGrowthHeadroom = time.Hour
+	oomMemoryDefault  = 512 * 1024 * 1024
+	mebibyte          = 1024 * 1024
+)
+
+// mergeOOMKills merges OOM kills reported by several sources. A report that
+// matches an unmatched kill from an earlier source is the same kill and is
+// dropped. Sources should be passed most precise first. The result is sorted
+// oldest first.
+func mergeOOMKills(sources ...[]entity.OOMKill) []entity.OOMKill {
+	var merged []entity.OOMKill
+	for _, kills := range sources {
+		earlier := len(merged)
+		matched := make([]bool, earlier)
+		for _, kill := range kills {
+			if i := matchOOMKill(merged[:earlier], matched, kill); i >= 0 {
+				matched[i] = true
+				continue
+			}
+			merged = append(merged, kill)
+		}
+	}
+	sort.SliceStable(merged, func(i, j int) bool { return merged[i].Time.Before(merged[j].Time) })
+	return merged
+}
+
+// corroboratedOOMKills drops the kills without a time, which may predate the
+// time range, unless metrics report a kill in the same pod within it.
+func corroboratedOOMKills(kills, metricKills []entity.OOMKill) []entity.OOMKill {
+	var corroborated []entity.OOMKill
+	for _, kill := range kills {
+		if kill.Time.IsZero() && !slices.ContainsFunc(metricKills, func(k entity.OOMKill) bool { return k.Pod == kill.Pod }) {
+			continue
+		}
+		corroborated = append(corroborated, kill)
+	}
+	return corroborated
+}
+
+// matchOOMKill returns the index of the first unmatched kill in kills that
+// is the same as kill, or -1. A kill without a time matches any kill in the
+// same pod.
+func matchOOMKill(kills []entity.OOMKill, matched []bool, kill entity.OOMKill) int {
+	for i, k := range kills {
+		if matched[i] || k.Pod != kill.Pod {
+			continue
+		}
+		if k.Time.IsZero() || kill.Time.IsZero() {
+			return i
+		}
+		if d := k.Time.Sub(kill.Time); d <= oomKillMatchWindow && d >= -oomKillMatchWindow {
+			return i
+		}
+	}
+	return -1
+}
+
+// recentTimedKills returns up to maxAnalyzedOOMKills of the most recent kills
+// with a known time.
+func recentTimedKills(kills []entity.OOMKill) []entity.OOMKill {
+	var timed []entity.OOMKill
+	for i := len(kills) - 1; i >= 0 && len(timed) < maxAnalyzedOOMKills; i-- {
+		if !kills[i].Time.IsZero() {
+			timed = append(timed, kills[i])
+		}
+	}
+	return timed
+}
+
+// oomMemoryLimit sizes the memory limit of an OOM-killed container from its
+// current limit and the working set before its kills. A kill preceded by a
+// working set close to the limit is explained by growth, and the limit is
+// raised by an hour of that growth, but at least 10%. A kill the working set
+// doesn't explain came from a spike between scrapes, and the limit is raised
+// by 50%. The increase is capped by the policy.
+func (uc *RecommenderUseCase) oomMemoryLimit(currentLimit *resource.Quantity, preKills []*entity.PreKillMemory) (*resource.Quantity, *entity.OOMSizing) {
+	var preKill *entity.PreKillMemory
+	for _, pk := range preKills {
+		if pk != nil && (preKill == nil || pk.Peak > preKill.Peak) {
+			preKill = pk
+		}
+	}
+
+	if currentLimit == nil || currentLimit.IsZero() {
+		sizing := &entity.OOMSizing{PreKill: preKill, Reason: "no memory limit was set, so the kill came from node memory pressure; using the default of 512Mi"}
+		limit := int64(oomMemoryDefault)
+		if preKill != nil && int64(preKill.Peak*mainContainerMemoryBufferPercent/100) > limit {
+			limit = roundUpMebibytes(preKill.Peak * mainContainerMemoryBufferPercent / 100)
+			sizing.Reason = "no memory limit was set, so the kill came from node memory pressure; using the peak working set before the kill plus 20%"
+		}
+		return resource.NewQuantity(limit, resource.BinarySI), sizing
+	}
+
+	current := float64(currentLimit.Value())
+	var increase float64
+	sizing := &entity.OOMSizing{CurrentLimit: currentLimit, PreKill: preKill}
+	switch {
+	case preKill == nil:
+		increase = current * (oomMemoryMultiplier - 1)
+		sizing.Reason = "no working set data before the kills; raised by 50%"
+	case preKill.Peak >= current*oomNearLimitRatio:
+		growth := preKill.GrowthRate * oomGrowthHeadroom.Seconds()
+		increase = math.Max(current*oomMinIncreaseRatio, growth)
+		sizing.Reason = fmt.Sprintf("working set reached %.0f%% of the limit, growing %.1fMi/min; raised by the larger of 10%% and one hour of growth",
+			preKill.Peak/current*100, preKill.GrowthRate*60/mebibyte)
+	default:
+		increase = current * (oomMemoryMultiplier - 1)
+		sizing.Reason = fmt.Sprintf("working set peaked at %.0f%% of the limit, so the kill came from a spike between scrapes; raised by 50%%",
+			preKill.Peak/current*100)
+	}
+
+	increaseBytes := roundUpMebibytes(increase)
+	if maxIncrease := uc.policy.OOMMaxIncrease; maxIncrease > 0 && increaseBytes > maxIncrease {
+		increaseBytes = maxIncrease
+		sizing.Capped = true
+		sizing.Reason += fmt.Sprintf(", capped at %s by policy", resource.NewQuantity(maxIncrease, resource.BinarySI).String())
+	}
+	sizing.Increase = resource.NewQuantity(increaseBytes, resource.BinarySI)
+	return resource.NewQuantity(currentLimit.Value()+increaseBytes, resource.BinarySI), sizing
+}
+
+// roundUpMebibytes rounds bytes up to whole mebibytes.
+func roundUpMebibytes(bytes float64) int64 {
+	return int64(math.Ceil(bytes/mebibyte)) * mebibyte
+}
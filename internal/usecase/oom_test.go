@@ -0,0 +1,176 @@
+package usecase
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sequring/sculptor/internal/entity"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMergeOOMKills(t *testing.T) {
+	// Arrange
+	killedAt := time.Date(2026, 10, 17, 9, 30, 0, 0, time.UTC)
+	status := []entity.OOMKill{{Pod: "api-1", Time: killedAt, Source: "container status"}}
+	metrics := []entity.OOMKill{
+		{Pod: "api-1", Time: killedAt.Add(-6 * time.Hour), Source: "metrics"},
+		{Pod: "api-1", Time: killedAt.Add(time.Minute), Source: "metrics"},
+		{Pod: "api-2", Time: killedAt.Add(time.Minute), Source: "metrics"},
+	}
+
+	// Act
+	kills := mergeOOMKills(status, metrics)
+
+	// Assert
+	if len(kills) != 3 {
+		t.Fatalf("expected 3 kills, got %v", kills)
+	}
+	if kills[0].Time != killedAt.Add(-6*time.Hour) || kills[1].Source != "container status" || kills[2].Pod != "api-2" {
+		t.Errorf("expected the earlier kill, the container status kill and api-2's kill in order, got %v", kills)
+	}
+}
+
+func TestCorroboratedOOMKills(t *testing.T) {
+	// Arrange
+	killedAt := time.Date(2026, 10, 17, 9, 30, 0, 0, time.UTC)
+	status := []entity.OOMKill{
+		{Pod: "api-1", Source: "event"},
+		{Pod: "api-2", Source: "event"},
+		{Pod: "api-2", Time: killedAt, Source: "container status"},
+	}
+	metrics := []entity.OOMKill{{Pod: "api-1", Time: killedAt, Source: "metrics"}}
+
+	// Act
+	kills := corroboratedOOMKills(status, metrics)
+
+	// Assert
+	if len(kills) != 2 || kills[0].Pod != "api-1" || kills[1].Time != killedAt {
+		t.Errorf("expected api-1's corroborated kill and api-2's timed kill, got %v", kills)
+	}
+}
+
+func TestRecommenderUseCase_CalculateForDeployment_OOMKillsFromMetrics(t *testing.T) {
+	// Arrange
+	deploymentGW := &mockDeploymentGateway{
+		deployment: &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-ns"},
+			Spec: appsv1.DeploymentSpec{
+				Template: v1.PodTemplateSpec{
+					Spec: v1.PodSpec{Containers: []v1.Container{{Name: "main-app"}}},
+				},
+			},
+		},
+	}
+	killedAt := time.Date(2026, 10, 17, 9, 30, 0, 0, time.UTC)
+	metricsGW := &mockMetricsGateway{
+		memValue:    200 * 1024 * 1024,
+		cpuP90Value: 0.1,
+		cpuP99Value: 0.2,
+		cpuP50Value: 0.1,
+		oomKills:    []entity.OOMKill{{Pod: "test-deployment-abc", Time: killedAt, Source: "metrics"}},
+	}
+	uc := NewRecommenderUseCase(deploymentGW, metricsGW, newTestLogger())
+
+	// Act
+	recs, err := uc.CalculateForDeployment(context.Background(), DeploymentParams{
+		Namespace:      "test-ns",
+		DeploymentName: "test-deployment",
+		TimeRange:      "7d",
+	})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rec := recs[0].Recommendation
+	if !rec.IsOOMKilled {
+		t.Error("expected IsOOMKilled to be true for a kill only seen in metrics")
+	}
+	if len(rec.OOMKills) != 1 || rec.OOMKills[0].Time != killedAt {
+		t.Errorf("expected the kill from metrics, got %v", rec.OOMKills)
+	}
+}
+
+func TestRecommenderUseCase_OOMMemoryLimit(t *testing.T) {
+	const mi = 1024 * 1024
+	tests := []struct {
+		name         string
+		currentLimit string
+		preKills     []*entity.PreKillMemory
+		maxIncrease  int64
+		wantLimit    string
+		wantCapped   bool
+		wantReason   string
+	}{
+		{
+			name:         "no data before the kill",
+			currentLimit: "256Mi",
+			wantLimit:    "384Mi",
+			wantReason:   "no working set data",
+		},
+		{
+			name:         "slow growth to the limit",
+			currentLimit: "1Gi",
+			preKills:     []*entity.PreKillMemory{{Peak: 1000 * mi, GrowthRate: 0.5 * mi / 60}},
+			wantLimit:    "1127Mi",
+			wantReason:   "growing 0.5Mi/min",
+		},
+		{
+			name:         "fast growth to the limit",
+			currentLimit: "1Gi",
+			preKills:     []*entity.PreKillMemory{nil, {Peak: 1000 * mi, GrowthRate: 10 * mi / 60}},
+			wantLimit:    "1624Mi",
+			wantReason:   "one hour of growth",
+		},
+		{
+			name:         "spike between scrapes",
+			currentLimit: "1Gi",
+			preKills:     []*entity.PreKillMemory{{Peak: 512 * mi}},
+			wantLimit:    "1536Mi",
+			wantReason:   "peaked at 50% of the limit",
+		},
+		{
+			name:         "large limit is capped",
+			currentLimit: "16Gi",
+			maxIncrease:  2 * 1024 * mi,
+			wantLimit:    "18Gi",
+			wantCapped:   true,
+			wantReason:   "capped at 2Gi by policy",
+		},
+		{
+			name:       "no limit",
+			preKills:   []*entity.PreKillMemory{{Peak: 1024 * mi}},
+			wantLimit:  "1229Mi",
+			wantReason: "no memory limit was set",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			uc := NewRecommenderUseCase(nil, nil, newTestLogger(), WithPolicy(Policy{OOMMaxIncrease: tt.maxIncrease}))
+			currentLimit := mustParseQuantity("0")
+			if tt.currentLimit != "" {
+				currentLimit = mustParseQuantity(tt.currentLimit)
+			}
+
+			// Act
+			limit, sizing := uc.oomMemoryLimit(currentLimit, tt.preKills)
+
+			// Assert
+			if want := mustParseQuantity(tt.wantLimit); limit.Cmp(*want) != 0 {
+				t.Errorf("limit: got %s, want %s", limit.String(), want.String())
+			}
+			if sizing.Capped != tt.wantCapped {
+				t.Errorf("capped: got %v, want %v", sizing.Capped, tt.wantCapped)
+			}
+			if !strings.Contains(sizing.Reason, tt.wantReason) {
+				t.Errorf("reason: got %q, want it to contain %q", sizing.Reason, tt.wantReason)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package usecase
+
+import (
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+)
+
+// carryResources copies the resources of each container's pod template that
+// the recommendation doesn't size, such as hugepages, device plugin resources
+// and unsized ephemeral storage, so applying the recommendation keeps them.
+func carryResources(d *appsv1.Deployment, recs []NamedRecommendation) {
+	for _, rec := range recs {
+		r := rec.Recommendation
+		c := templateContainer(d, rec.ContainerName)
+		if r == nil || r.IsMissingData() || c == nil {
+			continue
+		}
+		sized := map[v1.ResourceName]bool{v1.ResourceCPU: true, v1.ResourceMemory: true}
+		if r.EphemeralStorage != nil && r.EphemeralStorage.Request != nil {
+			sized[v1.ResourceEphemeralStorage] = true
+		}
+		r.PassthroughRequests = unsizedResources(c.Resources.Requests, sized)
+		r.PassthroughLimits = unsizedResources(c.Resources.Limits, sized)
+	}
+}
+
+// unsizedResources returns the resources of list that aren't sized, or nil.
+func unsizedResources(list v1.ResourceList, sized map[v1.ResourceName]bool) v1.ResourceList {
+	var unsized v1.ResourceList
+	for name, q := range list {
+		if sized[name] {
+			continue
+		}
+		if unsized == nil {
+			unsized = v1.ResourceList{}
+		}
+		unsized[name] = q.DeepCopy()
+	}
+	return unsized
+}
@@ -0,0 +1,108 @@
+package usecase
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sequring/sculptor/internal/entity"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRecommenderUseCase_CalculateForDeployment_CarriesResources(t *testing.T) {
+	// Arrange
+	resources := v1.ResourceList{
+		v1.ResourceCPU:              *mustParseQuantity("1"),
+		v1.ResourceMemory:           *mustParseQuantity("1Gi"),
+		v1.ResourceEphemeralStorage: *mustParseQuantity("2Gi"),
+		"hugepages-2Mi":             *mustParseQuantity("256Mi"),
+		"nvidia.com/gpu":            *mustParseQuantity("1"),
+	}
+	d := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-ns"},
+		Spec: appsv1.DeploymentSpec{
+			Template: v1.PodTemplateSpec{
+				Spec: v1.PodSpec{
+					Containers: []v1.Container{{Name: "main-app", Resources: v1.ResourceRequirements{Requests: resources, Limits: resources}}},
+				},
+			},
+		},
+	}
+	metricsGW := &mockMetricsGateway{
+		memValue:    100 * 1024 * 1024,
+		cpuP90Value: 0.2,
+		cpuP99Value: 0.4,
+		cpuP50Value: 0.25,
+		hugePages:   []entity.HugePagesUsage{{PageSize: "2Mi", Peak: 32 * 1024 * 1024}},
+	}
+	uc := NewRecommenderUseCase(&mockDeploymentGateway{deployment: d}, metricsGW, newTestLogger())
+
+	// Act
+	recs, err := uc.CalculateForDeployment(context.Background(), DeploymentParams{Namespace: "test-ns", DeploymentName: "test-deployment", TimeRange: "7d"})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rec := recs[0].Recommendation
+	for _, list := range []v1.ResourceList{rec.PassthroughRequests, rec.PassthroughLimits} {
+		if len(list) != 3 {
+			t.Errorf("expected hugepages, GPU and ephemeral storage to be carried through, got %v", list)
+		}
+		if gpu := list["nvidia.com/gpu"]; gpu.String() != "1" {
+			t.Errorf("nvidia.com/gpu: got %s, want 1", gpu.String())
+		}
+		if hugePages := list["hugepages-2Mi"]; hugePages.String() != "256Mi" {
+			t.Errorf("hugepages-2Mi: got %s, want 256Mi", hugePages.String())
+		}
+	}
+	requests, limits := recommendedResources(recs[0])
+	if _, ok := requests["hugepages-2Mi"]; !ok {
+		t.Errorf("expected recommended requests to include hugepages, got %v", requests)
+	}
+	if storage := limits[v1.ResourceEphemeralStorage]; storage.String() != "2Gi" {
+		t.Errorf("expected unsized ephemeral storage to be kept, got %s", storage.String())
+	}
+	if len(rec.HugePages) != 1 {
+		t.Fatalf("expected hugepages usage, got %v", rec.HugePages)
+	}
+	found := false
+	for _, w := range rec.Warnings {
+		found = found || strings.Contains(w, "used at most 32Mi of the 256Mi of hugepages-2Mi")
+	}
+	if !found {
+		t.Errorf("expected a warning about unused hugepages, got %v", rec.Warnings)
+	}
+}
+
+func TestCarryResources_SizedEphemeralStorage(t *testing.T) {
+	// Arrange
+	resources := v1.ResourceList{
+		v1.ResourceEphemeralStorage: *mustParseQuantity("2Gi"),
+		"example.com/fpga":          *mustParseQuantity("2"),
+	}
+	d := &appsv1.Deployment{Spec: appsv1.DeploymentSpec{Template: v1.PodTemplateSpec{Spec: v1.PodSpec{
+		Containers: []v1.Container{{Name: "app", Resources: v1.ResourceRequirements{Requests: resources}}},
+	}}}}
+	rec := &entity.Recommendation{
+		Memory:           mustParseQuantity("256Mi"),
+		CPU:              &entity.CPURecommendation{Request: mustParseQuantity("100m")},
+		EphemeralStorage: &entity.EphemeralStorage{Request: mustParseQuantity("1Gi"), Limit: mustParseQuantity("2Gi")},
+	}
+
+	// Act
+	carryResources(d, []NamedRecommendation{{ContainerName: "app", Recommendation: rec}})
+
+	// Assert
+	if _, ok := rec.PassthroughRequests[v1.ResourceEphemeralStorage]; ok {
+		t.Errorf("expected sized ephemeral storage not to be carried through, got %v", rec.PassthroughRequests)
+	}
+	if _, ok := rec.PassthroughRequests["example.com/fpga"]; !ok {
+		t.Errorf("expected example.com/fpga to be carried through, got %v", rec.PassthroughRequests)
+	}
+	if rec.PassthroughLimits != nil {
+		t.Errorf("expected no limits to be carried through, got %v", rec.PassthroughLimits)
+	}
+}
@@ -0,0 +1,240 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// PodRequests compares the CPU and memory the scheduler reserves for a pod of
+// the Deployment before and after the recommendations are applied.
+type PodRequests struct {
+	// RuntimeClass is the RuntimeClass the overhead was read from, or empty
+	// if the pod template sets none.
+	RuntimeClass string
+	// Overhead is the fixed pod overhead included in the requests, or nil if
+	// there is none.
+	Overhead v1.ResourceList
+	// OverheadErr is set when the RuntimeClass could not be read, leaving
+	// its overhead out.
+	OverheadErr error
+	Current     v1.ResourceList
+	Recommended v1.ResourceList
+	// InitBound lists the resources whose recommended request is set by an
+	// init container rather than by the containers that keep running.
+	InitBound []v1.ResourceName
+	// Nodes is the number of nodes the pod can be scheduled on, and
+	// FittingNodes the number of them whose allocatable resources hold the
+	// recommended requests. Both are zero if the nodes are unknown.
+	Nodes        int
+	FittingNodes int
+	// NodesErr is set when the nodes could not be listed.
+	NodesErr error
+	// LargestFit is, for each resource, the largest request that fits a node
+	// on which the other recommended requests fit. It is only set when the
+	// recommended requests fit no node.
+	LargestFit v1.ResourceList
+	// LimitRangeIssues describes how the recommended pod totals violate the
+	// Pod limits of the namespace's LimitRanges.
+	LimitRangeIssues []string
+}
+
+// AssessPodRequests computes the effective requests of the Deployment's pods
+// with their current resources and with recs applied, and stores the result on
+// recs.
+func (uc *RecommenderUseCase) AssessPodRequests(ctx context.Context, params DeploymentParams, recs *AllRecommendations) error {
+	d, err := uc.k8sGateway.GetDeployment(ctx, params.Namespace, params.DeploymentName)
+	if err != nil {
+		return fmt.Errorf("could not get deployment: %w", err)
+	}
+
+	spec := d.Spec.Template.Spec.DeepCopy()
+	applyRecommendations(spec.Containers, recs.MainContainers)
+	applyRecommendations(spec.InitContainers, recs.InitContainers)
+
+	podRequests := &PodRequests{}
+	podRequests.Overhead, podRequests.RuntimeClass, podRequests.OverheadErr = uc.podOverhead(ctx, d)
+	podRequests.Current, _ = effectiveRequests(&d.Spec.Template.Spec, podRequests.Overhead)
+	podRequests.Recommended, podRequests.InitBound = effectiveRequests(spec, podRequests.Overhead)
+
+	nodes, err := uc.k8sGateway.ListNodes(ctx, spec)
+	if err != nil {
+		uc.logger.Warn("Could not list nodes to check that the pod fits", "error", err)
+		podRequests.NodesErr = err
+	}
+	podRequests.Nodes = len(nodes)
+	podRequests.FittingNodes, podRequests.LargestFit = nodeFit(nodes, podRequests.Recommended)
+
+	limitRanges, err := uc.k8sGateway.ListLimitRanges(ctx, params.Namespace)
+	if err != nil {
+		uc.logger.Warn("Could not check pod totals against LimitRanges", "namespace", params.Namespace, "error", err)
+	}
+	// LimitRanges constrain what the containers ask for, without the overhead
+	// the RuntimeClass adds.
+	containerRequests, _ := effectiveRequests(spec, nil)
+	podRequests.LimitRangeIssues = podLimitRangeIssues(limitRanges, containerRequests, effectiveLimits(spec, nil))
+	recs.PodRequests = podRequests
+	return nil
+}
+
+// nodeFit counts the nodes whose allocatable resources hold requests. If none
+// does, it also returns the largest fitting value of each resource.
+func nodeFit(nodes []v1.Node, requests v1.ResourceList) (int, v1.ResourceList) {
+	fitting := 0
+	for _, node := range nodes {
+		if len(exceeded(node.Status.Allocatable, requests)) == 0 {
+			fitting++
+		}
+	}
+	if fitting > 0 || len(nodes) == 0 {
+		return fitting, nil
+	}
+
+	largest := v1.ResourceList{}
+	for _, name := range exceededAnywhere(nodes, requests) {
+		for _, node := range nodes {
+			if others := exceeded(node.Status.Allocatable, requests); len(others) > 1 || len(others) == 1 && others[0] != name {
+				continue
+			}
+			if allocatable, ok := node.Status.Allocatable[name]; ok && allocatable.Cmp(largest[name]) > 0 {
+				largest[name] = allocatable
+			}
+		}
+	}
+	return 0, largest
+}
+
+// exceededAnywhere lists the requested resources that exceed the allocatable
+// resources of at least one node.
+func exceededAnywhere(nodes []v1.Node, requests v1.ResourceList) []v1.ResourceName {
+	seen := v1.ResourceList{}
+	for _, node := range nodes {
+		for _, name := range exceeded(node.Status.Allocatable, requests) {
+			seen[name] = requests[name]
+		}
+	}
+	return sortedResourceNames(seen)
+}
+
+// exceeded lists the requested resources that exceed allocatable. A node that
+// doesn't advertise a resource holds none of it.
+func exceeded(allocatable, requests v1.ResourceList) []v1.ResourceName {
+	var names []v1.ResourceName
+	for _, name := range sortedResourceNames(requests) {
+		request := requests[name]
+		if request.IsZero() {
+			continue
+		}
+		if available, ok := allocatable[name]; !ok || request.Cmp(available) > 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// podOverhead returns the pod overhead of the Deployment's pods. The API
+// server copies it from the RuntimeClass into each pod, so pod templates
+// rarely carry it themselves.
+func (uc *RecommenderUseCase) podOverhead(ctx context.Context, d *appsv1.Deployment) (v1.ResourceList, string, error) {
+	spec := &d.Spec.Template.Spec
+	if spec.Overhead != nil || spec.RuntimeClassName == nil {
+		return spec.Overhead, "", nil
+	}
+	name := *spec.RuntimeClassName
+	runtimeClass, err := uc.k8sGateway.GetRuntimeClass(ctx, name)
+	if err != nil {
+		uc.logger.Warn("Could not read the pod overhead of the RuntimeClass", "runtimeClass", name, "error", err)
+		return nil, name, err
+	}
+	if runtimeClass == nil || runtimeClass.Overhead == nil {
+		return nil, name, nil
+	}
+	return runtimeClass.Overhead.PodFixed, name, nil
+}
+
+// effectiveRequests computes the requests the scheduler reserves for a pod,
+// for CPU, memory and every other resource a container or the overhead sets,
+// following the kubelet's rules: the larger of the containers that keep
+// running (main containers and native sidecars) and the largest init
+// container with the sidecars started before it, plus the pod overhead.
+// initBound lists the resources an init container sets.
+func effectiveRequests(spec *v1.PodSpec, overhead v1.ResourceList) (requests v1.ResourceList, initBound []v1.ResourceName) {
+	return effectiveResources(spec, overhead, containerRequest)
+}
+
+// effectiveLimits computes the limits of a pod the way effectiveRequests
+// computes its requests. Unset container limits count as zero.
+func effectiveLimits(spec *v1.PodSpec, overhead v1.ResourceList) v1.ResourceList {
+	limits, _ := effectiveResources(spec, overhead, func(c v1.Container, name v1.ResourceName) resource.Quantity {
+		return c.Resources.Limits[name].DeepCopy()
+	})
+	return limits
+}
+
+func effectiveResources(spec *v1.PodSpec, overhead v1.ResourceList, value func(v1.Container, v1.ResourceName) resource.Quantity) (requests v1.ResourceList, initBound []v1.ResourceName) {
+	requests = v1.ResourceList{}
+	for _, name := range podResourceNames(spec, overhead) {
+		var sidecars, initPeak resource.Quantity
+		for _, c := range spec.InitContainers {
+			request := value(c, name)
+			request.Add(sidecars)
+			if request.Cmp(initPeak) > 0 {
+				initPeak = request
+			}
+			if isNativeSidecar(c) {
+				sidecars.Add(value(c, name))
+			}
+		}
+
+		running := sidecars.DeepCopy()
+		for _, c := range spec.Containers {
+			running.Add(value(c, name))
+		}
+
+		effective := running
+		if initPeak.Cmp(running) > 0 {
+			effective = initPeak
+			initBound = append(initBound, name)
+		}
+		if o, ok := overhead[name]; ok {
+			effective.Add(o)
+		}
+		requests[name] = effective
+	}
+	return requests, initBound
+}
+
+// podResourceNames lists CPU, memory and the other resources the containers
+// of spec request or limit, or the overhead sets.
+func podResourceNames(spec *v1.PodSpec, overhead v1.ResourceList) []v1.ResourceName {
+	set := v1.ResourceList{v1.ResourceCPU: resource.Quantity{}, v1.ResourceMemory: resource.Quantity{}}
+	for _, containers := range [][]v1.Container{spec.InitContainers, spec.Containers} {
+		for _, c := range containers {
+			for name := range c.Resources.Requests {
+				set[name] = resource.Quantity{}
+			}
+			for name := range c.Resources.Limits {
+				set[name] = resource.Quantity{}
+			}
+		}
+	}
+	for name := range overhead {
+		set[name] = resource.Quantity{}
+	}
+	return sortedResourceNames(set)
+}
+
+// containerRequest returns a container's request for a resource. An unset
+// request defaults to the limit, as the API server does.
+func containerRequest(c v1.Container, name v1.ResourceName) resource.Quantity {
+	if request, ok := c.Resources.Requests[name]; ok {
+		return request.DeepCopy()
+	}
+	if limit, ok := c.Resources.Limits[name]; ok {
+		return limit.DeepCopy()
+	}
+	return resource.Quantity{}
+}
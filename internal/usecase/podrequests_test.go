@@ -0,0 +1,223 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sequring/sculptor/internal/entity"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	nodev1 "k8s.io/api/node/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func cpuContainer(name, request string) v1.Container {
+	return v1.Container{Name: name, Resources: v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse(request)}}}
+}
+
+func TestEffectiveRequests(t *testing.T) {
+	always := v1.ContainerRestartPolicyAlways
+	sidecar := cpuContainer("proxy", "200m")
+	sidecar.RestartPolicy = &always
+	limitOnly := v1.Container{Name: "limit-only", Resources: v1.ResourceRequirements{Limits: v1.ResourceList{v1.ResourceCPU: resource.MustParse("300m")}}}
+
+	tests := []struct {
+		name          string
+		spec          v1.PodSpec
+		overhead      v1.ResourceList
+		wantCPU       int64
+		wantOther     v1.ResourceList
+		wantInitBound bool
+	}{
+		{
+			name:    "main containers are summed",
+			spec:    v1.PodSpec{Containers: []v1.Container{cpuContainer("app", "500m"), limitOnly}},
+			wantCPU: 800,
+		},
+		{
+			name:          "largest init container",
+			spec:          v1.PodSpec{InitContainers: []v1.Container{cpuContainer("migrate", "2"), cpuContainer("setup", "1")}, Containers: []v1.Container{cpuContainer("app", "500m")}},
+			wantCPU:       2000,
+			wantInitBound: true,
+		},
+		{
+			name:    "sidecars run alongside later init containers and the main containers",
+			spec:    v1.PodSpec{InitContainers: []v1.Container{sidecar, cpuContainer("setup", "400m")}, Containers: []v1.Container{cpuContainer("app", "500m")}},
+			wantCPU: 700,
+		},
+		{
+			name:          "init container after a sidecar",
+			spec:          v1.PodSpec{InitContainers: []v1.Container{sidecar, cpuContainer("migrate", "1")}, Containers: []v1.Container{cpuContainer("app", "500m")}},
+			wantCPU:       1200,
+			wantInitBound: true,
+		},
+		{
+			name: "resources other than CPU and memory",
+			spec: v1.PodSpec{Containers: []v1.Container{{Name: "app", Resources: v1.ResourceRequirements{
+				Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("500m"), v1.ResourceEphemeralStorage: resource.MustParse("1Gi")},
+				Limits:   v1.ResourceList{v1.ResourceHugePagesPrefix + "2Mi": resource.MustParse("256Mi")},
+			}}}},
+			wantCPU: 500,
+			wantOther: v1.ResourceList{
+				v1.ResourceEphemeralStorage:        resource.MustParse("1Gi"),
+				v1.ResourceHugePagesPrefix + "2Mi": resource.MustParse("256Mi"),
+			},
+		},
+		{
+			name:     "overhead",
+			spec:     v1.PodSpec{Containers: []v1.Container{cpuContainer("app", "500m")}},
+			overhead: v1.ResourceList{v1.ResourceCPU: resource.MustParse("250m")},
+			wantCPU:  750,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests, initBound := effectiveRequests(&tt.spec, tt.overhead)
+
+			cpu := requests[v1.ResourceCPU]
+			if cpu.MilliValue() != tt.wantCPU {
+				t.Errorf("CPU: got %dm, want %dm", cpu.MilliValue(), tt.wantCPU)
+			}
+			for name, want := range tt.wantOther {
+				if got := requests[name]; got.Cmp(want) != 0 {
+					t.Errorf("%s: got %s, want %s", name, got.String(), want.String())
+				}
+			}
+			if got := len(initBound) > 0; got != tt.wantInitBound {
+				t.Errorf("init bound: got %v, want %v", initBound, tt.wantInitBound)
+			}
+		})
+	}
+}
+
+func TestRecommenderUseCase_AssessPodRequests(t *testing.T) {
+	// Arrange
+	kata := "kata"
+	app := cpuContainer("app", "2")
+	app.Resources.Requests[v1.ResourceMemory] = resource.MustParse("2Gi")
+	deploymentGW := &mockDeploymentGateway{
+		deployment: &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-ns"},
+			Spec: appsv1.DeploymentSpec{
+				Template: v1.PodTemplateSpec{
+					Spec: v1.PodSpec{RuntimeClassName: &kata, Containers: []v1.Container{app}},
+				},
+			},
+		},
+		runtimeClass: &nodev1.RuntimeClass{
+			ObjectMeta: metav1.ObjectMeta{Name: kata},
+			Overhead:   &nodev1.Overhead{PodFixed: v1.ResourceList{v1.ResourceCPU: resource.MustParse("250m"), v1.ResourceMemory: resource.MustParse("160Mi")}},
+		},
+	}
+	uc := NewRecommenderUseCase(deploymentGW, &mockMetricsGateway{}, newTestLogger())
+	recs := &AllRecommendations{MainContainers: []NamedRecommendation{{
+		ContainerName: "app",
+		Recommendation: &entity.Recommendation{
+			Memory: mustParseQuantity("512Mi"),
+			CPU:    &entity.CPURecommendation{Request: mustParseQuantity("1")},
+		},
+	}}}
+
+	// Act
+	err := uc.AssessPodRequests(context.Background(), DeploymentParams{Namespace: "test-ns", DeploymentName: "test-deployment"}, recs)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pr := recs.PodRequests
+	if pr == nil || pr.RuntimeClass != kata {
+		t.Fatalf("expected pod requests with the overhead of %s, got %+v", kata, pr)
+	}
+	currentCPU, recommendedCPU := pr.Current[v1.ResourceCPU], pr.Recommended[v1.ResourceCPU]
+	if currentCPU.MilliValue() != 2250 || recommendedCPU.MilliValue() != 1250 {
+		t.Errorf("CPU: got %s -> %s, want 2250m -> 1250m", currentCPU.String(), recommendedCPU.String())
+	}
+	recommendedMemory := pr.Recommended[v1.ResourceMemory]
+	if want := resource.MustParse("672Mi"); recommendedMemory.Cmp(want) != 0 {
+		t.Errorf("memory: got %s, want %s", recommendedMemory.String(), want.String())
+	}
+
+	// A RuntimeClass that can't be read leaves the overhead out.
+	deploymentGW.runtimeClass, deploymentGW.runtimeClassErr = nil, errors.New("forbidden")
+	if err := uc.AssessPodRequests(context.Background(), DeploymentParams{Namespace: "test-ns", DeploymentName: "test-deployment"}, recs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if recs.PodRequests.OverheadErr == nil || recs.PodRequests.Overhead != nil {
+		t.Errorf("expected the overhead to be left out with an error, got %+v", recs.PodRequests)
+	}
+}
+
+func testNode(name, cpu, memory string) v1.Node {
+	return v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: v1.NodeStatus{Allocatable: v1.ResourceList{
+			v1.ResourceCPU:    resource.MustParse(cpu),
+			v1.ResourceMemory: resource.MustParse(memory),
+		}},
+	}
+}
+
+func TestNodeFit(t *testing.T) {
+	nodes := []v1.Node{testNode("small", "4", "8Gi"), testNode("large", "2", "16Gi")}
+
+	fitting, largest := nodeFit(nodes, v1.ResourceList{v1.ResourceCPU: resource.MustParse("1"), v1.ResourceMemory: resource.MustParse("12Gi")})
+	if fitting != 1 || largest != nil {
+		t.Errorf("expected one fitting node, got %d, %v", fitting, largest)
+	}
+
+	fitting, largest = nodeFit(nodes, v1.ResourceList{v1.ResourceCPU: resource.MustParse("3"), v1.ResourceMemory: resource.MustParse("12Gi")})
+	if fitting != 0 {
+		t.Fatalf("expected no fitting node, got %d", fitting)
+	}
+	// 3 CPUs fit only the small node, which holds 8Gi. 12Gi fits only the
+	// large node, which holds 2 CPUs.
+	cpu, memory := largest[v1.ResourceCPU], largest[v1.ResourceMemory]
+	if cpu.Cmp(resource.MustParse("2")) != 0 || memory.Cmp(resource.MustParse("8Gi")) != 0 {
+		t.Errorf("largest fit: got CPU %s, memory %s; want 2, 8Gi", cpu.String(), memory.String())
+	}
+
+	if fitting, largest := nodeFit(nil, v1.ResourceList{}); fitting != 0 || largest != nil {
+		t.Errorf("expected nothing without nodes, got %d, %v", fitting, largest)
+	}
+}
+
+func TestNodeFit_OtherResources(t *testing.T) {
+	small := testNode("small", "4", "16Gi")
+	small.Status.Allocatable[v1.ResourceEphemeralStorage] = resource.MustParse("20Gi")
+	large := testNode("large", "4", "16Gi")
+	large.Status.Allocatable[v1.ResourceEphemeralStorage] = resource.MustParse("100Gi")
+	nodes := []v1.Node{small, large}
+	requests := v1.ResourceList{
+		v1.ResourceCPU:              resource.MustParse("1"),
+		v1.ResourceMemory:           resource.MustParse("2Gi"),
+		v1.ResourceEphemeralStorage: resource.MustParse("50Gi"),
+	}
+
+	if fitting, _ := nodeFit(nodes, requests); fitting != 1 {
+		t.Errorf("expected only the node with enough ephemeral storage to fit, got %d", fitting)
+	}
+
+	// No node advertises hugepages, so none fits, and no node falls short on
+	// ephemeral storage alone.
+	requests[v1.ResourceHugePagesPrefix+"2Mi"] = resource.MustParse("1Gi")
+	fitting, largest := nodeFit(nodes, requests)
+	if fitting != 0 {
+		t.Fatalf("expected no node without hugepages to fit, got %d", fitting)
+	}
+	if _, ok := largest[v1.ResourceEphemeralStorage]; ok {
+		t.Errorf("expected no largest ephemeral storage, got %v", largest)
+	}
+
+	// Without hugepages only ephemeral storage exceeds the small node.
+	delete(requests, v1.ResourceHugePagesPrefix+"2Mi")
+	requests[v1.ResourceEphemeralStorage] = resource.MustParse("200Gi")
+	_, largest = nodeFit(nodes, requests)
+	storage := largest[v1.ResourceEphemeralStorage]
+	if storage.Cmp(resource.MustParse("100Gi")) != 0 {
+		t.Errorf("largest ephemeral storage: got %s, want 100Gi", storage.String())
+	}
+}
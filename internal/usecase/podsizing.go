@@ -0,0 +1,148 @@
+package usecase
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/sequring/sculptor/internal/entity"
+)
+
+// PodSizing selects which pods of a workload main containers are sized for.
+type PodSizing string
+
+const (
+	// PodSizingMax sizes for the pod with the highest usage.
+	PodSizingMax PodSizing = "max"
+	// PodSizingQuantile sizes for a quantile of the per-pod usage, so a few
+	// hot pods don't set the size of all of them.
+	PodSizingQuantile PodSizing = "quantile"
+	// PodSizingMedian sizes for the median pod.
+	PodSizingMedian PodSizing = "median"
+)
+
+const (
+	// defaultPodQuantile is the quantile of pods sized for when the policy
+	// sets none.
+	defaultPodQuantile = 0.9
+	// podOutlierRatio is how far above the median a pod's p99 must be for
+	// it to count as an outlier.
+	podOutlierRatio = 1.5
+	// podOutlierMinPods is the fewest pods a median is meaningful for.
+	podOutlierMinPods = 3
+)
+
+// podScale holds the factors that scale usage aggregated over all pods, which
+// is that of the max pod, to the pods the policy sizes for.
+type podScale struct {
+	memory float64
+	cpuP90 float64
+	cpuP99 float64
+}
+
+var unscaled = podScale{memory: 1, cpuP90: 1, cpuP99: 1}
+
+// podDistribution summarizes per-pod usage and returns the factors that scale
+// the aggregated usage to the policy's pod sizing. It returns nil and no
+// scaling without per-pod usage.
+func (uc *RecommenderUseCase) podDistribution(pods []entity.PodUsage) (*entity.PodDistribution, podScale) {
+	if len(pods) == 0 {
+		return nil, unscaled
+	}
+	memory := make([]float64, len(pods))
+	cpuP90 := make([]float64, len(pods))
+	cpuP99 := make([]float64, len(pods))
+	for i, p := range pods {
+		memory[i], cpuP90[i], cpuP99[i] = p.MemoryP99, p.CPUP90, p.CPUP99
+	}
+	sort.Float64s(memory)
+	sort.Float64s(cpuP90)
+	sort.Float64s(cpuP99)
+
+	dist := &entity.PodDistribution{
+		Pods:      len(pods),
+		MemoryP99: spread(memory),
+		CPUP99:    spread(cpuP99),
+		SizedFor:  "the max pod",
+	}
+	if len(pods) >= podOutlierMinPods {
+		var outliers []string
+		for _, p := range pods {
+			if isOutlier(p.MemoryP99, dist.MemoryP99.Median) || isOutlier(p.CPUP99, dist.CPUP99.Median) {
+				outliers = append(outliers, p.Pod)
+			}
+		}
+		switch {
+		case len(outliers) == 1:
+			dist.Outlier = outliers[0]
+		case len(outliers) > 1:
+			dist.Imbalanced = true
+		}
+	}
+
+	q := 1.0
+	switch uc.policy.PodSizing {
+	case PodSizingQuantile:
+		q = uc.policy.PodQuantile
+		if q <= 0 || q > 1 {
+			q = defaultPodQuantile
+		}
+		dist.SizedFor = fmt.Sprintf("p%g of pods", q*100)
+	case PodSizingMedian:
+		q = 0.5
+		dist.SizedFor = "the median pod"
+	}
+	if q == 1 {
+		return dist, unscaled
+	}
+	return dist, podScale{
+		memory: ratio(quantile(q, memory), dist.MemoryP99.Max),
+		cpuP90: ratio(quantile(q, cpuP90), cpuP90[len(cpuP90)-1]),
+		cpuP99: ratio(quantile(q, cpuP99), dist.CPUP99.Max),
+	}
+}
+
+// podDistributionWarnings suggests sizing for fewer than the max pod when one
+// or several pods use far more than the rest.
+func (uc *RecommenderUseCase) podDistributionWarnings(containerName string, d *entity.PodDistribution) []string {
+	if d == nil {
+		return nil
+	}
+	sizedForMax := uc.policy.PodSizing == "" || uc.policy.PodSizing == PodSizingMax
+	switch {
+	case d.Outlier != "" && sizedForMax:
+		return []string{fmt.Sprintf("Pod '%s' uses far more than the other pods of container '%s' and sets its size; investigate it or use --pod-sizing=quantile", d.Outlier, containerName)}
+	case d.Outlier != "":
+		return []string{fmt.Sprintf("Pod '%s' uses far more than the other pods of container '%s'; sized for %s, it may be throttled or OOM-killed", d.Outlier, containerName, d.SizedFor)}
+	case d.Imbalanced:
+		return []string{fmt.Sprintf("Load is unevenly spread across the %d pods of container '%s'; check the load balancing before sizing for fewer than the max pod", d.Pods, containerName)}
+	}
+	return nil
+}
+
+// spread summarizes sorted values.
+func spread(sorted []float64) entity.Spread {
+	return entity.Spread{Min: sorted[0], Median: quantile(0.5, sorted), Max: sorted[len(sorted)-1]}
+}
+
+// quantile interpolates the q-quantile of sorted values the way PromQL's
+// quantile does.
+func quantile(q float64, sorted []float64) float64 {
+	rank := q * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	weight := rank - float64(lower)
+	return sorted[lower]*(1-weight) + sorted[upper]*weight
+}
+
+func isOutlier(v, median float64) bool {
+	return median > 0 && v > median*podOutlierRatio
+}
+
+// ratio returns part/whole, or 1 when whole is zero.
+func ratio(part, whole float64) float64 {
+	if whole <= 0 {
+		return 1
+	}
+	return part / whole
+}
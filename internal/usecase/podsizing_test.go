@@ -0,0 +1,182 @@
+package usecase
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sequring/sculptor/internal/entity"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func podUsage(pod string, memory, cpuP90, cpuP99 float64) entity.PodUsage {
+	return entity.PodUsage{Pod: pod, Usage: entity.Usage{MemoryP99: memory, CPUP90: cpuP90, CPUP99: cpuP99}}
+}
+
+func TestPodDistribution(t *testing.T) {
+	tests := []struct {
+		name           string
+		policy         Policy
+		pods           []entity.PodUsage
+		wantOutlier    string
+		wantImbalanced bool
+		wantSizedFor   string
+		wantMemory     float64
+	}{
+		{
+			name:         "balanced",
+			pods:         []entity.PodUsage{podUsage("a", 100, 1, 1), podUsage("b", 110, 1, 1), podUsage("c", 120, 1, 1)},
+			wantSizedFor: "the max pod",
+			wantMemory:   1,
+		},
+		{
+			name:         "single outlier",
+			policy:       Policy{PodSizing: PodSizingMedian},
+			pods:         []entity.PodUsage{podUsage("a", 100, 1, 1), podUsage("b", 100, 1, 1), podUsage("c", 400, 1, 1)},
+			wantOutlier:  "c",
+			wantSizedFor: "the median pod",
+			wantMemory:   0.25,
+		},
+		{
+			name:           "imbalanced",
+			policy:         Policy{PodSizing: PodSizingQuantile, PodQuantile: 0.5},
+			pods:           []entity.PodUsage{podUsage("a", 100, 1, 1), podUsage("b", 100, 1, 1), podUsage("c", 100, 1, 1), podUsage("d", 300, 1, 1), podUsage("e", 300, 1, 3)},
+			wantImbalanced: true,
+			wantSizedFor:   "p50 of pods",
+			wantMemory:     1.0 / 3,
+		},
+		{
+			name:         "too few pods for outliers",
+			pods:         []entity.PodUsage{podUsage("a", 100, 1, 1), podUsage("b", 400, 1, 1)},
+			wantSizedFor: "the max pod",
+			wantMemory:   1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uc := NewRecommenderUseCase(nil, nil, newTestLogger(), WithPolicy(tt.policy))
+
+			dist, scale := uc.podDistribution(tt.pods)
+
+			if dist.Outlier != tt.wantOutlier || dist.Imbalanced != tt.wantImbalanced {
+				t.Errorf("outlier %q, imbalanced %v; want %q, %v", dist.Outlier, dist.Imbalanced, tt.wantOutlier, tt.wantImbalanced)
+			}
+			if dist.SizedFor != tt.wantSizedFor {
+				t.Errorf("sized for %q, want %q", dist.SizedFor, tt.wantSizedFor)
+			}
+			if scale.memory != tt.wantMemory {
+				t.Errorf("memory scale %v, want %v", scale.memory, tt.wantMemory)
+			}
+		})
+	}
+
+	uc := NewRecommenderUseCase(nil, nil, newTestLogger())
+	if dist, scale := uc.podDistribution(nil); dist != nil || scale != unscaled {
+		t.Errorf("expected no distribution and no scaling without per-pod usage, got %+v, %+v", dist, scale)
+	}
+}
+
+func TestRecommenderUseCase_CalculateForDeployment_PodSizing(t *testing.T) {
+	// Arrange
+	deploymentGW := &mockDeploymentGateway{
+		deployment: &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-ns"},
+			Spec: appsv1.DeploymentSpec{
+				Template: v1.PodTemplateSpec{
+					Spec: v1.PodSpec{Containers: []v1.Container{{Name: "main-app"}}},
+				},
+			},
+		},
+	}
+	metricsGW := &mockMetricsGateway{
+		memValue:    400 * mebibyte,
+		cpuP90Value: 0.3,
+		cpuP99Value: 0.6,
+		cpuP50Value: 0.4,
+		podUsage: []entity.PodUsage{
+			podUsage("test-deployment-1", 100*mebibyte, 0.1, 0.2),
+			podUsage("test-deployment-2", 120*mebibyte, 0.2, 0.3),
+			podUsage("test-deployment-3", 400*mebibyte, 0.3, 0.6),
+		},
+	}
+	uc := NewRecommenderUseCase(deploymentGW, metricsGW, newTestLogger(), WithPolicy(Policy{PodSizing: PodSizingMedian}))
+
+	// Act
+	recs, err := uc.CalculateForDeployment(context.Background(), DeploymentParams{
+		Namespace:      "test-ns",
+		DeploymentName: "test-deployment",
+		TimeRange:      "7d",
+	})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rec := recs[0].Recommendation
+	if want := int64(120 * mebibyte * 12 / 10); rec.Memory.Value() != want {
+		t.Errorf("Memory: got %d, want %d from the median pod", rec.Memory.Value(), want)
+	}
+	if got := rec.CPU.Request.MilliValue(); got != 200 {
+		t.Errorf("CPU request: got %dm, want 200m from the median pod", got)
+	}
+	if got := rec.CPU.Limit.MilliValue(); got != 300 {
+		t.Errorf("CPU limit: got %dm, want 300m from the median pod", got)
+	}
+	if rec.PodDistribution == nil || rec.PodDistribution.Outlier != "test-deployment-3" {
+		t.Fatalf("expected test-deployment-3 to be reported as an outlier, got %+v", rec.PodDistribution)
+	}
+	if len(rec.Warnings) != 1 || !strings.Contains(rec.Warnings[0], "may be throttled or OOM-killed") {
+		t.Errorf("expected an outlier warning, got %v", rec.Warnings)
+	}
+}
+
+func TestRecommenderUseCase_CalculateForDeployment_SinglePod(t *testing.T) {
+	// Arrange
+	deploymentGW := &mockDeploymentGateway{
+		deployment: &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-ns"},
+			Spec: appsv1.DeploymentSpec{
+				Template: v1.PodTemplateSpec{
+					Spec: v1.PodSpec{Containers: []v1.Container{{Name: "main-app"}}},
+				},
+			},
+		},
+	}
+	// Per-pod usage would report an outlier if it were fetched.
+	metricsGW := &mockMetricsGateway{
+		memValue:    400 * mebibyte,
+		cpuP90Value: 0.3,
+		cpuP99Value: 0.6,
+		cpuP50Value: 0.4,
+		quality:     &entity.DataQuality{Span: 7 * 24 * time.Hour, Pods: 1},
+		podUsage: []entity.PodUsage{
+			podUsage("test-deployment-1", 100*mebibyte, 0.1, 0.2),
+			podUsage("test-deployment-2", 120*mebibyte, 0.2, 0.3),
+			podUsage("test-deployment-3", 400*mebibyte, 0.3, 0.6),
+		},
+	}
+	uc := NewRecommenderUseCase(deploymentGW, metricsGW, newTestLogger(), WithPolicy(Policy{PodSizing: PodSizingMedian}))
+
+	// Act
+	recs, err := uc.CalculateForDeployment(context.Background(), DeploymentParams{
+		Namespace:      "test-ns",
+		DeploymentName: "test-deployment",
+		TimeRange:      "7d",
+	})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rec := recs[0].Recommendation
+	if rec.PodDistribution != nil {
+		t.Errorf("expected no per-pod usage for a single pod, got %+v", rec.PodDistribution)
+	}
+	if want := int64(400 * mebibyte * 12 / 10); rec.Memory.Value() != want {
+		t.Errorf("Memory: got %d, want %d from the only pod", rec.Memory.Value(), want)
+	}
+}
@@ -0,0 +1,131 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sequring/sculptor/internal/entity"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// MemorySizing selects how memory requests relate to memory limits.
+type MemorySizing string
+
+const (
+	// MemoryGuaranteed sets the memory request equal to the limit.
+	MemoryGuaranteed MemorySizing = "guaranteed"
+	// MemoryBurstable sets the memory request to the p95 working set and
+	// keeps the limit at the p99 plus buffer.
+	MemoryBurstable MemorySizing = "burstable"
+)
+
+// Policy controls the requirements and shape of recommendations.
+type Policy struct {
+	// MinDataSpan is the time span of samples a main container needs for its
+	// recommendation to count as sufficient. An analysis range shorter than
+	// this value is itself reported as insufficient.
+	MinDataSpan time.Duration
+	// MinPods is the number of distinct pods that must have been observed.
+	MinPods int
+	// OmitCPULimit recommends CPU requests only. The limit that would have
+	// been recommended is kept as CPURecommendation.SuggestedLimit.
+	OmitCPULimit bool
+	// MemorySizing chooses between Guaranteed-style and Burstable-style
+	// memory. The zero value is Guaranteed-style.
+	MemorySizing MemorySizing
+	// QoSClass is the pod QoS class recommendations should produce. Empty
+	// means no target. Deployments can override it with QoSClassAnnotation.
+	QoSClass v1.PodQOSClass
+	// CPUManagerStatic rounds CPU up to whole cores for Guaranteed pods, so
+	// the kubelet's static CPU manager policy can pin them to exclusive cores.
+	CPUManagerStatic bool
+	// OOMMaxIncrease caps, in bytes, how far the memory limit of an
+	// OOM-killed container is raised in one recommendation. Zero means no cap.
+	OOMMaxIncrease int64
+	// TargetUptime is how long a container must run between restarts. When
+	// its working set grows like a leak, the memory limit is raised to the
+	// working set projected after this uptime. Zero disables the projection.
+	TargetUptime time.Duration
+	// PeakWindow is a recurring window, such as business hours, whose usage
+	// main containers are sized for. Nil sizes from the whole range only.
+	PeakWindow *entity.TimeWindow
+	// ForecastHorizon is how far ahead main containers are also sized for,
+	// from the trend of their workload's usage. Zero disables forecasts.
+	ForecastHorizon time.Duration
+	// ForecastRange is the Prometheus time range the trend is fitted over.
+	// Empty means 90d.
+	ForecastRange string
+	// PodSizing chooses which pods main containers are sized for. The zero
+	// value sizes for the max pod.
+	PodSizing PodSizing
+	// PodQuantile is the quantile of pods PodSizingQuantile sizes for. Zero
+	// means 0.9.
+	PodQuantile float64
+	// InitTargetDuration is how long a one-shot init container may take, and
+	// its CPU request is sized to finish within it. Zero sizes for the
+	// observed duration.
+	InitTargetDuration time.Duration
+	// JVM sizes the memory limit of Java containers around their max heap,
+	// and recommends the heap option to set with it.
+	JVM bool
+}
+
+var defaultPolicy = Policy{
+	MinDataSpan:    24 * time.Hour,
+	MinPods:        1,
+	MemorySizing:   MemoryGuaranteed,
+	OOMMaxIncrease: 2 * 1024 * 1024 * 1024,
+}
+
+// WithPolicy replaces the default recommendation policy.
+func WithPolicy(p Policy) Option {
+	return func(uc *RecommenderUseCase) {
+		uc.policy = p
+	}
+}
+
+// applyCPULimitPolicy drops the CPU limits of recs if the policy omits them,
+// warning when a LimitRange in the namespace injects a default limit anyway.
+func (uc *RecommenderUseCase) applyCPULimitPolicy(ctx context.Context, namespace string, recs []NamedRecommendation) {
+	if !uc.policy.OmitCPULimit || len(recs) == 0 {
+		return
+	}
+
+	limitRanges, err := uc.k8sGateway.ListLimitRanges(ctx, namespace)
+	if err != nil {
+		uc.logger.Warn("Could not check LimitRanges for default CPU limits", "namespace", namespace, "error", err)
+	}
+	limitRangeName, defaultLimit := defaultCPULimit(limitRanges)
+
+	for _, rec := range recs {
+		if rec.Recommendation.CPU == nil {
+			continue
+		}
+		rec.Recommendation.CPU.SuggestedLimit = rec.Recommendation.CPU.Limit
+		rec.Recommendation.CPU.Limit = nil
+		if err != nil {
+			rec.Recommendation.MetricErrors = append(rec.Recommendation.MetricErrors, entity.MetricError{Metric: "LimitRanges", Err: err})
+		}
+		if defaultLimit != nil {
+			rec.Recommendation.Warnings = append(rec.Recommendation.Warnings, fmt.Sprintf("LimitRange '%s' in namespace '%s' injects a default CPU limit of %s into containers without one", limitRangeName, namespace, defaultLimit.String()))
+		}
+	}
+}
+
+// defaultCPULimit returns the first LimitRange that sets a default CPU limit
+// for containers, and that limit.
+func defaultCPULimit(limitRanges []v1.LimitRange) (string, *resource.Quantity) {
+	for _, lr := range limitRanges {
+		for _, item := range lr.Spec.Limits {
+			if item.Type != v1.LimitTypeContainer {
+				continue
+			}
+			if limit, ok := item.Default[v1.ResourceCPU]; ok {
+				return lr.Name, &limit
+			}
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,145 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRecommenderUseCase_CalculateForAll_OmitCPULimit(t *testing.T) {
+	// Arrange
+	baseDeployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-ns"},
+		Spec: appsv1.DeploymentSpec{
+			Template: v1.PodTemplateSpec{
+				Spec: v1.PodSpec{
+					InitContainers: []v1.Container{{Name: "init-setup"}},
+					Containers:     []v1.Container{{Name: "main-app"}},
+				},
+			},
+		},
+	}
+	deploymentGW := &mockDeploymentGateway{
+		deployment: baseDeployment,
+		limitRanges: []v1.LimitRange{{
+			ObjectMeta: metav1.ObjectMeta{Name: "defaults"},
+			Spec: v1.LimitRangeSpec{Limits: []v1.LimitRangeItem{{
+				Type:    v1.LimitTypeContainer,
+				Default: v1.ResourceList{v1.ResourceCPU: resource.MustParse("500m")},
+			}}},
+		}},
+	}
+	metricsGW := &mockMetricsGateway{
+		memValue:     100 * 1024 * 1024,
+		cpuP90Value:  0.2,
+		cpuP99Value:  0.4,
+		cpuP50Value:  0.25,
+		initMemValue: 50 * 1024 * 1024,
+	}
+	uc := NewRecommenderUseCase(deploymentGW, metricsGW, newTestLogger(), WithPolicy(Policy{OmitCPULimit: true}))
+
+	// Act
+	recommendations, err := uc.CalculateForAll(context.Background(), "test-ns", "test-deployment", "", "7d")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, rec := range append(recommendations.MainContainers, recommendations.InitContainers...) {
+		cpu := rec.Recommendation.CPU
+		if cpu.Limit != nil {
+			t.Errorf("%s: expected no CPU limit, got %s", rec.ContainerName, cpu.Limit.String())
+		}
+		if cpu.SuggestedLimit == nil {
+			t.Errorf("%s: expected the suggested CPU limit to be kept", rec.ContainerName)
+		}
+		if len(rec.Recommendation.Warnings) != 1 || !strings.Contains(rec.Recommendation.Warnings[0], "LimitRange 'defaults'") {
+			t.Errorf("%s: expected a LimitRange warning, got %v", rec.ContainerName, rec.Recommendation.Warnings)
+		}
+	}
+	if got := recommendations.MainContainers[0].Recommendation.CPU.SuggestedLimit; got.Cmp(resource.MustParse("400m")) != 0 {
+		t.Errorf("expected suggested limit 400m, got %s", got.String())
+	}
+}
+
+func TestRecommenderUseCase_CalculateForDeployment_OmitCPULimit_LimitRangesError(t *testing.T) {
+	// Arrange
+	baseDeployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-ns"},
+		Spec: appsv1.DeploymentSpec{
+			Template: v1.PodTemplateSpec{
+				Spec: v1.PodSpec{Containers: []v1.Container{{Name: "main-app"}}},
+			},
+		},
+	}
+	deploymentGW := &mockDeploymentGateway{deployment: baseDeployment, limitRangesErr: fmt.Errorf("forbidden")}
+	metricsGW := &mockMetricsGateway{memValue: 100 * 1024 * 1024, cpuP90Value: 0.2, cpuP99Value: 0.4, cpuP50Value: 0.25}
+	uc := NewRecommenderUseCase(deploymentGW, metricsGW, newTestLogger(), WithPolicy(Policy{OmitCPULimit: true}))
+	params := DeploymentParams{Namespace: "test-ns", DeploymentName: "test-deployment", TimeRange: "7d"}
+
+	// Act
+	recommendations, err := uc.CalculateForDeployment(context.Background(), params)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rec := recommendations[0].Recommendation
+	if rec.CPU.Limit != nil {
+		t.Errorf("expected no CPU limit, got %s", rec.CPU.Limit.String())
+	}
+	if len(rec.MetricErrors) != 1 || rec.MetricErrors[0].Metric != "LimitRanges" {
+		t.Errorf("expected a LimitRanges metric error, got %v", rec.MetricErrors)
+	}
+}
+
+func TestRecommenderUseCase_CalculateForDeployment_MemorySizing(t *testing.T) {
+	baseDeployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-ns"},
+		Spec: appsv1.DeploymentSpec{
+			Template: v1.PodTemplateSpec{
+				Spec: v1.PodSpec{Containers: []v1.Container{{Name: "main-app"}}},
+			},
+		},
+	}
+	wantLimit := quantityFromInt((200 * 1024 * 1024 * mainContainerMemoryBufferPercent) / 100)
+
+	tests := []struct {
+		name        string
+		sizing      MemorySizing
+		wantRequest *resource.Quantity
+	}{
+		{name: "guaranteed", sizing: MemoryGuaranteed, wantRequest: wantLimit},
+		{name: "burstable", sizing: MemoryBurstable, wantRequest: quantityFromInt(150 * 1024 * 1024)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			metricsGW := &mockMetricsGateway{memValue: 200 * 1024 * 1024, memP95Value: 150 * 1024 * 1024, cpuP90Value: 0.2, cpuP99Value: 0.4, cpuP50Value: 0.25}
+			uc := NewRecommenderUseCase(&mockDeploymentGateway{deployment: baseDeployment}, metricsGW, newTestLogger(), WithPolicy(Policy{MemorySizing: tt.sizing}))
+			params := DeploymentParams{Namespace: "test-ns", DeploymentName: "test-deployment", TimeRange: "7d"}
+
+			// Act
+			recommendations, err := uc.CalculateForDeployment(context.Background(), params)
+
+			// Assert
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			rec := recommendations[0].Recommendation
+			if rec.Memory.Cmp(*wantLimit) != 0 {
+				t.Errorf("Memory limit: got %s, want %s", rec.Memory.String(), wantLimit.String())
+			}
+			if rec.MemoryRequest.Cmp(*tt.wantRequest) != 0 {
+				t.Errorf("Memory request: got %s, want %s", rec.MemoryRequest.String(), tt.wantRequest.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// QoSClassAnnotation overrides the policy's target QoS class for a single
+// Deployment.
+const QoSClassAnnotation = "sculptor.io/qos-class"
+
+// QoSAssessment compares the QoS class the recommended resources produce
+// with the target and the Deployment's current class.
+type QoSAssessment struct {
+	// Target is the requested QoS class, empty if none was requested.
+	Target v1.PodQOSClass
+	// Current is the QoS class of the Deployment's pod template today.
+	Current v1.PodQOSClass
+	// Recommended is the QoS class once the recommendations are applied.
+	Recommended v1.PodQOSClass
+}
+
+// ParseQoSClass parses a target QoS class case-insensitively. BestEffort is
+// rejected, since a recommendation always sets requests.
+func ParseQoSClass(s string) (v1.PodQOSClass, error) {
+	switch strings.ToLower(s) {
+	case "":
+		return "", nil
+	case "guaranteed":
+		return v1.PodQOSGuaranteed, nil
+	case "burstable":
+		return v1.PodQOSBurstable, nil
+	case "besteffort":
+		return "", fmt.Errorf("QoS class BestEffort cannot be targeted, recommendations always set requests")
+	}
+	return "", fmt.Errorf("unknown QoS class %q: must be Guaranteed or Burstable", s)
+}
+
+// targetQoSClass returns the Deployment's QoS class annotation if it is set
+// and valid, and the policy's target otherwise.
+func (uc *RecommenderUseCase) targetQoSClass(d *appsv1.Deployment) v1.PodQOSClass {
+	value, ok := d.Annotations[QoSClassAnnotation]
+	if !ok {
+		return uc.policy.QoSClass
+	}
+	target, err := ParseQoSClass(value)
+	if err != nil {
+		uc.logger.Warn("Ignoring invalid QoS class annotation", "annotation", QoSClassAnnotation, "error", err)
+		return uc.policy.QoSClass
+	}
+	return target
+}
+
+// burstableCPULimitPercent of the request is the CPU limit of a container
+// shaped for Burstable QoS whose recommended limit equals its request.
+const burstableCPULimitPercent = 120
+
+// shapeForQoS adjusts recs to produce the Deployment's target QoS class.
+// Guaranteed sets every request equal to its limit, restoring CPU limits the
+// policy omitted, and optionally rounds CPU up to whole cores for the kubelet's
+// static CPU manager policy. Burstable keeps every CPU limit above its
+// request, since a container whose CPU p90 and p99 coincide would otherwise
+// get equal requests and limits and, with Guaranteed-style memory, make the
+// pod Guaranteed.
+func (uc *RecommenderUseCase) shapeForQoS(d *appsv1.Deployment, recs []NamedRecommendation) {
+	switch uc.targetQoSClass(d) {
+	case v1.PodQOSGuaranteed:
+		uc.shapeGuaranteed(recs)
+	case v1.PodQOSBurstable:
+		shapeBurstable(recs)
+	}
+}
+
+func (uc *RecommenderUseCase) shapeGuaranteed(recs []NamedRecommendation) {
+	for _, rec := range recs {
+		r := rec.Recommendation
+		if r.IsMissingData() || r.CPU == nil {
+			continue
+		}
+
+		limit := r.CPU.Limit
+		if limit == nil {
+			limit = r.CPU.SuggestedLimit
+			r.CPU.SuggestedLimit = nil
+			r.Warnings = append(r.Warnings, fmt.Sprintf("CPU limit kept for container '%s', Guaranteed QoS requires it", rec.ContainerName))
+		}
+		cpuMilli := max(limit.MilliValue(), r.CPU.Request.MilliValue())
+		if uc.policy.CPUManagerStatic {
+			cpuMilli = int64(math.Ceil(float64(cpuMilli)/1000)) * 1000
+		}
+		r.CPU.Request = resource.NewMilliQuantity(cpuMilli, resource.DecimalSI)
+		r.CPU.Limit = resource.NewMilliQuantity(cpuMilli, resource.DecimalSI)
+		r.MemoryRequest = r.Memory
+	}
+}
+
+func shapeBurstable(recs []NamedRecommendation) {
+	for _, rec := range recs {
+		r := rec.Recommendation
+		if r.IsMissingData() || r.CPU == nil || r.CPU.Limit == nil {
+			continue
+		}
+		if r.CPU.Limit.Cmp(*r.CPU.Request) > 0 {
+			continue
+		}
+		limitMilli := max(r.CPU.Request.MilliValue()*burstableCPULimitPercent/100, r.CPU.Request.MilliValue()+1)
+		r.CPU.Limit = resource.NewMilliQuantity(limitMilli, resource.DecimalSI)
+	}
+}
+
+// AssessQoS compares the QoS class produced by recs with the target and the
+// current class of the Deployment, and stores the result on recs.
+func (uc *RecommenderUseCase) AssessQoS(ctx context.Context, params DeploymentParams, recs *AllRecommendations) error {
+	d, err := uc.k8sGateway.GetDeployment(ctx, params.Namespace, params.DeploymentName)
+	if err != nil {
+		return fmt.Errorf("could not get deployment: %w", err)
+	}
+
+	spec := d.Spec.Template.Spec.DeepCopy()
+	applyRecommendations(spec.Containers, recs.MainContainers)
+	applyRecommendations(spec.InitContainers, recs.InitContainers)
+
+	recs.QoS = &QoSAssessment{
+		Target:      uc.targetQoSClass(d),
+		Current:     podQOSClass(&d.Spec.Template.Spec),
+		Recommended: podQOSClass(spec),
+	}
+	return nil
+}
+
+// applyRecommendations sets the recommended resources on the matching
+// containers. Containers without a recommendation keep their resources.
+func applyRecommendations(containers []v1.Container, recs []NamedRecommendation) {
+	for _, rec := range recs {
+		r := rec.Recommendation
+		if r == nil || r.IsMissingData() {
+			continue
+		}
+		for i := range containers {
+			if containers[i].Name != rec.ContainerName {
+				continue
+			}
+			requests, limits := recommendedResources(rec)
+			containers[i].Resources.Requests = requests
+			containers[i].Resources.Limits = limits
+		}
+	}
+}
+
+// podQOSClass computes the QoS class of a pod from the CPU and memory
+// resources of its containers, following the kubelet's rules. Unset requests
+// default to their limits, as the API server does.
+func podQOSClass(spec *v1.PodSpec) v1.PodQOSClass {
+	var containers []v1.Container
+	containers = append(containers, spec.InitContainers...)
+	containers = append(containers, spec.Containers...)
+
+	anySet := false
+	guaranteed := true
+	for _, c := range containers {
+		for _, name := range []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory} {
+			limit, hasLimit := c.Resources.Limits[name]
+			request, hasRequest := c.Resources.Requests[name]
+			if hasLimit && !limit.IsZero() || hasRequest && !request.IsZero() {
+				anySet = true
+			}
+			if !hasLimit || limit.IsZero() {
+				guaranteed = false
+				continue
+			}
+			if hasRequest && request.Cmp(limit) != 0 {
+				guaranteed = false
+			}
+		}
+	}
+
+	switch {
+	case !anySet:
+		return v1.PodQOSBestEffort
+	case guaranteed:
+		return v1.PodQOSGuaranteed
+	}
+	return v1.PodQOSBurstable
+}
@@ -0,0 +1,141 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseQoSClass(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    v1.PodQOSClass
+		wantErr bool
+	}{
+		{in: "", want: ""},
+		{in: "Guaranteed", want: v1.PodQOSGuaranteed},
+		{in: "burstable", want: v1.PodQOSBurstable},
+		{in: "BestEffort", wantErr: true},
+		{in: "gold", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseQoSClass(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseQoSClass(%q): unexpected error %v", tt.in, err)
+		}
+		if got != tt.want {
+			t.Errorf("ParseQoSClass(%q): got %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestPodQOSClass(t *testing.T) {
+	resources := func(requests, limits v1.ResourceList) v1.PodSpec {
+		return v1.PodSpec{Containers: []v1.Container{{Resources: v1.ResourceRequirements{Requests: requests, Limits: limits}}}}
+	}
+	cpuMem := func(cpu, mem string) v1.ResourceList {
+		return v1.ResourceList{v1.ResourceCPU: resource.MustParse(cpu), v1.ResourceMemory: resource.MustParse(mem)}
+	}
+
+	tests := []struct {
+		name string
+		spec v1.PodSpec
+		want v1.PodQOSClass
+	}{
+		{"no resources", resources(nil, nil), v1.PodQOSBestEffort},
+		{"requests equal limits", resources(cpuMem("1", "1Gi"), cpuMem("1", "1Gi")), v1.PodQOSGuaranteed},
+		{"limits only", resources(nil, cpuMem("1", "1Gi")), v1.PodQOSGuaranteed},
+		{"requests below limits", resources(cpuMem("500m", "1Gi"), cpuMem("1", "1Gi")), v1.PodQOSBurstable},
+		{"no CPU limit", resources(cpuMem("1", "1Gi"), v1.ResourceList{v1.ResourceMemory: resource.MustParse("1Gi")}), v1.PodQOSBurstable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := podQOSClass(&tt.spec); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecommenderUseCase_CalculateForAll_GuaranteedQoS(t *testing.T) {
+	// Arrange
+	baseDeployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "test-deployment",
+			Namespace:   "test-ns",
+			Annotations: map[string]string{QoSClassAnnotation: "Guaranteed"},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Template: v1.PodTemplateSpec{
+				Spec: v1.PodSpec{
+					Containers: []v1.Container{{
+						Name: "main-app",
+						Resources: v1.ResourceRequirements{
+							Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("100m")},
+						},
+					}},
+				},
+			},
+		},
+	}
+	metricsGW := &mockMetricsGateway{memValue: 100 * 1024 * 1024, cpuP90Value: 0.2, cpuP99Value: 1.3, cpuP50Value: 0.25}
+	uc := NewRecommenderUseCase(&mockDeploymentGateway{deployment: baseDeployment}, metricsGW, newTestLogger(),
+		WithPolicy(Policy{QoSClass: v1.PodQOSBurstable, CPUManagerStatic: true}))
+
+	// Act
+	recommendations, err := uc.CalculateForAll(context.Background(), "test-ns", "test-deployment", "", "7d")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rec := recommendations.MainContainers[0].Recommendation
+	wantCPU := mustParseQuantity("2")
+	if rec.CPU.Request.Cmp(*wantCPU) != 0 || rec.CPU.Limit.Cmp(*wantCPU) != 0 {
+		t.Errorf("expected CPU request and limit of 2 cores, got %s/%s", rec.CPU.Request.String(), rec.CPU.Limit.String())
+	}
+	if rec.MemoryRequest.Cmp(*rec.Memory) != 0 {
+		t.Errorf("expected memory request %s to equal limit %s", rec.MemoryRequest.String(), rec.Memory.String())
+	}
+
+	want := QoSAssessment{Target: v1.PodQOSGuaranteed, Current: v1.PodQOSBurstable, Recommended: v1.PodQOSGuaranteed}
+	if recommendations.QoS == nil || *recommendations.QoS != want {
+		t.Errorf("got QoS assessment %+v, want %+v", recommendations.QoS, want)
+	}
+}
+
+func TestRecommenderUseCase_CalculateForAll_BurstableQoS(t *testing.T) {
+	// Arrange
+	baseDeployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-ns"},
+		Spec: appsv1.DeploymentSpec{
+			Template: v1.PodTemplateSpec{
+				Spec: v1.PodSpec{Containers: []v1.Container{{Name: "main-app"}}},
+			},
+		},
+	}
+	metricsGW := &mockMetricsGateway{memValue: 100 * 1024 * 1024, cpuP90Value: 0.4, cpuP99Value: 0.4, cpuP50Value: 0.4}
+	uc := NewRecommenderUseCase(&mockDeploymentGateway{deployment: baseDeployment}, metricsGW, newTestLogger(),
+		WithPolicy(Policy{QoSClass: v1.PodQOSBurstable}))
+
+	// Act
+	recommendations, err := uc.CalculateForAll(context.Background(), "test-ns", "test-deployment", "", "7d")
+
+	// Assert
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rec := recommendations.MainContainers[0].Recommendation
+	if rec.CPU.Limit.Cmp(*rec.CPU.Request) <= 0 {
+		t.Errorf("expected CPU limit above the request, got %s/%s", rec.CPU.Request.String(), rec.CPU.Limit.String())
+	}
+	if recommendations.QoS == nil || recommendations.QoS.Recommended != v1.PodQOSBurstable {
+		t.Errorf("expected recommended QoS Burstable, got %+v", recommendations.QoS)
+	}
+}
@@ -0,0 +1,271 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// QuotaAssessment projects the usage of the namespace's ResourceQuotas once
+// the recommendations are rolled out to every replica of the Deployment.
+type QuotaAssessment struct {
+	// Replicas is the number of pods the projection is made for.
+	Replicas int32
+	// Surge is the number of extra pods a rolling update may create.
+	Surge int32
+	// Quotas lists the ResourceQuotas that apply to the Deployment's pods
+	// and track their CPU or memory.
+	Quotas []QuotaProjection
+	// Err is set when the ResourceQuotas could not be listed.
+	Err error
+}
+
+// QuotaProjection is the projected usage of a single ResourceQuota.
+type QuotaProjection struct {
+	Name      string
+	Resources []QuotaResource
+	// MissingLimits lists the limits the quota tracks that a recommended
+	// container leaves unset with no LimitRange default to fill them in. The
+	// quota rejects such pods.
+	MissingLimits []v1.ResourceName
+}
+
+// QuotaResource is the usage of one resource a ResourceQuota tracks.
+type QuotaResource struct {
+	Name v1.ResourceName
+	Hard resource.Quantity
+	// Used is the usage the quota reports today.
+	Used resource.Quantity
+	// Projected is the usage once every replica runs the recommendations.
+	Projected resource.Quantity
+	// Rollout is the highest usage while a rolling update replaces the
+	// current pods with recommended ones.
+	Rollout resource.Quantity
+}
+
+// Exceeded reports whether the projected usage is above the hard limit.
+func (r QuotaResource) Exceeded() bool {
+	return r.Projected.Cmp(r.Hard) > 0
+}
+
+// RolloutExceeded reports whether a rolling update goes above the hard limit.
+func (r QuotaResource) RolloutExceeded() bool {
+	return r.Rollout.Cmp(r.Hard) > 0
+}
+
+// quotaResources maps the CPU and memory resources a ResourceQuota can track
+// to the pod resource they count and whether they count limits.
+var quotaResources = map[v1.ResourceName]struct {
+	name  v1.ResourceName
+	limit bool
+}{
+	v1.ResourceCPU:            {v1.ResourceCPU, false},
+	v1.ResourceRequestsCPU:    {v1.ResourceCPU, false},
+	v1.ResourceLimitsCPU:      {v1.ResourceCPU, true},
+	v1.ResourceMemory:         {v1.ResourceMemory, false},
+	v1.ResourceRequestsMemory: {v1.ResourceMemory, false},
+	v1.ResourceLimitsMemory:   {v1.ResourceMemory, true},
+}
+
+// AssessQuota projects the usage of the namespace's ResourceQuotas with recs
+// applied to every replica of the Deployment, and stores the result on recs.
+func (uc *RecommenderUseCase) AssessQuota(ctx context.Context, params DeploymentParams, recs *AllRecommendations) error {
+	d, err := uc.k8sGateway.GetDeployment(ctx, params.Namespace, params.DeploymentName)
+	if err != nil {
+		return fmt.Errorf("could not get deployment: %w", err)
+	}
+
+	assessment := &QuotaAssessment{Replicas: 1}
+	if d.Spec.Replicas != nil {
+		assessment.Replicas = *d.Spec.Replicas
+	}
+	assessment.Surge = rolloutSurge(d, assessment.Replicas)
+	recs.Quota = assessment
+
+	quotas, err := uc.k8sGateway.ListResourceQuotas(ctx, params.Namespace)
+	if err != nil {
+		uc.logger.Warn("Could not list ResourceQuotas to project their usage", "namespace", params.Namespace, "error", err)
+		assessment.Err = err
+		return nil
+	}
+	if len(quotas) == 0 {
+		return nil
+	}
+	limitRanges, err := uc.k8sGateway.ListLimitRanges(ctx, params.Namespace)
+	if err != nil {
+		uc.logger.Warn("Could not check LimitRanges for default limits", "namespace", params.Namespace, "error", err)
+	}
+
+	current := &d.Spec.Template.Spec
+	spec := current.DeepCopy()
+	applyRecommendations(spec.Containers, recs.MainContainers)
+	applyRecommendations(spec.InitContainers, recs.InitContainers)
+
+	overhead, _, _ := uc.podOverhead(ctx, d)
+	currentRequests, _ := effectiveRequests(current, overhead)
+	recommendedRequests, _ := effectiveRequests(spec, overhead)
+	currentLimits := effectiveLimits(current, overhead)
+	recommendedLimits := effectiveLimits(spec, overhead)
+
+	for _, quota := range quotas {
+		currentApplies := quotaApplies(quota, current)
+		recommendedApplies := quotaApplies(quota, spec)
+		if !currentApplies && !recommendedApplies {
+			continue
+		}
+		projection := QuotaProjection{Name: quota.Name}
+		for _, quotaName := range sortedResourceNames(quota.Spec.Hard) {
+			tracked, ok := quotaResources[quotaName]
+			if !ok {
+				continue
+			}
+			currentPod, recommendedPod := currentRequests[tracked.name], recommendedRequests[tracked.name]
+			if tracked.limit {
+				currentPod, recommendedPod = currentLimits[tracked.name], recommendedLimits[tracked.name]
+				if recommendedApplies && missingLimit(spec, tracked.name, limitRanges) {
+					projection.MissingLimits = append(projection.MissingLimits, quotaName)
+				}
+			}
+			if !currentApplies {
+				currentPod = resource.Quantity{}
+			}
+			if !recommendedApplies {
+				recommendedPod = resource.Quantity{}
+			}
+			projection.Resources = append(projection.Resources, projectQuota(quotaName, quota, currentPod, recommendedPod, assessment.Replicas, assessment.Surge))
+		}
+		if len(projection.Resources) > 0 {
+			assessment.Quotas = append(assessment.Quotas, projection)
+		}
+	}
+	return nil
+}
+
+// projectQuota projects the usage of one quota resource when the pods of the
+// Deployment change from currentPod to recommendedPod. A rolling update runs
+// up to surge extra pods, so its usage peaks either right after the first
+// recommended pods start or right before the last current pods stop.
+func projectQuota(name v1.ResourceName, quota v1.ResourceQuota, currentPod, recommendedPod resource.Quantity, replicas, surge int32) QuotaResource {
+	r := QuotaResource{Name: name, Hard: quota.Spec.Hard[name], Used: quota.Status.Used[name]}
+
+	r.Projected = r.Used.DeepCopy()
+	r.Projected.Sub(scaled(currentPod, replicas))
+	r.Projected.Add(scaled(recommendedPod, replicas))
+	if r.Projected.Sign() < 0 {
+		r.Projected = resource.Quantity{}
+	}
+
+	start := r.Used.DeepCopy()
+	start.Add(scaled(recommendedPod, surge))
+	end := r.Projected.DeepCopy()
+	end.Add(scaled(currentPod, surge))
+	r.Rollout = start
+	if end.Cmp(start) > 0 {
+		r.Rollout = end
+	}
+	return r
+}
+
+// scaled returns q times n.
+func scaled(q resource.Quantity, n int32) resource.Quantity {
+	if milli := q.MilliValue(); milli%1000 != 0 {
+		return *resource.NewMilliQuantity(milli*int64(n), q.Format)
+	}
+	return *resource.NewQuantity(q.Value()*int64(n), q.Format)
+}
+
+// rolloutSurge returns the number of extra pods a rolling update of the
+// Deployment may create.
+func rolloutSurge(d *appsv1.Deployment, replicas int32) int32 {
+	if d.Spec.Strategy.Type == appsv1.RecreateDeploymentStrategyType {
+		return 0
+	}
+	maxSurge := intstr.FromString("25%")
+	if d.Spec.Strategy.RollingUpdate != nil && d.Spec.Strategy.RollingUpdate.MaxSurge != nil {
+		maxSurge = *d.Spec.Strategy.RollingUpdate.MaxSurge
+	}
+	surge, err := intstr.GetScaledValueFromIntOrPercent(&maxSurge, int(replicas), true)
+	if err != nil {
+		return 0
+	}
+	return int32(surge)
+}
+
+// quotaApplies reports whether the scopes of a ResourceQuota select pods with
+// spec. Scopes that don't concern CPU and memory never match.
+func quotaApplies(quota v1.ResourceQuota, spec *v1.PodSpec) bool {
+	for _, scope := range quota.Spec.Scopes {
+		if !scopeMatches(v1.ScopedResourceSelectorRequirement{ScopeName: scope, Operator: v1.ScopeSelectorOpExists}, spec) {
+			return false
+		}
+	}
+	if quota.Spec.ScopeSelector != nil {
+		for _, requirement := range quota.Spec.ScopeSelector.MatchExpressions {
+			if !scopeMatches(requirement, spec) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func scopeMatches(requirement v1.ScopedResourceSelectorRequirement, spec *v1.PodSpec) bool {
+	switch requirement.ScopeName {
+	case v1.ResourceQuotaScopeTerminating:
+		return spec.ActiveDeadlineSeconds != nil
+	case v1.ResourceQuotaScopeNotTerminating:
+		return spec.ActiveDeadlineSeconds == nil
+	case v1.ResourceQuotaScopeBestEffort:
+		return podQOSClass(spec) == v1.PodQOSBestEffort
+	case v1.ResourceQuotaScopeNotBestEffort:
+		return podQOSClass(spec) != v1.PodQOSBestEffort
+	case v1.ResourceQuotaScopePriorityClass:
+		switch requirement.Operator {
+		case v1.ScopeSelectorOpExists:
+			return spec.PriorityClassName != ""
+		case v1.ScopeSelectorOpDoesNotExist:
+			return spec.PriorityClassName == ""
+		case v1.ScopeSelectorOpIn, v1.ScopeSelectorOpNotIn:
+			in := false
+			for _, value := range requirement.Values {
+				in = in || value == spec.PriorityClassName
+			}
+			return in == (requirement.Operator == v1.ScopeSelectorOpIn)
+		}
+	}
+	return false
+}
+
+// missingLimit reports whether a container of spec sets no limit for a
+// resource that no LimitRange defaults either.
+func missingLimit(spec *v1.PodSpec, name v1.ResourceName, limitRanges []v1.LimitRange) bool {
+	for _, lr := range limitRanges {
+		for _, item := range lr.Spec.Limits {
+			if _, ok := item.Default[name]; ok && item.Type == v1.LimitTypeContainer {
+				return false
+			}
+		}
+	}
+	for _, containers := range [][]v1.Container{spec.InitContainers, spec.Containers} {
+		for _, c := range containers {
+			if _, ok := c.Resources.Limits[name]; !ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func sortedResourceNames(list v1.ResourceList) []v1.ResourceName {
+	names := make([]v1.ResourceName, 0, len(list))
+	for name := range list {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
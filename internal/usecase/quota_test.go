@@ -0,0 +1,118 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sequring/sculptor/internal/entity"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func quotaDeployment(replicas int32, maxSurge intstr.IntOrString) *appsv1.Deployment {
+	app := cpuContainer("app", "1")
+	app.Resources.Limits = v1.ResourceList{v1.ResourceCPU: resource.MustParse("2")}
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-ns"},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Strategy: appsv1.DeploymentStrategy{RollingUpdate: &appsv1.RollingUpdateDeployment{MaxSurge: &maxSurge}},
+			Template: v1.PodTemplateSpec{Spec: v1.PodSpec{Containers: []v1.Container{app}}},
+		},
+	}
+}
+
+func TestRecommenderUseCase_AssessQuota(t *testing.T) {
+	// Arrange
+	deploymentGW := &mockDeploymentGateway{
+		deployment: quotaDeployment(4, intstr.FromInt32(1)),
+		resourceQuotas: []v1.ResourceQuota{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "compute"},
+				Spec: v1.ResourceQuotaSpec{Hard: v1.ResourceList{
+					v1.ResourceRequestsCPU: resource.MustParse("8"),
+					v1.ResourceLimitsCPU:   resource.MustParse("10"),
+					v1.ResourcePods:        resource.MustParse("20"),
+				}},
+				Status: v1.ResourceQuotaStatus{Used: v1.ResourceList{
+					v1.ResourceRequestsCPU: resource.MustParse("5"),
+					v1.ResourceLimitsCPU:   resource.MustParse("9"),
+				}},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "best-effort"},
+				Spec: v1.ResourceQuotaSpec{
+					Hard:   v1.ResourceList{v1.ResourceRequestsCPU: resource.MustParse("1")},
+					Scopes: []v1.ResourceQuotaScope{v1.ResourceQuotaScopeBestEffort},
+				},
+			},
+		},
+	}
+	uc := NewRecommenderUseCase(deploymentGW, &mockMetricsGateway{}, newTestLogger())
+	recs := &AllRecommendations{MainContainers: []NamedRecommendation{{
+		ContainerName: "app",
+		Recommendation: &entity.Recommendation{
+			Memory: mustParseQuantity("512Mi"),
+			CPU:    &entity.CPURecommendation{Request: mustParseQuantity("1500m")},
+		},
+	}}}
+
+	// Act
+	err := uc.AssessQuota(context.Background(), DeploymentParams{Namespace: "test-ns", DeploymentName: "test-deployment"}, recs)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	q := recs.Quota
+	if q == nil || q.Replicas != 4 || q.Surge != 1 || len(q.Quotas) != 1 {
+		t.Fatalf("expected the compute quota at 4 replicas with a surge of 1, got %+v", q)
+	}
+	compute := q.Quotas[0]
+	if len(compute.Resources) != 2 {
+		t.Fatalf("expected limits.cpu and requests.cpu, got %+v", compute.Resources)
+	}
+	limits, requests := compute.Resources[0], compute.Resources[1]
+	if requests.Projected.MilliValue() != 7000 || requests.Exceeded() {
+		t.Errorf("requests.cpu: got %s, want 7 within the quota", requests.Projected.String())
+	}
+	if requests.Rollout.MilliValue() != 8000 || requests.RolloutExceeded() {
+		t.Errorf("requests.cpu rollout: got %s, want 8 within the quota", requests.Rollout.String())
+	}
+	// The recommendation omits the CPU limit, which the quota requires.
+	if len(compute.MissingLimits) != 1 || compute.MissingLimits[0] != v1.ResourceLimitsCPU {
+		t.Errorf("expected limits.cpu to be missing, got %v", compute.MissingLimits)
+	}
+	if limits.Projected.MilliValue() != 1000 {
+		t.Errorf("limits.cpu: got %s, want 1", limits.Projected.String())
+	}
+
+	// A quota that can't be listed is reported, not fatal.
+	deploymentGW.quotasErr = errors.New("forbidden")
+	if err := uc.AssessQuota(context.Background(), DeploymentParams{Namespace: "test-ns", DeploymentName: "test-deployment"}, recs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if recs.Quota.Err == nil {
+		t.Errorf("expected the listing error to be kept")
+	}
+}
+
+func TestProjectQuota_RolloutExceeded(t *testing.T) {
+	quota := v1.ResourceQuota{
+		Spec:   v1.ResourceQuotaSpec{Hard: v1.ResourceList{v1.ResourceRequestsMemory: resource.MustParse("10Gi")}},
+		Status: v1.ResourceQuotaStatus{Used: v1.ResourceList{v1.ResourceRequestsMemory: resource.MustParse("8Gi")}},
+	}
+
+	r := projectQuota(v1.ResourceRequestsMemory, quota, resource.MustParse("2Gi"), resource.MustParse("1Gi"), 4, 3)
+
+	if want := resource.MustParse("4Gi"); r.Projected.Cmp(want) != 0 || r.Exceeded() {
+		t.Errorf("projected: got %s, want %s within the quota", r.Projected.String(), want.String())
+	}
+	if want := resource.MustParse("11Gi"); r.Rollout.Cmp(want) != 0 || !r.RolloutExceeded() {
+		t.Errorf("rollout: got %s, want %s over the quota", r.Rollout.String(), want.String())
+	}
+}
@@ -4,8 +4,14 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"math"
+	"sort"
+	"time"
 
+	"github.com/prometheus/common/model"
 	"github.com/sequring/sculptor/internal/entity"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 )
 
@@ -13,20 +19,30 @@ type RecommenderUseCase struct {
 	k8sGateway  DeploymentGateway
 	promGateway MetricsGateway
 	logger      *slog.Logger
+	fetch       FetchConfig
+	policy      Policy
 }
 
-func NewRecommenderUseCase(k8sGateway DeploymentGateway, promGateway MetricsGateway, logger *slog.Logger) *RecommenderUseCase {
-	return &RecommenderUseCase{
+func NewRecommenderUseCase(k8sGateway DeploymentGateway, promGateway MetricsGateway, logger *slog.Logger, opts ...Option) *RecommenderUseCase {
+	uc := &RecommenderUseCase{
 		k8sGateway:  k8sGateway,
 		promGateway: promGateway,
 		logger:      logger,
+		fetch:       defaultFetchConfig,
+		policy:      defaultPolicy,
 	}
+	for _, opt := range opts {
+		opt(uc)
+	}
+	return uc
 }
 
 const (
 	spikinessThreshold               = 2.0
 	spikinessCPUBuffer               = 1.25
 	oomMemoryMultiplier              = 1.5
+	cpuThrottlingThreshold           = 0.25 // Share of throttled CFS periods, as in kube-prometheus' CPUThrottlingHigh alert
+	cpuThrottlingMultiplier          = 1.5
 	mainContainerMemoryBufferPercent = 120 // Represents 1.2x buffer
 	initContainerMemoryBufferPercent = 115 // Represents 1.15x buffer
 	initMemoryDefault                = "128Mi"
@@ -42,12 +58,70 @@ type NamedRecommendation struct {
 	Recommendation *entity.Recommendation
 }
 
+// mainContainerPlan holds the inputs gathered for one main container before
+// its recommendation is computed.
+type mainContainerPlan struct {
+	containerName string
+	clusterKills  []entity.OOMKill
+	currentLimit  *resource.Quantity
+	cpuLimitSpec  *resource.Quantity
+	errors        []entity.MetricError
+	memory        *metricFetch
+	memoryRequest *metricFetch
+	cpuRequest    *metricFetch
+	cpuLimit      *metricFetch
+	cpuMedian     *metricFetch
+	cpuThrottling *metricFetch
+	quality       *metricFetch
+	qualityResult *entity.DataQuality
+	restarts      *metricFetch
+	oomKills      *metricFetch
+	metricKills   []entity.OOMKill
+	kills         []entity.OOMKill
+	preKills      []*metricFetch
+	preKillUsage  []*entity.PreKillMemory
+	memoryTrend   *metricFetch
+	lifetimes     []entity.MemoryLifetime
+	peak          *metricFetch
+	peakUsage     *entity.Usage
+	offPeak       *metricFetch
+	offPeakUsage  *entity.Usage
+	forecast      *metricFetch
+	usageTrend    *entity.UsageTrend
+	podUsage      *metricFetch
+	pods          []entity.PodUsage
+	storage       *metricFetch
+	evictions     []entity.StorageEviction
+	storageLimit  *resource.Quantity
+	hugePages     *metricFetch
+	hugePageUsage []entity.HugePagesUsage
+	jvmOptions    *jvmOptions
+	jvmMemory     *metricFetch
+	jvmUsage      *entity.JVMMemory
+	// memoryLimitSpec is the memory limit of the container's pod template.
+	memoryLimitSpec *resource.Quantity
+	hpa             *hpaPlan
+}
+
 func (uc *RecommenderUseCase) CalculateForDeployment(ctx context.Context, params DeploymentParams) ([]NamedRecommendation, error) {
 	d, err := uc.k8sGateway.GetDeployment(ctx, params.Namespace, params.DeploymentName)
 	if err != nil {
 		return nil, fmt.Errorf("could not get deployment %w", err)
 	}
 
+	containersToAnalyze, err := mainContainers(d, params)
+	if err != nil {
+		return nil, err
+	}
+	if len(containersToAnalyze) == 0 {
+		return []NamedRecommendation{}, nil
+	}
+	return uc.calculateLongRunning(ctx, d, params, containersToAnalyze), nil
+}
+
+// mainContainers returns the main containers of the deployment to size: the
+// target container, or all of them.
+func mainContainers(d *appsv1.Deployment, params DeploymentParams) ([]string, error) {
 	var containersToAnalyze []string
 	if len(params.TargetContainer) > 0 {
 		found := false
@@ -67,101 +141,502 @@ func (uc *RecommenderUseCase) CalculateForDeployment(ctx context.Context, params
 			containersToAnalyze = append(containersToAnalyze, c.Name)
 		}
 	}
+	return containersToAnalyze, nil
+}
 
-	if len(containersToAnalyze) == 0 {
-		return []NamedRecommendation{}, nil
-	}
+// calculateLongRunning sizes containers that run for the lifetime of the pod
+// from their usage percentiles: main containers and native sidecars.
+func (uc *RecommenderUseCase) calculateLongRunning(ctx context.Context, d *appsv1.Deployment, params DeploymentParams, containersToAnalyze []string) []NamedRecommendation {
+	plans := make([]*mainContainerPlan, 0, len(containersToAnalyze))
+	var fetches []*metricFetch
 
-	var finalRecommendations []NamedRecommendation
+	// An HPA scaling on CPU utilization keeps usage at a share of the
+	// request, so it changes how CPU requests are sized.
+	hpa, hpaErr := uc.k8sGateway.GetHorizontalPodAutoscaler(ctx, d)
+	if hpaErr != nil {
+		uc.logger.Warn("Could not check for a HorizontalPodAutoscaler", "deployment", params.DeploymentName, "error", hpaErr)
+	}
+	scaler := cpuUtilizationHPA(hpa)
+	if scaler != nil {
+		scaler.replicas = &metricFetch{container: params.DeploymentName, metric: "replica count", query: func(ctx context.Context) (float64, error) {
+			stats, err := uc.promGateway.GetReplicaStats(ctx, params.Namespace, params.DeploymentName, params.TimeRange)
+			scaler.replicaStats = stats
+			return 0, err
+		}}
+		fetches = append(fetches, scaler.replicas)
+	} else if hpa != nil {
+		uc.logger.Info("HorizontalPodAutoscaler doesn't scale on CPU utilization, sizing CPU requests as usual", "hpa", hpa.Name)
+	}
+	// The pods and their events are listed once for all the containers.
+	kills, killsErr := uc.k8sGateway.ListOOMKills(ctx, d, containersToAnalyze, params.TimeRange)
+	if killsErr != nil {
+		uc.logger.Warn("Could not check for OOM kills", "deployment", params.DeploymentName, "error", killsErr)
+	}
+	evictions, evictionsErr := uc.k8sGateway.ListStorageEvictions(ctx, d, containersToAnalyze, params.TimeRange)
+	if evictionsErr != nil {
+		uc.logger.Warn("Could not check for ephemeral storage evictions", "deployment", params.DeploymentName, "error", evictionsErr)
+	}
 	for _, containerName := range containersToAnalyze {
-		isOOM, _, currentLimit, _ := uc.k8sGateway.CheckForOOMKilledEvents(ctx, d, containerName)
+		plan := &mainContainerPlan{containerName: containerName, cpuLimitSpec: containerCPULimit(d, containerName)}
+		if killsErr != nil {
+			plan.errors = append(plan.errors, entity.MetricError{Metric: "OOMKilled events", Err: killsErr})
+		}
+		plan.clusterKills = kills[containerName].Kills
+		plan.currentLimit = kills[containerName].CurrentLimit
+		if evictionsErr != nil {
+			plan.errors = append(plan.errors, entity.MetricError{Metric: "Evicted events", Err: evictionsErr})
+		}
+		plan.evictions = evictions[containerName].Evictions
+		plan.storageLimit = evictions[containerName].CurrentLimit
+		if hpaErr != nil {
+			plan.errors = append(plan.errors, entity.MetricError{Metric: "HorizontalPodAutoscaler", Err: hpaErr})
+		}
+		if scaler.covers(containerName) {
+			plan.hpa = scaler
+		}
 
-		var memRecommendation *resource.Quantity
-		isOOMRecommendation := false
-		if isOOM {
-			isOOMRecommendation = true
-			if currentLimit != nil {
-				newVal := int64(float64(currentLimit.Value()) * oomMemoryMultiplier)
-				memRecommendation = resource.NewQuantity(newVal, resource.BinarySI)
-			} else {
-				memRecommendation = resource.NewQuantity(1024*1024*512, resource.BinarySI)
+		plan.memory = &metricFetch{container: containerName, metric: "P99 memory", query: func(ctx context.Context) (float64, error) {
+			return uc.promGateway.GetMemoryMetrics(ctx, params.Namespace, params.DeploymentName, containerName, params.TimeRange)
+		}}
+		fetches = append(fetches, plan.memory)
+		if uc.policy.MemorySizing == MemoryBurstable {
+			plan.memoryRequest = &metricFetch{container: containerName, metric: "P95 memory", query: func(ctx context.Context) (float64, error) {
+				return uc.promGateway.GetMemoryRequestMetrics(ctx, params.Namespace, params.DeploymentName, containerName, params.TimeRange)
+			}}
+			fetches = append(fetches, plan.memoryRequest)
+		}
+		plan.cpuRequest = &metricFetch{container: containerName, metric: "P90 CPU", query: func(ctx context.Context) (float64, error) {
+			return uc.promGateway.GetCPURequestMetrics(ctx, params.Namespace, params.DeploymentName, containerName, params.TimeRange)
+		}}
+		plan.cpuLimit = &metricFetch{container: containerName, metric: "P99 CPU", query: func(ctx context.Context) (float64, error) {
+			return uc.promGateway.GetCPULimitMetrics(ctx, params.Namespace, params.DeploymentName, containerName, params.TimeRange)
+		}}
+		plan.cpuMedian = &metricFetch{container: containerName, metric: "P50 CPU", query: func(ctx context.Context) (float64, error) {
+			return uc.promGateway.GetCPUMedianMetrics(ctx, params.Namespace, params.DeploymentName, containerName, params.TimeRange)
+		}}
+		plan.cpuThrottling = &metricFetch{container: containerName, metric: "CPU throttling", query: func(ctx context.Context) (float64, error) {
+			return uc.promGateway.GetCPUThrottlingMetrics(ctx, params.Namespace, params.DeploymentName, containerName, params.TimeRange)
+		}}
+		plan.quality = &metricFetch{container: containerName, metric: "data coverage", query: func(ctx context.Context) (float64, error) {
+			quality, err := uc.promGateway.GetDataQuality(ctx, params.Namespace, params.DeploymentName, containerName, params.TimeRange)
+			plan.qualityResult = quality
+			return 0, err
+		}}
+		plan.restarts = &metricFetch{container: containerName, metric: "container restarts", query: func(ctx context.Context) (float64, error) {
+			return uc.promGateway.GetRestarts(ctx, params.Namespace, params.DeploymentName, containerName, params.TimeRange)
+		}}
+		plan.oomKills = &metricFetch{container: containerName, metric: "OOM kills", query: func(ctx context.Context) (float64, error) {
+			kills, err := uc.promGateway.GetOOMKills(ctx, params.Namespace, params.DeploymentName, containerName, params.TimeRange)
+			plan.metricKills = kills
+			return float64(len(kills)), err
+		}}
+		plan.memoryTrend = &metricFetch{container: containerName, metric: "memory trend", query: func(ctx context.Context) (float64, error) {
+			lifetimes, err := uc.promGateway.GetMemoryLifetimes(ctx, params.Namespace, params.DeploymentName, containerName, params.TimeRange)
+			plan.lifetimes = lifetimes
+			return 0, err
+		}}
+		plan.storage = &metricFetch{container: containerName, metric: "ephemeral storage", query: func(ctx context.Context) (float64, error) {
+			return uc.promGateway.GetEphemeralStorageMetrics(ctx, params.Namespace, params.DeploymentName, containerName, params.TimeRange)
+		}}
+		fetches = append(fetches, plan.cpuRequest, plan.cpuLimit, plan.cpuMedian, plan.cpuThrottling, plan.quality, plan.restarts, plan.oomKills, plan.memoryTrend, plan.storage)
+		if requestsHugePages(templateContainer(d, containerName)) {
+			plan.hugePages = &metricFetch{container: containerName, metric: "hugepages usage", query: func(ctx context.Context) (float64, error) {
+				usage, err := uc.promGateway.GetHugePagesUsage(ctx, params.Namespace, params.DeploymentName, containerName, params.TimeRange)
+				plan.hugePageUsage = usage
+				return 0, err
+			}}
+			fetches = append(fetches, plan.hugePages)
+		}
+		if uc.policy.JVM {
+			c := templateContainer(d, containerName)
+			plan.jvmOptions = parseJVMOptions(c)
+			if limit, ok := c.Resources.Limits[v1.ResourceMemory]; ok {
+				plan.memoryLimitSpec = &limit
 			}
-		} else {
-			memP99, _ := uc.promGateway.GetMemoryMetrics(ctx, params.Namespace, params.DeploymentName, containerName, params.TimeRange)
-			memBytes := (int64(memP99) * mainContainerMemoryBufferPercent) / 100
-			memRecommendation = resource.NewQuantity(memBytes, resource.BinarySI)
+			plan.jvmMemory = &metricFetch{container: containerName, metric: "JVM memory", query: func(ctx context.Context) (float64, error) {
+				usage, err := uc.promGateway.GetJVMMemory(ctx, params.Namespace, params.DeploymentName, containerName, params.TimeRange)
+				plan.jvmUsage = usage
+				return 0, err
+			}}
+			fetches = append(fetches, plan.jvmMemory)
+		}
+		if window := uc.policy.PeakWindow; window != nil {
+			plan.peak = &metricFetch{container: containerName, metric: "peak window usage", query: func(ctx context.Context) (float64, error) {
+				usage, err := uc.promGateway.GetWindowUsage(ctx, params.Namespace, params.DeploymentName, containerName, params.TimeRange, *window, true)
+				plan.peakUsage = usage
+				return 0, err
+			}}
+			plan.offPeak = &metricFetch{container: containerName, metric: "off-peak usage", query: func(ctx context.Context) (float64, error) {
+				usage, err := uc.promGateway.GetWindowUsage(ctx, params.Namespace, params.DeploymentName, containerName, params.TimeRange, *window, false)
+				plan.offPeakUsage = usage
+				return 0, err
+			}}
+			fetches = append(fetches, plan.peak, plan.offPeak)
+		}
+		if uc.policy.ForecastHorizon > 0 {
+			plan.forecast = &metricFetch{container: containerName, metric: "usage trend", query: func(ctx context.Context) (float64, error) {
+				trend, err := uc.promGateway.GetUsageTrend(ctx, params.Namespace, params.DeploymentName, containerName, uc.forecastRange())
+				plan.usageTrend = trend
+				return 0, err
+			}}
+			fetches = append(fetches, plan.forecast)
+		}
+		plans = append(plans, plan)
+	}
+
+	uc.fetchMetrics(ctx, fetches)
+
+	// The working set before each kill can only be fetched once the kills
+	// are known. Per-pod usage is only fetched once the data shows more than
+	// one pod: the usage of a single pod is the aggregate.
+	var followUps []*metricFetch
+	for _, plan := range plans {
+		if plan.qualityResult == nil || plan.qualityResult.Pods > 1 {
+			plan.podUsage = &metricFetch{container: plan.containerName, metric: "per-pod usage", query: func(ctx context.Context) (float64, error) {
+				pods, err := uc.promGateway.GetPodUsage(ctx, params.Namespace, params.DeploymentName, plan.containerName, params.TimeRange)
+				plan.pods = pods
+				return float64(len(pods)), err
+			}}
+			followUps = append(followUps, plan.podUsage)
+		}
+		plan.kills = mergeOOMKills(corroboratedOOMKills(plan.clusterKills, plan.metricKills), plan.metricKills)
+		timed := recentTimedKills(plan.kills)
+		plan.preKillUsage = make([]*entity.PreKillMemory, len(timed))
+		for i, kill := range timed {
+			f := &metricFetch{container: plan.containerName, metric: "memory before OOM kill", query: func(ctx context.Context) (float64, error) {
+				usage, err := uc.promGateway.GetPreKillMemory(ctx, params.Namespace, params.DeploymentName, plan.containerName, kill, oomPreKillWindow)
+				plan.preKillUsage[i] = usage
+				return 0, err
+			}}
+			plan.preKills = append(plan.preKills, f)
+			followUps = append(followUps, f)
 		}
+	}
+	uc.fetchMetrics(ctx, followUps)
+
+	finalRecommendations := make([]NamedRecommendation, 0, len(plans))
+	for _, plan := range plans {
+		rec := uc.recommendMainContainer(plan, params.TimeRange)
+		uc.sizeJVM(plan, rec)
+		rec.Warnings = append(rec.Warnings, jvmWarnings(plan.containerName, rec, plan.jvmOptions)...)
+		finalRecommendations = append(finalRecommendations, NamedRecommendation{ContainerName: plan.containerName, Recommendation: rec})
+	}
+	uc.applyCPULimitPolicy(ctx, params.Namespace, finalRecommendations)
+	uc.shapeForQoS(d, finalRecommendations)
+	uc.applyLimitRanges(ctx, params.Namespace, finalRecommendations)
+	carryResources(d, finalRecommendations)
+	// Forecasts scale the final shape, so they keep the CPU limit policy and
+	// QoS class of today's recommendation.
+	for i, plan := range plans {
+		rec := finalRecommendations[i].Recommendation
+		rec.HugePages = plan.hugePageUsage
+		rec.Warnings = append(rec.Warnings, hugePagesWarnings(plan.containerName, plan.hugePageUsage, rec.PassthroughLimits)...)
+		rec.Forecast = uc.forecast(plan.usageTrend, rec)
+		rec.Warnings = append(rec.Warnings, uc.forecastWarnings(plan.containerName, rec.Forecast)...)
+	}
+	return finalRecommendations
+}
+
+func (uc *RecommenderUseCase) recommendMainContainer(plan *mainContainerPlan, timeRange string) *entity.Recommendation {
+	containerName := plan.containerName
+	errs := append(plan.errors, failedFetches(plan.memory, plan.memoryRequest, plan.cpuRequest, plan.cpuLimit, plan.cpuMedian, plan.cpuThrottling, plan.quality, plan.restarts, plan.oomKills, plan.memoryTrend, plan.peak, plan.offPeak, plan.forecast, plan.podUsage, plan.storage, plan.hugePages, plan.jvmMemory)...)
+	errs = append(errs, failedFetches(plan.preKills...)...)
+	if plan.hpa != nil {
+		errs = append(errs, failedFetches(plan.hpa.replicas)...)
+	}
+	for _, e := range errs {
+		uc.logger.Warn("Metric unavailable for recommendation", "container", containerName, "metric", e.Metric, "error", e.Err)
+	}
+	// Restarts are optional: without kube-state-metrics, or if the query
+	// fails, the data quality reports none.
+	if plan.qualityResult != nil && plan.restarts.err == nil {
+		plan.qualityResult.Restarts = int(plan.restarts.value)
+	}
 
-		cpuP90, _ := uc.promGateway.GetCPURequestMetrics(ctx, params.Namespace, params.DeploymentName, containerName, params.TimeRange)
-		cpuP99, _ := uc.promGateway.GetCPULimitMetrics(ctx, params.Namespace, params.DeploymentName, containerName, params.TimeRange)
-		cpuP50, _ := uc.promGateway.GetCPUMedianMetrics(ctx, params.Namespace, params.DeploymentName, containerName, params.TimeRange)
-
-		cpuLimitValue := cpuP99
-		isSpiky := false
-		if cpuP50 > 0 && (cpuP99/cpuP50 > spikinessThreshold) {
-			isSpiky = true
-			cpuLimitValue *= spikinessCPUBuffer
-		}
-
-		calculatedCPURequestMilli := int64(cpuP90 * 1000)
-		if calculatedCPURequestMilli < minCPURequestMilli {
-			uc.logger.Info(
-				"Calculated CPU request is below the minimum floor, applying minimum.",
-				"container", containerName,
-				"calculated", fmt.Sprintf("%dm", calculatedCPURequestMilli),
-				"minimum", fmt.Sprintf("%dm", minCPURequestMilli),
-			)
-			calculatedCPURequestMilli = minCPURequestMilli
-		}
-
-		calculatedCPULimitMilli := int64(cpuLimitValue * 1000)
-		if calculatedCPULimitMilli < minCPULimitMilli {
-			uc.logger.Info(
-				"Calculated CPU limit is below the minimum floor, applying minimum.",
-				"container", containerName,
-				"calculated", fmt.Sprintf("%dm", calculatedCPULimitMilli),
-				"minimum", fmt.Sprintf("%dm", minCPULimitMilli),
-			)
-			calculatedCPULimitMilli = minCPULimitMilli
-		}
-
-		if calculatedCPULimitMilli < calculatedCPURequestMilli {
-			uc.logger.Info(
-				"Calculated CPU limit is below the CPU request, applying CPU request as limit.",
-				"container", containerName,
-				"calculated", fmt.Sprintf("%dm", calculatedCPULimitMilli),
-				"request", fmt.Sprintf("%dm", calculatedCPURequestMilli),
-			)
-			calculatedCPULimitMilli = calculatedCPURequestMilli
-		}
-
-		calculatedMemoryBytes := memRecommendation.Value()
-		if calculatedMemoryBytes < minMemoryBytes {
-			uc.logger.Info(
-				"Calculated memory is below the minimum floor, applying minimum.",
-				"container", containerName,
-				"calculated", fmt.Sprintf("%dMi", calculatedMemoryBytes),
-				"minimum", fmt.Sprintf("%dMi", minMemoryBytes),
-			)
-			calculatedMemoryBytes = minMemoryBytes
-		}
-
-		memRecommendation = resource.NewQuantity(calculatedMemoryBytes, resource.BinarySI)
-		cpuRequest := resource.NewMilliQuantity(calculatedCPURequestMilli, resource.DecimalSI)
-		cpuLimit := resource.NewMilliQuantity(calculatedCPULimitMilli, resource.DecimalSI)
+	kills := plan.kills
+	isOOM := len(kills) > 0
+	if isOOM {
+		uc.logger.Warn("Container was OOMKilled", "container", containerName, "kills", len(kills))
+	}
 
+	// An OOM-killed container is sized from its current limit, so its memory
+	// usage is not required.
+	var required []*metricFetch
+	if !isOOM {
+		required = append(required, plan.memory)
+	}
+	required = append(required, plan.memoryRequest, plan.cpuRequest, plan.cpuLimit)
+	if missing := missingFetches(required...); len(missing) > 0 {
+		if plan.qualityResult != nil {
+			plan.qualityResult.Confidence = entity.ConfidenceLow
+		}
+		uc.logger.Warn("Required metrics are missing, not recommending resources", "container", containerName, "issues", missing)
 		rec := &entity.Recommendation{
-			Memory:      memRecommendation,
-			IsOOMKilled: isOOMRecommendation,
-			CPU: &entity.CPURecommendation{
-				Request:          cpuRequest,
-				Limit:            cpuLimit,
-				SpikinessWarning: isSpiky,
-			},
+			IsOOMKilled:  isOOM,
+			OOMKills:     kills,
+			DataStatus:   entity.DataMissing,
+			DataIssues:   missing,
+			DataQuality:  plan.qualityResult,
+			MetricErrors: errs,
 		}
-		finalRecommendations = append(finalRecommendations, NamedRecommendation{ContainerName: containerName, Recommendation: rec})
+		if len(plan.evictions) > 0 {
+			rec.EphemeralStorage = &entity.EphemeralStorage{Evictions: plan.evictions, CurrentLimit: plan.storageLimit}
+		}
+		return rec
+	}
+
+	dataStatus := entity.DataSufficient
+	dataIssues := missingFetches(plan.cpuMedian)
+	dataIssues = append(dataIssues, uc.coverageIssues(plan.qualityResult, plan.quality.err, timeRange)...)
+	if len(dataIssues) > 0 {
+		dataStatus = entity.DataInsufficient
+		uc.logger.Warn("Recommendation is based on insufficient data", "container", containerName, "issues", dataIssues)
+	}
+	if plan.qualityResult != nil {
+		plan.qualityResult.Confidence = confidence(plan.qualityResult, dataStatus, timeRange)
+	}
+
+	// Size for the peak window wherever its usage exceeds the whole range's.
+	memP99 := plan.memory.value
+	cpuP90 := plan.cpuRequest.value
+	cpuP99 := plan.cpuLimit.value
+	cpuP50 := plan.cpuMedian.value
+	cpuLimitBase := cpuP99
+	seasonality := uc.seasonality(plan)
+	if seasonality != nil && seasonality.Peak != nil {
+		peak := seasonality.Peak
+		seasonality.SizedForPeak = (!isOOM && peak.MemoryP99 > memP99) || peak.CPUP90 > cpuP90 || peak.CPUP99 > cpuP99
+		memP99 = max(memP99, peak.MemoryP99)
+		cpuP90 = max(cpuP90, peak.CPUP90)
+		cpuLimitBase = max(cpuP99, peak.CPUP99)
+	}
+
+	// Percentiles across all pods are those of the max pod. Scale them down
+	// when the policy sizes for fewer pods.
+	podDistribution, scale := uc.podDistribution(plan.pods)
+	memP99 *= scale.memory
+	cpuP90 *= scale.cpuP90
+	cpuLimitBase *= scale.cpuP99
+
+	var memRecommendation *resource.Quantity
+	var oomSizing *entity.OOMSizing
+	if isOOM {
+		memRecommendation, oomSizing = uc.oomMemoryLimit(plan.currentLimit, plan.preKillUsage)
+		uc.logger.Info("Raised memory limit after OOM kills", "container", containerName, "limit", memRecommendation.String(), "reason", oomSizing.Reason)
+	} else {
+		memBytes := (int64(memP99) * mainContainerMemoryBufferPercent) / 100
+		memRecommendation = resource.NewQuantity(memBytes, resource.BinarySI)
+	}
+
+	// A leaking container needs the memory it will reach by its next
+	// restart, not what it used so far.
+	trend := uc.memoryTrend(plan.lifetimes)
+	if trend != nil && trend.ProbableLeak {
+		uc.logger.Warn("Working set grows steadily, probable memory leak", "container", containerName, "growingLifetimes", trend.Growing, "lifetimes", trend.Lifetimes)
+		projected := int64(trend.ProjectedPeak*mainContainerMemoryBufferPercent) / 100
+		if projected > memRecommendation.Value() {
+			memRecommendation = resource.NewQuantity(projected, resource.BinarySI)
+			trend.LimitRaised = true
+		}
+	}
+
+	// Spikiness compares percentiles of the whole range, so a busy peak
+	// window alone doesn't count as spiky.
+	cpuLimitValue := cpuLimitBase
+	isSpiky := false
+	if cpuP50 > 0 && (cpuP99/cpuP50 > spikinessThreshold) {
+		isSpiky = true
+		cpuLimitValue *= spikinessCPUBuffer
+	}
+
+	// Usage can never exceed the current limit, so a throttled container's
+	// p99 understates its need. Raise the limit above the current one.
+	isThrottled := false
+	throttledRatio := plan.cpuThrottling.value
+	if plan.cpuThrottling.err == nil && throttledRatio > cpuThrottlingThreshold {
+		isThrottled = true
+		base := cpuP99
+		if plan.cpuLimitSpec != nil && !plan.cpuLimitSpec.IsZero() {
+			base = plan.cpuLimitSpec.AsApproximateFloat64()
+		}
+		cpuLimitValue = max(cpuLimitValue, base*cpuThrottlingMultiplier)
+		uc.logger.Warn("Significant CPU throttling detected, raising CPU limit", "container", containerName, "throttledRatio", throttledRatio)
+	}
+
+	calculatedCPURequestMilli := int64(cpuP90 * 1000)
+	if calculatedCPURequestMilli < minCPURequestMilli {
+		uc.logger.Info(
+			"Calculated CPU request is below the minimum floor, applying minimum.",
+			"container", containerName,
+			"calculated", fmt.Sprintf("%dm", calculatedCPURequestMilli),
+			"minimum", fmt.Sprintf("%dm", minCPURequestMilli),
+		)
+		calculatedCPURequestMilli = minCPURequestMilli
+	}
+
+	// An HPA keeps CPU usage at its target share of the request, so the
+	// request is sized for typical usage to sit at the target. Peaks are
+	// absorbed by more replicas rather than a larger request.
+	var hpaScaling *entity.HPAScaling
+	if plan.hpa != nil && plan.cpuMedian.err == nil && cpuP50 > 0 {
+		hpaScaling = plan.hpa.scaling(resource.NewMilliQuantity(calculatedCPURequestMilli, resource.DecimalSI))
+		hpaScaling.TypicalUsage = typicalCPU(plan.pods, cpuP50)
+		calculatedCPURequestMilli = max(int64(math.Ceil(cpuP50*1000/plan.hpa.utilization)), minCPURequestMilli)
+		uc.logger.Info("Sized CPU request for the HPA's target utilization", "container", containerName, "hpa", plan.hpa.name, "request", fmt.Sprintf("%dm", calculatedCPURequestMilli))
+	}
+
+	calculatedCPULimitMilli := int64(cpuLimitValue * 1000)
+	if calculatedCPULimitMilli < minCPULimitMilli {
+		uc.logger.Info(
+			"Calculated CPU limit is below the minimum floor, applying minimum.",
+			"container", containerName,
+			"calculated", fmt.Sprintf("%dm", calculatedCPULimitMilli),
+			"minimum", fmt.Sprintf("%dm", minCPULimitMilli),
+		)
+		calculatedCPULimitMilli = minCPULimitMilli
+	}
+
+	if calculatedCPULimitMilli < calculatedCPURequestMilli {
+		uc.logger.Info(
+			"Calculated CPU limit is below the CPU request, applying CPU request as limit.",
+			"container", containerName,
+			"calculated", fmt.Sprintf("%dm", calculatedCPULimitMilli),
+			"request", fmt.Sprintf("%dm", calculatedCPURequestMilli),
+		)
+		calculatedCPULimitMilli = calculatedCPURequestMilli
+	}
+
+	calculatedMemoryBytes := memRecommendation.Value()
+	if calculatedMemoryBytes < minMemoryBytes {
+		uc.logger.Info(
+			"Calculated memory is below the minimum floor, applying minimum.",
+			"container", containerName,
+			"calculated", fmt.Sprintf("%dMi", calculatedMemoryBytes),
+			"minimum", fmt.Sprintf("%dMi", minMemoryBytes),
+		)
+		calculatedMemoryBytes = minMemoryBytes
+	}
+
+	memRecommendation = resource.NewQuantity(calculatedMemoryBytes, resource.BinarySI)
+	memRequest := memRecommendation
+	if plan.memoryRequest != nil {
+		requestBytes := min(max(int64(plan.memoryRequest.value*scale.memory), minMemoryBytes), calculatedMemoryBytes)
+		memRequest = resource.NewQuantity(requestBytes, resource.BinarySI)
+	}
+	cpuRequest := resource.NewMilliQuantity(calculatedCPURequestMilli, resource.DecimalSI)
+	cpuLimit := resource.NewMilliQuantity(calculatedCPULimitMilli, resource.DecimalSI)
+
+	if len(plan.evictions) > 0 {
+		uc.logger.Warn("Pods were evicted for ephemeral storage", "container", containerName, "evictions", len(plan.evictions))
+	}
+	storage := ephemeralStorage(plan.storage.value, plan.storage.err == nil, plan.evictions, plan.storageLimit)
+
+	return &entity.Recommendation{
+		Memory:           memRecommendation,
+		MemoryRequest:    memRequest,
+		IsOOMKilled:      isOOM,
+		OOMKills:         kills,
+		OOMSizing:        oomSizing,
+		MemoryTrend:      trend,
+		Seasonality:      seasonality,
+		HPA:              hpaScaling,
+		PodDistribution:  podDistribution,
+		EphemeralStorage: storage,
+		Warnings:         append(seasonalityWarnings(containerName, seasonality, timeRange), uc.podDistributionWarnings(containerName, podDistribution)...),
+		DataStatus:       dataStatus,
+		DataIssues:       dataIssues,
+		DataQuality:      plan.qualityResult,
+		MetricErrors:     errs,
+		CPU: &entity.CPURecommendation{
+			Request:           cpuRequest,
+			Limit:             cpuLimit,
+			SpikinessWarning:  isSpiky,
+			ThrottlingWarning: isThrottled,
+			ThrottledRatio:    throttledRatio,
+		},
 	}
-	return finalRecommendations, nil
+}
+
+// containerCPULimit returns the CPU limit of a container in the deployment's
+// pod template, or nil if it has none.
+func containerCPULimit(d *appsv1.Deployment, containerName string) *resource.Quantity {
+	if c := templateContainer(d, containerName); c != nil {
+		if limit, ok := c.Resources.Limits[v1.ResourceCPU]; ok {
+			return &limit
+		}
+	}
+	return nil
+}
+
+// templateContainer returns the container or init container of the
+// deployment's pod template with the given name, or nil.
+func templateContainer(d *appsv1.Deployment, containerName string) *v1.Container {
+	spec := &d.Spec.Template.Spec
+	for _, list := range [][]v1.Container{spec.Containers, spec.InitContainers} {
+		for i := range list {
+			if list[i].Name == containerName {
+				return &list[i]
+			}
+		}
+	}
+	return nil
+}
+
+// isNativeSidecar reports whether an init container is a sidecar that keeps
+// running alongside the main containers (restartPolicy: Always).
+func isNativeSidecar(c v1.Container) bool {
+	return c.RestartPolicy != nil && *c.RestartPolicy == v1.ContainerRestartPolicyAlways
+}
+
+// containerCPURequest returns the CPU request of a container in the
+// deployment's pod template, or nil if it has none.
+func containerCPURequest(d *appsv1.Deployment, containerName string) *resource.Quantity {
+	if c := templateContainer(d, containerName); c != nil {
+		if request, ok := c.Resources.Requests[v1.ResourceCPU]; ok {
+			return &request
+		}
+	}
+	return nil
+}
+
+// coverageIssues checks the observed data against the policy's minimum span
+// and pod count.
+func (uc *RecommenderUseCase) coverageIssues(quality *entity.DataQuality, fetchErr error, timeRange string) []string {
+	if quality == nil {
+		if fetchErr != nil {
+			return []string{"data coverage unknown"}
+		}
+		return []string{"no samples observed"}
+	}
+
+	var issues []string
+	minSpan := uc.policy.MinDataSpan
+	if duration, err := model.ParseDuration(timeRange); err == nil && time.Duration(duration) < minSpan {
+		issues = append(issues, fmt.Sprintf("range %s shorter than required span of %s", timeRange, minSpan))
+	} else if quality.Span < minSpan {
+		issues = append(issues, fmt.Sprintf("samples cover %s, policy requires %s", quality.Span.Round(time.Minute), minSpan))
+	}
+	if quality.Pods < uc.policy.MinPods {
+		issues = append(issues, fmt.Sprintf("%d pod(s) observed, policy requires %d", quality.Pods, uc.policy.MinPods))
+	}
+	return issues
+}
+
+// confidence rates a recommendation from the quality of its data. Anything
+// the policy flags, or a span that is mostly gaps, is low confidence. Data
+// that is usable but doesn't cover the whole range, has noticeable gaps or
+// includes restarts is medium confidence.
+func confidence(quality *entity.DataQuality, status entity.DataStatus, timeRange string) entity.Confidence {
+	if status != entity.DataSufficient || quality.Gaps*4 > quality.Span {
+		return entity.ConfidenceLow
+	}
+	if duration, err := model.ParseDuration(timeRange); err == nil && quality.Span*10 < time.Duration(duration)*9 {
+		return entity.ConfidenceMedium
+	}
+	if quality.Gaps*20 > quality.Span || quality.Restarts > 0 {
+		return entity.ConfidenceMedium
+	}
+	return entity.ConfidenceHigh
 }
 
 func (uc *RecommenderUseCase) CalculateForInitContainers(ctx context.Context, params DeploymentParams) ([]NamedRecommendation, error) {
@@ -170,34 +645,85 @@ func (uc *RecommenderUseCase) CalculateForInitContainers(ctx context.Context, pa
 		return nil, fmt.Errorf("could not get deployment: %w", err)
 	}
 
-	var containersToAnalyze []string
-	if params.TargetContainer != "" {
-		found := false
-		for _, c := range d.Spec.Template.Spec.InitContainers {
-			if c.Name == params.TargetContainer {
-				found = true
-				break
-			}
+	oneShot, sidecars, err := initContainers(d, params)
+	if err != nil {
+		return nil, err
+	}
+	if len(oneShot) == 0 && len(sidecars) == 0 {
+		return []NamedRecommendation{}, nil
+	}
+	var sidecarRecommendations []NamedRecommendation
+	if len(sidecars) > 0 {
+		sidecarRecommendations = uc.calculateLongRunning(ctx, d, params, sidecars)
+	}
+	return inInitOrder(d, append(uc.calculateOneShot(ctx, d, params, oneShot), sidecarRecommendations...)), nil
+}
+
+// initContainers returns the init containers of the deployment to size: the
+// target container, or all of them. Native sidecars run as long as the main
+// containers, so they are sized like them. Only one-shot init containers are
+// sized for their peak.
+func initContainers(d *appsv1.Deployment, params DeploymentParams) (oneShot, sidecars []string, err error) {
+	found := false
+	for _, c := range d.Spec.Template.Spec.InitContainers {
+		if params.TargetContainer != "" && c.Name != params.TargetContainer {
+			continue
 		}
-		if found {
-			containersToAnalyze = append(containersToAnalyze, params.TargetContainer)
+		found = true
+		if isNativeSidecar(c) {
+			sidecars = append(sidecars, c.Name)
 		} else {
-			return nil, fmt.Errorf("container '%s' not found in deployment '%s'", params.TargetContainer, params.DeploymentName)
-		}
-	} else {
-		for _, c := range d.Spec.Template.Spec.InitContainers {
-			containersToAnalyze = append(containersToAnalyze, c.Name)
+			oneShot = append(oneShot, c.Name)
 		}
 	}
+	if params.TargetContainer != "" && !found {
+		return nil, nil, fmt.Errorf("container '%s' not found in deployment '%s'", params.TargetContainer, params.DeploymentName)
+	}
+	return oneShot, sidecars, nil
+}
 
-	if len(containersToAnalyze) == 0 {
-		return []NamedRecommendation{}, nil
+// calculateOneShot sizes one-shot init containers for the peak of their runs.
+func (uc *RecommenderUseCase) calculateOneShot(ctx context.Context, d *appsv1.Deployment, params DeploymentParams, containersToAnalyze []string) []NamedRecommendation {
+	memFetches := make([]*metricFetch, 0, len(containersToAnalyze))
+	cpuFetches := make([]*metricFetch, 0, len(containersToAnalyze))
+	cpuUsage := make([]*entity.InitCPUUsage, len(containersToAnalyze))
+	for i, containerName := range containersToAnalyze {
+		memFetches = append(memFetches, &metricFetch{container: containerName, metric: "Max init container memory", query: func(ctx context.Context) (float64, error) {
+			return uc.promGateway.GetInitContainerMemoryMetrics(ctx, params.Namespace, params.DeploymentName, containerName, params.TimeRange)
+		}})
+		cpuFetches = append(cpuFetches, &metricFetch{container: containerName, metric: "Init container CPU", query: func(ctx context.Context) (float64, error) {
+			usage, err := uc.promGateway.GetInitContainerCPU(ctx, params.Namespace, params.DeploymentName, containerName, params.TimeRange)
+			cpuUsage[i] = usage
+			return 0, err
+		}})
 	}
 
-	var finalRecommendations []NamedRecommendation
-	for _, containerName := range containersToAnalyze {
+	uc.fetchMetrics(ctx, append(append([]*metricFetch{}, memFetches...), cpuFetches...))
+
+	// One-shot init containers get no DataQuality: they run for moments at
+	// pod start, so the span, gaps and confidence of long-running data don't
+	// describe them.
+	finalRecommendations := make([]NamedRecommendation, 0, len(memFetches))
+	for i, memFetch := range memFetches {
+		containerName := memFetch.container
+		errs := failedFetches(memFetch, cpuFetches[i])
+		for _, e := range errs {
+			uc.logger.Warn("Metric unavailable for recommendation", "container", containerName, "metric", e.Metric, "error", e.Err)
+		}
+
+		if missing := missingFetches(memFetch); len(missing) > 0 {
+			uc.logger.Warn("Required metrics are missing, not recommending resources", "container", containerName, "issues", missing)
+			rec := &entity.Recommendation{
+				DataStatus:   entity.DataMissing,
+				DataIssues:   missing,
+				MetricErrors: errs,
+			}
+			finalRecommendations = append(finalRecommendations, NamedRecommendation{ContainerName: containerName, Recommendation: rec})
+			continue
+		}
+
 		var memRecommendation *resource.Quantity
-		memMax, _ := uc.promGateway.GetInitContainerMemoryMetrics(ctx, params.Namespace, params.DeploymentName, containerName, params.TimeRange)
+		memMax := memFetch.value
 
 		if memMax > 0 {
 			// FIX: Use integer math to avoid float inaccuracies
@@ -207,20 +733,42 @@ func (uc *RecommenderUseCase) CalculateForInitContainers(ctx context.Context, pa
 			memRecommendationVal := resource.MustParse(initMemoryDefault)
 			memRecommendation = &memRecommendationVal
 		}
-		cpuRequest := resource.MustParse(initCPURequestDefault)
-		cpuLimit := resource.MustParse(initCPULimitDefault)
+		cpuRequest, cpuLimit, initCPU := uc.initCPU(cpuUsage[i], containerCPULimit(d, containerName))
+		if initCPU == nil {
+			uc.logger.Info("No CPU usage of init container runs, using default CPU", "container", containerName)
+		}
 		rec := &entity.Recommendation{
-			Memory:      memRecommendation,
-			IsOOMKilled: false,
+			Memory:        memRecommendation,
+			MemoryRequest: memRecommendation,
+			IsOOMKilled:   false,
+			InitCPU:       initCPU,
+			Warnings:      initCPUWarnings(containerName, initCPU),
+			DataStatus:    entity.DataSufficient,
+			MetricErrors:  errs,
 			CPU: &entity.CPURecommendation{
-				Request:          &cpuRequest,
-				Limit:            &cpuLimit,
+				Request:          cpuRequest,
+				Limit:            cpuLimit,
 				SpikinessWarning: false,
 			},
 		}
 		finalRecommendations = append(finalRecommendations, NamedRecommendation{ContainerName: containerName, Recommendation: rec})
 	}
-	return finalRecommendations, nil
+	uc.applyCPULimitPolicy(ctx, params.Namespace, finalRecommendations)
+	uc.shapeForQoS(d, finalRecommendations)
+	uc.applyLimitRanges(ctx, params.Namespace, finalRecommendations)
+	carryResources(d, finalRecommendations)
+	return finalRecommendations
+}
+
+// inInitOrder sorts recommendations in the order of the deployment's init
+// containers.
+func inInitOrder(d *appsv1.Deployment, recs []NamedRecommendation) []NamedRecommendation {
+	position := make(map[string]int, len(d.Spec.Template.Spec.InitContainers))
+	for i, c := range d.Spec.Template.Spec.InitContainers {
+		position[c.Name] = i
+	}
+	sort.SliceStable(recs, func(i, j int) bool { return position[recs[i].ContainerName] < position[recs[j].ContainerName] })
+	return recs
 }
 
 func (uc *RecommenderUseCase) CalculateForAll(ctx context.Context, namespace, deploymentName, targetContainerName, timeRange string) (*AllRecommendations, error) {
@@ -230,16 +778,51 @@ func (uc *RecommenderUseCase) CalculateForAll(ctx context.Context, namespace, de
 		TargetContainer: targetContainerName,
 		TimeRange:       timeRange,
 	}
-	mainRecs, err := uc.CalculateForDeployment(ctx, params)
+	d, err := uc.k8sGateway.GetDeployment(ctx, params.Namespace, params.DeploymentName)
+	if err != nil {
+		return nil, fmt.Errorf("could not get deployment: %w", err)
+	}
+	mainNames, err := mainContainers(d, params)
 	if err != nil {
 		return nil, fmt.Errorf("error calculating main container recommendations: %w", err)
 	}
-	initRecs, err := uc.CalculateForInitContainers(ctx, params)
+	oneShot, sidecars, err := initContainers(d, params)
 	if err != nil {
 		return nil, fmt.Errorf("error calculating init container recommendations: %w", err)
 	}
-	return &AllRecommendations{
-		MainContainers: mainRecs,
-		InitContainers: initRecs,
-	}, nil
-}
\ No newline at end of file
+
+	// Main containers and native sidecars are sized in one pass, so the HPA,
+	// the replica counts and the pods' kills and evictions are looked up
+	// once for the deployment.
+	recs := &AllRecommendations{MainContainers: []NamedRecommendation{}, InitContainers: []NamedRecommendation{}}
+	var sidecarRecs []NamedRecommendation
+	if longRunning := append(append([]string{}, mainNames...), sidecars...); len(longRunning) > 0 {
+		all := uc.calculateLongRunning(ctx, d, params, longRunning)
+		recs.MainContainers, sidecarRecs = all[:len(mainNames):len(mainNames)], all[len(mainNames):]
+	}
+	if len(oneShot) > 0 || len(sidecarRecs) > 0 {
+		recs.InitContainers = inInitOrder(d, append(uc.calculateOneShot(ctx, d, params, oneShot), sidecarRecs...))
+	}
+	if err := uc.Assess(ctx, params, recs); err != nil {
+		return nil, err
+	}
+	return recs, nil
+}
+
+// Assess runs the deployment-wide assessments on the recommendations: HPA
+// replicas, QoS class, pod requests and resource quotas.
+func (uc *RecommenderUseCase) Assess(ctx context.Context, params DeploymentParams, recs *AllRecommendations) error {
+	if err := uc.AssessHPA(ctx, params, recs); err != nil {
+		return fmt.Errorf("error assessing HPA replicas: %w", err)
+	}
+	if err := uc.AssessQoS(ctx, params, recs); err != nil {
+		return fmt.Errorf("error assessing QoS class: %w", err)
+	}
+	if err := uc.AssessPodRequests(ctx, params, recs); err != nil {
+		return fmt.Errorf("error assessing pod requests: %w", err)
+	}
+	if err := uc.AssessQuota(ctx, params, recs); err != nil {
+		return fmt.Errorf("error assessing resource quotas: %w", err)
+	}
+	return nil
+}
@@ -8,10 +8,13 @@ import (
 	"io"
 	"log/slog"
 	"testing"
+	"time"
 
 	"github.com/sequring/sculptor/internal/entity"
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
 	v1 "k8s.io/api/core/v1"
+	nodev1 "k8s.io/api/node/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -25,6 +28,50 @@ type mockDeploymentGateway struct {
 	oomPodName       string
 	oomCurrentLimit  *resource.Quantity
 	checkOOMErr      error
+	limitRanges      []v1.LimitRange
+	limitRangesErr   error
+	resourceQuotas   []v1.ResourceQuota
+	quotasErr        error
+	hpa              *autoscalingv2.HorizontalPodAutoscaler
+	runtimeClass     *nodev1.RuntimeClass
+	runtimeClassErr  error
+	nodes            []v1.Node
+	nodesErr         error
+	evictions        []entity.StorageEviction
+	storageLimit     *resource.Quantity
+	hpaLookups       int
+	oomKillLists     int
+	evictionLists    int
+}
+
+func (m *mockDeploymentGateway) ListNodes(ctx context.Context, spec *v1.PodSpec) ([]v1.Node, error) {
+	return m.nodes, m.nodesErr
+}
+
+func (m *mockDeploymentGateway) GetRuntimeClass(ctx context.Context, name string) (*nodev1.RuntimeClass, error) {
+	return m.runtimeClass, m.runtimeClassErr
+}
+
+func (m *mockDeploymentGateway) ListStorageEvictions(ctx context.Context, d *appsv1.Deployment, containerNames []string, timeRange string) (map[string]entity.ContainerStorageEvictions, error) {
+	m.evictionLists++
+	evictions := make(map[string]entity.ContainerStorageEvictions, len(containerNames))
+	for _, name := range containerNames {
+		evictions[name] = entity.ContainerStorageEvictions{Evictions: m.evictions, CurrentLimit: m.storageLimit}
+	}
+	return evictions, nil
+}
+
+func (m *mockDeploymentGateway) ListLimitRanges(ctx context.Context, namespace string) ([]v1.LimitRange, error) {
+	return m.limitRanges, m.limitRangesErr
+}
+
+func (m *mockDeploymentGateway) ListResourceQuotas(ctx context.Context, namespace string) ([]v1.ResourceQuota, error) {
+	return m.resourceQuotas, m.quotasErr
+}
+
+func (m *mockDeploymentGateway) GetHorizontalPodAutoscaler(ctx context.Context, d *appsv1.Deployment) (*autoscalingv2.HorizontalPodAutoscaler, error) {
+	m.hpaLookups++
+	return m.hpa, nil
 }
 
 func (m *mockDeploymentGateway) GetDeployment(ctx context.Context, namespace, name string) (*appsv1.Deployment, error) {
@@ -34,30 +81,58 @@ func (m *mockDeploymentGateway) GetDeployment(ctx context.Context, namespace, na
 	return m.deployment, nil
 }
 
-func (m *mockDeploymentGateway) CheckForOOMKilledEvents(ctx context.Context, d *appsv1.Deployment, targetContainerName string) (bool, string, *resource.Quantity, error) {
+func (m *mockDeploymentGateway) ListOOMKills(ctx context.Context, d *appsv1.Deployment, containerNames []string, timeRange string) (map[string]entity.ContainerOOMKills, error) {
+	m.oomKillLists++
 	if m.checkOOMErr != nil {
-		return false, "", nil, m.checkOOMErr
+		return nil, m.checkOOMErr
 	}
-	// Allow specific container targeting for OOM tests
-	if m.isOOMKilled && targetContainerName == m.oomPodName {
-		return true, m.oomPodName, m.oomCurrentLimit, m.checkOOMErr
+	kills := make(map[string]entity.ContainerOOMKills, len(containerNames))
+	for _, name := range containerNames {
+		// Allow specific container targeting for OOM tests
+		if m.isOOMKilled && name == m.oomPodName {
+			kills[name] = entity.ContainerOOMKills{Kills: []entity.OOMKill{{Pod: m.oomPodName, Time: time.Now().Add(-time.Hour), Source: "container status"}}, CurrentLimit: m.oomCurrentLimit}
+		}
 	}
-	return false, "", nil, m.checkOOMErr
+	return kills, nil
 }
 
 type mockMetricsGateway struct {
 	memValue          float64
+	memP95Value       float64
 	cpuP90Value       float64
 	cpuP99Value       float64
 	cpuP50Value       float64
+	throttledRatio    float64
 	initMemValue      float64
+	quality           *entity.DataQuality
+	restarts          float64
+	getRestartsErr    error
+	oomKills          []entity.OOMKill
+	preKill           *entity.PreKillMemory
+	lifetimes         []entity.MemoryLifetime
+	peakUsage         *entity.Usage
+	offPeakUsage      *entity.Usage
+	usageTrend        *entity.UsageTrend
+	replicaStats      *entity.ReplicaStats
+	replicaQueries    int
+	podUsage          []entity.PodUsage
+	initCPU           *entity.InitCPUUsage
+	storageValue      float64
+	hugePages         []entity.HugePagesUsage
+	jvmMemory         *entity.JVMMemory
 	getMetricsErr     error
 	getInitMetricsErr error
+	getQualityErr     error
+	getThrottlingErr  error
+	getOOMKillsErr    error
 }
 
 func (m *mockMetricsGateway) GetMemoryMetrics(ctx context.Context, ns, deploymentName, containerName, timeRange string) (float64, error) {
 	return m.memValue, m.getMetricsErr
 }
+func (m *mockMetricsGateway) GetMemoryRequestMetrics(ctx context.Context, ns, deploymentName, containerName, timeRange string) (float64, error) {
+	return m.memP95Value, m.getMetricsErr
+}
 func (m *mockMetricsGateway) GetCPURequestMetrics(ctx context.Context, ns, deploymentName, containerName, timeRange string) (float64, error) {
 	return m.cpuP90Value, m.getMetricsErr
 }
@@ -67,9 +142,87 @@ func (m *mockMetricsGateway) GetCPULimitMetrics(ctx context.Context, ns, deploym
 func (m *mockMetricsGateway) GetCPUMedianMetrics(ctx context.Context, ns, deploymentName, containerName, timeRange string) (float64, error) {
 	return m.cpuP50Value, m.getMetricsErr
 }
+func (m *mockMetricsGateway) GetCPUThrottlingMetrics(ctx context.Context, ns, deploymentName, containerName, timeRange string) (float64, error) {
+	return m.throttledRatio, m.getThrottlingErr
+}
+func (m *mockMetricsGateway) GetJVMMemory(ctx context.Context, ns, deploymentName, containerName, timeRange string) (*entity.JVMMemory, error) {
+	if m.jvmMemory == nil {
+		return nil, entity.ErrNoData
+	}
+	return m.jvmMemory, nil
+}
+func (m *mockMetricsGateway) GetHugePagesUsage(ctx context.Context, ns, deploymentName, containerName, timeRange string) ([]entity.HugePagesUsage, error) {
+	if len(m.hugePages) == 0 {
+		return nil, entity.ErrNoData
+	}
+	return m.hugePages, nil
+}
+func (m *mockMetricsGateway) GetEphemeralStorageMetrics(ctx context.Context, ns, deploymentName, containerName, timeRange string) (float64, error) {
+	if m.storageValue == 0 {
+		return 0, entity.ErrNoData
+	}
+	return m.storageValue, nil
+}
 func (m *mockMetricsGateway) GetInitContainerMemoryMetrics(ctx context.Context, ns, deploymentName, containerName, timeRange string) (float64, error) {
 	return m.initMemValue, m.getInitMetricsErr
 }
+func (m *mockMetricsGateway) GetDataQuality(ctx context.Context, ns, deploymentName, containerName, timeRange string) (*entity.DataQuality, error) {
+	return m.quality, m.getQualityErr
+}
+func (m *mockMetricsGateway) GetRestarts(ctx context.Context, ns, deploymentName, containerName, timeRange string) (float64, error) {
+	if m.restarts == 0 && m.getRestartsErr == nil {
+		return 0, entity.ErrNoData
+	}
+	return m.restarts, m.getRestartsErr
+}
+func (m *mockMetricsGateway) GetOOMKills(ctx context.Context, ns, deploymentName, containerName, timeRange string) ([]entity.OOMKill, error) {
+	return m.oomKills, m.getOOMKillsErr
+}
+func (m *mockMetricsGateway) GetMemoryLifetimes(ctx context.Context, ns, deploymentName, containerName, timeRange string) ([]entity.MemoryLifetime, error) {
+	return m.lifetimes, nil
+}
+func (m *mockMetricsGateway) GetWindowUsage(ctx context.Context, ns, deploymentName, containerName, timeRange string, window entity.TimeWindow, inside bool) (*entity.Usage, error) {
+	usage := m.offPeakUsage
+	if inside {
+		usage = m.peakUsage
+	}
+	if usage == nil {
+		return nil, entity.ErrNoData
+	}
+	return usage, nil
+}
+func (m *mockMetricsGateway) GetUsageTrend(ctx context.Context, ns, deploymentName, containerName, timeRange string) (*entity.UsageTrend, error) {
+	if m.usageTrend == nil {
+		return nil, entity.ErrNoData
+	}
+	return m.usageTrend, nil
+}
+func (m *mockMetricsGateway) GetInitContainerCPU(ctx context.Context, ns, deploymentName, containerName, timeRange string) (*entity.InitCPUUsage, error) {
+	if m.initCPU == nil {
+		return nil, entity.ErrNoData
+	}
+	usage := *m.initCPU
+	return &usage, nil
+}
+func (m *mockMetricsGateway) GetPodUsage(ctx context.Context, ns, deploymentName, containerName, timeRange string) ([]entity.PodUsage, error) {
+	if m.podUsage == nil {
+		return nil, entity.ErrNoData
+	}
+	return m.podUsage, nil
+}
+func (m *mockMetricsGateway) GetReplicaStats(ctx context.Context, ns, deploymentName, timeRange string) (*entity.ReplicaStats, error) {
+	m.replicaQueries++
+	if m.replicaStats == nil {
+		return nil, entity.ErrNoData
+	}
+	return m.replicaStats, nil
+}
+func (m *mockMetricsGateway) GetPreKillMemory(ctx context.Context, ns, deploymentName, containerName string, kill entity.OOMKill, window time.Duration) (*entity.PreKillMemory, error) {
+	if m.preKill == nil {
+		return nil, entity.ErrNoData
+	}
+	return m.preKill, nil
+}
 
 // --- Helper Functions ---
 
@@ -435,6 +588,65 @@ func TestRecommenderUseCase_CalculateForInitContainers_HappyPath(t *testing.T) {
 	}
 }
 
+func TestRecommenderUseCase_CalculateForInitContainers_NativeSidecar(t *testing.T) {
+	// Arrange
+	always := v1.ContainerRestartPolicyAlways
+	baseDeployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-ns"},
+		Spec: appsv1.DeploymentSpec{
+			Template: v1.PodTemplateSpec{
+				Spec: v1.PodSpec{
+					InitContainers: []v1.Container{{Name: "proxy", RestartPolicy: &always}, {Name: "init-setup"}},
+				},
+			},
+		},
+	}
+
+	deploymentGW := &mockDeploymentGateway{deployment: baseDeployment}
+	metricsGW := &mockMetricsGateway{
+		memValue:     100 * 1024 * 1024,
+		cpuP90Value:  0.2,
+		cpuP99Value:  0.3,
+		cpuP50Value:  0.2,
+		initMemValue: 50 * 1024 * 1024,
+	}
+	uc := NewRecommenderUseCase(deploymentGW, metricsGW, newTestLogger())
+
+	params := DeploymentParams{
+		Namespace:      "test-ns",
+		DeploymentName: "test-deployment",
+		TimeRange:      "7d",
+	}
+
+	// Act
+	recommendations, err := uc.CalculateForInitContainers(context.Background(), params)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(recommendations) != 2 || recommendations[0].ContainerName != "proxy" || recommendations[1].ContainerName != "init-setup" {
+		t.Fatalf("expected recommendations for proxy and init-setup in spec order, got %v", recommendations)
+	}
+
+	sidecar := recommendations[0].Recommendation
+	wantMemory := quantityFromInt((100 * 1024 * 1024 * mainContainerMemoryBufferPercent) / 100)
+	if sidecar.Memory.Cmp(*wantMemory) != 0 {
+		t.Errorf("sidecar Memory: got %s, want %s from p99", sidecar.Memory.String(), wantMemory.String())
+	}
+	if got := sidecar.CPU.Request.MilliValue(); got != 200 {
+		t.Errorf("sidecar CPU Request: got %dm, want 200m from p90", got)
+	}
+	if got := sidecar.CPU.Limit.MilliValue(); got != 300 {
+		t.Errorf("sidecar CPU Limit: got %dm, want 300m from p99", got)
+	}
+
+	initSetup := recommendations[1].Recommendation
+	if initSetup.CPU.Request.Cmp(*mustParseQuantity(initCPURequestDefault)) != 0 {
+		t.Errorf("init-setup CPU Request: got %s, want %s", initSetup.CPU.Request.String(), initCPURequestDefault)
+	}
+}
+
 func TestRecommenderUseCase_CalculateForInitContainers_NoMetricsData(t *testing.T) {
 	// Arrange
 	baseDeployment := &appsv1.Deployment{
@@ -559,4 +771,231 @@ func TestRecommenderUseCase_CalculateForAll_HappyPath(t *testing.T) {
 			SpikinessWarning: false,
 		},
 	})
-}
\ No newline at end of file
+}
+func TestRecommenderUseCase_CalculateForDeployment_DataStatus(t *testing.T) {
+	baseDeployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-ns"},
+		Spec: appsv1.DeploymentSpec{
+			Template: v1.PodTemplateSpec{
+				Spec: v1.PodSpec{
+					Containers: []v1.Container{{Name: "main-app"}},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		metricsGW  *mockMetricsGateway
+		timeRange  string
+		wantStatus entity.DataStatus
+	}{
+		{
+			name: "sufficient coverage",
+			metricsGW: &mockMetricsGateway{
+				memValue: 100 * 1024 * 1024, cpuP90Value: 0.2, cpuP99Value: 0.4, cpuP50Value: 0.25,
+				quality: &entity.DataQuality{Span: 7 * 24 * time.Hour, Pods: 3},
+			},
+			wantStatus: entity.DataSufficient,
+		},
+		{
+			name: "short coverage",
+			metricsGW: &mockMetricsGateway{
+				memValue: 100 * 1024 * 1024, cpuP90Value: 0.2, cpuP99Value: 0.4, cpuP50Value: 0.25,
+				quality: &entity.DataQuality{Span: 2 * time.Hour, Pods: 3},
+			},
+			wantStatus: entity.DataInsufficient,
+		},
+		{
+			name: "range shorter than the required span",
+			metricsGW: &mockMetricsGateway{
+				memValue: 100 * 1024 * 1024, cpuP90Value: 0.2, cpuP99Value: 0.4, cpuP50Value: 0.25,
+				quality: &entity.DataQuality{Span: 12 * time.Hour, Pods: 3},
+			},
+			timeRange:  "12h",
+			wantStatus: entity.DataInsufficient,
+		},
+		{
+			name:       "no data",
+			metricsGW:  &mockMetricsGateway{getMetricsErr: fmt.Errorf("query: %w", entity.ErrNoData)},
+			wantStatus: entity.DataMissing,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			uc := NewRecommenderUseCase(&mockDeploymentGateway{deployment: baseDeployment}, tt.metricsGW, newTestLogger())
+			timeRange := tt.timeRange
+			if timeRange == "" {
+				timeRange = "7d"
+			}
+			params := DeploymentParams{Namespace: "test-ns", DeploymentName: "test-deployment", TimeRange: timeRange}
+
+			// Act
+			recommendations, err := uc.CalculateForDeployment(context.Background(), params)
+
+			// Assert
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			rec := recommendations[0].Recommendation
+			if rec.DataStatus != tt.wantStatus {
+				t.Errorf("got DataStatus %q, want %q (issues: %v)", rec.DataStatus, tt.wantStatus, rec.DataIssues)
+			}
+			if tt.wantStatus == entity.DataMissing {
+				if rec.Memory != nil || rec.CPU != nil {
+					t.Errorf("expected no resources for missing data, got memory %v, cpu %v", rec.Memory, rec.CPU)
+				}
+				if len(rec.MetricErrors) != 0 {
+					t.Errorf("expected no-data results not to be reported as errors, got %v", rec.MetricErrors)
+				}
+			}
+		})
+	}
+}
+
+func TestRecommenderUseCase_CalculateForDeployment_RestartsOptional(t *testing.T) {
+	// Arrange
+	deploymentGW := &mockDeploymentGateway{
+		deployment: &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-ns"},
+			Spec: appsv1.DeploymentSpec{
+				Template: v1.PodTemplateSpec{
+					Spec: v1.PodSpec{Containers: []v1.Container{{Name: "main-app"}}},
+				},
+			},
+		},
+	}
+	metricsGW := &mockMetricsGateway{
+		memValue: 100 * 1024 * 1024, cpuP90Value: 0.2, cpuP99Value: 0.4, cpuP50Value: 0.25,
+		quality:        &entity.DataQuality{Span: 7 * 24 * time.Hour, Pods: 3},
+		getRestartsErr: fmt.Errorf("timeout"),
+	}
+	uc := NewRecommenderUseCase(deploymentGW, metricsGW, newTestLogger(), WithFetchConfig(FetchConfig{Retries: 0}))
+
+	// Act
+	recs, err := uc.CalculateForDeployment(context.Background(), DeploymentParams{Namespace: "test-ns", DeploymentName: "test-deployment", TimeRange: "7d"})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rec := recs[0].Recommendation
+	if rec.DataQuality == nil || rec.DataStatus != entity.DataSufficient {
+		t.Errorf("expected sufficient data with a data quality despite the failed restarts query, got %q %+v", rec.DataStatus, rec.DataQuality)
+	}
+	if len(rec.MetricErrors) != 1 || rec.MetricErrors[0].Metric != "container restarts" {
+		t.Errorf("expected the restarts failure as a metric error, got %v", rec.MetricErrors)
+	}
+}
+
+func TestConfidence(t *testing.T) {
+	week := 7 * 24 * time.Hour
+	tests := []struct {
+		name    string
+		quality entity.DataQuality
+		status  entity.DataStatus
+		want    entity.Confidence
+	}{
+		{"full coverage", entity.DataQuality{Span: week, Pods: 3}, entity.DataSufficient, entity.ConfidenceHigh},
+		{"insufficient data", entity.DataQuality{Span: week, Pods: 3}, entity.DataInsufficient, entity.ConfidenceLow},
+		{"mostly gaps", entity.DataQuality{Span: week, Gaps: 3 * 24 * time.Hour}, entity.DataSufficient, entity.ConfidenceLow},
+		{"partial range", entity.DataQuality{Span: 3 * 24 * time.Hour}, entity.DataSufficient, entity.ConfidenceMedium},
+		{"some gaps", entity.DataQuality{Span: week, Gaps: 12 * time.Hour}, entity.DataSufficient, entity.ConfidenceMedium},
+		{"restarts", entity.DataQuality{Span: week, Restarts: 1}, entity.DataSufficient, entity.ConfidenceMedium},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := confidence(&tt.quality, tt.status, "7d"); got != tt.want {
+				t.Errorf("got confidence %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecommenderUseCase_CalculateForDeployment_CPUThrottling(t *testing.T) {
+	newDeployment := func(limits v1.ResourceList) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-ns"},
+			Spec: appsv1.DeploymentSpec{
+				Template: v1.PodTemplateSpec{
+					Spec: v1.PodSpec{
+						Containers: []v1.Container{{Name: "main-app", Resources: v1.ResourceRequirements{Limits: limits}}},
+					},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name           string
+		deployment     *appsv1.Deployment
+		throttledRatio float64
+		throttlingErr  error
+		wantLimit      string
+		wantWarning    bool
+	}{
+		{
+			name:           "throttled at current limit",
+			deployment:     newDeployment(v1.ResourceList{v1.ResourceCPU: resource.MustParse("400m")}),
+			throttledRatio: 0.4,
+			wantLimit:      "600m",
+			wantWarning:    true,
+		},
+		{
+			name:           "throttled without limit in spec",
+			deployment:     newDeployment(nil),
+			throttledRatio: 0.4,
+			wantLimit:      "600m",
+			wantWarning:    true,
+		},
+		{
+			name:           "minor throttling",
+			deployment:     newDeployment(v1.ResourceList{v1.ResourceCPU: resource.MustParse("400m")}),
+			throttledRatio: 0.05,
+			wantLimit:      "400m",
+		},
+		{
+			name:          "no CFS data",
+			deployment:    newDeployment(nil),
+			throttlingErr: fmt.Errorf("query: %w", entity.ErrNoData),
+			wantLimit:     "400m",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			metricsGW := &mockMetricsGateway{
+				memValue:         100 * 1024 * 1024,
+				cpuP90Value:      0.2,
+				cpuP99Value:      0.4,
+				cpuP50Value:      0.25,
+				throttledRatio:   tt.throttledRatio,
+				getThrottlingErr: tt.throttlingErr,
+			}
+			uc := NewRecommenderUseCase(&mockDeploymentGateway{deployment: tt.deployment}, metricsGW, newTestLogger())
+			params := DeploymentParams{Namespace: "test-ns", DeploymentName: "test-deployment", TimeRange: "7d"}
+
+			// Act
+			recommendations, err := uc.CalculateForDeployment(context.Background(), params)
+
+			// Assert
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			cpu := recommendations[0].Recommendation.CPU
+			if cpu.Limit.Cmp(*mustParseQuantity(tt.wantLimit)) != 0 {
+				t.Errorf("CPU Limit: got %s, want %s", cpu.Limit.String(), tt.wantLimit)
+			}
+			if cpu.ThrottlingWarning != tt.wantWarning {
+				t.Errorf("got ThrottlingWarning %v, want %v", cpu.ThrottlingWarning, tt.wantWarning)
+			}
+			if len(recommendations[0].Recommendation.MetricErrors) != 0 {
+				t.Errorf("expected no metric errors, got %v", recommendations[0].Recommendation.MetricErrors)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package usecase
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/sequring/sculptor/internal/entity"
+)
+
+// seasonalityMinRange is the shortest time range that covers every weekday.
+const seasonalityMinRange = 7 * 24 * time.Hour
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ParsePeakWindow parses a recurring window such as "Mon-Fri 09:00-18:00" or
+// "Sat,Sun 10:00-22:00 +02:00". Days are three-letter names, ranges of them,
+// or "*" for every day. The optional offset is "UTC" or a fixed UTC offset;
+// windows are in UTC by default. An empty string means no window.
+func ParsePeakWindow(s string) (*entity.TimeWindow, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	if len(fields) > 3 || len(fields) < 2 {
+		return nil, fmt.Errorf("invalid peak window %q: expected days, a time range and an optional UTC offset, e.g. \"Mon-Fri 09:00-18:00\"", s)
+	}
+
+	var w entity.TimeWindow
+	if err := parseDays(fields[0], &w); err != nil {
+		return nil, fmt.Errorf("invalid peak window %q: %w", s, err)
+	}
+
+	from, to, ok := strings.Cut(fields[1], "-")
+	if !ok {
+		return nil, fmt.Errorf("invalid peak window %q: time range must look like 09:00-18:00", s)
+	}
+	var err error
+	if w.From, err = parseMinuteOfDay(from); err != nil {
+		return nil, fmt.Errorf("invalid peak window %q: %w", s, err)
+	}
+	if w.To, err = parseMinuteOfDay(to); err != nil {
+		return nil, fmt.Errorf("invalid peak window %q: %w", s, err)
+	}
+	if w.From == w.To {
+		return nil, fmt.Errorf("invalid peak window %q: time range is empty", s)
+	}
+
+	if len(fields) == 3 && !strings.EqualFold(fields[2], "UTC") {
+		offset, err := time.Parse("-07:00", fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid peak window %q: offset must be UTC or look like +02:00", s)
+		}
+		_, seconds := offset.Zone()
+		w.Offset = time.Duration(seconds) * time.Second
+	}
+	return &w, nil
+}
+
+// parseDays sets the days of w from a comma-separated list of days and day
+// ranges.
+func parseDays(s string, w *entity.TimeWindow) error {
+	if s == "*" {
+		for d := range w.Days {
+			w.Days[d] = true
+		}
+		return nil
+	}
+	for _, item := range strings.Split(strings.ToLower(s), ",") {
+		first, last, isRange := strings.Cut(item, "-")
+		if !isRange {
+			last = first
+		}
+		from, ok := weekdays[first]
+		to, ok2 := weekdays[last]
+		if !ok || !ok2 {
+			return fmt.Errorf("unknown day %q, use Mon, Tue, Wed, Thu, Fri, Sat or Sun", item)
+		}
+		// Ranges may wrap around the week, as in Fri-Mon.
+		for d := from; ; d = (d + 1) % 7 {
+			w.Days[d] = true
+			if d == to {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// parseMinuteOfDay parses HH:MM into minutes since midnight. 24:00 is
+// accepted as the end of the day.
+func parseMinuteOfDay(s string) (int, error) {
+	hh, mm, ok := strings.Cut(s, ":")
+	hours, err := strconv.Atoi(hh)
+	if !ok || err != nil {
+		return 0, fmt.Errorf("invalid time %q, use HH:MM", s)
+	}
+	minutes, err := strconv.Atoi(mm)
+	if err != nil || len(mm) != 2 || minutes > 59 || hours < 0 || hours > 24 || (hours == 24 && minutes != 0) {
+		return 0, fmt.Errorf("invalid time %q, use HH:MM", s)
+	}
+	return hours*60 + minutes, nil
+}
+
+// seasonality compares the peak and off-peak usage fetched for a plan. It
+// returns nil without a peak window in the policy.
+func (uc *RecommenderUseCase) seasonality(plan *mainContainerPlan) *entity.Seasonality {
+	if uc.policy.PeakWindow == nil {
+		return nil
+	}
+	return &entity.Seasonality{Window: *uc.policy.PeakWindow, Peak: plan.peakUsage, OffPeak: plan.offPeakUsage}
+}
+
+// seasonalityWarnings explains when the peak window could not be sized for,
+// or may be missing from the time range.
+func seasonalityWarnings(containerName string, s *entity.Seasonality, timeRange string) []string {
+	if s == nil {
+		return nil
+	}
+	var warnings []string
+	if s.Peak == nil {
+		warnings = append(warnings, fmt.Sprintf("No samples of container '%s' fall inside the peak window %s, sized from the whole range", containerName, s.Window))
+	}
+	if duration, err := model.ParseDuration(timeRange); err == nil && time.Duration(duration) < seasonalityMinRange {
+		warnings = append(warnings, fmt.Sprintf("Time range %s is shorter than a week and may miss peaks of the window %s for container '%s'", timeRange, s.Window, containerName))
+	}
+	return warnings
+}
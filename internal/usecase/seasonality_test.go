@@ -0,0 +1,126 @@
+package usecase
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sequring/sculptor/internal/entity"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParsePeakWindow(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		wantString string
+		wantErr    bool
+	}{
+		{name: "empty", input: ""},
+		{name: "weekdays", input: "Mon-Fri 09:00-18:00", wantString: "Mon,Tue,Wed,Thu,Fri 09:00-18:00 UTC"},
+		{name: "offset", input: "sat,sun 10:00-22:00 +02:00", wantString: "Sun,Sat 10:00-22:00 UTC+02:00"},
+		{name: "every day until midnight", input: "* 20:00-24:00 UTC", wantString: "Sun,Mon,Tue,Wed,Thu,Fri,Sat 20:00-24:00 UTC"},
+		{name: "range wrapping the week", input: "Fri-Mon 22:00-02:00 -05:30", wantString: "Sun,Mon,Fri,Sat 22:00-02:00 UTC-05:30"},
+		{name: "missing time range", input: "Mon-Fri", wantErr: true},
+		{name: "unknown day", input: "Mon-Fry 09:00-18:00", wantErr: true},
+		{name: "invalid time", input: "Mon 9:60-18:00", wantErr: true},
+		{name: "empty range", input: "Mon 09:00-09:00", wantErr: true},
+		{name: "invalid offset", input: "Mon 09:00-18:00 CEST", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := ParsePeakWindow(tt.input)
+
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %v", w)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantString == "" {
+				if w != nil {
+					t.Errorf("expected no window, got %v", w)
+				}
+				return
+			}
+			if w == nil || w.String() != tt.wantString {
+				t.Errorf("got %v, want %s", w, tt.wantString)
+			}
+		})
+	}
+}
+
+func TestRecommenderUseCase_CalculateForDeployment_PeakWindow(t *testing.T) {
+	// Arrange
+	deploymentGW := &mockDeploymentGateway{
+		deployment: &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-ns"},
+			Spec: appsv1.DeploymentSpec{
+				Template: v1.PodTemplateSpec{
+					Spec: v1.PodSpec{Containers: []v1.Container{{Name: "main-app"}}},
+				},
+			},
+		},
+	}
+	metricsGW := &mockMetricsGateway{
+		memValue:     200 * mebibyte,
+		cpuP90Value:  0.1,
+		cpuP99Value:  0.2,
+		cpuP50Value:  0.1,
+		peakUsage:    &entity.Usage{MemoryP99: 100 * mebibyte, CPUP90: 0.5, CPUP99: 0.8},
+		offPeakUsage: &entity.Usage{MemoryP99: 200 * mebibyte, CPUP90: 0.05, CPUP99: 0.1},
+	}
+	window, err := ParsePeakWindow("Mon-Fri 09:00-18:00")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	uc := NewRecommenderUseCase(deploymentGW, metricsGW, newTestLogger(), WithPolicy(Policy{PeakWindow: window}))
+
+	// Act
+	recs, err := uc.CalculateForDeployment(context.Background(), DeploymentParams{
+		Namespace:      "test-ns",
+		DeploymentName: "test-deployment",
+		TimeRange:      "1d",
+	})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rec := recs[0].Recommendation
+	if rec.Seasonality == nil || !rec.Seasonality.SizedForPeak {
+		t.Fatalf("expected the recommendation to be sized for the peak, got %+v", rec.Seasonality)
+	}
+	if got := rec.CPU.Request.MilliValue(); got != 500 {
+		t.Errorf("CPU request: got %dm, want 500m from the peak p90", got)
+	}
+	if got := rec.CPU.Limit.MilliValue(); got != 800 {
+		t.Errorf("CPU limit: got %dm, want 800m from the peak p99", got)
+	}
+	// The whole range's memory p99 is higher than the peak's.
+	if want := int64(200 * mebibyte * 12 / 10); rec.Memory.Value() != want {
+		t.Errorf("Memory: got %d, want %d", rec.Memory.Value(), want)
+	}
+	if len(rec.Warnings) != 1 || !strings.Contains(rec.Warnings[0], "shorter than a week") {
+		t.Errorf("expected a short range warning, got %v", rec.Warnings)
+	}
+}
+
+func TestSeasonalityWarnings_NoPeakSamples(t *testing.T) {
+	s := &entity.Seasonality{Window: entity.TimeWindow{From: 0, To: 60}}
+
+	warnings := seasonalityWarnings("app", s, "14d")
+
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "No samples of container 'app'") {
+		t.Errorf("expected a missing peak warning, got %v", warnings)
+	}
+	if seasonalityWarnings("app", nil, "1d") != nil {
+		t.Error("expected no warnings without a peak window")
+	}
+}
@@ -0,0 +1,62 @@
+package usecase
+
+import (
+	"github.com/sequring/sculptor/internal/entity"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	// storageRequestBufferPercent covers the peak usage, so the kubelet
+	// doesn't pick the pod first when the node runs low on disk.
+	storageRequestBufferPercent = 120
+	// storageLimitMultiplier leaves room for logs and scratch files to grow
+	// between rotations and cleanups.
+	storageLimitMultiplier = 2.0
+	// storageEvictionMultiplier raises the limit of a container evicted for
+	// exceeding it, whose usage was cut short at the limit.
+	storageEvictionMultiplier = 1.5
+	minStorageBytes           = 128 * 1024 * 1024
+)
+
+// ephemeralStorage sizes the ephemeral storage of a long-running container
+// from the peak usage of its writable layer and logs. After evictions for
+// exceeding a limit, the limit is also raised above the current one, since
+// usage was cut short there. It returns nil without usage or evictions, and
+// no request or limit when the container was evicted but its usage is
+// unknown and it had no limit to raise.
+func ephemeralStorage(peak float64, hasUsage bool, evictions []entity.StorageEviction, currentLimit *resource.Quantity) *entity.EphemeralStorage {
+	if !hasUsage && len(evictions) == 0 {
+		return nil
+	}
+	storage := &entity.EphemeralStorage{Peak: peak, Evictions: evictions, CurrentLimit: currentLimit}
+
+	var requestBytes, limitBytes int64
+	if hasUsage {
+		requestBytes = max(int64(peak*storageRequestBufferPercent/100), minStorageBytes)
+		limitBytes = max(int64(peak*storageLimitMultiplier), minStorageBytes)
+	}
+	if currentLimit != nil && limitExceeded(evictions) {
+		if raised := int64(currentLimit.AsApproximateFloat64() * storageEvictionMultiplier); raised > limitBytes {
+			limitBytes = raised
+			storage.LimitRaised = true
+		}
+	}
+	if limitBytes == 0 {
+		return storage
+	}
+	requestBytes = max(min(requestBytes, limitBytes), minStorageBytes)
+	storage.Request = resource.NewQuantity(requestBytes, resource.BinarySI)
+	storage.Limit = resource.NewQuantity(limitBytes, resource.BinarySI)
+	return storage
+}
+
+// limitExceeded reports whether any eviction was for exceeding a limit rather
+// than for node pressure.
+func limitExceeded(evictions []entity.StorageEviction) bool {
+	for _, e := range evictions {
+		if e.Cause == entity.EvictionContainerLimit || e.Cause == entity.EvictionPodLimit {
+			return true
+		}
+	}
+	return false
+}
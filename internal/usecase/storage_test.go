@@ -0,0 +1,103 @@
+package usecase
+
+import (
+	"testing"
+
+	"github.com/sequring/sculptor/internal/entity"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestEphemeralStorage(t *testing.T) {
+	limitEviction := []entity.StorageEviction{{Pod: "api-1", Cause: entity.EvictionContainerLimit}}
+	pressureEviction := []entity.StorageEviction{{Pod: "api-1", Cause: entity.EvictionNodePressure}}
+
+	tests := []struct {
+		name         string
+		peak         float64
+		hasUsage     bool
+		evictions    []entity.StorageEviction
+		currentLimit string
+		wantNil      bool
+		wantRequest  string
+		wantLimit    string
+		wantRaised   bool
+	}{
+		{
+			name:    "no usage or evictions",
+			wantNil: true,
+		},
+		{
+			name:        "sized from the peak",
+			peak:        1000 * mebibyte,
+			hasUsage:    true,
+			wantRequest: "1200Mi",
+			wantLimit:   "2000Mi",
+		},
+		{
+			name:        "small usage gets the floor",
+			peak:        10 * mebibyte,
+			hasUsage:    true,
+			wantRequest: "128Mi",
+			wantLimit:   "128Mi",
+		},
+		{
+			name:         "evicted at the limit",
+			peak:         1000 * mebibyte,
+			hasUsage:     true,
+			evictions:    limitEviction,
+			currentLimit: "2Gi",
+			wantRequest:  "1200Mi",
+			wantLimit:    "3Gi",
+			wantRaised:   true,
+		},
+		{
+			name:         "node pressure keeps the usage-based limit",
+			peak:         1000 * mebibyte,
+			hasUsage:     true,
+			evictions:    pressureEviction,
+			currentLimit: "1Gi",
+			wantRequest:  "1200Mi",
+			wantLimit:    "2000Mi",
+		},
+		{
+			name:      "evicted without usage or a limit",
+			evictions: pressureEviction,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var currentLimit *resource.Quantity
+			if tt.currentLimit != "" {
+				currentLimit = mustParseQuantity(tt.currentLimit)
+			}
+
+			storage := ephemeralStorage(tt.peak, tt.hasUsage, tt.evictions, currentLimit)
+
+			if tt.wantNil {
+				if storage != nil {
+					t.Errorf("expected no recommendation, got %+v", storage)
+				}
+				return
+			}
+			if storage == nil {
+				t.Fatal("expected a recommendation, got nil")
+			}
+			if tt.wantRequest == "" {
+				if storage.Request != nil || storage.Limit != nil {
+					t.Errorf("expected no request or limit, got %v/%v", storage.Request, storage.Limit)
+				}
+				return
+			}
+			if want := resource.MustParse(tt.wantRequest); storage.Request.Value() != want.Value() {
+				t.Errorf("request: got %s, want %s", storage.Request.String(), tt.wantRequest)
+			}
+			if want := resource.MustParse(tt.wantLimit); storage.Limit.Value() != want.Value() {
+				t.Errorf("limit: got %s, want %s", storage.Limit.String(), tt.wantLimit)
+			}
+			if storage.LimitRaised != tt.wantRaised {
+				t.Errorf("limit raised: got %v, want %v", storage.LimitRaised, tt.wantRaised)
+			}
+		})
+	}
+}
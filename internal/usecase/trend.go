@@ -0,0 +1,55 @@
+package usecase
+
+import (
+	"time"
+
+	"github.com/sequring/sculptor/internal/entity"
+)
+
+const (
+	// trendMinLifetime and trendMinSamples are how long and how densely a
+	// container instance must have been observed for its trend to count.
+	trendMinLifetime = time.Hour
+	trendMinSamples  = 10
+	// leakMinR2 is how much of the working set's variation steady growth must
+	// explain for a lifetime to count as growing.
+	leakMinR2 = 0.6
+	// leakMinDailyGrowth is the smallest growth per day, relative to the mean
+	// working set, that counts as growing.
+	leakMinDailyGrowth = 0.05
+)
+
+// memoryTrend summarizes the lifetimes long enough to analyze. A lifetime is
+// growing if a line fits its working set well and rises by at least 5% of
+// the mean per day. Most lifetimes growing marks a probable leak, and with a
+// target uptime in the policy the working set is projected to that uptime
+// from the fastest-growing lifetime.
+func (uc *RecommenderUseCase) memoryTrend(lifetimes []entity.MemoryLifetime) *entity.MemoryTrend {
+	trend := &entity.MemoryTrend{}
+	for _, l := range lifetimes {
+		if l.Duration < trendMinLifetime || l.Samples < trendMinSamples {
+			continue
+		}
+		trend.Lifetimes++
+		if l.R2 < leakMinR2 || l.GrowthRate*24*time.Hour.Seconds() < l.Mean*leakMinDailyGrowth {
+			continue
+		}
+		trend.Growing++
+		if l.GrowthRate > trend.GrowthRate {
+			trend.GrowthRate = l.GrowthRate
+		}
+		if uc.policy.TargetUptime > 0 {
+			trend.ProjectedPeak = max(trend.ProjectedPeak, l.Start+l.GrowthRate*uc.policy.TargetUptime.Seconds())
+		}
+	}
+	if trend.Lifetimes == 0 {
+		return nil
+	}
+	trend.ProbableLeak = trend.Growing*2 > trend.Lifetimes
+	if !trend.ProbableLeak {
+		trend.ProjectedPeak = 0
+	} else if uc.policy.TargetUptime > 0 {
+		trend.TargetUptime = uc.policy.TargetUptime
+	}
+	return trend
+}
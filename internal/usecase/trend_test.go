@@ -0,0 +1,112 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sequring/sculptor/internal/entity"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// leakingLifetime grows by 10Mi per hour from 100Mi over a day.
+var leakingLifetime = entity.MemoryLifetime{Pod: "api-1", Duration: 24 * time.Hour, Samples: 100, Start: 100 * mebibyte, Mean: 220 * mebibyte, GrowthRate: 10 * mebibyte / 3600.0, R2: 0.95}
+
+func TestRecommenderUseCase_MemoryTrend(t *testing.T) {
+	flat := entity.MemoryLifetime{Pod: "api-2", Duration: 24 * time.Hour, Samples: 100, Start: 200 * mebibyte, Mean: 200 * mebibyte, R2: 0.01}
+	short := entity.MemoryLifetime{Pod: "api-3", Duration: 30 * time.Minute, Samples: 100, Start: 100 * mebibyte, Mean: 100 * mebibyte, GrowthRate: mebibyte, R2: 1}
+
+	tests := []struct {
+		name          string
+		lifetimes     []entity.MemoryLifetime
+		targetUptime  time.Duration
+		wantNil       bool
+		wantLeak      bool
+		wantGrowing   int
+		wantProjected float64
+	}{
+		{name: "no lifetime long enough", lifetimes: []entity.MemoryLifetime{short}, wantNil: true},
+		{name: "flat usage", lifetimes: []entity.MemoryLifetime{flat, flat}},
+		{name: "half the lifetimes grow", lifetimes: []entity.MemoryLifetime{leakingLifetime, flat}, wantGrowing: 1},
+		{name: "leak", lifetimes: []entity.MemoryLifetime{leakingLifetime, leakingLifetime, flat}, wantLeak: true, wantGrowing: 2},
+		{
+			name:          "leak projected to the target uptime",
+			lifetimes:     []entity.MemoryLifetime{leakingLifetime},
+			targetUptime:  7 * 24 * time.Hour,
+			wantLeak:      true,
+			wantGrowing:   1,
+			wantProjected: 100*mebibyte + 7*24*10*mebibyte,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			uc := NewRecommenderUseCase(nil, nil, newTestLogger(), WithPolicy(Policy{TargetUptime: tt.targetUptime}))
+
+			// Act
+			trend := uc.memoryTrend(tt.lifetimes)
+
+			// Assert
+			if tt.wantNil {
+				if trend != nil {
+					t.Errorf("expected no trend, got %+v", trend)
+				}
+				return
+			}
+			if trend == nil {
+				t.Fatal("expected a trend")
+			}
+			if trend.ProbableLeak != tt.wantLeak || trend.Growing != tt.wantGrowing {
+				t.Errorf("got leak %v with %d growing, want %v with %d", trend.ProbableLeak, trend.Growing, tt.wantLeak, tt.wantGrowing)
+			}
+			if diff := trend.ProjectedPeak - tt.wantProjected; diff > 1 || diff < -1 {
+				t.Errorf("projected peak: got %.0f, want %.0f", trend.ProjectedPeak, tt.wantProjected)
+			}
+		})
+	}
+}
+
+func TestRecommenderUseCase_CalculateForDeployment_MemoryLeak(t *testing.T) {
+	// Arrange
+	deploymentGW := &mockDeploymentGateway{
+		deployment: &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-deployment", Namespace: "test-ns"},
+			Spec: appsv1.DeploymentSpec{
+				Template: v1.PodTemplateSpec{
+					Spec: v1.PodSpec{Containers: []v1.Container{{Name: "main-app"}}},
+				},
+			},
+		},
+	}
+	metricsGW := &mockMetricsGateway{
+		memValue:    340 * mebibyte,
+		cpuP90Value: 0.1,
+		cpuP99Value: 0.2,
+		cpuP50Value: 0.1,
+		lifetimes:   []entity.MemoryLifetime{leakingLifetime},
+	}
+	uc := NewRecommenderUseCase(deploymentGW, metricsGW, newTestLogger(), WithPolicy(Policy{TargetUptime: 7 * 24 * time.Hour}))
+
+	// Act
+	recs, err := uc.CalculateForDeployment(context.Background(), DeploymentParams{
+		Namespace:      "test-ns",
+		DeploymentName: "test-deployment",
+		TimeRange:      "7d",
+	})
+
+	// Assert
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rec := recs[0].Recommendation
+	if rec.MemoryTrend == nil || !rec.MemoryTrend.LimitRaised {
+		t.Fatalf("expected the projection to raise the limit, got %+v", rec.MemoryTrend)
+	}
+	// (100Mi + 7d * 10Mi/h) * 1.2
+	if want := int64((100 + 1680) * mebibyte * 12 / 10); rec.Memory.Value() != want {
+		t.Errorf("Memory: got %d, want %d", rec.Memory.Value(), want)
+	}
+}